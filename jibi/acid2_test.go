@@ -0,0 +1,152 @@
+package jibi
+
+import (
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "write the golden images of the screen tests")
+
+// screenAfter runs rom headless for frames frames and returns the screen
+// of the frame after.
+func screenAfter(t *testing.T, rom []Byte, frames int) *image.Gray {
+	var img *image.Gray
+	_, _, err := runTestRom(rom, frames, Options{}, false, func(j Jibi, brk string) bool {
+		img = j.Screenshot()
+		return false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// writeGolden writes img as the golden image in path.
+func writeGolden(t *testing.T, path string, img *image.Gray) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkGolden compares img with the golden image in path. On a mismatch img
+// is written to a temp dir to look at.
+func checkGolden(t *testing.T, path string, img *image.Gray) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	golden, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	if golden.Bounds() != img.Bounds() {
+		t.Fatalf("%s: golden is %v, screen is %v", path, golden.Bounds(), img.Bounds())
+	}
+	diff, first := 0, image.Point{-1, -1}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			gr, gg, gb, _ := golden.At(x, y).RGBA()
+			if r, _, _, _ := img.At(x, y).RGBA(); r != gr || r != gg || r != gb {
+				if diff == 0 {
+					first = image.Pt(x, y)
+				}
+				diff++
+			}
+		}
+	}
+	if diff == 0 {
+		return
+	}
+	out := filepath.Join(t.TempDir(), filepath.Base(path))
+	writeGolden(t, out, img)
+	t.Errorf("%s: %d pixels differ, the first at %v, screen in %s", path, diff, first, out)
+}
+
+// screenRom returns a rom that draws a background of striped tiles
+// scrolled by 3,5, a window from 80,80 and two sprites, one flipped and one
+// with OBP1.
+func screenRom() []Byte {
+	rom := headerRom("SCREEN", 2)
+	code := []Byte{
+		0xAF, 0xE0, 0x40, // XOR A; LDH (LCDC), A, the lcd off to load vram
+		0x21, 0x10, 0x80, // LD HL, 0x8010, tile 1
+		0x11, 0x00, 0x02, // LD DE, 0x0200
+		0x06, 0x20, // LD B, 32
+		0x1A, 0x13, 0x22, 0x05, 0x20, 0xFA, // copy tiles 1 and 2
+		0x21, 0x00, 0x98, // LD HL, 0x9800
+		0x01, 0x00, 0x02, // LD BC, 0x0200
+		0xAF, 0x22, 0x3E, 0x01, 0x22, 0x0B, 0x78, 0xB1, 0x20, 0xF6, // tiles 0 and 1 by column
+		0x21, 0x00, 0x9C, // LD HL, 0x9C00
+		0x01, 0x00, 0x04, // LD BC, 0x0400
+		0x3E, 0x02, 0x22, 0x0B, 0x78, 0xB1, 0x20, 0xF8, // tile 2 everywhere
+		0x21, 0x00, 0xFE, // LD HL, 0xFE00
+	}
+	for _, b := range []Byte{40, 40, 1, 0x20, 60, 100, 2, 0x10} {
+		code = append(code, 0x3E, b, 0x22) // LD A, b; LD (HL+), A
+	}
+	for _, r := range []struct{ addr, b Byte }{
+		{0x47, 0xE4}, {0x48, 0xD2}, {0x49, 0x1B}, // BGP, OBP0, OBP1
+		{0x42, 5}, {0x43, 3}, {0x4A, 80}, {0x4B, 87}, // SCY, SCX, WY, WX
+		{0x40, 0xF3}, // LCDC
+	} {
+		code = append(code, 0x3E, r.b, 0xE0, r.addr) // LD A, b; LDH (addr), A
+	}
+	code = append(code, 0x18, 0xFE) // JR -2
+
+	copy(rom[0x0100:], []Byte{0x18, 0x4E}) // JR 0x0150, past the header
+	copy(rom[0x0150:], code)
+	copy(rom[0x0200:], []Byte{
+		0x3C, 0x7E, 0x42, 0x42, 0x42, 0x42, 0x42, 0x42,
+		0x7E, 0x5E, 0x7E, 0x0A, 0x7C, 0x56, 0x38, 0x7C,
+		0xF0, 0xCC, 0xF0, 0xCC, 0xF0, 0xCC, 0xF0, 0xCC,
+		0x0F, 0x33, 0x0F, 0x33, 0x0F, 0x33, 0x0F, 0x33,
+	})
+	return rom
+}
+
+// TestScreenGolden compares the screen of screenRom with
+// testdata/screen.png, -update writes it after a deliberate change to what
+// the gpu draws.
+func TestScreenGolden(t *testing.T) {
+	path := filepath.Join("testdata", "screen.png")
+	img := screenAfter(t, screenRom(), 10)
+	if *update {
+		writeGolden(t, path, img)
+		return
+	}
+	checkGolden(t, path, img)
+}
+
+// TestDmgAcid2 runs dmg-acid2 from JIBI_ACID2, testdata/dmg-acid2.gb by
+// default, and compares the screen with its reference image in
+// testdata/dmg-acid2.png. Both come from
+// https://github.com/mattcurrie/dmg-acid2 under the MIT license, the rom
+// from its releases and the reference as img/reference-dmg.png, which is in
+// the shades screenshots use and needs no conversion. They are not checked
+// in yet, so the test skips when the rom is not in testdata, but fails when
+// JIBI_ACID2 names one that can not be read.
+func TestDmgAcid2(t *testing.T) {
+	path := os.Getenv("JIBI_ACID2")
+	explicit := path != ""
+	if !explicit {
+		path = filepath.Join("testdata", "dmg-acid2.gb")
+	}
+	rom, err := ReadRomFile(path)
+	if err != nil && explicit {
+		t.Fatal(err)
+	} else if err != nil {
+		t.Skipf("no dmg-acid2, see https://github.com/mattcurrie/dmg-acid2: %v", err)
+	}
+	checkGolden(t, filepath.Join("testdata", "dmg-acid2.png"), screenAfter(t, rom, 60))
+}
@@ -0,0 +1,443 @@
+package jibi
+
+import (
+	"fmt"
+)
+
+// The sound registers.
+const (
+	AddrApuRegs    Word = 0xFF10
+	AddrNR10       Word = 0xFF10
+	AddrNR11       Word = 0xFF11
+	AddrNR12       Word = 0xFF12
+	AddrNR13       Word = 0xFF13
+	AddrNR14       Word = 0xFF14
+	AddrNR21       Word = 0xFF16
+	AddrNR22       Word = 0xFF17
+	AddrNR23       Word = 0xFF18
+	AddrNR24       Word = 0xFF19
+	AddrNR30       Word = 0xFF1A
+	AddrNR31       Word = 0xFF1B
+	AddrNR32       Word = 0xFF1C
+	AddrNR33       Word = 0xFF1D
+	AddrNR34       Word = 0xFF1E
+	AddrNR41       Word = 0xFF20
+	AddrNR42       Word = 0xFF21
+	AddrNR43       Word = 0xFF22
+	AddrNR44       Word = 0xFF23
+	AddrNR50       Word = 0xFF24
+	AddrNR51       Word = 0xFF25
+	AddrNR52       Word = 0xFF26
+	AddrWaveRam    Word = 0xFF30
+	AddrApuRegsEnd Word = 0xFF40
+)
+
+// apuReadMasks are the bits of each sound register that always read as one,
+// write only and unused bits.
+var apuReadMasks = [AddrWaveRam - AddrApuRegs]Byte{
+	0x80, 0x3F, 0x00, 0xFF, 0xBF, // NR10-NR14
+	0xFF, 0x3F, 0x00, 0xFF, 0xBF, // NR20-NR24
+	0x7F, 0xFF, 0x9F, 0xFF, 0xBF, // NR30-NR34
+	0xFF, 0xFF, 0x00, 0x00, 0xBF, // NR40-NR44
+	0x00, 0x00, 0x70, // NR50-NR52
+	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+}
+
+const (
+	// cycles between two steps of the frame sequencer, it runs at 512Hz
+	frameSeqCycles = dmgHz / 512
+
+	// default output sample rate
+	apuSampleRate = 44100
+
+	// samples collected before they are handed to the sink
+	apuBufferSamples = 512
+
+	// samples of each channel kept for Jibi.Channels
+	apuScopeSamples = 512
+)
+
+// A Sample is one stereo output sample.
+type Sample struct {
+	L, R int16
+}
+
+// An Apu is the audio processing unit. It runs the sound channels off the cpu
+// clock, like the Gpu, and mixes them into samples at the output rate.
+type Apu struct {
+	CommanderInterface
+
+	mmu Mmu
+
+	regs  [AddrWaveRam - AddrApuRegs]Byte
+	power bool
+	ch1   square
+	ch2   square
+	ch3   wave
+	ch4   noise
+
+	frameT    uint32 // cycles into the current frame sequencer step
+	frameStep uint8
+
+	rate    uint64 // samples per second
+	sampleT uint64 // sample clock, a sample is due when it reaches dmgHz
+	buf     []Sample
+	sink    AudioSink // nil when nobody listens
+
+	scope    [4][apuScopeSamples]int8 // ring of the last channel outputs
+	scopePos int
+
+	log componentLog
+}
+
+// NewApu creates an Apu scheduled by cpu.
+func NewApu(mmu Mmu, cpu *Cpu) *Apu {
+	apu := &Apu{
+		mmu:  mmu,
+		ch1:  square{sweeps: true},
+		rate: apuSampleRate,
+		buf:  make([]Sample, 0, apuBufferSamples),
+	}
+	cmdHandlers := map[Command]CommandFn{
+		CmdString:   apu.cmdString,
+		CmdStop:     apu.cmdStop,
+		CmdChannels: apu.cmdChannels,
+	}
+	apu.CommanderInterface = cpu.schedule("apu", cmdHandlers, apu)
+	mmu.SetApu(apu)
+	return apu
+}
+
+func (a *Apu) cmdString(resp interface{}) {
+	if resp, ok := resp.(chan string); !ok {
+		panic("invalid command response type")
+	} else {
+		resp <- a.str()
+	}
+}
+
+// cmdStop hands the samples still buffered to the sink.
+func (a *Apu) cmdStop(resp interface{}) {
+	if a.sink != nil && len(a.buf) > 0 {
+		a.sink.Play(a.buf)
+		a.buf = a.buf[:0]
+	}
+}
+
+func (a *Apu) String() string {
+	resp := make(chan string)
+	a.RunCommand(CmdString, resp)
+	return <-resp
+}
+
+func (a *Apu) str() string {
+	return fmt.Sprintf("apu power:%t ch1:%t ch2:%t ch3:%t ch4:%t",
+		a.power, a.ch1.on, a.ch2.on, a.ch3.on, a.ch4.on)
+}
+
+// clock runs the apu for t cycles while it is playing.
+func (a *Apu) clock(t uint32) {
+	if a.isPlaying() {
+		a.run(t)
+	}
+}
+
+// run advances the apu by t cycles, stopping at every frame sequencer step
+// and every sample.
+func (a *Apu) run(t uint32) {
+	for t > 0 {
+		n := t
+		if f := frameSeqCycles - a.frameT; f < n {
+			n = f
+		}
+		if a.sink != nil {
+			// cycles until the next sample, rounded up
+			if s := uint32((dmgHz - a.sampleT + a.rate - 1) / a.rate); s < n {
+				n = s
+			}
+		}
+		if a.power {
+			a.ch1.tick(n)
+			a.ch2.tick(n)
+			a.ch3.tick(n)
+			a.ch4.tick(n)
+			a.frameT += n
+			if a.frameT == frameSeqCycles {
+				a.frameT = 0
+				a.clockFrame()
+			}
+		}
+		if a.sink != nil {
+			a.sampleT += uint64(n) * a.rate
+			if a.sampleT >= dmgHz {
+				a.sampleT -= dmgHz
+				a.emit()
+			}
+		}
+		t -= n
+	}
+}
+
+// clockFrame runs a frame sequencer step, lengths are clocked at 256Hz,
+// the sweep at 128Hz and envelopes at 64Hz.
+func (a *Apu) clockFrame() {
+	if a.frameStep%2 == 0 {
+		a.ch1.len.clock(&a.ch1.on)
+		a.ch2.len.clock(&a.ch2.on)
+		a.ch3.len.clock(&a.ch3.on)
+		a.ch4.len.clock(&a.ch4.on)
+	}
+	if a.frameStep == 2 || a.frameStep == 6 {
+		a.ch1.clockSweep()
+	}
+	if a.frameStep == 7 {
+		a.ch1.env.clock()
+		a.ch2.env.clock()
+		a.ch4.env.clock()
+	}
+	a.frameStep = (a.frameStep + 1) % 8
+}
+
+// dacOutput converts a channel's 4 bit output to -15..15, or 0 with its dac
+// off.
+func dacOutput(dac bool, v Byte) int32 {
+	if !dac {
+		return 0
+	}
+	return int32(v)*2 - 15
+}
+
+// emit mixes the channels into a sample, and hands the buffer to the sink
+// when it is full. NR51 routes each channel to the left (high nibble) and
+// right (low nibble) outputs and NR50 sets their volumes, 1 to 8. The
+// channel outputs are also kept in the scope ring.
+func (a *Apu) emit() {
+	var l, r int32
+	if a.power {
+		out := [4]int32{
+			dacOutput(a.ch1.dac(), a.ch1.output()),
+			dacOutput(a.ch2.dac(), a.ch2.output()),
+			dacOutput(a.ch3.dac, a.ch3.output()),
+			dacOutput(a.ch4.dac(), a.ch4.output()),
+		}
+		nr50 := a.regs[AddrNR50-AddrApuRegs]
+		nr51 := a.regs[AddrNR51-AddrApuRegs]
+		for i, v := range out {
+			a.scope[i][a.scopePos] = int8(v)
+			if nr51&(0x10<<uint(i)) != 0 {
+				l += v
+			}
+			if nr51&(0x01<<uint(i)) != 0 {
+				r += v
+			}
+		}
+		l *= int32(nr50>>4&0x07) + 1
+		r *= int32(nr50&0x07) + 1
+	} else {
+		for i := range a.scope {
+			a.scope[i][a.scopePos] = 0
+		}
+	}
+	a.scopePos = (a.scopePos + 1) % apuScopeSamples
+	// 4 channels of 15 at volume 8 is 480
+	a.buf = append(a.buf, Sample{int16(l * 64), int16(r * 64)})
+	if len(a.buf) == cap(a.buf) {
+		a.sink.Play(a.buf)
+		a.buf = a.buf[:0]
+	}
+}
+
+// Read reads a sound register or wave ram, the apu is the MemoryDevice at
+// 0xFF10-0xFF3F.
+func (a *Apu) Read(addr Word) Byte {
+	if addr >= AddrWaveRam {
+		return a.ch3.readRam(addr - AddrWaveRam)
+	}
+	i := addr - AddrApuRegs
+	if addr == AddrNR52 {
+		nr52 := Byte(0)
+		if a.power {
+			nr52 |= 0x80
+		}
+		if a.ch1.on {
+			nr52 |= 0x01
+		}
+		if a.ch2.on {
+			nr52 |= 0x02
+		}
+		if a.ch3.on {
+			nr52 |= 0x04
+		}
+		if a.ch4.on {
+			nr52 |= 0x08
+		}
+		return nr52 | apuReadMasks[i]
+	}
+	return a.regs[i] | apuReadMasks[i]
+}
+
+// Write writes a sound register or wave ram. While the apu is off only
+// NR52 and wave ram can be written.
+func (a *Apu) Write(addr Word, b Byte) {
+	if addr >= AddrWaveRam {
+		a.ch3.writeRam(addr-AddrWaveRam, b)
+		return
+	}
+	if addr == AddrNR52 {
+		a.setPower(b&0x80 != 0)
+		return
+	}
+	if !a.power {
+		return
+	}
+	a.regs[addr-AddrApuRegs] = b
+	switch addr {
+	case AddrNR10:
+		a.ch1.writeSweep(b)
+	case AddrNR11:
+		a.ch1.writeDutyLength(b)
+	case AddrNR12:
+		a.ch1.env.write(b)
+		if !a.ch1.dac() {
+			a.ch1.on = false
+		}
+	case AddrNR13:
+		a.ch1.freq = a.ch1.freq&0x700 | uint16(b)
+	case AddrNR14:
+		a.ch1.writeControl(b, a.frameStep)
+	case AddrNR21:
+		a.ch2.writeDutyLength(b)
+	case AddrNR22:
+		a.ch2.env.write(b)
+		if !a.ch2.dac() {
+			a.ch2.on = false
+		}
+	case AddrNR23:
+		a.ch2.freq = a.ch2.freq&0x700 | uint16(b)
+	case AddrNR24:
+		a.ch2.writeControl(b, a.frameStep)
+	case AddrNR30:
+		a.ch3.dac = b&0x80 != 0
+		if !a.ch3.dac {
+			a.ch3.on = false
+		}
+	case AddrNR31:
+		a.ch3.len.n = 256 - int(b)
+	case AddrNR32:
+		a.ch3.volume = b >> 5 & 0x03
+	case AddrNR33:
+		a.ch3.freq = a.ch3.freq&0x700 | uint16(b)
+	case AddrNR34:
+		a.ch3.writeControl(b, a.frameStep)
+	case AddrNR41:
+		a.ch4.len.n = 64 - int(b&0x3F)
+	case AddrNR42:
+		a.ch4.env.write(b)
+		if !a.ch4.dac() {
+			a.ch4.on = false
+		}
+	case AddrNR43:
+		a.ch4.writePoly(b)
+	case AddrNR44:
+		a.ch4.writeControl(b, a.frameStep)
+	}
+}
+
+// setPower turns the apu on or off, turning it off clears every register.
+func (a *Apu) setPower(on bool) {
+	if a.power == on {
+		return
+	}
+	a.power = on
+	if !on {
+		for i := range a.regs {
+			a.regs[i] = 0
+		}
+		a.ch1 = square{sweeps: true}
+		a.ch2 = square{}
+		a.ch3 = wave{ram: a.ch3.ram} // wave ram survives
+		a.ch4 = noise{}
+	} else {
+		a.frameStep = 0
+		a.frameT = 0
+	}
+}
+
+// a lengthCounter silences a channel once it counts down to zero
+type lengthCounter struct {
+	n       int
+	enabled bool
+}
+
+func (l *lengthCounter) clock(on *bool) {
+	if l.enabled && l.n > 0 {
+		l.n--
+		if l.n == 0 {
+			*on = false
+		}
+	}
+}
+
+// enable sets the length enable from NRx4. Enabling it in the first half of
+// a length period clocks it once more, a hardware quirk games rely on.
+func (l *lengthCounter) enable(enabled bool, frameStep uint8, on *bool) {
+	was := l.enabled
+	l.enabled = enabled
+	if !was && enabled && frameStep%2 == 1 {
+		l.clock(on)
+	}
+}
+
+// trigger reloads an expired counter to max, with the same quirk as enable.
+func (l *lengthCounter) trigger(max int, frameStep uint8) {
+	if l.n == 0 {
+		l.n = max
+		if l.enabled && frameStep%2 == 1 {
+			l.n--
+		}
+	}
+}
+
+// an envelope changes a channel's volume every period 64Hz ticks
+type envelope struct {
+	initial Byte
+	up      bool
+	period  Byte
+	volume  Byte
+	timer   Byte
+}
+
+// write sets the envelope from NRx2.
+func (e *envelope) write(b Byte) {
+	e.initial = b >> 4
+	e.up = b&0x08 != 0
+	e.period = b & 0x07
+}
+
+// dac returns whether the channel dac is on, NRx2 with any of the top 5 bits
+// set.
+func (e *envelope) dac() bool {
+	return e.initial != 0 || e.up
+}
+
+func (e *envelope) trigger() {
+	e.volume = e.initial
+	e.timer = e.period
+}
+
+func (e *envelope) clock() {
+	if e.period == 0 {
+		return
+	}
+	if e.timer > 0 {
+		e.timer--
+	}
+	if e.timer == 0 {
+		e.timer = e.period
+		if e.up && e.volume < 15 {
+			e.volume++
+		} else if !e.up && e.volume > 0 {
+			e.volume--
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package jibi
+
+import (
+	"testing"
+)
+
+// newTestApu returns an apu that is driven by the test instead of the cpu,
+// which is never played.
+func newTestApu() *Apu {
+	cpu := NewCpu(newTestMmu(), nil)
+	return NewApu(cpu.mmu, cpu)
+}
+
+func TestApuRegs(t *testing.T) {
+	a := newTestApu()
+	defer a.RunCommand(CmdStop, nil)
+
+	a.Write(AddrNR11, 0x80)
+	if r := a.Read(AddrNR11); r != 0x3F {
+		t.Errorf("written while off 0x%02X", r)
+	}
+	a.Write(AddrNR52, 0x80)
+	a.Write(AddrNR10, 0x00)
+	a.Write(AddrNR11, 0x80)
+	a.Write(AddrNR13, 0x12)
+	for addr, want := range map[Word]Byte{
+		AddrNR10: 0x80,
+		AddrNR11: 0xBF,
+		AddrNR13: 0xFF, // write only
+		AddrNR52: 0xF0,
+	} {
+		if r := a.Read(addr); r != want {
+			t.Errorf("0x%04X: 0x%02X", addr, r)
+		}
+	}
+	a.Write(AddrNR52, 0x00)
+	if r := a.Read(AddrNR11); r != 0x3F {
+		t.Errorf("not cleared 0x%02X", r)
+	}
+}
+
+func TestApuChannels(t *testing.T) {
+	a := newTestApu()
+	defer a.RunCommand(CmdStop, nil)
+	a.sink = AudioFunc(func(s []Sample) {})
+	a.Write(AddrNR52, 0x80)
+	a.Write(AddrNR11, 0x80) // 50%
+	a.Write(AddrNR12, 0xA3) // 10, down every 3 ticks
+	a.Write(AddrNR13, 0x80) // 1024Hz
+	a.Write(AddrNR14, 0x87)
+	a.run(dmgHz / 100)
+	chs := a.channels()
+
+	ch1 := chs[0]
+	if !ch1.On || !ch1.Dac || ch1.Volume != 10 || ch1.EnvelopeUp || ch1.EnvelopePeriod != 3 {
+		t.Errorf("ch1 %+v", ch1)
+	}
+	if ch1.Freq != 0x780 || ch1.Hz != 1024 {
+		t.Errorf("ch1 freq 0x%03X %gHz", ch1.Freq, ch1.Hz)
+	}
+	if len(ch1.Samples) != apuScopeSamples {
+		t.Fatalf("%d samples", len(ch1.Samples))
+	}
+	// the oldest samples are from before the run
+	if v := ch1.Samples[0]; v != 0 {
+		t.Errorf("oldest sample %d", v)
+	}
+	high, low := 0, 0
+	for _, v := range ch1.Samples[apuScopeSamples-400:] {
+		switch v {
+		case 5:
+			high++
+		case -15:
+			low++
+		default:
+			t.Fatalf("sample %d", v)
+		}
+	}
+	if high == 0 || low == 0 {
+		t.Errorf("%d high %d low", high, low)
+	}
+	for i, ch := range chs[1:] {
+		if ch.On {
+			t.Errorf("ch%d on", i+2)
+		}
+		for _, v := range ch.Samples {
+			if v != 0 {
+				t.Fatalf("ch%d sample %d", i+2, v)
+			}
+		}
+	}
+}
+
+func TestApuLength(t *testing.T) {
+	a := newTestApu()
+	defer a.RunCommand(CmdStop, nil)
+	a.Write(AddrNR52, 0x80)
+	a.Write(AddrNR12, 0xF0)
+	a.Write(AddrNR11, 0x3E) // 2 length ticks
+	a.Write(AddrNR14, 0xC0)
+	if a.Read(AddrNR52)&0x01 == 0 {
+		t.Fatal("not triggered")
+	}
+	a.run(frameSeqCycles * 2)
+	if a.Read(AddrNR52)&0x01 == 0 {
+		t.Error("stopped after 1 length tick")
+	}
+	a.run(frameSeqCycles * 2)
+	if a.Read(AddrNR52)&0x01 != 0 {
+		t.Error("still on")
+	}
+
+	// the dac off turns the channel off
+	a.Write(AddrNR14, 0x80)
+	a.Write(AddrNR12, 0x00)
+	if a.Read(AddrNR52)&0x01 != 0 {
+		t.Error("on without dac")
+	}
+}
+
+func TestApuSweep(t *testing.T) {
+	a := newTestApu()
+	defer a.RunCommand(CmdStop, nil)
+	a.Write(AddrNR52, 0x80)
+	a.Write(AddrNR12, 0xF0)
+
+	// up by freq/2 every 128Hz tick
+	a.Write(AddrNR10, 0x11)
+	a.Write(AddrNR13, 0x00)
+	a.Write(AddrNR14, 0x82)
+	a.run(frameSeqCycles * 3)
+	if a.ch1.freq != 0x300 {
+		t.Errorf("freq 0x%03X", a.ch1.freq)
+	}
+	// 0x480 then the overflow check of 0x6C0 passes, 0x6C0 overflows
+	a.run(frameSeqCycles * 8)
+	if a.Read(AddrNR52)&0x01 != 0 {
+		t.Errorf("no overflow, freq 0x%03X", a.ch1.freq)
+	}
+
+	// overflow on trigger
+	a.Write(AddrNR13, 0xFF)
+	a.Write(AddrNR14, 0x87)
+	if a.Read(AddrNR52)&0x01 != 0 {
+		t.Error("no overflow on trigger")
+	}
+}
+
+func TestApuSamples(t *testing.T) {
+	a := newTestApu()
+	defer a.RunCommand(CmdStop, nil)
+	var samples []Sample
+	a.sink = AudioFunc(func(s []Sample) {
+		samples = append(samples, s...)
+	})
+	a.Write(AddrNR52, 0x80)
+	a.Write(AddrNR50, 0x77)
+	a.Write(AddrNR51, 0xFF)
+	a.Write(AddrNR11, 0x80) // 50%
+	a.Write(AddrNR12, 0xF0)
+	a.Write(AddrNR13, 0x80) // 1024Hz
+	a.Write(AddrNR14, 0x87)
+	a.run(dmgHz / 10)
+	if n := len(samples); n < apuSampleRate/10-apuBufferSamples || n > apuSampleRate/10 {
+		t.Fatalf("%d samples", n)
+	}
+	high := 0
+	edges := 0
+	for i, s := range samples {
+		if s.L != s.R || (s.L != 15*512 && s.L != -15*512) {
+			t.Fatalf("sample %d %v", i, s)
+		}
+		if s.L > 0 {
+			high++
+		}
+		if i > 0 && s.L > 0 && samples[i-1].L < 0 {
+			edges++
+		}
+	}
+	if high < len(samples)*4/10 || high > len(samples)*6/10 {
+		t.Errorf("%d of %d high", high, len(samples))
+	}
+	if cycles := edges * apuSampleRate / len(samples); cycles < 1000 || cycles > 1050 {
+		t.Errorf("%d Hz", cycles)
+	}
+}
+
+func TestApuMix(t *testing.T) {
+	a := newTestApu()
+	defer a.RunCommand(CmdStop, nil)
+	var samples []Sample
+	a.sink = AudioFunc(func(s []Sample) {
+		samples = append(samples, s...)
+	})
+	a.Write(AddrNR52, 0x80)
+	a.Write(AddrNR50, 0x77)
+	a.Write(AddrNR51, 0xFF)
+	a.Write(AddrNR12, 0xF0)
+	a.Write(AddrNR14, 0x87)
+	a.Write(AddrNR21, 0x40) // 25%
+	a.Write(AddrNR22, 0x80)
+	a.Write(AddrNR23, 0x00)
+	a.Write(AddrNR24, 0x86)
+	if r := a.Read(AddrNR52); r != 0xF3 {
+		t.Fatalf("NR52 0x%02X", r)
+	}
+	a.run(dmgHz / 10)
+	levels := map[int16]bool{}
+	for _, s := range samples {
+		levels[s.L] = true
+	}
+	// channel 1 at 15 and channel 2 at 8, each high or low
+	for _, v := range []int16{(15 + 1) * 512, (15 - 15) * 512, (-15 + 1) * 512, (-15 - 15) * 512} {
+		if !levels[v] {
+			t.Errorf("no %d in %v", v, levels)
+		}
+	}
+}
+
+func TestApuPanning(t *testing.T) {
+	a := newTestApu()
+	defer a.RunCommand(CmdStop, nil)
+	var samples []Sample
+	a.sink = AudioFunc(func(s []Sample) {
+		samples = append(samples, s...)
+	})
+	a.Write(AddrNR52, 0x80)
+	a.Write(AddrNR50, 0x30) // left at 4, right at 1
+	a.Write(AddrNR51, 0x12) // channel 1 left, channel 2 right
+	a.Write(AddrNR12, 0xF0)
+	a.Write(AddrNR14, 0x87)
+	a.Write(AddrNR22, 0x80)
+	a.Write(AddrNR24, 0x86)
+	a.run(dmgHz / 10)
+	left, right := map[int16]bool{}, map[int16]bool{}
+	for _, s := range samples {
+		left[s.L] = true
+		right[s.R] = true
+	}
+	if len(left) != 2 || !left[15*4*64] || !left[-15*4*64] {
+		t.Errorf("left %v", left)
+	}
+	if len(right) != 2 || !right[1*64] || !right[-15*64] {
+		t.Errorf("right %v", right)
+	}
+}
+
+func TestApuWave(t *testing.T) {
+	a := newTestApu()
+	defer a.RunCommand(CmdStop, nil)
+	for i := Word(0); i < 16; i++ {
+		a.Write(AddrWaveRam+i, Byte(i)<<4|Byte(15-i))
+	}
+	if r := a.Read(AddrWaveRam + 1); r != 0x1E {
+		t.Errorf("wave ram 0x%02X", r)
+	}
+	a.Write(AddrNR52, 0x80)
+	a.Write(AddrNR30, 0x80)
+	a.Write(AddrNR32, 0x40) // half
+	a.Write(AddrNR33, 0x00)
+	a.Write(AddrNR34, 0x87)
+	if a.Read(AddrNR52)&0x04 == 0 {
+		t.Fatal("not triggered")
+	}
+	var got []Byte
+	for i := 0; i < 4; i++ {
+		got = append(got, a.ch3.output())
+		a.run(a.ch3.period())
+	}
+	if want := []Byte{0, 7, 0, 7}; string(got) != string(want) {
+		t.Errorf("%v", got)
+	}
+	if r := a.Read(AddrWaveRam + 9); r != 0x2D {
+		t.Errorf("wave ram while playing 0x%02X", r)
+	}
+
+	a.Write(AddrNR30, 0x00)
+	if a.Read(AddrNR52)&0x04 != 0 {
+		t.Error("on without dac")
+	}
+	a.Write(AddrNR52, 0x00)
+	if r := a.Read(AddrWaveRam + 15); r != 0xF0 {
+		t.Errorf("wave ram lost 0x%02X", r)
+	}
+}
+
+func TestApuNoise(t *testing.T) {
+	a := newTestApu()
+	defer a.RunCommand(CmdStop, nil)
+	a.Write(AddrNR52, 0x80)
+	a.Write(AddrNR42, 0xF0)
+	a.Write(AddrNR43, 0x08) // 7 bit, period 8
+	a.Write(AddrNR44, 0x80)
+	if r := a.Read(AddrNR52); r != 0xF8 {
+		t.Fatalf("NR52 0x%02X", r)
+	}
+	// the 7 bit lfsr repeats every 127 shifts
+	var seq []Byte
+	for i := 0; i < 254; i++ {
+		seq = append(seq, a.ch4.output())
+		a.run(8)
+	}
+	if string(seq[:127]) != string(seq[127:]) {
+		t.Error("7 bit sequence does not repeat")
+	}
+	ones := 0
+	for _, v := range seq[:127] {
+		if v == 15 {
+			ones++
+		}
+	}
+	if ones != 63 {
+		t.Errorf("%d of 127 high", ones)
+	}
+
+	// the 15 bit lfsr does not repeat that soon
+	a.Write(AddrNR43, 0x00)
+	a.Write(AddrNR44, 0x80)
+	seq = seq[:0]
+	for i := 0; i < 254; i++ {
+		seq = append(seq, a.ch4.output())
+		a.run(8)
+	}
+	if string(seq[:127]) == string(seq[127:]) {
+		t.Error("15 bit sequence repeats after 127")
+	}
+}
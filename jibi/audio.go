@@ -0,0 +1,243 @@
+package jibi
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// An AudioSink plays the samples mixed by the apu. Play is called on the apu
+// goroutine with a buffer that is reused afterwards, it must copy what it
+// keeps and must not block.
+type AudioSink interface {
+	Play(s []Sample)
+}
+
+// An AudioFunc is a function used as an AudioSink.
+type AudioFunc func(s []Sample)
+
+// Play calls f(s).
+func (f AudioFunc) Play(s []Sample) {
+	f(s)
+}
+
+// An AudioRing is an AudioSink for backends that pull samples from their own
+// callback. It holds samples till they are read. When the backend falls
+// behind the oldest samples are dropped, when it runs ahead it reads silence.
+type AudioRing struct {
+	lock sync.Mutex
+	buf  []Sample
+	r    int // next sample to read
+	n    int // samples buffered
+}
+
+// NewAudioRing returns a ring holding latency worth of samples at rate.
+func NewAudioRing(rate int, latency time.Duration) *AudioRing {
+	size := int(int64(rate) * int64(latency) / int64(time.Second))
+	if size < 1 {
+		size = 1
+	}
+	return &AudioRing{buf: make([]Sample, size)}
+}
+
+// Play adds s to the ring.
+func (r *AudioRing) Play(s []Sample) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, v := range s {
+		if r.n == len(r.buf) {
+			// full, drop the oldest
+			r.r = (r.r + 1) % len(r.buf)
+			r.n--
+		}
+		r.buf[(r.r+r.n)%len(r.buf)] = v
+		r.n++
+	}
+}
+
+// Read fills p with the oldest samples and silence once the ring is empty.
+// It returns the number of samples that were not silence.
+func (r *AudioRing) Read(p []Sample) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	n := 0
+	for ; n < len(p) && r.n > 0; n++ {
+		p[n] = r.buf[r.r]
+		r.r = (r.r + 1) % len(r.buf)
+		r.n--
+	}
+	for i := n; i < len(p); i++ {
+		p[i] = Sample{}
+	}
+	return n
+}
+
+// Buffered returns the number of samples waiting to be read.
+func (r *AudioRing) Buffered() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.n
+}
+
+// An AudioWriter plays samples by writing them as raw signed 16 bit little
+// endian stereo to an io.Writer, like the stdin of aplay or pacat. The writer
+// sets the pace: its writes are expected to block while the device is busy.
+type AudioWriter struct {
+	*AudioRing
+	w     io.Writer
+	chunk int // samples per write
+	done  chan bool
+	ended chan bool // closed when loop returns, after err is set
+	err   error
+}
+
+// NewAudioWriter starts writing the samples played at rate to w, buffering
+// up to latency of them.
+func NewAudioWriter(w io.Writer, rate int, latency time.Duration) *AudioWriter {
+	a := &AudioWriter{
+		AudioRing: NewAudioRing(rate, latency),
+		w:         w,
+		chunk:     rate / 100,
+		done:      make(chan bool),
+		ended:     make(chan bool),
+	}
+	if a.chunk < 1 {
+		a.chunk = 1
+	}
+	go a.loop()
+	return a
+}
+
+func (a *AudioWriter) loop() {
+	defer close(a.ended)
+	p := make([]Sample, a.chunk)
+	b := make([]byte, 4*a.chunk)
+	for {
+		select {
+		case <-a.done:
+			return
+		default:
+		}
+		a.Read(p)
+		for i, s := range p {
+			b[4*i] = byte(s.L)
+			b[4*i+1] = byte(uint16(s.L) >> 8)
+			b[4*i+2] = byte(s.R)
+			b[4*i+3] = byte(uint16(s.R) >> 8)
+		}
+		if _, err := a.w.Write(b); err != nil {
+			a.err = err
+			return
+		}
+	}
+}
+
+// Close stops writing once the write in progress returns. It returns the
+// write error that stopped it early if there was one.
+func (a *AudioWriter) Close() error {
+	close(a.done)
+	<-a.ended
+	return a.err
+}
+
+// MultiAudio returns an AudioSink playing to every sink, nil sinks are
+// skipped.
+func MultiAudio(sinks ...AudioSink) AudioSink {
+	var m multiAudio
+	for _, s := range sinks {
+		if s != nil {
+			m = append(m, s)
+		}
+	}
+	return m
+}
+
+type multiAudio []AudioSink
+
+func (m multiAudio) Play(s []Sample) {
+	for _, sink := range m {
+		sink.Play(s)
+	}
+}
+
+// the wav header up to the data, sizes are filled in as samples are written
+const wavHeaderSize = 44
+
+// A WavWriter is an AudioSink recording 16 bit stereo wav. The header is
+// updated after every Play, so the file is complete whenever the Jibi stops.
+type WavWriter struct {
+	w    io.WriteSeeker
+	data uint32 // bytes of samples written
+	buf  []byte
+	err  error
+}
+
+// NewWavWriter writes the header of a wav file of samples at rate to w.
+func NewWavWriter(w io.WriteSeeker, rate int) (*WavWriter, error) {
+	h := make([]byte, 0, wavHeaderSize)
+	h = append(h, "RIFF"...)
+	h = appendUint32(h, wavHeaderSize-8)
+	h = append(h, "WAVEfmt "...)
+	h = appendUint32(h, 16)
+	h = appendUint16(h, 1) // pcm
+	h = appendUint16(h, 2) // channels
+	h = appendUint32(h, uint32(rate))
+	h = appendUint32(h, uint32(rate)*4) // bytes per second
+	h = appendUint16(h, 4)              // bytes per sample
+	h = appendUint16(h, 16)             // bits per channel
+	h = append(h, "data"...)
+	h = appendUint32(h, 0)
+	if _, err := w.Write(h); err != nil {
+		return nil, err
+	}
+	return &WavWriter{w: w}, nil
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// Play appends s to the file. After a write error it does nothing, see Err.
+func (w *WavWriter) Play(s []Sample) {
+	if w.err != nil {
+		return
+	}
+	w.buf = w.buf[:0]
+	for _, v := range s {
+		w.buf = appendUint16(w.buf, uint16(v.L))
+		w.buf = appendUint16(w.buf, uint16(v.R))
+	}
+	if _, w.err = w.w.Write(w.buf); w.err != nil {
+		return
+	}
+	w.data += uint32(len(w.buf))
+	w.err = w.writeSizes()
+}
+
+// writeSizes sets the riff and data sizes in the header and returns to the
+// end of the file.
+func (w *WavWriter) writeSizes() error {
+	if _, err := w.w.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(appendUint32(nil, wavHeaderSize-8+w.data)); err != nil {
+		return err
+	}
+	if _, err := w.w.Seek(wavHeaderSize-4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(appendUint32(nil, w.data)); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+// Err returns the write error that stopped the recording, if any.
+func (w *WavWriter) Err() error {
+	return w.err
+}
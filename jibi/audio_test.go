@@ -0,0 +1,116 @@
+package jibi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAudioRing(t *testing.T) {
+	r := NewAudioRing(1000, 4*time.Millisecond)
+	r.Play([]Sample{{1, 1}, {2, 2}, {3, 3}})
+	p := make([]Sample, 2)
+	if n := r.Read(p); n != 2 || p[0].L != 1 || p[1].L != 2 {
+		t.Errorf("%d %v", n, p)
+	}
+	// overflow drops the oldest
+	r.Play([]Sample{{4, 4}, {5, 5}, {6, 6}, {7, 7}})
+	if n := r.Buffered(); n != 4 {
+		t.Errorf("%d buffered", n)
+	}
+	p = make([]Sample, 6)
+	if n := r.Read(p); n != 4 || p[0].L != 4 || p[3].L != 7 || p[4] != (Sample{}) {
+		t.Errorf("%d %v", n, p)
+	}
+}
+
+// a pacedWriter blocks till the test asks for the next write
+type pacedWriter struct {
+	next chan []byte
+}
+
+func (w pacedWriter) Write(b []byte) (int, error) {
+	c := make([]byte, len(b))
+	copy(c, b)
+	w.next <- c
+	return len(b), nil
+}
+
+func TestAudioWriter(t *testing.T) {
+	w := pacedWriter{make(chan []byte)}
+	a := NewAudioWriter(w, 400, time.Second)
+	<-w.next // silence, nothing played yet
+	a.Play([]Sample{{0x0102, -2}, {3, 4}, {5, 6}, {7, 8}})
+	var b []byte
+	for !bytes.HasPrefix(b, []byte{0x02, 0x01, 0xFE, 0xFF}) {
+		b = <-w.next
+	}
+	if len(b) != 16 || b[4] != 3 || b[6] != 4 {
+		t.Errorf("% X", b)
+	}
+	go func() {
+		for range w.next {
+		}
+	}()
+	if err := a.Close(); err != nil {
+		t.Error(err)
+	}
+	close(w.next)
+
+	// write errors stop the writer
+	r, pw := io.Pipe()
+	r.Close()
+	a = NewAudioWriter(pw, 400, time.Second)
+	<-a.ended
+	if err := a.Close(); err == nil {
+		t.Error("no write error")
+	}
+}
+
+func TestMultiAudio(t *testing.T) {
+	var a, b []Sample
+	m := MultiAudio(AudioFunc(func(s []Sample) { a = append(a, s...) }), nil,
+		AudioFunc(func(s []Sample) { b = append(b, s...) }))
+	m.Play([]Sample{{1, 2}})
+	if len(a) != 1 || len(b) != 1 || a[0] != b[0] {
+		t.Errorf("%v %v", a, b)
+	}
+}
+
+func TestWavWriter(t *testing.T) {
+	f, err := ioutil.TempFile("", "jibi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	w, err := NewWavWriter(f, 8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Play([]Sample{{0x0102, -2}})
+	w.Play([]Sample{{3, 4}, {5, 6}})
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != wavHeaderSize+12 {
+		t.Fatalf("% X", b)
+	}
+	le := binary.LittleEndian
+	if string(b[:4]) != "RIFF" || le.Uint32(b[4:]) != 36+12 ||
+		string(b[8:16]) != "WAVEfmt " || le.Uint32(b[24:]) != 8000 ||
+		string(b[36:40]) != "data" || le.Uint32(b[40:]) != 12 {
+		t.Errorf("header % X", b[:wavHeaderSize])
+	}
+	if !bytes.Equal(b[wavHeaderSize:], []byte{2, 1, 0xFE, 0xFF, 3, 0, 4, 0, 5, 0, 6, 0}) {
+		t.Errorf("data % X", b[wavHeaderSize:])
+	}
+}
@@ -0,0 +1,196 @@
+package jibi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// battery returns whether the cartridge type keeps its ram powered by a
+// battery.
+func (ct cartridgeType) battery() bool {
+	switch ct {
+	case 0x03, 0x06, 0x09, 0x0D, 0x0F, 0x10, 0x13, 0x1B, 0x1E, 0x22, 0xFD, 0xFE, 0xFF:
+		return true
+	}
+	return false
+}
+
+// timer returns whether the cartridge type has a real time clock, which is
+// kept in the save file after the ram.
+func (ct cartridgeType) timer() bool {
+	switch ct {
+	case 0x0F, 0x10, 0xFE:
+		return true
+	}
+	return false
+}
+
+// a batteryMapper is a mapper with memory that survives power off
+type batteryMapper interface {
+	batteryRam() []Byte
+}
+
+func (m *romOnly) batteryRam() []Byte { return m.ram }
+func (m *mbc1) batteryRam() []Byte    { return m.ram }
+func (m *mbc2) batteryRam() []Byte    { return m.ram }
+func (m *mbc3) batteryRam() []Byte    { return m.ram }
+func (m *mbc5) batteryRam() []Byte    { return m.ram }
+func (m *mbc7) batteryRam() []Byte    { return m.eeprom.data }
+func (m *tama5) batteryRam() []Byte   { return m.ram }
+func (m *huc3) batteryRam() []Byte    { return m.ram }
+
+// Battery returns whether the cartridge has battery backed ram or a clock to
+// save.
+func (c *Cartridge) Battery() bool {
+	m, ok := c.mapper.(batteryMapper)
+	return ok && c.ct.battery() && (len(m.batteryRam()) > 0 || c.rtcSaver() != nil)
+}
+
+// rtcSaver returns the mapper if its clock is kept in the save file.
+func (c *Cartridge) rtcSaver() rtcSaver {
+	if m, ok := c.mapper.(rtcSaver); ok && c.ct.timer() {
+		return m
+	}
+	return nil
+}
+
+// LoadRam fills the battery backed ram from a save, a save of a different
+// size fills what fits. The clock of cartridges with one is set from the
+// footer after the ram, if the save has one. It must be called before the
+// Jibi is started.
+func (c *Cartridge) LoadRam(ram []Byte) {
+	m, ok := c.mapper.(batteryMapper)
+	if !ok {
+		return
+	}
+	n := copy(m.batteryRam(), ram)
+	if r := c.rtcSaver(); r != nil && n == len(m.batteryRam()) {
+		loadRtcFooter(r, ram[n:])
+	}
+}
+
+// a ramSave asks the cpu for a copy of the battery backed ram
+type ramSave struct {
+	cart *Cartridge
+	resp chan []Byte
+}
+
+// cmdSaveRam copies the cartridge ram between two instructions so the copy is
+// consistent.
+func (c *Cpu) cmdSaveRam(data interface{}) {
+	s, ok := data.(ramSave)
+	if !ok {
+		panic("invalid command response type")
+	}
+	var ram []Byte
+	if m, ok := s.cart.mapper.(batteryMapper); ok {
+		ram = make([]Byte, len(m.batteryRam()))
+		copy(ram, m.batteryRam())
+	}
+	if r := s.cart.rtcSaver(); r != nil {
+		ram = append(ram, rtcFooter(r)...)
+	}
+	s.resp <- ram
+}
+
+// SaveRam returns a copy of the battery backed ram as kept in the save file,
+// followed by the clock for cartridges with one, or nil if the cartridge has
+// neither.
+func (j Jibi) SaveRam() []Byte {
+	if !j.cart.Battery() {
+		return nil
+	}
+	resp := make(chan []Byte)
+	j.cpu.RunCommand(CmdSaveRam, ramSave{j.cart, resp})
+	return <-resp
+}
+
+// SaveFileName returns the name of the save file for a rom file, the rom
+// file name with its extension replaced by .sav.
+func SaveFileName(romFilename string) string {
+	return strings.TrimSuffix(romFilename, filepath.Ext(romFilename)) + ".sav"
+}
+
+// saveInterval is how often a running Jibi flushes changed save ram
+const saveInterval = 5 * time.Second
+
+// a saveFile is where the battery backed ram is kept between runs
+type saveFile struct {
+	name string
+	last []byte // ram as last read or written
+}
+
+// loadSaveFile loads the battery backed ram of cart from name, a missing file
+// is an empty save.
+func loadSaveFile(name string, cart *Cartridge) (*saveFile, error) {
+	f := &saveFile{name: name}
+	buf, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	ram := make([]Byte, len(buf))
+	for i, b := range buf {
+		ram[i] = Byte(b)
+	}
+	cart.LoadRam(ram)
+	f.last = buf
+	return f, nil
+}
+
+// flushSave writes the battery backed ram to the save file if it changed
+// since the last flush.
+func (j Jibi) flushSave() error {
+	if j.save == nil {
+		return nil
+	}
+	ram := j.SaveRam()
+	buf := make([]byte, len(ram))
+	for i, b := range ram {
+		buf[i] = byte(b)
+	}
+	if bytes.Equal(buf, j.save.last) {
+		return nil
+	}
+	if err := replaceFile(j.save.name, buf); err != nil {
+		return err
+	}
+	j.save.last = buf
+	return nil
+}
+
+// replaceFile writes buf to a temporary file next to name and renames it
+// over name, syncing the file before the rename and the directory after it
+// so a crash leaves either the old save or the new one, never a torn one.
+func replaceFile(name string, buf []byte) error {
+	tmp := name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,190 @@
+package jibi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveFileName(t *testing.T) {
+	for name, want := range map[string]string{
+		"roms/game.gb":  "roms/game.sav",
+		"game.zip":      "game.sav",
+		"game.v1.1.gbc": "game.v1.1.sav",
+		"game":          "game.sav",
+	} {
+		if got := SaveFileName(name); got != want {
+			t.Errorf("%s: %s", name, got)
+		}
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	rom := make([]Byte, 0x8000)
+	rom[0x0147] = 0x03 // mbc1+ram+battery
+	rom[0x0149] = 0x02
+	copy(rom[0x0100:], []Byte{
+		0x3E, 0x0A, // LD A, 0x0A
+		0xEA, 0x00, 0x00, // LD (0x0000), A
+		0x3E, 0x18, // LD A, 0x18
+		0xEA, 0x00, 0xA0, // LD (0xA000), A
+		0x18, 0xFE, // JR -2
+	})
+	name := filepath.Join(t.TempDir(), "game.sav")
+	if err := ioutil.WriteFile(name, []byte{0x00, 0x17}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := New(rom, Options{Skipbios: true, SaveFile: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	j.Play()
+	deadline := time.Now().Add(10 * time.Second)
+	for j.SaveRam()[0] != 0x18 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := j.flushSave(); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != 0x4000 || buf[0] != 0x18 || buf[1] != 0x17 {
+		t.Errorf("%d bytes % X", len(buf), buf[:2])
+	}
+}
+
+func TestSaveRtc(t *testing.T) {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := &FixedClock{start}
+	rom := busyRom()
+	rom[0x0147] = 0x10 // mbc3+timer+ram+battery
+	rom[0x0149] = 0x02
+	j, err := New(rom, Options{Skipbios: true, RtcClock: clk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	m := j.cart.mapper.(*mbc3)
+	m.WriteRom(0x0000, 0x0A)
+	// day 258 23:59:50, halted
+	for i, b := range []Byte{50, 59, 23, 0x02, 0x41} {
+		m.WriteRom(0x4000, mbc3RtcS+Byte(i))
+		m.WriteRam(0xA000, b)
+	}
+	m.WriteRom(0x4000, mbc3RtcDH)
+	m.WriteRam(0xA000, 0x01) // running
+	clk.Advance(5 * time.Second)
+	m.WriteRom(0x6000, 0x00)
+	m.WriteRom(0x6000, 0x01)
+	clk.Advance(3 * time.Second)
+
+	save := j.SaveRam()
+	if len(save) != 0x4000+rtcFooterLen {
+		t.Fatalf("%d bytes", len(save))
+	}
+	footer := save[0x4000:]
+	for i, want := range []Byte{58, 59, 23, 0x02, 0x01, 55, 59, 23, 0x02, 0x01} {
+		if b := footer[i*4]; b != want {
+			t.Errorf("register %d: %d, want %d", i, b, want)
+		}
+	}
+	unix := uint64(0)
+	for i, b := range footer[40:] {
+		unix |= uint64(b) << (8 * uint(i))
+	}
+	if at := start.Add(8 * time.Second).Unix(); unix != uint64(at) {
+		t.Errorf("saved at %d, not %d", unix, at)
+	}
+
+	// the time passed since the save counts
+	cart, err := NewCartridge(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(time.Hour)
+	cart.SetRtcClock(clk)
+	cart.LoadRam(save)
+	loaded := cart.mapper.(*mbc3)
+	loaded.WriteRom(0x0000, 0x0A)
+	if r := mbc3Rtc(loaded); r != [5]Byte{55, 59, 23, 0x02, 0x01} {
+		t.Errorf("latched %v", r)
+	}
+	loaded.WriteRom(0x6000, 0x00)
+	loaded.WriteRom(0x6000, 0x01)
+	if r := mbc3Rtc(loaded); r != [5]Byte{58, 59, 0, 0x03, 0x01} {
+		t.Errorf("loaded %v", r)
+	}
+
+	// and the 44 byte footer with a 32 bit time
+	cart, _ = NewCartridge(rom)
+	cart.SetRtcClock(clk)
+	cart.LoadRam(save[:len(save)-4])
+	loaded = cart.mapper.(*mbc3)
+	loaded.WriteRom(0x0000, 0x0A)
+	loaded.WriteRom(0x6000, 0x00)
+	loaded.WriteRom(0x6000, 0x01)
+	if r := mbc3Rtc(loaded); r != [5]Byte{58, 59, 0, 0x03, 0x01} {
+		t.Errorf("loaded from 44 bytes %v", r)
+	}
+}
+
+func TestSaveRtcHuc3(t *testing.T) {
+	clk := &FixedClock{time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := newHuc3(make([]Byte, 0x8000), 0x03)
+	m.setRtcClock(clk)
+	m.minutes, m.days = 1439, 0x1FF
+	footer := rtcFooter(m)
+
+	loaded := newHuc3(make([]Byte, 0x8000), 0x03)
+	clk.Advance(2 * time.Minute)
+	loaded.setRtcClock(clk)
+	loadRtcFooter(loaded, footer)
+	loaded.update()
+	if loaded.minutes != 1 || loaded.days != 0x200 {
+		t.Errorf("minute %d of day %d", loaded.minutes, loaded.days)
+	}
+}
+
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "game.sav")
+	if err := ioutil.WriteFile(name, []byte{0x01, 0x02}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceFile(name, []byte{0x03}); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := ioutil.ReadFile(name); err != nil || len(buf) != 1 || buf[0] != 0x03 {
+		t.Errorf("% X %v", buf, err)
+	}
+	if _, err := os.Stat(name + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+
+	// a failed rename keeps the old file and removes the temporary one
+	busy := filepath.Join(dir, "busy.sav")
+	if err := os.Mkdir(busy, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(busy, "x"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceFile(busy, []byte{0x04}); err == nil {
+		t.Error("renamed over a directory")
+	}
+	if fi, err := os.Stat(busy); err != nil || !fi.IsDir() {
+		t.Errorf("%v %v", fi, err)
+	}
+	if _, err := os.Stat(busy + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package jibi
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// A BenchResult is the outcome of running a rom with Bench.
+type BenchResult struct {
+	Frames       int
+	Wall         time.Duration
+	Cycles       uint64 // cpu clock cycles
+	Instructions uint64
+	Allocs       uint64 // heap allocations of the whole process
+	AllocBytes   uint64
+}
+
+// FPS returns the emulated frames per wall clock second.
+func (r BenchResult) FPS() float64 {
+	return float64(r.Frames) / r.Wall.Seconds()
+}
+
+func (r BenchResult) String() string {
+	return fmt.Sprintf("frames: %d\nwall: %s\nfps: %.1f (%.0f%% speed)\n"+
+		"instructions: %d (%.0f per frame)\ncycles: %d\n"+
+		"allocs: %d (%.1f per frame, %d bytes)\n",
+		r.Frames, r.Wall, r.FPS(), 100*float64(r.Cycles)/(dmgHz*r.Wall.Seconds()),
+		r.Instructions, float64(r.Instructions)/float64(r.Frames), r.Cycles,
+		r.Allocs, float64(r.Allocs)/float64(r.Frames), r.AllocBytes)
+}
+
+// cpuCounters are the work the cpu has done since power on.
+type cpuCounters struct {
+	cycles       uint64
+	instructions uint64
+}
+
+func (c *Cpu) cmdCounters(resp interface{}) {
+	if resp, ok := resp.(chan cpuCounters); !ok {
+		panic("invalid command response type")
+	} else {
+		resp <- cpuCounters{c.cycles, c.instructions}
+	}
+}
+
+// Bench runs rom for frames frames as fast as it goes, without rendering or
+// the keypad, and reports how long it took. The frames include the boot rom.
+func Bench(rom []Byte, frames int, options Options) (BenchResult, error) {
+	options.Render = false
+	options.Keypad = false
+	j, err := New(rom, options)
+	if err != nil {
+		return BenchResult{}, err
+	}
+	defer j.Stop()
+	resp := make(chan chan ClockType)
+	j.gpu.RunCommand(CmdFrameCounter, resp)
+	frameClk := <-resp
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	j.Play()
+	n := 0
+	for n < frames {
+		n += int(<-frameClk)
+	}
+	j.Pause()
+	wall := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	respCounters := make(chan cpuCounters)
+	j.cpu.RunCommand(CmdCounters, respCounters)
+	counters := <-respCounters
+	return BenchResult{
+		Frames:       n,
+		Wall:         wall,
+		Cycles:       counters.cycles,
+		Instructions: counters.instructions,
+		Allocs:       after.Mallocs - before.Mallocs,
+		AllocBytes:   after.TotalAlloc - before.TotalAlloc,
+	}, nil
+}
@@ -0,0 +1,15 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	r, err := Bench(busyRom(), 3, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Frames < 3 || r.Wall <= 0 || r.Instructions == 0 || r.Cycles < r.Instructions*4 {
+		t.Errorf("%+v", r)
+	}
+}
@@ -1,5 +1,12 @@
 package jibi
 
+// Boot rom sizes. A dmg bios overlays 0x0000-0x00FF, a cgb bios also
+// overlays 0x0200-0x08FF leaving the cartridge header visible.
+const (
+	biosSizeDmg = 0x0100
+	biosSizeCgb = 0x0900
+)
+
 // this seems to be a gbc bios, it will probably still work
 var bios = []Byte{
 	0x31, 0xFE, 0xFF, 0xAF, 0x21, 0xFF, 0x9F, 0x32, 0xCB, 0x7C, 0x20, 0xFB, 0x21, 0x26, 0xFF, 0x0E,
@@ -19,3 +26,58 @@ var bios = []Byte{
 	0x21, 0x04, 0x01, 0x11, 0xA8, 0x00, 0x1A, 0x13, 0xBE, 0x20, 0xFE, 0x23, 0x7D, 0xFE, 0x34, 0x20,
 	0xF5, 0x06, 0x19, 0x78, 0x86, 0x23, 0x05, 0x20, 0xFB, 0x86, 0x20, 0xFE, 0x3E, 0x01, 0xE0, 0x50,
 }
+
+// postBootIo are the io registers the dmg bios leaves different from their
+// power on values, in the order they are written. NR52 powers the apu on so
+// it takes the other sound registers.
+var postBootIo = []struct {
+	addr Word
+	b    Byte
+}{
+	{AddrNR52, 0x80},
+	{AddrNR11, 0x80},
+	{AddrNR12, 0xF3},
+	{AddrNR50, 0x77},
+	{AddrNR51, 0xF3},
+	{AddrBGP, 0xFC},
+	{AddrLCDC, 0x91},
+	{AddrIF, 0x01},
+}
+
+func (c *Cpu) cmdSkipBios(data interface{}) {
+	cgb, ok := data.(bool)
+	if !ok {
+		panic("invalid command response type")
+	}
+	c.skipBios(cgb)
+}
+
+// skipBios unmaps the bios and sets the registers and io the way it leaves
+// them when it jumps to the cartridge at 0x0100. On the cgb KEY0 selects
+// dmg compatibility for cartridges without cgb support, like its bios does.
+func (c *Cpu) skipBios(cgb bool) {
+	c.biosFinished = true
+	regs := [8]Byte{0x01, 0xB0, 0x00, 0x13, 0x00, 0xD8, 0x01, 0x4D}
+	if cgb {
+		regs = [8]Byte{0x11, 0x80, 0x00, 0x00, 0xFF, 0x56, 0x00, 0x0D}
+	}
+	for i, r := range []*register8{c.a, c.f, c.b, c.c, c.d, c.e, c.h, c.l} {
+		r.set(regs[i])
+	}
+	c.sp = 0xFFFE
+	c.pc = 0x0100
+
+	for _, io := range postBootIo {
+		c.writeByte(io.addr, io.b)
+	}
+	c.div = 0xABCC
+	c.mmu.Hardware().Write(AddrDIV, Byte(c.div>>8))
+	if cgb {
+		key0 := c.readByte(Word(0x0143)) // header cgb flag
+		if key0&0x80 == 0 {
+			key0 = 0x04
+		}
+		c.writeByte(AddrKEY0, key0)
+		c.writeByte(AddrBOOT, Byte(0x01))
+	}
+}
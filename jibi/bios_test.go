@@ -0,0 +1,89 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestSkipBios(t *testing.T) {
+	for _, c := range []struct {
+		options Options
+		af, de  Word
+	}{
+		{Options{Skipbios: true}, 0x01B0, 0x00D8},
+		{Options{Skipbios: true, Cgb: true}, 0x1180, 0xFF56},
+	} {
+		j, err := New(make([]Byte, 0x8000), c.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := make(chan string)
+		j.cpu.RunCommand(CmdString, resp)
+		<-resp
+		cpu := j.cpu
+		af := Word(cpu.a.Byte())<<8 | Word(cpu.f.Byte())
+		de := Word(cpu.d.Byte())<<8 | Word(cpu.e.Byte())
+		if af != c.af || de != c.de || cpu.pc.Word() != 0x0100 || cpu.sp.Word() != 0xFFFE {
+			t.Errorf("cgb %t: af %04X de %04X pc %04X sp %04X", c.options.Cgb, af, de,
+				cpu.pc.Word(), cpu.sp.Word())
+		}
+		if !cpu.biosFinished {
+			t.Error("bios still mapped")
+		}
+		if b := cpu.readByte(AddrLCDC); b != 0x91 {
+			t.Errorf("LCDC 0x%02X", b)
+		}
+		if b := cpu.readByte(AddrDIV); b != 0xAB {
+			t.Errorf("DIV 0x%02X", b)
+		}
+		if b := cpu.readByte(AddrNR52); b&0x80 == 0 {
+			t.Errorf("NR52 0x%02X", b)
+		}
+		j.Stop()
+	}
+}
+
+func TestBiosOverlay(t *testing.T) {
+	rom := make([]Byte, 0x8000)
+	rom[0x0000], rom[0x0100], rom[0x0200], rom[0x08FF], rom[0x0900] = 0xA0, 0x00, 0xA2, 0xA8, 0xA9
+	for _, size := range []int{biosSizeDmg, biosSizeCgb} {
+		bios := make([]Byte, size)
+		for i := range bios {
+			bios[i] = 0xB0
+		}
+		cart, err := NewCartridge(rom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cpu := NewCpu(NewMmu(cart, size == biosSizeCgb), bios)
+		cpu.Clock()
+		cgb := size == biosSizeCgb
+		want := map[Word]Byte{0x0000: 0xB0, 0x0100: 0x00, 0x0200: 0xA2, 0x08FF: 0xA8, 0x0900: 0xA9}
+		if cgb {
+			// the cgb bios leaves the cartridge header visible
+			want[0x0200], want[0x08FF] = 0xB0, 0xB0
+		}
+		for a, b := range want {
+			if got := cpu.readByte(a); got != b {
+				t.Errorf("bios of %d: 0x%04X reads 0x%02X, not 0x%02X", size, a, got, b)
+			}
+		}
+
+		// reaching the cartridge does not unmap the bios, only FF50 does
+		cpu.pc = 0x0100
+		cpu.fetch()
+		cpu.execute()
+		cpu.writeByte(AddrBOOT, Byte(0))
+		if cpu.readByte(Word(0x0000)) != 0xB0 {
+			t.Errorf("bios of %d unmapped without a write to FF50", size)
+		}
+		cpu.writeByte(AddrBOOT, Byte(1))
+		cpu.writeByte(AddrBOOT, Byte(0))
+		if b := cpu.readByte(Word(0x0000)); b != 0xA0 {
+			t.Errorf("bios of %d still mapped after FF50: 0x%02X", size, b)
+		}
+		if cgb && cpu.readByte(Word(0x0200)) != 0xA2 {
+			t.Errorf("cgb bios still mapped at 0x0200")
+		}
+		cpu.RunCommand(CmdStop, nil)
+	}
+}
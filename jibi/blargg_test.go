@@ -0,0 +1,98 @@
+package jibi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// blarggRom returns a rom that reports status and text through cartridge
+// ram like blargg's test roms do.
+func blarggRom(status Byte, text string) []Byte {
+	rom := headerRom("BLARGG", 2)
+	code := []Byte{
+		0x3E, 0x0A, // LD A, 0x0A
+		0xEA, 0x00, 0x00, // LD (0x0000), A, enable ram
+		0x21, 0x00, 0xA0, // LD HL, 0xA000
+	}
+	data := append([]Byte{blarggRunning}, blarggSignature...)
+	for _, c := range []byte(text) {
+		data = append(data, Byte(c))
+	}
+	for _, b := range append(data, 0) {
+		code = append(code, 0x3E, b, 0x22) // LD A, b; LD (HL+), A
+	}
+	code = append(code,
+		0x3E, status, // LD A, status
+		0xEA, 0x00, 0xA0, // LD (0xA000), A
+		0x18, 0xFE) // JR -2
+	copy(rom[0x0100:], []Byte{0x18, 0x4E}) // JR 0x0150, past the header
+	copy(rom[0x0150:], code)
+	return rom
+}
+
+func TestRunBlargg(t *testing.T) {
+	r, err := RunBlargg(blarggRom(0, "mem_timing\n\n01:ok  02:ok\n\nPassed all tests\n"), 30, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Finished || !r.Passed || len(r.Subtests) != 2 || !r.Subtests[1].Passed {
+		t.Errorf("%+v", r)
+	}
+
+	r, err = RunBlargg(blarggRom(1, "mem_timing\n\n01:ok  02:03\n\nFailed\n"), 30, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Finished || r.Passed || len(r.Subtests) != 2 || r.Subtests[1].Passed ||
+		r.Subtests[1].Result != "03" {
+		t.Errorf("%+v", r)
+	}
+
+	// a rom that never reports
+	r, err = RunBlargg(busyRom(), 10, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Finished || r.Passed || r.Frames < 10 {
+		t.Errorf("%+v", r)
+	}
+}
+
+// TestBlarggRoms runs blargg's test roms from the directory in JIBI_BLARGG,
+// testdata/blargg by default, and skips the ones that are not there.
+func TestBlarggRoms(t *testing.T) {
+	dir := os.Getenv("JIBI_BLARGG")
+	if dir == "" {
+		dir = filepath.Join("testdata", "blargg")
+	}
+	for _, rom := range []struct {
+		name   string
+		frames int
+	}{
+		{"cpu_instrs.gb", 4000},
+		{"instr_timing.gb", 600},
+		{"mem_timing.gb", 600},
+	} {
+		t.Run(rom.name, func(t *testing.T) {
+			data, err := ReadRomFile(filepath.Join(dir, rom.name))
+			if err != nil {
+				t.Skip(err)
+			}
+			r, err := RunBlargg(data, rom.frames, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range r.Subtests {
+				t.Run(s.Name, func(t *testing.T) {
+					if !s.Passed {
+						t.Errorf("failed: %s", s.Result)
+					}
+				})
+			}
+			if !r.Passed {
+				t.Errorf("%s\n%s", r, r.Output)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package jibi
+
+// A Bus reads and writes the whole address space synchronously, without the
+// caller having to know where the address is mapped. It is the only way into
+// memory: the cpu, gpu, apu and keypad all run on the scheduler goroutine of
+// the cpu, so an access never races another and needs no locking.
+type Bus interface {
+	Read(addr Word) Byte
+	Write(addr Word, b Byte)
+}
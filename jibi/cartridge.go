@@ -9,6 +9,8 @@ import (
 type Cartridge struct {
 	Rom []Byte
 
+	mapper Mapper
+
 	// rom info
 	name    string
 	color   bool
@@ -19,23 +21,190 @@ type Cartridge struct {
 }
 
 // NewCartridge reads and parses a rom and returns a new cartridge object.
-func NewCartridge(rom []Byte) *Cartridge {
-	name := ""
+// The header is not verified, see CartridgeHeader.Verify.
+func NewCartridge(rom []Byte) (*Cartridge, error) {
+	h, err := ParseCartridgeHeader(rom)
+	if err != nil {
+		return nil, err
+	}
+	romLen := 0x8000
+	if len(rom) > romLen {
+		romLen = len(rom)
+	}
+	romN := make([]Byte, romLen)
+	copy(romN, rom)
+	color := h.Cgb == 0x80
+	// the sgb bios only enables sgb functions with the old licensee 0x33
+	super := h.Sgb && h.OldLicensee == 0x33
+	ct := cartridgeType(h.Type)
+	romSize := cartridgeRomSize(h.RomSize)
+	ramSize := cartridgeRamSize(h.RamSize)
+	mapper, err := newMapper(ct, romN, ramSize)
+	if err != nil {
+		return nil, err
+	}
+	cart := &Cartridge{romN, mapper, h.Title, color, super, ct, romSize, ramSize}
+	return cart, nil
+}
+
+// A CartridgeHeader is the description of the cartridge at 0x0100-0x014F
+// of the rom.
+type CartridgeHeader struct {
+	Title       string
+	Cgb         Byte // 0x80 supports the cgb, 0xC0 needs it
+	Sgb         bool // supports the sgb
+	Type        Byte // mapper and extra hardware
+	RomSize     Byte
+	RamSize     Byte
+	OldLicensee Byte
+	Version     Byte
+
+	HeaderChecksum Byte
+	GlobalChecksum Word
+
+	// checksums of the rom
+	header Byte
+	global Word
+	romLen int
+}
+
+// ParseCartridgeHeader decodes the header of rom and computes its
+// checksums.
+func ParseCartridgeHeader(rom []Byte) (*CartridgeHeader, error) {
+	if len(rom) < 0x0150 {
+		return nil, fmt.Errorf("rom of %d bytes is too small for a cartridge header", len(rom))
+	}
+	h := &CartridgeHeader{
+		Cgb:            rom[0x0143],
+		Sgb:            rom[0x0146] == 0x03,
+		Type:           rom[0x0147],
+		RomSize:        rom[0x0148],
+		RamSize:        rom[0x0149],
+		OldLicensee:    rom[0x014B],
+		Version:        rom[0x014C],
+		HeaderChecksum: rom[0x014D],
+		GlobalChecksum: BytesToWord(rom[0x014E], rom[0x014F]),
+		romLen:         len(rom),
+	}
 	for _, c := range rom[0x0134 : 0x0142+1] {
 		if c == 0 {
 			break
 		}
-		name += string(c)
+		h.Title += string(c)
+	}
+	for _, b := range rom[0x0134:0x014D] {
+		h.header = h.header - b - 1
+	}
+	for i, b := range rom {
+		if i != 0x014E && i != 0x014F {
+			h.global += Word(b)
+		}
+	}
+	return h, nil
+}
+
+// RomBanks returns the number of 16KB rom banks, 0 for an unknown size.
+func (h *CartridgeHeader) RomBanks() int {
+	return cartridgeRomSize(h.RomSize).banks()
+}
+
+// RamBanks returns the number of 8KB ram banks.
+func (h *CartridgeHeader) RamBanks() int {
+	return cartridgeRamSize(h.RamSize).banks()
+}
+
+// TypeName describes the cartridge type, like 13-ROM+MBC3+RAM+BATT.
+func (h *CartridgeHeader) TypeName() string {
+	return cartridgeType(h.Type).String()
+}
+
+// HeaderChecksumOk returns whether the header checksum matches. The bios
+// locks up when it does not.
+func (h *CartridgeHeader) HeaderChecksumOk() bool {
+	return h.header == h.HeaderChecksum
+}
+
+// GlobalChecksumOk returns whether the checksum of the whole rom matches.
+// Nothing checks it on the hardware and patched roms often get it wrong.
+func (h *CartridgeHeader) GlobalChecksumOk() bool {
+	return h.global == h.GlobalChecksum
+}
+
+// String describes the header the way jibi info prints it: the decoded
+// fields, the bank counts, whether the mapper is emulated and the checksums.
+func (h *CartridgeHeader) String() string {
+	mapper := "emulated"
+	if _, err := newMapper(cartridgeType(h.Type), make([]Byte, 0x8000), 0); err != nil {
+		mapper = err.Error()
+	}
+	headerSum := "ok"
+	if !h.HeaderChecksumOk() {
+		headerSum = fmt.Sprintf("bad, the header sums to 0x%02X", h.header)
+	}
+	globalSum := "ok"
+	if !h.GlobalChecksumOk() {
+		globalSum = fmt.Sprintf("bad, the rom sums to 0x%04X", h.global)
+	}
+	return fmt.Sprintf(`title: %s
+type: %s (%s)
+rom: %d banks, %dKB, %d bytes in the file
+ram: %d banks, %dKB
+cgb: 0x%02X
+sgb: %v
+licensee: 0x%02X
+version: %d
+header checksum: 0x%02X %s
+global checksum: 0x%04X %s`, h.Title, h.TypeName(), mapper,
+		h.RomBanks(), h.RomBanks()*16, h.romLen, h.RamBanks(), h.RamBanks()*8,
+		h.Cgb, h.Sgb, h.OldLicensee, h.Version,
+		h.HeaderChecksum, headerSum, h.GlobalChecksum, globalSum)
+}
+
+// Verify returns an error describing what is wrong with a header a gameboy
+// would not run: a bad header checksum, a size it does not know or a rom
+// shorter than the header says.
+func (h *CartridgeHeader) Verify() error {
+	if !h.HeaderChecksumOk() {
+		return fmt.Errorf("header checksum is 0x%02X, the header sums to 0x%02X: the rom is corrupt",
+			h.HeaderChecksum, h.header)
+	}
+	banks := h.RomBanks()
+	if banks == 0 {
+		return fmt.Errorf("unknown rom size 0x%02X in the header", h.RomSize)
+	}
+	if h.romLen < banks*0x4000 {
+		return fmt.Errorf("rom is %d bytes but the header says %d: the rom is truncated",
+			h.romLen, banks*0x4000)
+	}
+	return nil
+}
+
+// SetRtcClock replaces the time source of cartridges with a real time clock.
+func (c *Cartridge) SetRtcClock(clk RtcClock) {
+	if m, ok := c.mapper.(rtcMapper); ok {
+		m.setRtcClock(clk)
+	}
+}
+
+// SetTilt connects a TiltSource to cartridges with an accelerometer.
+func (c *Cartridge) SetTilt(t TiltSource) {
+	if m, ok := c.mapper.(*mbc7); ok {
+		m.SetTilt(t)
 	}
-	romN := make([]Byte, 0x10000)
-	copy(romN, rom)
-	color := rom[0x0143] == 0x80
-	super := rom[0x0146] == 0x03
-	ct := cartridgeType(rom[0x0147])
-	romSize := cartridgeRomSize(rom[0x0148])
-	ramSize := cartridgeRamSize(rom[0x0149])
-	cart := &Cartridge{romN, name, color, super, ct, romSize, ramSize}
-	return cart
+}
+
+// Title returns the cartridge title from the header.
+func (c *Cartridge) Title() string {
+	return c.name
+}
+
+// globalChecksum returns the global checksum the header claims, at
+// 0x014E-0x014F.
+func (c *Cartridge) globalChecksum() Word {
+	if len(c.Rom) < 0x0150 {
+		return 0
+	}
+	return BytesToWord(c.Rom[0x014E], c.Rom[0x014F])
 }
 
 func (c *Cartridge) String() string {
@@ -97,12 +266,14 @@ func (ct cartridgeType) String() string {
 		return "1E-ROM+MBC5+RUMBLE+SRAM+BATT"
 	case 0x1F:
 		return "1F-PocketCamera"
+	case 0x22:
+		return "22-ROM+MBC7+EEPROM+ACCEL"
 	case 0xFD:
 		return "FD-BandaiTAMA5"
 	case 0xFE:
 		return "FE-HudsonHuC_3"
 	default:
-		return fmt.Sprintf("%0X-UNKNOWN", ct)
+		return fmt.Sprintf("%02X-UNKNOWN", uint8(ct))
 	}
 }
 
@@ -124,6 +295,10 @@ func (cs cartridgeRomSize) banks() int {
 		return 64
 	case 0x06:
 		return 128
+	case 0x07:
+		return 256
+	case 0x08:
+		return 512
 	case 0x52:
 		return 72
 	case 0x53:
@@ -153,6 +328,8 @@ func (cs cartridgeRamSize) banks() int {
 		return 4
 	case 0x04:
 		return 16
+	case 0x05:
+		return 8
 	}
 	return 0
 }
@@ -0,0 +1,120 @@
+package jibi
+
+import (
+	"strings"
+	"testing"
+)
+
+// headerRom returns a rom of banks 16KB banks with a valid header.
+func headerRom(title string, banks int) []Byte {
+	rom := make([]Byte, banks*0x4000)
+	copy(rom[0x0134:], []Byte(title))
+	rom[0x0143] = 0x80
+	rom[0x0147] = 0x13
+	rom[0x0148] = 0x01
+	rom[0x0149] = 0x03
+	sum := Byte(0)
+	for _, b := range rom[0x0134:0x014D] {
+		sum = sum - b - 1
+	}
+	rom[0x014D] = sum
+	return rom
+}
+
+func TestCartridgeHeader(t *testing.T) {
+	rom := headerRom("JIBI", 4)
+	rom[0x2000] = 0x12
+	global := Word(0)
+	for _, b := range rom {
+		global += Word(b)
+	}
+	rom[0x014E], rom[0x014F] = global.High(), global.Low()
+
+	h, err := ParseCartridgeHeader(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Title != "JIBI" || h.Cgb != 0x80 || h.RomBanks() != 4 || h.RamBanks() != 4 ||
+		h.TypeName() != "13-ROM+MBC3+RAM+BATT" {
+		t.Errorf("%+v", h)
+	}
+	if err := h.Verify(); err != nil {
+		t.Error(err)
+	}
+	if !h.GlobalChecksumOk() {
+		t.Errorf("global checksum 0x%04X", h.GlobalChecksum)
+	}
+
+	for _, c := range []struct {
+		rom  []Byte
+		want string
+	}{
+		{append([]Byte{}, rom[:0x8000]...), "truncated"},
+		{func() []Byte { r := headerRom("JIBI", 4); r[0x0134] = 'X'; return r }(), "header checksum"},
+	} {
+		h, err := ParseCartridgeHeader(c.rom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Verify(); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("want %q, got %v", c.want, err)
+		}
+	}
+	if _, err := ParseCartridgeHeader(make([]Byte, 0x100)); err == nil {
+		t.Error("no error for a rom without a header")
+	}
+}
+
+func TestCartridgeSizes(t *testing.T) {
+	for size, banks := range map[Byte]int{
+		0x00: 2, 0x01: 4, 0x02: 8, 0x03: 16, 0x04: 32, 0x05: 64, 0x06: 128,
+		0x07: 256, 0x08: 512, 0x52: 72, 0x53: 80, 0x54: 96,
+	} {
+		rom := headerRom("JIBI", banks)
+		rom[0x0148] = size
+		rom[0x014D] -= size - 0x01
+		h, err := ParseCartridgeHeader(rom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.RomBanks() != banks {
+			t.Errorf("rom size 0x%02X: %d banks", size, h.RomBanks())
+		}
+		if err := h.Verify(); err != nil {
+			t.Errorf("rom size 0x%02X: %s", size, err)
+		}
+	}
+	for size, banks := range map[Byte]int{
+		0x00: 0, 0x01: 1, 0x02: 2, 0x03: 4, 0x04: 16, 0x05: 8,
+	} {
+		rom := headerRom("JIBI", 2)
+		rom[0x0149] = size
+		h, err := ParseCartridgeHeader(rom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.RamBanks() != banks {
+			t.Errorf("ram size 0x%02X: %d banks", size, h.RamBanks())
+		}
+	}
+}
+
+func TestCartridgeHeaderString(t *testing.T) {
+	rom := headerRom("JIBI", 4)
+	h, err := ParseCartridgeHeader(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := h.String()
+	for _, want := range []string{"title: JIBI", "13-ROM+MBC3+RAM+BATT (emulated)",
+		"rom: 4 banks", "ram: 4 banks", "header checksum: 0x", " ok\n", "bad, the rom sums"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("%q not in\n%s", want, s)
+		}
+	}
+	rom[0x0147] = 0x0B
+	h, _ = ParseCartridgeHeader(rom)
+	if s := h.String(); !strings.Contains(s, "not supported") {
+		t.Errorf("mmm01 in\n%s", s)
+	}
+}
@@ -0,0 +1,123 @@
+package jibi
+
+// A cgbPalette is one of the two cgb color palette memories. It holds 8
+// palettes of 4 colors, each color is 2 bytes of little endian 15bit rgb. It
+// is accessed through an index register (BCPS/OCPS) and a data register
+// (BCPD/OCPD).
+type cgbPalette struct {
+	index Byte // bit 7 auto increment, bits 0-5 address
+	data  []Byte
+}
+
+func newCgbPalette() *cgbPalette {
+	return &cgbPalette{data: make([]Byte, 64)}
+}
+
+func (p *cgbPalette) readIndex() Byte {
+	return p.index | 0x40 // bit 6 unused
+}
+
+func (p *cgbPalette) writeIndex(b Byte) {
+	p.index = b & 0xBF
+}
+
+func (p *cgbPalette) readData() Byte {
+	return p.data[p.index&0x3F]
+}
+
+// writeData sets the currently indexed byte and advances the index if auto
+// increment is set.
+func (p *cgbPalette) writeData(b Byte) {
+	p.data[p.index&0x3F] = b
+	if p.index&0x80 == 0x80 {
+		p.index = 0x80 | (p.index+1)&0x3F
+	}
+}
+
+// setColors loads 4 colors into palette number pal.
+func (p *cgbPalette) setColors(pal int, colors [4]Word) {
+	for i, c := range colors {
+		p.data[pal*8+i*2] = c.Low()
+		p.data[pal*8+i*2+1] = c.High()
+	}
+}
+
+// ReadPaletteColor returns color number color of palette pal from the
+// background palette memory, or the sprite one if obj is set, as 15 bit rgb.
+func (m *RomOnlyMmu) ReadPaletteColor(obj bool, pal, color Byte) Word {
+	p := m.bgPal
+	if obj {
+		p = m.objPal
+	}
+	i := (pal&0x07)*8 + (color&0x03)*2
+	return Word(p.data[i]) | Word(p.data[i+1]&0x7F)<<8
+}
+
+// SetColorization puts the mmu in the state the cgb bios leaves it in after
+// booting a dmg cartridge: dmg compatibility mode, x coordinate sprite
+// priority and the colorization in palette memory.
+func (m *RomOnlyMmu) SetColorization(cz Colorization) {
+	m.key0 = 0x04
+	m.opri = 0x01
+	m.bgPal.setColors(0, cz.Bg)
+	m.objPal.setColors(0, cz.Obj0)
+	m.objPal.setColors(1, cz.Obj1)
+}
+
+func (m *RomOnlyMmu) readCgbReg(a Word, hw bool) Byte {
+	switch a {
+	case AddrKEY0:
+		return m.key0
+	case AddrVBK:
+		return 0xFE | m.vbk
+	case AddrBOOT:
+		return 0xFF
+	case AddrRP:
+		return m.readRP()
+	case AddrBCPS:
+		return m.bgPal.readIndex()
+	case AddrBCPD:
+		return m.bgPal.readData()
+	case AddrOCPS:
+		return m.objPal.readIndex()
+	case AddrOCPD:
+		return m.objPal.readData()
+	case AddrOPRI:
+		return 0xFE | m.opri
+	case AddrSVBK:
+		return 0xF8 | m.svbk
+	}
+	return m.cgbregs[a-AddrCgbRegs]
+}
+
+func (m *RomOnlyMmu) writeCgbReg(a Word, b Byte, hw bool) {
+	switch a {
+	case AddrKEY0:
+		// only the boot rom can select dmg compatibility mode
+		if m.boot == 0 {
+			m.key0 = b
+		}
+	case AddrVBK:
+		m.vbk = b & 0x01
+	case AddrBOOT:
+		if b != 0 {
+			m.boot = 1
+		}
+	case AddrRP:
+		m.writeRP(b)
+	case AddrBCPS:
+		m.bgPal.writeIndex(b)
+	case AddrBCPD:
+		m.bgPal.writeData(b)
+	case AddrOCPS:
+		m.objPal.writeIndex(b)
+	case AddrOCPD:
+		m.objPal.writeData(b)
+	case AddrOPRI:
+		m.opri = b & 0x01
+	case AddrSVBK:
+		m.svbk = b & 0x07
+	default:
+		m.cgbregs[a-AddrCgbRegs] = b
+	}
+}
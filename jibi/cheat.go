@@ -0,0 +1,176 @@
+package jibi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// A Cheat is a decoded cheat code. Game Genie codes replace the byte the
+// cartridge answers at Addr with Data, when it holds Compare if Compared is
+// set, so a code for one bank leaves the other banks alone.
+//
+// GameShark codes, with Ram set, write Data to Addr at every vblank. Bank
+// 0x80-0x8F picks the cartridge ram bank at 0xA000-0xBFFF and 0x90-0x97
+// the cgb work ram bank at 0xD000-0xDFFF, whatever bank is mapped. Other
+// banks, usually 0x01, write to what is mapped.
+type Cheat struct {
+	Code     string
+	Addr     Word
+	Data     Byte
+	Compare  Byte
+	Compared bool
+	Ram      bool
+	Bank     Byte
+}
+
+// ParseCheat decodes a Game Genie or a GameShark code.
+//
+// Game Genie codes are ABC-DEF or ABC-DEF-GHI in hex digits. AB is the
+// data, FCDE the address with F inverted and GI the compare byte rotated and
+// scrambled, H is not used.
+//
+// GameShark codes are 8 hex digits BBDDLLHH, the bank, the data and the
+// address low byte first, in ram at 0xA000-0xDFFF.
+func ParseCheat(code string) (Cheat, error) {
+	digits := strings.Replace(strings.TrimSpace(code), "-", "", -1)
+	v, err := strconv.ParseUint(digits, 16, 64)
+	if err != nil || len(digits) != 6 && len(digits) != 8 && len(digits) != 9 {
+		return Cheat{}, fmt.Errorf("cheat %q: not a game genie or gameshark code", code)
+	}
+	if len(digits) == 8 {
+		c := Cheat{
+			Code: code,
+			Bank: Byte(v >> 24),
+			Data: Byte(v >> 16),
+			Addr: Word(v)<<8 | Word(v>>8)&0xFF,
+			Ram:  true,
+		}
+		if c.Addr < AddrERam || c.Addr >= AddrEcho {
+			return Cheat{}, fmt.Errorf("cheat %q: address 0x%04X is not in ram", code, uint16(c.Addr))
+		}
+		return c, nil
+	}
+	if len(digits) == 9 {
+		v >>= 12
+	}
+	c := Cheat{
+		Code: code,
+		Data: Byte(v >> 16),
+		Addr: Word(v>>4)&0x0FFF | Word(^v&0x0F)<<12,
+	}
+	if c.Addr >= 0x8000 {
+		return Cheat{}, fmt.Errorf("cheat %q: address 0x%04X is not in rom", code, uint16(c.Addr))
+	}
+	if len(digits) == 9 {
+		g, _ := strconv.ParseUint(digits[6:7], 16, 8)
+		i, _ := strconv.ParseUint(digits[8:9], 16, 8)
+		gi := Byte(g<<4 | i)
+		c.Compare = (gi>>2 | gi<<6) ^ 0xBA
+		c.Compared = true
+	}
+	return c, nil
+}
+
+// romCheats are the enabled Game Genie codes, read on every rom access
+// without locking. Changes replace the whole list.
+type romCheats struct {
+	cheats atomic.Pointer[[]Cheat]
+}
+
+// patch returns what the cartridge answers at addr when it holds b.
+func (rc *romCheats) patch(addr Word, b Byte) Byte {
+	p := rc.cheats.Load()
+	if p == nil {
+		return b
+	}
+	for _, c := range *p {
+		if c.Addr == addr && (!c.Compared || c.Compare == b) {
+			return c.Data
+		}
+	}
+	return b
+}
+
+// SetCheats replaces the Game Genie codes patching rom reads.
+func (m *RomOnlyMmu) SetCheats(cheats []Cheat) {
+	list := append([]Cheat(nil), cheats...)
+	m.cheats.cheats.Store(&list)
+}
+
+// WriteBankByte writes b to addr in a bank that need not be mapped, the
+// cartridge ram bank at 0xA000-0xBFFF or on the cgb the work ram bank at
+// 0xD000-0xDFFF, where bank 0 is bank 1. It returns false for other memory
+// and banks that do not exist.
+func (m *RomOnlyMmu) WriteBankByte(addr Word, bank int, b Byte) bool {
+	if AddrERam <= addr && addr < AddrRam {
+		bm, ok := m.mapper.(batteryMapper)
+		if !ok {
+			return false
+		}
+		i := bank*0x2000 + int(addr-AddrERam)
+		if ram := bm.batteryRam(); i < len(ram) {
+			ram[i] = b
+			return true
+		}
+	} else if m.cgb && AddrRam+0x1000 <= addr && addr < AddrEcho && bank < 8 {
+		if bank == 0 {
+			bank = 1
+		}
+		m.ram[bank*0x1000+int(addr-AddrRam-0x1000)] = b
+		return true
+	}
+	return false
+}
+
+// a cheatToggle enables or disables a cheat
+type cheatToggle struct {
+	cheat Cheat
+	on    bool
+}
+
+// cmdSetCheat enables or disables a cheat between instructions, cheats are
+// told apart by their code.
+func (c *Cpu) cmdSetCheat(data interface{}) {
+	t, ok := data.(cheatToggle)
+	if !ok {
+		panic("invalid command response type")
+	}
+	var cheats []Cheat
+	for _, o := range c.cheats {
+		if o.Code != t.cheat.Code {
+			cheats = append(cheats, o)
+		}
+	}
+	if t.on {
+		cheats = append(cheats, t.cheat)
+	}
+	c.cheats = cheats
+	var rom []Cheat
+	for _, o := range cheats {
+		if !o.Ram {
+			rom = append(rom, o)
+		}
+	}
+	c.mmu.SetCheats(rom)
+}
+
+// ramCheats writes the GameShark codes, the cpu runs them when a vblank is
+// requested.
+func (c *Cpu) ramCheats() {
+	for _, o := range c.cheats {
+		if !o.Ram {
+			continue
+		}
+		banked := o.Bank&0xF0 == 0x80 || o.Bank&0xF8 == 0x90
+		if !banked || !c.mmu.WriteBankByte(o.Addr, int(o.Bank&0x0F), o.Data) {
+			c.writeByte(o.Addr, o.Data)
+		}
+	}
+}
+
+// SetCheat enables or disables a cheat while the Jibi runs.
+func (j Jibi) SetCheat(c Cheat, on bool) {
+	j.cpu.RunCommand(CmdSetCheat, cheatToggle{c, on})
+}
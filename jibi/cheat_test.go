@@ -0,0 +1,126 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestParseCheat(t *testing.T) {
+	for _, c := range []struct {
+		code     string
+		addr     Word
+		data     Byte
+		compare  Byte
+		compared bool
+	}{
+		{"3EA-BCF", 0x0ABC, 0x3E, 0, false},
+		{"3EA-BCF-4A2", 0x0ABC, 0x3E, 0x2A, true},
+		{"00a-17b-c49", 0x4A17, 0x00, 0xC8, true},
+	} {
+		cheat, err := ParseCheat(c.code)
+		if err != nil {
+			t.Errorf("%s: %v", c.code, err)
+			continue
+		}
+		if cheat.Addr != c.addr || cheat.Data != c.data || cheat.Compare != c.compare ||
+			cheat.Compared != c.compared {
+			t.Errorf("%s: %+v", c.code, cheat)
+		}
+	}
+	for _, code := range []string{"3EA-BC", "3EA-BC7", "XYZ-BCF"} {
+		if _, err := ParseCheat(code); err == nil {
+			t.Errorf("%s: no error", code)
+		}
+	}
+}
+
+func TestCheatRom(t *testing.T) {
+	cpu := newCodeCpu(t, nil)
+	defer cpu.RunCommand(CmdStop, nil)
+	rom := cpu.mmu.Rom()
+	rom[0x0150] = 0x12
+	plain, _ := ParseCheat("341-50F") // 0x0150
+	compared, _ := ParseCheat("561-50F-A62")
+	if compared.Compare != 0x12 {
+		t.Fatalf("compare 0x%02X", compared.Compare)
+	}
+
+	cpu.cmdSetCheat(cheatToggle{plain, true})
+	if b := cpu.readByte(Word(0x0150)); b != 0x34 {
+		t.Errorf("read 0x%02X with the cheat on", b)
+	}
+	cpu.cmdSetCheat(cheatToggle{plain, false})
+	if b := cpu.readByte(Word(0x0150)); b != 0x12 {
+		t.Errorf("read 0x%02X with the cheat off", b)
+	}
+
+	cpu.cmdSetCheat(cheatToggle{compared, true})
+	if b := cpu.readByte(Word(0x0150)); b != 0x56 {
+		t.Errorf("read 0x%02X with a matching compare byte", b)
+	}
+	rom[0x0150] = 0x13
+	if b := cpu.readByte(Word(0x0150)); b != 0x13 {
+		t.Errorf("read 0x%02X with another compare byte", b)
+	}
+}
+
+func TestParseGameShark(t *testing.T) {
+	c, err := ParseCheat("019900C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Ram || c.Bank != 0x01 || c.Data != 0x99 || c.Addr != 0xC100 {
+		t.Errorf("%+v", c)
+	}
+	if _, err := ParseCheat("01990080"); err == nil {
+		t.Error("no error for an address in vram")
+	}
+}
+
+func TestCheatRam(t *testing.T) {
+	cpu := newFrameCpu(t)
+	defer cpu.RunCommand(CmdStop, nil)
+	c, _ := ParseCheat("019900C1")
+	cpu.cmdSetCheat(cheatToggle{c, true})
+	cpu.step(false, 0)
+	if b := cpu.readByte(Word(0xC100)); b != 0x00 {
+		t.Fatalf("0x%02X written before a vblank", b)
+	}
+	cpu.mmu.SetInterrupt(InterruptVblank)
+	cpu.step(false, 0)
+	if b := cpu.readByte(Word(0xC100)); b != 0x99 {
+		t.Errorf("0x%02X after a vblank", b)
+	}
+	// the game changes it until the next vblank
+	cpu.writeByte(Word(0xC100), Byte(0x10))
+	cpu.step(false, 0)
+	if b := cpu.readByte(Word(0xC100)); b != 0x10 {
+		t.Errorf("0x%02X written again without a vblank", b)
+	}
+}
+
+func TestCheatBanks(t *testing.T) {
+	cart, err := NewCartridge(headerRom("JIBI", 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mmu := NewMmu(cart, true)
+	if !mmu.WriteBankByte(0xA010, 2, 0x55) {
+		t.Error("cartridge ram bank 2 not written")
+	}
+	if ram := cart.mapper.(batteryMapper).batteryRam(); ram[2*0x2000+0x10] != 0x55 {
+		t.Errorf("cartridge ram 0x%02X", ram[2*0x2000+0x10])
+	}
+	if mmu.WriteBankByte(0xA010, 4, 0x55) {
+		t.Error("cartridge ram bank 4 written")
+	}
+	if !mmu.WriteBankByte(0xD020, 3, 0x66) {
+		t.Error("work ram bank 3 not written")
+	}
+	mmu.Write(AddrSVBK, 3)
+	if b := mmu.Read(0xD020); b != 0x66 {
+		t.Errorf("work ram bank 3 0x%02X", b)
+	}
+	if mmu.WriteBankByte(0xC020, 3, 0x66) {
+		t.Error("banked write to bank 0")
+	}
+}
@@ -0,0 +1,308 @@
+package jibi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Colorization is the 12 color palette the cgb bios assigns to a dmg
+// cartridge, 4 colors each for the background and the two sprite palettes.
+// Colors are 15bit rgb as stored in cgb palette memory.
+type Colorization struct {
+	Bg   [4]Word
+	Obj0 [4]Word
+	Obj1 [4]Word
+}
+
+// rgb converts 24bit 0xRRGGBB to 15bit cgb color.
+func rgb(c uint32) Word {
+	r := Word(c>>16&0xFF) >> 3
+	g := Word(c>>8&0xFF) >> 3
+	b := Word(c&0xFF) >> 3
+	return r | g<<5 | b<<10
+}
+
+func rgb4(c0, c1, c2, c3 uint32) [4]Word {
+	return [4]Word{rgb(c0), rgb(c1), rgb(c2), rgb(c3)}
+}
+
+// ParseColorization parses 12 comma separated 24bit hex colors, background
+// first, then sprite palette 0 and sprite palette 1.
+func ParseColorization(s string) (Colorization, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 12 {
+		return Colorization{}, fmt.Errorf("colorization needs 12 colors, got %d", len(parts))
+	}
+	colors, err := parseColors(parts)
+	if err != nil {
+		return Colorization{}, err
+	}
+	var cz Colorization
+	copy(cz.Bg[:], colors[0:4])
+	copy(cz.Obj0[:], colors[4:8])
+	copy(cz.Obj1[:], colors[8:12])
+	return cz, nil
+}
+
+// parseColors parses 24bit hex colors, with or without a leading #.
+func parseColors(parts []string) ([]Word, error) {
+	colors := make([]Word, len(parts))
+	for i, p := range parts {
+		p = strings.TrimPrefix(strings.TrimSpace(p), "#")
+		c, err := strconv.ParseUint(p, 16, 24)
+		if err != nil {
+			return nil, fmt.Errorf("invalid color %q: %v", p, err)
+		}
+		colors[i] = rgb(uint32(c))
+	}
+	return colors, nil
+}
+
+// colorPalettes are the 4 color palettes of the cgb bios in the order it
+// stores them. Combinations pick a palette by its offset in colors, which
+// is usually a multiple of 4 but not always.
+var colorPalettes = [...]Word{
+	0x7FFF, 0x32BF, 0x00D0, 0x0000, // 0 brown
+	0x639F, 0x4279, 0x15B0, 0x04CB, // 1 dark brown
+	0x7FFF, 0x6E31, 0x454A, 0x0000, // 2 dark blue
+	0x7FFF, 0x1BEF, 0x0200, 0x0000, // 3 green
+	0x7FFF, 0x421F, 0x1CF2, 0x0000, // 4 red
+	0x7FFF, 0x5294, 0x294A, 0x0000, // 5 gray
+	0x7FFF, 0x03FF, 0x012F, 0x0000, // 6 yellow
+	0x7FFF, 0x03EF, 0x01D6, 0x0000,
+	0x7FFF, 0x42B5, 0x3DC8, 0x0000,
+	0x7E74, 0x03FF, 0x0180, 0x0000,
+	0x67FF, 0x77AC, 0x1A13, 0x2D6B, // 10
+	0x7ED6, 0x4BFF, 0x2175, 0x0000,
+	0x53FF, 0x4A5F, 0x7E52, 0x0000, // 12 pale
+	0x4FFF, 0x7ED2, 0x3A4C, 0x1CE0,
+	0x03ED, 0x7FFF, 0x255F, 0x0000,
+	0x036A, 0x021F, 0x03FF, 0x7FFF,
+	0x7FFF, 0x01DF, 0x0112, 0x0000,
+	0x231F, 0x035F, 0x00F2, 0x0009,
+	0x7FFF, 0x03EA, 0x011F, 0x0000, // 18 dark green
+	0x299F, 0x001A, 0x000C, 0x0000,
+	0x7FFF, 0x027F, 0x001F, 0x0000, // 20
+	0x7FFF, 0x03E0, 0x0206, 0x0120,
+	0x7FFF, 0x7EEB, 0x001F, 0x7C00,
+	0x7FFF, 0x3FFF, 0x7E00, 0x001F,
+	0x7FFF, 0x03FF, 0x001F, 0x0000, // 24 orange
+	0x03FF, 0x001F, 0x000C, 0x0000,
+	0x7FFF, 0x033F, 0x0193, 0x0000,
+	0x0000, 0x4200, 0x037F, 0x7FFF, // 27 reverse
+	0x7FFF, 0x7E8C, 0x7C00, 0x0000, // 28 blue
+	0x7FFF, 0x1BEF, 0x6180, 0x0000, // 29 green and blue
+}
+
+// a colorCombination is the offsets in colorPalettes of the palettes for
+// sprite palette 0, sprite palette 1 and the background.
+type colorCombination struct {
+	obj0, obj1, bg int
+}
+
+// pals returns the combination of the palettes numbered obj0, obj1 and bg.
+func pals(obj0, obj1, bg int) colorCombination {
+	return colorCombination{obj0 * 4, obj1 * 4, bg * 4}
+}
+
+func (cc colorCombination) colorization() Colorization {
+	var cz Colorization
+	copy(cz.Obj0[:], colorPalettes[cc.obj0:])
+	copy(cz.Obj1[:], colorPalettes[cc.obj1:])
+	copy(cz.Bg[:], colorPalettes[cc.bg:])
+	return cz
+}
+
+// colorCombinations are the palette combinations of the bios, picked by
+// the title hash or by the keys held while the logo shows. The sprite
+// palettes of 22, 34 and 35 start one color before a palette, as in the
+// bios.
+var colorCombinations = [...]colorCombination{
+	pals(4, 4, 29),   // 0 right, and the default
+	pals(18, 18, 18), // right + a
+	pals(20, 20, 20),
+	pals(24, 24, 24), // down + a
+	pals(9, 9, 9),
+	pals(0, 0, 0),    // 5 up
+	pals(27, 27, 27), // right + b
+	pals(5, 5, 5),    // left + b
+	pals(12, 12, 12), // down
+	pals(26, 26, 26),
+	pals(16, 8, 8), // 10
+	pals(4, 28, 28),
+	pals(4, 2, 2),
+	pals(3, 4, 4),
+	pals(4, 29, 29),
+	pals(28, 4, 28), // 15
+	pals(2, 17, 2),
+	pals(16, 16, 8),
+	pals(4, 4, 7),
+	pals(4, 4, 18),
+	pals(4, 4, 20), // 20
+	pals(19, 19, 9),
+	{4*4 - 1, 4*4 - 1, 11 * 4},
+	pals(17, 17, 2),
+	pals(4, 4, 2),
+	pals(4, 4, 3), // 25
+	pals(28, 28, 0),
+	pals(3, 3, 0),
+	pals(0, 0, 1), // up + b
+	pals(18, 22, 18),
+	pals(20, 22, 20), // 30
+	pals(24, 22, 24),
+	pals(16, 22, 8),
+	pals(17, 4, 13),
+	{28*4 - 1, 0 * 4, 14 * 4},
+	{28*4 - 1, 4 * 4, 15 * 4}, // 35
+	pals(19, 22, 9),
+	pals(16, 28, 10),
+	pals(4, 23, 28),
+	pals(17, 22, 2),
+	pals(4, 0, 2), // 40 left + a
+	pals(4, 28, 3),
+	pals(28, 3, 0),
+	pals(3, 28, 4), // up + a
+	pals(21, 28, 4),
+	pals(3, 28, 0), // 45
+	pals(25, 3, 28),
+	pals(0, 28, 8),
+	pals(4, 3, 28),  // left
+	pals(28, 3, 6),  // down + b
+	pals(4, 28, 29), // 50
+}
+
+// a colorCombo is a direction optionally with a or b held during boot
+type colorCombo struct {
+	dir Key
+	btn Key // KeyA, KeyB, or KeyStart for none
+}
+
+// colorComboTable holds the combination each key combo picks.
+var colorComboTable = map[colorCombo]int{
+	{KeyRight, KeyStart}: 0,
+	{KeyLeft, KeyStart}:  48,
+	{KeyUp, KeyStart}:    5,
+	{KeyDown, KeyStart}:  8,
+	{KeyRight, KeyA}:     1,
+	{KeyLeft, KeyA}:      40,
+	{KeyUp, KeyA}:        43,
+	{KeyDown, KeyA}:      3,
+	{KeyRight, KeyB}:     6,
+	{KeyLeft, KeyB}:      7,
+	{KeyUp, KeyB}:        28,
+	{KeyDown, KeyB}:      49,
+}
+
+// colorTitleSums are the title hashes the bios knows, the sum of the title
+// bytes. Hashes from colorFirstDuplicate on are shared by several titles,
+// they only match if the 4th letter of the title is the one at the same
+// position in colorFourthLetters.
+var colorTitleSums = [...]Byte{
+	0x00, 0x88, 0x16, 0x36, 0xD1, 0xDB, 0xF2, 0x3C, 0x8C, 0x92, 0x3D, 0x5C, 0x58, 0xC9, 0x3E, 0x70,
+	0x1D, 0x59, 0x69, 0x19, 0x35, 0xA8, 0x14, 0xAA, 0x75, 0x95, 0x99, 0x34, 0x6F, 0x15, 0xFF, 0x97,
+	0x4B, 0x90, 0x17, 0x10, 0x39, 0xF7, 0xF6, 0xA2, 0x49, 0x4E, 0x43, 0x68, 0xE0, 0x8B, 0xF0, 0xCE,
+	0x0C, 0x29, 0xE8, 0xB7, 0x86, 0x9A, 0x52, 0x01, 0x9D, 0x71, 0x9C, 0xBD, 0x5D, 0x6D, 0x67, 0x3F,
+	0x6B,
+	0xB3, 0x46, 0x28, 0xA5, 0xC6, 0xD3, 0x27, 0x61, 0x18, 0x66, 0x6A, 0xBF, 0x0D, 0xF4,
+	0xB3, 0x46, 0x28, 0xA5, 0xC6, 0xD3, 0x27, 0x61, 0x18, 0x66, 0x6A, 0xBF, 0x0D, 0xF4,
+	0xB3,
+}
+
+const (
+	colorFirstDuplicate = 65
+	colorFourthLetters  = "BEFAARBEKEK R-URAR INAILICE R"
+)
+
+// colorTitleCombinations are the combinations of the titles in
+// colorTitleSums.
+var colorTitleCombinations = [...]uint8{
+	0, 4, 5, 35, 34, 3, 31, 15, 10, 5, 19, 36, 7, 37, 30, 44,
+	21, 32, 31, 20, 5, 33, 13, 14, 5, 29, 5, 18, 9, 3, 2, 26,
+	25, 25, 41, 42, 26, 45, 42, 45, 36, 38, 26, 42, 30, 41, 34, 34,
+	5, 42, 6, 5, 33, 25, 42, 42, 40, 2, 16, 25, 42, 42, 5, 0,
+	39,
+	36, 22, 25, 6, 32, 12, 36, 11, 39, 18, 39, 24, 31, 50,
+	17, 46, 6, 27, 0, 47, 41, 41, 0, 0, 19, 34, 23, 18, 29,
+}
+
+// titleHash returns the bios title hash, the sum of the 16 title bytes, and
+// whether the cartridge is from nintendo, the bios only looks up nintendo
+// cartridges.
+func titleHash(rom []Byte) (Byte, bool) {
+	licensee := rom[0x014B]
+	nintendo := licensee == 0x01 ||
+		(licensee == 0x33 && rom[0x0144] == '0' && rom[0x0145] == '1')
+	sum := Byte(0)
+	for _, c := range rom[0x0134:0x0144] {
+		sum += c
+	}
+	return sum, nintendo
+}
+
+// titleCombination looks up the combination for a title hash the way the
+// bios does, the first hash that matches wins and shared hashes also need
+// the 4th letter of the title to match. Unknown titles get combination 0.
+func titleCombination(sum, fourth Byte) int {
+	for i, s := range colorTitleSums {
+		if s != sum {
+			continue
+		}
+		if i >= colorFirstDuplicate && colorFourthLetters[i-colorFirstDuplicate] != byte(fourth) {
+			continue
+		}
+		return int(colorTitleCombinations[i])
+	}
+	return 0
+}
+
+// colorize picks the palette the cgb bios would assign to a dmg cartridge. A
+// user palette for the cartridge title wins, then any held key combination,
+// then the built in title hash table.
+func colorize(cart *Cartridge, keys []Key, user map[string]Colorization) Colorization {
+	if cz, ok := user[cart.name]; ok {
+		return cz
+	}
+	combo := colorCombo{btn: KeyStart}
+	haveDir := false
+	for _, k := range keys {
+		switch k {
+		case KeyUp, KeyDown, KeyLeft, KeyRight:
+			combo.dir = k
+			haveDir = true
+		case KeyA, KeyB:
+			combo.btn = k
+		}
+	}
+	if haveDir {
+		return colorCombinations[colorComboTable[combo]].colorization()
+	}
+	sum, nintendo := titleHash(cart.Rom)
+	if !nintendo {
+		return colorCombinations[0].colorization()
+	}
+	return colorCombinations[titleCombination(sum, cart.Rom[0x0137])].colorization()
+}
+
+// ParseColorKeys parses the keys to hold while the cgb bios shows the logo,
+// a direction optionally with a or b, as left+a.
+func ParseColorKeys(s string) ([]Key, error) {
+	var keys []Key
+	dirs := 0
+	for _, name := range strings.Split(s, "+") {
+		k, ok := ParseKey(strings.TrimSpace(name))
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("color keys: unknown key %q", name)
+		case k == KeyUp || k == KeyDown || k == KeyLeft || k == KeyRight:
+			dirs++
+		case k != KeyA && k != KeyB:
+			return nil, fmt.Errorf("color keys: %s does not pick a palette", k)
+		}
+		keys = append(keys, k)
+	}
+	if dirs != 1 || len(keys) > 2 {
+		return nil, fmt.Errorf("color keys: %q needs a direction and at most a or b", s)
+	}
+	return keys, nil
+}
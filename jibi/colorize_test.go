@@ -0,0 +1,157 @@
+package jibi
+
+import (
+	"testing"
+)
+
+// nintendoRom returns a dmg rom with title from licensee.
+func nintendoRom(title string, licensee Byte) []Byte {
+	rom := make([]Byte, 0x8000)
+	copy(rom[0x0134:], []Byte(title))
+	rom[0x014B] = licensee
+	return rom
+}
+
+func TestColorTables(t *testing.T) {
+	if len(colorPalettes) != 30*4 {
+		t.Errorf("%d palette colors", len(colorPalettes))
+	}
+	if len(colorTitleSums) != colorFirstDuplicate+len(colorFourthLetters) ||
+		len(colorTitleCombinations) != len(colorTitleSums) {
+		t.Errorf("%d title sums for %d letters and %d combinations",
+			len(colorTitleSums), len(colorFourthLetters), len(colorTitleCombinations))
+	}
+	for i, cc := range colorCombinations {
+		for _, o := range []int{cc.obj0, cc.obj1, cc.bg} {
+			if o < 0 || o+4 > len(colorPalettes) {
+				t.Errorf("combination %d: offset %d", i, o)
+			}
+		}
+	}
+	for i, c := range colorTitleCombinations {
+		if int(c) >= len(colorCombinations) {
+			t.Errorf("title %d: combination %d", i, c)
+		}
+	}
+}
+
+func TestTitleCombination(t *testing.T) {
+	for _, c := range []struct {
+		title string
+		want  int
+	}{
+		{"", 0},
+		{"ALLEY WAY", 4},
+		{"TETRIS", 3},
+		{"POKEMON RED", 13},
+		{"POKEMON BLUE", 11},
+		{"POKEMON GREEN", 14},
+		{"SUPER MARIOLAND", 22}, // shares its hash with METROID2
+		{"METROID2", 46},
+		{"GOLF", 25},
+		{"KID ICARUS", 24},
+		{"DONKEYKONGLAND", 39},
+		{"JIBI", 0},
+	} {
+		sum, _ := titleHash(nintendoRom(c.title, 0x01))
+		fourth := Byte(0)
+		if len(c.title) > 3 {
+			fourth = Byte(c.title[3])
+		}
+		if got := titleCombination(sum, fourth); got != c.want {
+			t.Errorf("%q (0x%02X): combination %d, not %d", c.title, sum, got, c.want)
+		}
+	}
+	// a shared hash with another 4th letter keeps looking
+	if c := titleCombination(0x61, 'A'); c != 41 {
+		t.Errorf("0x61 A: %d", c)
+	}
+	if c := titleCombination(0x61, 'X'); c != 0 {
+		t.Errorf("0x61 X: %d", c)
+	}
+}
+
+func TestColorize(t *testing.T) {
+	red := [4]Word{0x7FFF, 0x421F, 0x1CF2, 0x0000}
+	green := [4]Word{0x7FFF, 0x1BEF, 0x0200, 0x0000}
+	blue := [4]Word{0x7FFF, 0x7E8C, 0x7C00, 0x0000}
+	orange := [4]Word{0x7FFF, 0x03FF, 0x001F, 0x0000}
+	user := Colorization{Bg: orange, Obj0: orange, Obj1: red}
+	for _, c := range []struct {
+		title    string
+		licensee Byte
+		keys     []Key
+		want     Colorization
+	}{
+		{"POKEMON RED", 0x01, nil, Colorization{red, green, red}},
+		{"POKEMON BLUE", 0x01, nil, Colorization{blue, red, blue}},
+		{"TETRIS", 0x01, nil, Colorization{orange, orange, orange}},
+		{"SUPER MARIOLAND", 0x01, nil, Colorization{
+			[4]Word{0x7ED6, 0x4BFF, 0x2175, 0x0000},
+			[4]Word{0x0000, 0x7FFF, 0x421F, 0x1CF2},
+			[4]Word{0x0000, 0x7FFF, 0x421F, 0x1CF2}}},
+		{"TETRIS", 0x33, nil, Colorization{[4]Word{0x7FFF, 0x1BEF, 0x6180, 0x0000}, red, red}},
+		{"TETRIS", 0x01, []Key{KeyUp, KeyA}, Colorization{red, green, blue}},
+		{"TETRIS", 0x01, []Key{KeyB, KeyRight}, Colorization{
+			[4]Word{0x0000, 0x4200, 0x037F, 0x7FFF},
+			[4]Word{0x0000, 0x4200, 0x037F, 0x7FFF},
+			[4]Word{0x0000, 0x4200, 0x037F, 0x7FFF}}},
+		{"TETRIS", 0x01, []Key{KeyA}, Colorization{orange, orange, orange}},
+		{"JIBI", 0x01, []Key{KeyUp}, user},
+	} {
+		cart, err := NewCartridge(nintendoRom(c.title, c.licensee))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cz := colorize(cart, c.keys, map[string]Colorization{"JIBI": user}); cz != c.want {
+			t.Errorf("%q %v: %04X, not %04X", c.title, c.keys, cz, c.want)
+		}
+	}
+}
+
+func TestParseColorization(t *testing.T) {
+	cz, err := ParseColorization("FFFFFF,#ff0000, 00FF00,0000FF, 000000,000000,000000,000000, 080808,101010,181818,F8F8F8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Colorization{
+		Bg:   [4]Word{0x7FFF, 0x001F, 0x03E0, 0x7C00},
+		Obj1: [4]Word{0x0421, 0x0842, 0x0C63, 0x7FFF},
+	}
+	if cz != want {
+		t.Errorf("%04X", cz)
+	}
+	for _, s := range []string{
+		"",
+		"FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF",
+		"FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF",
+		"FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,GGGGGG",
+		"FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,FFFFFF,1000000",
+	} {
+		if _, err := ParseColorization(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestParseColorKeys(t *testing.T) {
+	for s, want := range map[string][]Key{
+		"left":     {KeyLeft},
+		"up+a":     {KeyUp, KeyA},
+		"b + down": {KeyB, KeyDown},
+	} {
+		keys, err := ParseColorKeys(s)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		if len(keys) != len(want) || keys[0] != want[0] || keys[len(keys)-1] != want[len(want)-1] {
+			t.Errorf("%q: %v", s, keys)
+		}
+	}
+	for _, s := range []string{"", "a", "up+down", "up+a+b", "up+start", "north"} {
+		if _, err := ParseColorKeys(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
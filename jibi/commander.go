@@ -12,19 +12,55 @@ const (
 	CmdNil Command = iota
 
 	CmdUnloadBios
+	CmdSkipBios // set up the machine like the bios leaves it, see Cpu.skipBios
 	CmdSetInterrupt
 	CmdClockAccumulator // accumulating clock
 	CmdOnInstruction    // blocking clock channel that ticks after every instruction
+	CmdOnBreakpoint     // blocking channel that gets a message on every ld b,b
+	CmdOnDebugMessage   // blocking channel that gets the message of every ld d,d
+	CmdProfileStart
+	CmdProfileReport
+	CmdCoverageStart
+	CmdCoverageReport
+	CmdInterruptStats
+	CmdCounters // cycles and instructions executed
+	CmdPoke
+	CmdPatchRom
+	CmdSaveRam // copy of the battery backed ram
+	CmdSaveState
+	CmdLoadState
+	CmdQueueInput
+	CmdPlayMacro
+	CmdSetCheat
+	CmdPeek
+	CmdPeekBytes
+	CmdRegisters
+	CmdSetBreakpoint
+	CmdClearBreakpoint
+	CmdOnStop // blocking channel that gets the registers when a breakpoint or a step stops the cpu
+	CmdContinue
+	CmdStepOne
+	CmdStepBack
+	CmdContinueBack
+	CmdSetWatchpoint
+	CmdOnWatch // blocking channel that gets the accesses that stop the cpu on a watchpoint
 	cmdCPU
 
 	CmdFrameCounter
+	CmdSnapshot   // video memory copy taken after the next frame
+	CmdScreenshot // the next frame as shown on the lcd
+	CmdSetLayers
+	CmdToggleLayers
+	CmdNotify
 	cmdGPU
 
 	CmdKeyDown
 	CmdKeyUp
-	CmdKeyCheck
 	cmdKEYPAD
 
+	CmdChannels // recent output and state of the sound channels
+	cmdAPU
+
 	CmdCmdCounter  // a clock that outputs number of commands processed
 	CmdLoopCounter // a clock that outputs number of loops run
 	CmdString
@@ -40,24 +76,94 @@ func (c Command) String() string {
 		return "CmdNil"
 	case CmdUnloadBios:
 		return "CmdUnloadBios"
+	case CmdSkipBios:
+		return "CmdSkipBios"
 	case CmdClockAccumulator:
 		return "CmdClockAccumulator"
 	case CmdOnInstruction:
 		return "CmdOnInstruction"
+	case CmdOnBreakpoint:
+		return "CmdOnBreakpoint"
+	case CmdOnDebugMessage:
+		return "CmdOnDebugMessage"
+	case CmdProfileStart:
+		return "CmdProfileStart"
+	case CmdProfileReport:
+		return "CmdProfileReport"
+	case CmdCoverageStart:
+		return "CmdCoverageStart"
+	case CmdCoverageReport:
+		return "CmdCoverageReport"
+	case CmdInterruptStats:
+		return "CmdInterruptStats"
+	case CmdCounters:
+		return "CmdCounters"
+	case CmdPoke:
+		return "CmdPoke"
+	case CmdPatchRom:
+		return "CmdPatchRom"
+	case CmdSaveRam:
+		return "CmdSaveRam"
+	case CmdSaveState:
+		return "CmdSaveState"
+	case CmdLoadState:
+		return "CmdLoadState"
+	case CmdQueueInput:
+		return "CmdQueueInput"
+	case CmdPlayMacro:
+		return "CmdPlayMacro"
+	case CmdSetCheat:
+		return "CmdSetCheat"
+	case CmdPeek:
+		return "CmdPeek"
+	case CmdPeekBytes:
+		return "CmdPeekBytes"
+	case CmdRegisters:
+		return "CmdRegisters"
+	case CmdSetBreakpoint:
+		return "CmdSetBreakpoint"
+	case CmdClearBreakpoint:
+		return "CmdClearBreakpoint"
+	case CmdOnStop:
+		return "CmdOnStop"
+	case CmdContinue:
+		return "CmdContinue"
+	case CmdStepOne:
+		return "CmdStepOne"
+	case CmdStepBack:
+		return "CmdStepBack"
+	case CmdContinueBack:
+		return "CmdContinueBack"
+	case CmdSetWatchpoint:
+		return "CmdSetWatchpoint"
+	case CmdOnWatch:
+		return "CmdOnWatch"
 	case cmdCPU:
 		return "cmdCPU"
 	case CmdFrameCounter:
 		return "CmdFrameCounter"
+	case CmdSnapshot:
+		return "CmdSnapshot"
+	case CmdScreenshot:
+		return "CmdScreenshot"
+	case CmdSetLayers:
+		return "CmdSetLayers"
+	case CmdToggleLayers:
+		return "CmdToggleLayers"
+	case CmdNotify:
+		return "CmdNotify"
 	case cmdGPU:
 		return "cmdGPU"
 	case CmdKeyDown:
 		return "CmdKeyDown"
 	case CmdKeyUp:
 		return "CmdKeyUp"
-	case CmdKeyCheck:
-		return "CmdKeyCheck"
 	case cmdKEYPAD:
 		return "cmdKEYPAD"
+	case CmdChannels:
+		return "CmdChannels"
+	case cmdAPU:
+		return "cmdAPU"
 	case CmdCmdCounter:
 		return "CmdCmdCounter"
 	case CmdLoopCounter:
@@ -76,10 +182,12 @@ func (c Command) String() string {
 	return fmt.Sprintf("CmdUNKNOWN-%d", int(c))
 }
 
-// A CommandResponse holds a command and response data (usually a channel).
+// A CommandResponse holds a command and response data (usually a channel),
+// and the Commander that handles it.
 type CommandResponse struct {
 	cmd  Command
 	resp interface{}
+	to   *Commander
 }
 
 // A CommanderStateFn is a chained state function that returns the next state.
@@ -90,9 +198,11 @@ type CommanderStateFn func(bool, uint32) (CommanderStateFn, bool, uint32, uint32
 type CommanderInterface interface {
 	RunCommand(Command, interface{})
 	start(CommanderStateFn, map[Command]CommandFn, chan ClockType)
+	attach(string, map[Command]CommandFn) CommanderInterface
 	yield()
 	play()
 	pause()
+	isPlaying() bool
 }
 
 // A Commander handles an event loop in a goroutine that processes and
@@ -105,17 +215,26 @@ type Commander struct {
 	playing      bool
 	running      bool
 	handlerFns   map[Command]CommandFn
+	parent       *Commander // runs the loop of an attached Commander
 }
 
 // NewCommander returns a new named Commander object.
 func NewCommander(name string) *Commander {
 	c := &Commander{name,
 		make(chan CommandResponse, 1024), // HACK
-		nil, nil, false, false, nil,
+		nil, nil, false, false, nil, nil,
 	}
 	return c
 }
 
+// attach returns a Commander for a component that runs on the goroutine of
+// c instead of its own. Its commands are queued with those of c and handled
+// between two states of c, it has no loop or states itself and playing only
+// tells the component whether to run when c clocks it.
+func (c *Commander) attach(name string, handlerFns map[Command]CommandFn) CommanderInterface {
+	return &Commander{name: name, c: c.c, running: true, handlerFns: handlerFns, parent: c}
+}
+
 // start creates the goroutine.
 func (c *Commander) start(state CommanderStateFn, handlerFns map[Command]CommandFn, clk chan ClockType) {
 	c.handlerFns = handlerFns
@@ -130,7 +249,7 @@ func (c *Commander) yield() {
 
 // RunCommand queues the given command for processing.
 func (c *Commander) RunCommand(cmd Command, resp interface{}) {
-	c.c <- CommandResponse{cmd, resp}
+	c.c <- CommandResponse{cmd, resp, c}
 }
 
 func (c *Commander) String() string {
@@ -161,7 +280,7 @@ func (c *Commander) loopCommander(state CommanderStateFn, clk chan ClockType) {
 	var cmdr CommandResponse
 	to := ClockType(0)
 	for c.running {
-		cmdr.cmd = CmdNil
+		cmdr = CommandResponse{}
 		for _, clk := range c.loopCounters {
 			clk.AddCycles(1)
 		}
@@ -198,7 +317,7 @@ func (c *Commander) processCommands() {
 	var cmdr CommandResponse
 
 	for loop := true; loop; {
-		cmdr.cmd = CmdNil
+		cmdr = CommandResponse{}
 		select {
 		case cmdr = <-c.c:
 		default:
@@ -209,6 +328,10 @@ func (c *Commander) processCommands() {
 }
 
 func (c *Commander) processCommand(cmdr CommandResponse) {
+	if cmdr.to != nil && cmdr.to != c {
+		cmdr.to.processCommand(cmdr)
+		return
+	}
 	if cmdr.cmd != CmdNil {
 		for _, clk := range c.cmdCounters {
 			clk.AddCycles(1)
@@ -252,7 +375,12 @@ func (c *Commander) cmdLoopCounter(resp interface{}) {
 		panic("invalid command response type")
 	} else {
 		clk := make(chan ClockType, 1)
-		c.loopCounters = append(c.loopCounters, NewClock(clk))
+		// an attached commander runs in the loop of its parent
+		loop := c
+		if c.parent != nil {
+			loop = c.parent
+		}
+		loop.loopCounters = append(loop.loopCounters, NewClock(clk))
 		resp <- clk
 	}
 }
@@ -264,3 +392,33 @@ func (c *Commander) play() {
 func (c *Commander) pause() {
 	c.playing = false
 }
+
+func (c *Commander) isPlaying() bool {
+	return c.playing
+}
+
+// A stateClock runs a chain of CommanderStateFn off the cycles it is handed,
+// the way a Commander runs one off its clock, for components clocked by the
+// scheduler on its goroutine.
+type stateClock struct {
+	state    CommanderStateFn
+	first    bool
+	t, tnext uint32
+}
+
+func newStateClock(state CommanderStateFn) stateClock {
+	return stateClock{state: state, first: true}
+}
+
+// run adds t cycles and runs states for as long as there are cycles enough.
+func (s *stateClock) run(t uint32) {
+	s.t += t
+	for s.first || s.t >= s.tnext {
+		s.state, s.first, s.t, s.tnext = s.state(s.first, s.t)
+	}
+}
+
+// restart continues from the start of state, dropping the state it was in.
+func (s *stateClock) restart(state CommanderStateFn) {
+	*s = newStateClock(state)
+}
@@ -206,7 +206,7 @@ func TestCall(t *testing.T) {
 	}
 	w := BytesToWord(cpu.readByte(cpu.sp.Word()+1), cpu.readByte(cpu.sp.Word()))
 	if w != Word(0x0003) {
-		t.Errorf(fmt.Sprintf("0x%04X", w))
+		t.Errorf("0x%04X", w)
 	}
 }
 
@@ -242,7 +242,7 @@ func TestPush(t *testing.T) {
 	}
 	w := BytesToWord(cpu.readByte(cpu.sp.Word()+1), cpu.readByte(cpu.sp.Word()))
 	if w != Word(0x6004) {
-		t.Errorf(fmt.Sprintf("0x%04X", w))
+		t.Errorf("0x%04X", w)
 	}
 }
 
@@ -259,7 +259,7 @@ func TestPop(t *testing.T) {
 		t.Error()
 	}
 	if cpu.b.Word() != Word(0x2003) {
-		t.Errorf(fmt.Sprintf("0x%04X", cpu.b.Word()))
+		t.Errorf("0x%04X", cpu.b.Word())
 	}
 }
 
@@ -1035,3 +1035,17 @@ func TestDec16(t *testing.T) {
 		t.Error()
 	}
 }
+
+func TestSoftBreak(t *testing.T) {
+	cpu := NewCpu(newTestMmu(), []Byte{0x40, 0x18, 0x07, 0x64, 0x64, 0x00, 0x00,
+		'h', 'e', 'y'})
+	defer cpu.RunCommand(CmdStop, nil)
+
+	resp := make(chan chan string)
+	cpu.RunCommand(CmdOnBreakpoint, resp)
+	brk := <-resp
+	cpu.RunCommand(CmdPlay, nil)
+	if s := <-brk; s != "breakpoint at 0x0000: hey" {
+		t.Error(s)
+	}
+}
@@ -0,0 +1,128 @@
+package jibi
+
+import (
+	"fmt"
+	"sort"
+)
+
+// OpcodeCoverage counts the times each opcode was executed, Base by the
+// opcode and Cb by the byte after the 0xCB prefix. Coverage from several
+// runs, a test rom corpus say, is combined with Add.
+type OpcodeCoverage struct {
+	Base [256]uint64
+	Cb   [256]uint64
+}
+
+func (c *OpcodeCoverage) count(o opcode) {
+	if o&0xFF00 == 0xCB00 {
+		c.Cb[o&0xFF]++
+	} else {
+		c.Base[o&0xFF]++
+	}
+}
+
+// Add adds the counts of o to c.
+func (c *OpcodeCoverage) Add(o OpcodeCoverage) {
+	for i := range c.Base {
+		c.Base[i] += o.Base[i]
+		c.Cb[i] += o.Cb[i]
+	}
+}
+
+// executions returns the times o was executed.
+func (c *OpcodeCoverage) executions(o opcode) uint64 {
+	if o&0xFF00 == 0xCB00 {
+		return c.Cb[o&0xFF]
+	}
+	return c.Base[o&0xFF]
+}
+
+// legalOpcodes returns every sm83 opcode, the cb prefix itself and the
+// opcodes that lock up the cpu are left out.
+func legalOpcodes() []opcode {
+	ops := []opcode{}
+	for i := 0; i < 0x100; i++ {
+		if i == 0xCB || sm83Ops[i].length == 0 {
+			continue
+		}
+		ops = append(ops, opcode(i))
+	}
+	for i := 0; i < 0x100; i++ {
+		ops = append(ops, opcode(0xCB00+i))
+	}
+	return ops
+}
+
+func implemented(o opcode) bool {
+	return opcodeFuncs[o] != nil
+}
+
+// FormatCoverage returns a report of cov against the full sm83 set. Opcodes
+// that were executed but are not implemented come first, most executed
+// first, as those are the ones games need. Then the implemented opcodes that
+// were never executed, which are untested by the run.
+func FormatCoverage(cov OpcodeCoverage) string {
+	var executed, impl, missing, unused []opcode
+	for _, o := range legalOpcodes() {
+		n := cov.executions(o)
+		if n > 0 {
+			executed = append(executed, o)
+		}
+		if implemented(o) {
+			impl = append(impl, o)
+			if n == 0 {
+				unused = append(unused, o)
+			}
+		} else if n > 0 {
+			missing = append(missing, o)
+		}
+	}
+	total := len(legalOpcodes())
+	sort.Stable(opcodesByExecutions{missing, &cov})
+
+	s := fmt.Sprintf("executed %d/%d opcodes (%.1f%%), implemented %d/%d (%.1f%%)\n",
+		len(executed), total, 100*float64(len(executed))/float64(total),
+		len(impl), total, 100*float64(len(impl))/float64(total))
+	s += fmt.Sprintf("executed but not implemented: %d\n", len(missing))
+	for _, o := range missing {
+		s += fmt.Sprintf("  %s %12d\n", opcodeName(o), cov.executions(o))
+	}
+	s += fmt.Sprintf("implemented but not executed: %d\n", len(unused))
+	for _, o := range unused {
+		s += fmt.Sprintf("  %s %s\n", opcodeName(o), o)
+	}
+	return s
+}
+
+// opcodeName returns the opcode bytes of o, as 0x00 or 0xCB00.
+func opcodeName(o opcode) string {
+	if o&0xFF00 == 0xCB00 {
+		return fmt.Sprintf("0x%04X", uint16(o))
+	}
+	return fmt.Sprintf("0x%02X  ", uint16(o))
+}
+
+type opcodesByExecutions struct {
+	ops []opcode
+	cov *OpcodeCoverage
+}
+
+func (o opcodesByExecutions) Len() int      { return len(o.ops) }
+func (o opcodesByExecutions) Swap(i, j int) { o.ops[i], o.ops[j] = o.ops[j], o.ops[i] }
+func (o opcodesByExecutions) Less(i, j int) bool {
+	return o.cov.executions(o.ops[i]) > o.cov.executions(o.ops[j])
+}
+
+func (c *Cpu) cmdCoverageStart(resp interface{}) {
+	c.cov = &OpcodeCoverage{}
+}
+
+func (c *Cpu) cmdCoverageReport(resp interface{}) {
+	if resp, ok := resp.(chan OpcodeCoverage); !ok {
+		panic("invalid command response type")
+	} else if c.cov == nil {
+		resp <- OpcodeCoverage{}
+	} else {
+		resp <- *c.cov
+	}
+}
@@ -0,0 +1,33 @@
+package jibi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOpcodeCoverage(t *testing.T) {
+	if n := len(legalOpcodes()); n != 500 {
+		t.Errorf("%d legal opcodes", n)
+	}
+
+	var cov, run OpcodeCoverage
+	run.count(0x00)
+	run.count(0x19) // not implemented
+	run.count(0xCB7C)
+	cov.Add(run)
+	cov.Add(run)
+	if cov.Base[0x00] != 2 || cov.Base[0x19] != 2 || cov.Cb[0x7C] != 2 {
+		t.Fatalf("%v %v", cov.Base[:0x20], cov.Cb[0x7C])
+	}
+
+	s := FormatCoverage(cov)
+	if !strings.HasPrefix(s, "executed 3/500 opcodes") {
+		t.Error(s)
+	}
+	if !strings.Contains(s, "executed but not implemented: 1\n  0x19              2\n") {
+		t.Error(s)
+	}
+	if strings.Contains(s, "  0x00   NOP\n") || !strings.Contains(s, "  0x01   LD BC, d16\n") {
+		t.Error(s)
+	}
+}
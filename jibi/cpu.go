@@ -2,6 +2,7 @@ package jibi
 
 import (
 	"fmt"
+	"io"
 	"time"
 )
 
@@ -11,15 +12,15 @@ import (
 type Cpu struct {
 	CommanderInterface
 
-	// registers
-	a  register8
-	b  register8
-	c  register8
-	d  register8
-	e  register8
-	f  register8 // 8 bits, but lower 4 bits always read zero
-	h  register8
-	l  register8
+	// registers, pointers so they are passed as a Byter without allocating
+	a  *register8
+	b  *register8
+	c  *register8
+	d  *register8
+	e  *register8
+	f  *register8 // 8 bits, but lower 4 bits always read zero
+	h  *register8
+	l  *register8
 	sp register16
 	pc register16
 
@@ -28,23 +29,79 @@ type Cpu struct {
 	m       uint8    // machine cycles
 	t       uint8    // clock cycles
 	div     Word
+	tac     Byte   // TAC the timer last ran with
+	divW    bool   // DIV was written by the instruction
+	cycles  uint64 // clock cycles since power on
+	timed   bool   // memory accesses run the clock, see tick
+	ticked  uint8  // clock cycles of the instruction already run
+
+	instructions uint64 // executed since power on
+
+	// c.step, bound once as method values allocate
+	stepFn CommanderStateFn
 
 	// current instruction buffer
-	inst instruction
+	inst     instruction
+	branched bool // inst met its condition, see command.taken
 
 	// interrupt master enable
 	ime Bit
+	ei  uint8 // instructions until EI sets ime, counting its own
+
+	halted  bool // HALT waits for an interrupt
+	locked  bool // an illegal opcode stopped the cpu for good
+	haltBug bool // the next fetch does not advance pc
+	pending bool // an enabled interrupt was requested this step
+	vblank  bool // the vblank interrupt was requested last step
+
+	mmu Mmu
+	bus Bus // the cpu view of mmu
 
-	mmu     Mmu
-	mmuKeys AddressKeys
+	// components the cpu clocks on its goroutine, see schedule
+	clocked []clocked
 
 	// internal state
 	bios         []Byte
 	biosFinished bool
-	tima         timer
+	sio          serialClock
+	dma          oamDma
+	link         SerialDevice
 
 	// notifications
-	notifyInst []chan string
+	notifyInst  []chan string
+	notifyBreak []chan string
+	notifyPrint []chan string
+	notifyStop  []chan Registers
+	notifyWatch []chan Watch
+
+	// pc breakpoints, resume runs the instruction at pc even if it has one
+	breakpoints map[Word]bool
+	resume      bool
+
+	// snapshots to step backwards, nil without Options.Rewind, and the
+	// replay that sees every instruction start while one runs
+	rewind   *rewind
+	replayAt func() bool
+
+	// accesses to watched memory, nil without watchpoints
+	watches *watchHits
+
+	events *eventBus
+
+	prof *profiler
+	cov  *OpcodeCoverage
+	irqs *irqStats
+
+	// scheduled input, applied through kp
+	inputs []InputEvent
+	kp     *Keypad
+
+	// enabled cheats
+	cheats []Cheat
+
+	log    componentLog
+	strict bool      // panic on instructions that are not verified
+	trace  io.Writer // a line per instruction, see Options.Trace
 
 	// cpu information
 	hz     float64
@@ -61,53 +118,83 @@ func NewCpu(mmu Mmu, bios []Byte) *Cpu {
 	period := time.Duration(1e9 / hz)
 
 	f := newFlagsRegister8()
-	a := newRegister8(&f)
+	a := newRegister8(f)
 	c := newRegister8(nil)
-	b := newRegister8(&c)
+	b := newRegister8(c)
 	e := newRegister8(nil)
-	d := newRegister8(&e)
+	d := newRegister8(e)
 	l := newRegister8(nil)
-	h := newRegister8(&l)
+	h := newRegister8(l)
 
 	biosFinished := true
 	if len(bios) > 0 {
 		biosFinished = false
-		biosN := make([]Byte, 0x100)
+		size := biosSizeDmg
+		if len(bios) > biosSizeDmg {
+			size = biosSizeCgb
+		}
+		biosN := make([]Byte, size)
 		copy(biosN, bios)
 		bios = biosN
 	}
 
-	mmuKeys := AddressKeys(0)
-	mmuKeys = mmu.LockAddr(AddrRom, mmuKeys)
-	mmuKeys = mmu.LockAddr(AddrRam, mmuKeys)
-	mmuKeys = mmu.LockAddr(AddrIF, mmuKeys)
-	mmuKeys = mmu.LockAddr(AddrDIV, mmuKeys)
-	mmuKeys = mmu.LockAddr(AddrTIMA, mmuKeys)
-	mmuKeys = mmu.LockAddr(AddrTMA, mmuKeys)
-	mmuKeys = mmu.LockAddr(AddrTAC, mmuKeys)
-	mmuKeys = mmu.LockAddr(AddrZero, mmuKeys)
-	mmuKeys = mmu.LockAddr(AddrIE, mmuKeys)
-
 	commander := NewCommander("cpu")
 	cpu := &Cpu{CommanderInterface: commander,
 		a: a, b: b, c: c, d: d, e: e, f: f, l: l, h: h,
 		ime:          Bit(1),
 		mmu:          mmu,
-		mmuKeys:      mmuKeys,
+		bus:          mmu,
 		bios:         bios,
 		biosFinished: biosFinished,
+		link:         noSerial{},
+		irqs:         newIrqStats(),
 		hz:           hz, period: period,
 	}
 	cmdHandlers := map[Command]CommandFn{
+		CmdUnloadBios:       cpu.cmdUnloadBios,
+		CmdSkipBios:         cpu.cmdSkipBios,
 		CmdClockAccumulator: cpu.cmdClock,
 		CmdString:           cpu.cmdString,
 		CmdOnInstruction:    cpu.cmdOnInstruction,
+		CmdOnBreakpoint:     cpu.cmdOnBreakpoint,
+		CmdOnDebugMessage:   cpu.cmdOnDebugMessage,
+		CmdProfileStart:     cpu.cmdProfileStart,
+		CmdProfileReport:    cpu.cmdProfileReport,
+		CmdCoverageStart:    cpu.cmdCoverageStart,
+		CmdCoverageReport:   cpu.cmdCoverageReport,
+		CmdInterruptStats:   cpu.cmdInterruptStats,
+		CmdCounters:         cpu.cmdCounters,
+		CmdPoke:             cpu.cmdPoke,
+		CmdPatchRom:         cpu.cmdPatchRom,
+		CmdSaveRam:          cpu.cmdSaveRam,
+		CmdSaveState:        cpu.cmdSaveState,
+		CmdLoadState:        cpu.cmdLoadState,
+		CmdQueueInput:       cpu.cmdQueueInput,
+		CmdPlayMacro:        cpu.cmdPlayMacro,
+		CmdSetCheat:         cpu.cmdSetCheat,
+		CmdPeek:             cpu.cmdPeek,
+		CmdPeekBytes:        cpu.cmdPeekBytes,
+		CmdRegisters:        cpu.cmdRegisters,
+		CmdSetBreakpoint:    cpu.cmdSetBreakpoint,
+		CmdClearBreakpoint:  cpu.cmdClearBreakpoint,
+		CmdOnStop:           cpu.cmdOnStop,
+		CmdContinue:         cpu.cmdContinue,
+		CmdStepOne:          cpu.cmdStepOne,
+		CmdStepBack:         cpu.cmdStepBack,
+		CmdContinueBack:     cpu.cmdContinueBack,
+		CmdSetWatchpoint:    cpu.cmdSetWatchpoint,
+		CmdOnWatch:          cpu.cmdOnWatch,
 	}
 
-	commander.start(cpu.step, cmdHandlers, nil)
+	cpu.stepFn = cpu.step
+	commander.start(cpu.stepFn, cmdHandlers, nil)
 	return cpu
 }
 
+func (c *Cpu) cmdUnloadBios(resp interface{}) {
+	c.biosFinished = true
+}
+
 func (c *Cpu) cmdClock(resp interface{}) {
 	if resp, ok := resp.(chan chan ClockType); !ok {
 		panic("invalid command response type")
@@ -150,56 +237,124 @@ func (c *Cpu) String() string {
 	return <-resp
 }
 
-func (c *Cpu) lockAddr(addr Worder) {
-	c.mmuKeys = c.mmu.LockAddr(addr, c.mmuKeys)
+// A clocked component is handed the cycles the cpu ran after every step.
+type clocked interface {
+	clock(t uint32)
 }
 
-func (c *Cpu) unlockAddr(addr Worder) {
-	c.mmuKeys = c.mmu.UnlockAddr(addr, c.mmuKeys)
+// schedule attaches a component to the commander of the cpu, which is the
+// single scheduler of the machine: the commands of the component run on the
+// cpu goroutine between two steps and d, when not nil, is clocked after each
+// of them.
+func (c *Cpu) schedule(name string, handlerFns map[Command]CommandFn, d clocked) CommanderInterface {
+	if d != nil {
+		c.clocked = append(c.clocked, d)
+	}
+	return c.attach(name, handlerFns)
+}
+
+// inBios returns true if the address is currently overlayed by the bios.
+func (c *Cpu) inBios(a Word) bool {
+	if c.biosFinished {
+		return false
+	}
+	if a < biosSizeDmg {
+		return true
+	}
+	return len(c.bios) == biosSizeCgb && 0x0200 <= a && a < biosSizeCgb
 }
 
-func (c *Cpu) readByte(addr Worder) Byte {
-	a := addr.Word()
-	if !c.biosFinished && a <= 0xFF {
+// readByte takes a plain address, as a Worder holding one would have to be
+// allocated.
+func (c *Cpu) readByte(a Word) Byte {
+	c.tick()
+	if !c.inBios(a) && (c.oamDmaBlocked(a) || c.modeBlocked(a)) {
+		return 0xFF
+	}
+	return c.peekByte(a)
+}
+
+func (c *Cpu) writeByte(a Word, b Byter) {
+	c.tick()
+	if c.oamDmaBlocked(a) || c.modeBlocked(a) {
+		return
+	}
+	c.pokeByte(a, b.Byte())
+}
+
+// peekByte reads a like the cpu does, bios included, but without taking a
+// machine cycle and without the gpu or the oam dma shutting it out. It is
+// for debuggers and the embedder, which look at memory between two
+// instructions.
+func (c *Cpu) peekByte(a Word) Byte {
+	if c.inBios(a) {
 		return c.bios[a]
 	}
-	if AddrVRam <= a && a <= AddrRam {
-		c.lockAddr(AddrVRam)
-		defer c.unlockAddr(AddrVRam)
-	} else if AddrOam <= a && a <= AddrOamEnd {
-		c.lockAddr(AddrOam)
-		defer c.unlockAddr(AddrOam)
-	} else if AddrGpuRegs <= a && a <= AddrGpuRegsEnd {
-		c.lockAddr(AddrGpuRegs)
-		defer c.unlockAddr(AddrGpuRegs)
+	return c.bus.Read(a)
+}
+
+// pokeByte writes a like the cpu does, with the side effects of the io
+// registers the cpu handles, but like peekByte untimed and never shut out.
+func (c *Cpu) pokeByte(a Word, b Byte) {
+	if a == AddrBOOT && b != 0 {
+		// any non zero write unmaps the bios until reset
+		c.biosFinished = true
 	}
-	return c.mmu.ReadByteAt(addr, c.mmuKeys)
+	if a == AddrDIV {
+		c.divW = true
+	}
+	if a == AddrDMA {
+		c.startDma(b)
+	}
+	c.bus.Write(a, b)
 }
 
-func (c *Cpu) writeByte(addr Worder, b Byter) {
-	a := addr.Word()
-	if AddrVRam <= a && a <= AddrRam {
-		c.lockAddr(AddrVRam)
-		defer c.unlockAddr(AddrVRam)
-	} else if AddrOam <= a && a <= AddrOamEnd {
-		c.lockAddr(AddrOam)
-		defer c.unlockAddr(AddrOam)
-	} else if AddrGpuRegs <= a && a <= AddrGpuRegsEnd {
-		c.lockAddr(AddrGpuRegs)
-		defer c.unlockAddr(AddrGpuRegs)
+// modeBlocked returns whether the gpu shuts the cpu out of address a in the
+// lcd mode STAT shows, vram while it draws in mode 3 and oam while it scans
+// or draws in modes 2 and 3. Reads see 0xFF and writes are dropped. With the
+// lcd off STAT shows mode 0 and nothing is blocked.
+func (c *Cpu) modeBlocked(a Word) bool {
+	vram := AddrVRam <= a && a < AddrERam
+	if !vram && (a < AddrOam || a >= AddrOamEnd) {
+		return false
 	}
-	c.mmu.WriteByteAt(addr, b, c.mmuKeys)
+	mode := c.bus.Read(AddrSTAT) & 0x03
+	return mode == LcdModeVRam || !vram && mode == LcdModeOam
 }
 
-func (c *Cpu) readWord(addr Worder) Word {
+func (c *Cpu) readWord(addr Word) Word {
 	l := c.readByte(addr)
-	h := c.readByte(addr.Word() + 1)
+	h := c.readByte(addr + 1)
 	return BytesToWord(h, l)
 }
 
-func (c *Cpu) writeWord(addr Worder, w Worder) {
+func (c *Cpu) writeWord(addr Word, w Word) {
 	c.writeByte(addr, w.Low())
-	c.writeByte(addr.Word()+1, w.High())
+	c.writeByte(addr+1, w.High())
+}
+
+// tick runs the timer, the serial port and the oam dma through the machine
+// cycle of a memory access the instruction makes, so they see the access on
+// the cycle it happens. It does nothing outside of fetch and execute, where
+// the cpu and the components themselves read io registers.
+func (c *Cpu) tick() {
+	if !c.timed {
+		return
+	}
+	c.timed = false
+	c.clock(4)
+	c.timed = true
+	c.ticked += 4
+}
+
+// clock runs the components that follow the cpu clock for t clock cycles.
+func (c *Cpu) clock(t uint8) {
+	c.timers(t) // handle tima, tma, tac
+	c.serial(t) // handle sb, sc
+	c.runDma(t) // handle oam dma
+	for _, d := range c.clocked {
+		d.clock(uint32(t)) // gpu, apu
+	}
 }
 
 // Clock returns a new channel that holds acumulating clock ticks.
@@ -210,33 +365,68 @@ func (c *Cpu) Clock() chan ClockType {
 }
 
 func (c *Cpu) fetch() {
-	op := opcode(c.readByte(c.pc))
-	c.pc++
+	op := opcode(c.readByte(c.pc.Word()))
+	if c.haltBug {
+		c.haltBug = false // the byte after HALT is read twice
+	} else {
+		c.pc++
+	}
 	if op == 0xCB {
-		op = opcode(0xCB00 + uint16(c.readByte(c.pc)))
+		op = opcode(0xCB00 + uint16(c.readByte(c.pc.Word())))
 		c.pc++
 	}
 	command := commandTable[op]
-	p := []Byte{}
+	c.inst = instruction{o: op, n: command.b}
 	for i := uint8(0); i < command.b; i++ {
-		p = append(p, c.readByte(c.pc))
+		c.inst.p[i] = c.readByte(c.pc.Word())
 		c.pc++
 	}
-	c.inst = newInstruction(op, p...)
 }
 
 func (c *Cpu) execute() {
-	if cmd, ok := commandTable[c.inst.o]; ok {
+	if cmd := commandTable[c.inst.o]; cmd.f != nil {
+		c.branched = false
 		cmd.f(c)
-		c.t += cmd.t
-		c.m += cmd.t * 4
+		t := cmd.t
+		if c.branched {
+			t += cmd.taken
+		}
+		c.t += t
+		c.m += t * 4
 	}
 }
 
+// halt stops fetching until an interrupt is pending. With ime 0 and an
+// interrupt already pending it does not halt, and instead the byte after it
+// is read twice, the halt bug. Right after EI the interrupt is dispatched
+// instead, and returns to the HALT.
+func (c *Cpu) halt() {
+	if c.ime == 0 && c.pending {
+		if c.ei > 0 {
+			c.pc--
+			return
+		}
+		c.haltBug = true
+		return
+	}
+	c.halted = true
+}
+
+// lockUp stops the cpu on an illegal opcode, the opcodes missing from the
+// sm83 set. Like the hardware it runs nothing more, not even interrupts,
+// while the clock and the rest of the machine carry on. In strict mode it
+// panics instead.
+func (c *Cpu) lockUp() {
+	if c.strict {
+		panic(fmt.Sprintf("illegal opcode 0x%02X at 0x%04X", uint16(c.inst.o), uint16(c.pc.Word()-1)))
+	}
+	c.log.Error("illegal opcode, cpu locked up", "state", c.str())
+	c.locked = true
+}
+
 // setInterrupt sets the specific interrupt.
 func (cpu *Cpu) setInterrupt(in Interrupt) {
-	iflags := cpu.mmu.ReadByteAt(AddrIF, 0)
-	cpu.mmu.WriteByteAt(AddrIF, iflags|Byte(in), 0)
+	cpu.mmu.SetInterrupt(in)
 }
 
 // resetInterrupt resets the specific interrupt.
@@ -262,117 +452,162 @@ func (cpu *Cpu) getInterrupt(ie, iflag Byte) Interrupt {
 }
 
 func (cpu *Cpu) io() {
-	iflag, _ := cpu.mmu.ReadIoByte(AddrIF, cpu.mmuKeys)
+	raw := cpu.mmu.Hardware().Read(AddrIF)
+	ie := cpu.readByte(AddrIE)
+	if cpu.halted && raw&ie&0x1F != 0 {
+		cpu.halted = false // an enabled interrupt is pending, even with ime 0
+	}
+	cpu.pending = raw&ie&0x1F != 0
+	if vblank := raw&Byte(InterruptVblank) != 0; vblank != cpu.vblank {
+		cpu.vblank = vblank
+		if vblank && len(cpu.cheats) > 0 {
+			cpu.ramCheats()
+		}
+	}
+	// requests stay in IF while ime is 0, to be dispatched once EI sets it
+	iflag := raw
 	if cpu.ime == 0 {
 		iflag = 0 // mask all interrupts
 	} else {
-		ie := cpu.readByte(AddrIE)
 		iflag &= ie // mask interrupts
 	}
-	cpu.writeByte(AddrIF, iflag)
+	cpu.irqs.flags(raw, iflag, cpu.cycles)
 }
 
+// interrupt dispatches the highest priority pending interrupt. Dispatch
+// takes 5 machine cycles, 2 waiting, 2 pushing pc high byte first and one
+// jumping to the vector, run like the cycles of an instruction.
+//
+// The interrupt is picked again after the high byte is pushed. When that
+// push lands on IE, sp at 0x0000, and leaves nothing to dispatch, the cpu
+// jumps to 0x0000 instead and IF is left alone.
 func (cpu *Cpu) interrupt() {
-	if cpu.ime == 1 {
+	if cpu.ime == 1 && !cpu.locked {
 		ie := cpu.readByte(AddrIE)
 		iflag := cpu.readByte(AddrIF)
 		in := cpu.getInterrupt(ie, iflag)
 		if in > 0 {
 			cpu.ime = 0
-			cpu.push(cpu.pc)
+			cpu.haltBug = false // the vector is fetched as usual
+			cpu.timed = true
+			cpu.tick()
+			cpu.tick()
+			cpu.sp--
+			cpu.writeByte(cpu.sp.Word(), cpu.pc.High())
+			iflag = cpu.bus.Read(AddrIF)
+			in = cpu.getInterrupt(cpu.bus.Read(AddrIE), iflag)
+			cpu.sp--
+			cpu.writeByte(cpu.sp.Word(), cpu.pc.Low())
+			cpu.tick()
+			cpu.timed = false
+			cpu.t = cpu.ticked
+			if in == 0 {
+				cpu.jp(Word(0x0000))
+				return
+			}
 			cpu.jp(in.Address())
 			cpu.resetInterrupt(in, iflag)
-		}
-	}
-}
-
-type timer struct {
-	v       Byte
-	div     uint16
-	running bool
-}
-
-func newTimer() *timer {
-	return &timer{}
-}
-
-func (t *timer) run(c uint8, f Byte, tma Byte) (Byte, bool) {
-	overflow := false
-
-	tmaBit := uint16(1)
-	if tma == 0x00 {
-		tmaBit = 0x0400 // 10th bit
-	} else if tma == 0x01 {
-		tmaBit = 0x0010 // 4th bit
-	} else if tma == 0x02 {
-		tmaBit = 0x0040 // 6th bit
-	} else if tma == 0x03 {
-		tmaBit = 0x0100 // 8th bit
-	}
-
-	p := t.div & tmaBit
-	t.div += uint16(c)
-	if p == 0 { // previously 0
-		if t.div&tmaBit == tmaBit { // now 1
-			t.v += 1
-			if t.v == 0 {
-				overflow = true
+			cpu.irqs.dispatch(in, cpu.sp.Word(), cpu.cycles)
+			if cpu.prof != nil {
+				cpu.prof.call(0, in.Address().Word(), cpu.sp.Word())
 			}
 		}
 	}
-
-	return t.v, overflow
-}
-
-func (t *timer) stop() {
-	t.v = 0
-	t.div = 0
-	t.running = false
-}
-
-func (cpu *Cpu) timers() {
-	// update divider
-	div := cpu.readByte(AddrDIV)
-	cpu.div = (cpu.div & 0x00FF) | (Word(div) << 8)
-	cpu.div += Word(cpu.t)
-	div = Byte(cpu.div >> 8)
-	cpu.mmu.WriteByteAt(AddrDIV, div, cpu.mmuKeys|AddressKeys(abElevated))
-
-	// update timer
-	tac := cpu.readByte(AddrTAC)
-	if tac&0x04 == 0x00 {
-		cpu.tima.stop()
-		return
-	}
-	tima := cpu.readByte(AddrTIMA)
-	tma := cpu.readByte(AddrTMA)
-
-	tima, interrupt := cpu.tima.run(cpu.t, tac&0x03, tma)
-	if interrupt {
-		cpu.setInterrupt(InterruptTimer)
-	}
-	cpu.writeByte(AddrTIMA, tima)
 }
 
 func (c *Cpu) step(first bool, t uint32) (CommanderStateFn, bool, uint32, uint32) {
 	// reset clocks
 	c.m = 0
 	c.t = 0
-	if !c.biosFinished && c.pc == 0x0100 {
-		c.biosFinished = true
-	}
 	for _, inst := range c.notifyInst {
 		inst <- c.str()
 	}
 
+	c.applyInputs()
 	c.io()        // handle memory mapped io
 	c.interrupt() // handle interrupts
-	c.fetch()     // load next instruction into c.inst
-	c.execute()   // execute c.inst instruction
-	c.timers()    // handle tima, tma, tac
+	sp, pc := c.sp.Word(), c.pc.Word()
+	if c.halted || c.locked {
+		c.t = 4 // the clock runs while the cpu waits
+	} else if c.breakpoint() {
+		// stopped before the instruction at pc
+	} else {
+		if c.trace != nil {
+			c.traceLine()
+		}
+		c.timed = true
+		c.fetch()   // load next instruction into c.inst
+		c.execute() // execute c.inst instruction
+		c.timed = false
+		if c.ei > 0 {
+			// ime is set after the instruction following EI
+			if c.ei--; c.ei == 0 {
+				c.ime = 1
+			}
+		}
+		if c.cov != nil {
+			c.cov.count(c.inst.o)
+		}
+	}
+	// the cycles without a memory access, internal ones and those of
+	// instructions that have no timing yet, run after the last access
+	if c.ticked > c.t {
+		c.t = c.ticked
+	}
+	c.clock(c.t - c.ticked)
+	c.ticked = 0
+	if c.watches != nil {
+		c.watched(pc)
+	}
+
+	c.cycles += uint64(c.t)
+	c.instructions++
+	if c.events != nil {
+		c.events.cycles.Store(c.cycles)
+	}
+	if callKind(c.inst.o, sp, c.sp.Word()) == opRet {
+		c.irqs.ret(sp, c.cycles)
+	}
+	if c.prof != nil {
+		c.prof.step(c.inst.o, c.t, c.mmu.RomBank(), sp, c.sp.Word(), c.pc.Word())
+	}
 
 	for _, clk := range c.tClocks {
 		clk.AddCycles(c.t)
 	}
-	return c.step, false, 0, 0
+	c.snapshot()
+	return c.stepFn, false, 0, 0
+}
+
+// Registers are the cpu registers between two instructions, and the clock
+// cycles since power on.
+type Registers struct {
+	A, F, B, C, D, E, H, L Byte
+	SP, PC                 Word
+	Ime, Halted            bool
+	Cycles                 uint64
+}
+
+func (c *Cpu) registers() Registers {
+	return Registers{
+		A: c.a.Byte(), F: c.f.Byte(), B: c.b.Byte(), C: c.c.Byte(),
+		D: c.d.Byte(), E: c.e.Byte(), H: c.h.Byte(), L: c.l.Byte(),
+		SP: c.sp.Word(), PC: c.pc.Word(), Ime: c.ime == 1, Halted: c.halted,
+		Cycles: c.cycles,
+	}
+}
+
+func (c *Cpu) cmdRegisters(resp interface{}) {
+	if resp, ok := resp.(chan Registers); !ok {
+		panic("invalid command response type")
+	} else {
+		resp <- c.registers()
+	}
+}
+
+// Registers returns the cpu registers.
+func (j Jibi) Registers() Registers {
+	resp := make(chan Registers)
+	j.cpu.RunCommand(CmdRegisters, resp)
+	return <-resp
 }
@@ -0,0 +1,369 @@
+package jibi
+
+import (
+	"testing"
+)
+
+// newCodeCpu returns a cpu about to run code at 0x0100 of a rom only
+// cartridge, with a clock like the one the gpu follows.
+func newCodeCpu(t testing.TB, code []Byte) *Cpu {
+	rom := make([]Byte, 0x8000)
+	copy(rom[0x0100:], code)
+	cart, err := NewCartridge(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mmu := NewMmu(cart, false)
+	cpu := NewCpu(mmu, nil)
+	cpu.pc = 0x0100
+	cpu.sp = 0xFFFE
+	cpu.Clock()
+	return cpu
+}
+
+// newFrameCpu returns a cpu running a nop loop with the timer running.
+func newFrameCpu(t testing.TB) *Cpu {
+	cpu := newCodeCpu(t, []Byte{0x00, 0x18, 0xFD}) // NOP, JR -3
+	cpu.writeByte(AddrTAC, Byte(0x05))
+	return cpu
+}
+
+// runFrame steps the cpu through one frame worth of clock cycles.
+func runFrame(cpu *Cpu) {
+	for start := cpu.cycles; cpu.cycles-start < 70224; {
+		cpu.step(false, 0)
+	}
+}
+
+// nullLcd is a ColorLcd that shows nothing.
+type nullLcd struct{}
+
+func (nullLcd) DrawLine(bl []Byte)        {}
+func (nullLcd) DrawColorLine(line []Word) {}
+func (nullLcd) Blank()                    {}
+func (nullLcd) DisableRender()            {}
+func (nullLcd) SetTitle(title string)     {}
+func (nullLcd) Notify(n Notification)     {}
+
+// TestFrameAllocs checks that a frame, fetching, executing instructions on
+// registers and memory, timers, interrupts and the gpu drawing, does not
+// allocate once running.
+func TestFrameAllocs(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{
+		0x21, 0x00, 0xC0, // LD HL, 0xC000
+		0x22,       // LD (HL+), A
+		0x3C,       // INC A
+		0x80,       // ADD A, B
+		0xAE,       // XOR (HL)
+		0xCB, 0x11, // RL C
+		0xC5,             // PUSH BC
+		0xC1,             // POP BC
+		0x08, 0x00, 0xD0, // LD (0xD000), SP
+		0xCD, 0x14, 0x01, // CALL 0x0114
+		0x18, 0xED, // JR -19
+		0x00,
+		0xC9, // RET
+	})
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.writeByte(AddrTAC, Byte(0x05))
+	NewGpu(cpu.mmu, nullLcd{}, cpu, false)
+	cpu.writeByte(AddrLCDC, Byte(0x93)) // bg and sprites
+	runFrame(cpu)
+	// allocations are counted for the whole process, retry in case the
+	// goroutines of earlier tests are still winding down
+	n := float64(0)
+	for i := 0; i < 5; i++ {
+		if n = testing.AllocsPerRun(10, func() { runFrame(cpu) }); n == 0 {
+			return
+		}
+	}
+	t.Errorf("%.0f allocations per frame", n)
+}
+
+// TestSchedule checks that the gpu runs off the cpu clock, in step with the
+// instructions, and that its commands are handled by the loop of the cpu.
+func TestSchedule(t *testing.T) {
+	cpu := newFrameCpu(t)
+	defer cpu.RunCommand(CmdStop, nil)
+	lcd := NewLcd(false)
+	lcd.DisableRender()
+	g := NewGpu(cpu.mmu, lcd, cpu, false)
+	resp := make(chan chan ClockType)
+	g.RunCommand(CmdFrameCounter, resp)
+	frames := <-resp
+
+	cpu.writeByte(AddrLCDC, Byte(0x91)) // plays the gpu
+	on := cpu.cycles
+	for line := uint64(1); line <= 200; line++ {
+		for cpu.cycles-on < line*456 {
+			cpu.step(false, 0)
+		}
+		want := Byte(line % 154)
+		if ly := cpu.readByte(AddrLY); ly != want {
+			t.Fatalf("line %d: LY %d", line, ly)
+		}
+	}
+	select {
+	case n := <-frames:
+		if n != 1 {
+			t.Errorf("%d frames", n)
+		}
+	default:
+		t.Error("no frame")
+	}
+
+	cpu.writeByte(AddrLCDC, Byte(0x11))
+	runFrame(cpu)
+	if ly := cpu.readByte(AddrLY); ly != 0 || g.isPlaying() {
+		t.Errorf("lcd off: LY %d, playing %t", ly, g.isPlaying())
+	}
+}
+
+// TestGpuAccessCycle reads STAT on the 4th machine cycle of LD A, (nn),
+// across the end of the 80 dots the first line after the lcd is turned on
+// waits in mode 0 before it draws.
+func TestGpuAccessCycle(t *testing.T) {
+	for _, c := range []struct {
+		dots uint32 // run by the gpu before the instruction
+		mode Byte
+	}{
+		{60, LcdModeHBlank},
+		{64, LcdModeVRam},
+	} {
+		cpu := newCodeCpu(t, []Byte{0xFA, 0x41, 0xFF}) // LD A, (STAT)
+		lcd := NewLcd(false)
+		lcd.DisableRender()
+		g := NewGpu(cpu.mmu, lcd, cpu, false)
+		cpu.writeByte(AddrLCDC, Byte(0x91))
+		g.clock(c.dots)
+		cpu.step(false, 0)
+		if mode := cpu.a.Byte() & 0x03; mode != c.mode {
+			t.Errorf("%d dots: mode %d", c.dots, mode)
+		}
+		cpu.RunCommand(CmdStop, nil)
+	}
+}
+
+func TestHalt(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{0x76, 0x00}) // HALT, NOP
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.ime = 1
+	cpu.writeByte(AddrIE, Byte(InterruptTimer))
+	cpu.step(false, 0)
+	start := cpu.cycles
+	for i := 0; i < 10; i++ {
+		cpu.step(false, 0)
+	}
+	if pc := cpu.pc.Word(); !cpu.halted || pc != 0x0101 {
+		t.Fatalf("pc 0x%04X halted %v", pc, cpu.halted)
+	}
+	if n := cpu.cycles - start; n != 40 {
+		t.Errorf("%d cycles while halted", n)
+	}
+	// a disabled interrupt does not wake it
+	cpu.setInterrupt(InterruptVblank)
+	cpu.step(false, 0)
+	if !cpu.halted {
+		t.Fatal("woken by a disabled interrupt")
+	}
+	cpu.setInterrupt(InterruptTimer)
+	cpu.step(false, 0)
+	if pc := cpu.pc.Word(); cpu.halted || pc != 0x0051 {
+		t.Errorf("pc 0x%04X halted %v", pc, cpu.halted)
+	}
+}
+
+func TestHaltIme0(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{0x76, 0x04}) // HALT, INC B
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.ime = 0
+	cpu.writeByte(AddrIE, Byte(InterruptTimer))
+	cpu.step(false, 0)
+	cpu.step(false, 0)
+	if !cpu.halted {
+		t.Fatal("not halted")
+	}
+	// the interrupt wakes it without being dispatched
+	cpu.setInterrupt(InterruptTimer)
+	cpu.step(false, 0)
+	if pc := cpu.pc.Word(); cpu.halted || pc != 0x0102 || cpu.b.Byte() != 1 {
+		t.Errorf("pc 0x%04X halted %v B %d", pc, cpu.halted, cpu.b.Byte())
+	}
+}
+
+func TestHaltBug(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{0x76, 0x04}) // HALT, INC B
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.ime = 0
+	cpu.writeByte(AddrIE, Byte(InterruptTimer))
+	cpu.setInterrupt(InterruptTimer)
+	cpu.step(false, 0)
+	if cpu.halted {
+		t.Fatal("halted with an interrupt pending")
+	}
+	// INC B is read twice
+	cpu.step(false, 0)
+	cpu.step(false, 0)
+	if pc := cpu.pc.Word(); pc != 0x0102 || cpu.b.Byte() != 2 {
+		t.Errorf("pc 0x%04X B %d", pc, cpu.b.Byte())
+	}
+}
+
+// TestEiHalt checks that HALT right after EI with an interrupt pending
+// dispatches it, returning to the HALT, instead of running the halt bug.
+func TestEiHalt(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{0xFB, 0x76, 0x04}) // EI, HALT, INC B
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.ime = 0
+	cpu.writeByte(AddrIE, Byte(InterruptTimer))
+	cpu.setInterrupt(InterruptTimer)
+	cpu.step(false, 0)
+	cpu.step(false, 0)
+	cpu.step(false, 0)
+	if pc := cpu.pc.Word(); pc != 0x0051 || cpu.haltBug || cpu.halted {
+		t.Fatalf("pc 0x%04X halt bug %t halted %t", pc, cpu.haltBug, cpu.halted)
+	}
+	if ret := cpu.readWord(Word(0xFFFC)); ret != 0x0101 {
+		t.Errorf("pushed 0x%04X", ret)
+	}
+}
+
+func TestEiDelay(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{0xFB, 0x00, 0x00}) // EI, NOP, NOP
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.ime = 0
+	cpu.writeByte(AddrIE, Byte(InterruptTimer))
+	cpu.setInterrupt(InterruptTimer)
+	cpu.step(false, 0)
+	cpu.step(false, 0)
+	// the instruction after EI runs before the interrupt
+	if pc := cpu.pc.Word(); pc != 0x0102 || cpu.ime != 1 {
+		t.Fatalf("pc 0x%04X ime %d", pc, cpu.ime)
+	}
+	cpu.step(false, 0)
+	if pc := cpu.pc.Word(); pc != 0x0051 {
+		t.Fatalf("pc 0x%04X", pc)
+	}
+	// 5 machine cycles of dispatch and the NOP at the vector
+	if cpu.t != 24 {
+		t.Errorf("%d cycles", cpu.t)
+	}
+	if ret := cpu.readWord(Word(0xFFFC)); ret != 0x0102 {
+		t.Errorf("pushed 0x%04X", ret)
+	}
+}
+
+func TestEiDi(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{0xFB, 0xF3, 0x00}) // EI, DI, NOP
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.ime = 0
+	cpu.writeByte(AddrIE, Byte(InterruptTimer))
+	cpu.setInterrupt(InterruptTimer)
+	for i := 0; i < 3; i++ {
+		cpu.step(false, 0)
+	}
+	if pc := cpu.pc.Word(); pc != 0x0103 || cpu.ime != 0 {
+		t.Errorf("pc 0x%04X ime %d", pc, cpu.ime)
+	}
+}
+
+func TestInterruptIePush(t *testing.T) {
+	for _, c := range []struct {
+		pc, want Word
+	}{
+		{0x0100, 0x0001}, // IE 0x01 leaves the timer disabled
+		{0x0400, 0x0051}, // IE 0x04 keeps it
+	} {
+		cpu := newCodeCpu(t, nil)
+		cpu.pc = register16(c.pc)
+		cpu.sp = 0x0000
+		cpu.writeByte(AddrIE, Byte(InterruptTimer))
+		cpu.setInterrupt(InterruptTimer)
+		cpu.step(false, 0)
+		if pc := cpu.pc.Word(); pc != c.want {
+			t.Errorf("pc 0x%04X: pc 0x%04X after the dispatch", c.pc, pc)
+		}
+		if ie := cpu.readByte(AddrIE); ie != c.pc.High() {
+			t.Errorf("pc 0x%04X: IE 0x%02X", c.pc, ie)
+		}
+		cpu.RunCommand(CmdStop, nil)
+	}
+}
+
+func TestIllegalOpcode(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{0xD3, 0x04}) // illegal, INC B
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.writeByte(AddrIE, Byte(InterruptTimer))
+	cpu.step(false, 0)
+	if !cpu.locked {
+		t.Fatal("not locked up")
+	}
+	start := cpu.cycles
+	cpu.setInterrupt(InterruptTimer)
+	for i := 0; i < 10; i++ {
+		cpu.step(false, 0)
+	}
+	// nothing runs, interrupts included, while the clock does
+	if pc := cpu.pc.Word(); pc != 0x0101 || cpu.b.Byte() != 0 {
+		t.Errorf("pc 0x%04X B %d", pc, cpu.b.Byte())
+	}
+	if n := cpu.cycles - start; n != 40 {
+		t.Errorf("%d cycles while locked up", n)
+	}
+}
+
+func BenchmarkFrame(b *testing.B) {
+	cpu := newFrameCpu(b)
+	defer cpu.RunCommand(CmdStop, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runFrame(cpu)
+	}
+}
+
+func TestModeBlocked(t *testing.T) {
+	cpu := newCodeCpu(t, nil)
+	defer cpu.RunCommand(CmdStop, nil)
+	setMode := func(mode Byte) {
+		cpu.mmu.Hardware().Write(AddrSTAT, mode)
+	}
+	for _, c := range []struct {
+		mode      Byte
+		vram, oam bool // accessible
+	}{
+		{LcdModeHBlank, true, true},
+		{LcdModeVBlank, true, true},
+		{LcdModeOam, true, false},
+		{LcdModeVRam, false, false},
+	} {
+		setMode(LcdModeHBlank)
+		cpu.writeByte(AddrVRam, Byte(0x11))
+		cpu.writeByte(AddrOam, Byte(0x22))
+		setMode(c.mode)
+		cpu.writeByte(AddrVRam, Byte(0x33))
+		cpu.writeByte(AddrOam, Byte(0x44))
+		for _, a := range []struct {
+			addr       Word
+			ok         bool
+			old, write Byte
+		}{{AddrVRam, c.vram, 0x11, 0x33}, {AddrOam, c.oam, 0x22, 0x44}} {
+			want := Byte(0xFF)
+			if a.ok {
+				want = a.write
+			}
+			if b := cpu.readByte(a.addr); b != want {
+				t.Errorf("mode %d: read 0x%04X: 0x%02X", c.mode, a.addr, b)
+			}
+			setMode(LcdModeHBlank)
+			want = a.old
+			if a.ok {
+				want = a.write
+			}
+			if b := cpu.readByte(a.addr); b != want {
+				t.Errorf("mode %d: write 0x%04X: 0x%02X", c.mode, a.addr, b)
+			}
+			setMode(c.mode)
+		}
+	}
+}
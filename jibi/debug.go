@@ -0,0 +1,216 @@
+package jibi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// debug message signature that follows a source code breakpoint, as used by
+// bgb and no$gmb:
+//
+//	ld b,b
+//	jr .end
+//	dw $6464
+//	dw $0000
+//	db "message"
+//	.end
+const debugMessageSig = 0x6464
+
+func (c *Cpu) cmdOnBreakpoint(resp interface{}) {
+	if resp, ok := resp.(chan chan string); !ok {
+		panic("invalid command response type")
+	} else {
+		brk := make(chan string)
+		c.notifyBreak = append(c.notifyBreak, brk)
+		resp <- brk
+	}
+}
+
+func (c *Cpu) cmdOnDebugMessage(resp interface{}) {
+	if resp, ok := resp.(chan chan string); !ok {
+		panic("invalid command response type")
+	} else {
+		msg := make(chan string)
+		c.notifyPrint = append(c.notifyPrint, msg)
+		resp <- msg
+	}
+}
+
+// softBreak pauses the cpu on a ld b,b when anyone is listening for
+// breakpoints.
+func (c *Cpu) softBreak() {
+	if len(c.notifyBreak) == 0 {
+		return
+	}
+	s := fmt.Sprintf("breakpoint at 0x%04X", c.pc.Word()-1)
+	if msg, ok := c.debugMessage(c.pc.Word()); ok {
+		s += ": " + msg
+	}
+	for _, brk := range c.notifyBreak {
+		brk <- s
+	}
+	c.pause()
+}
+
+// debugPrint hands the message after a ld d,d to everyone listening for
+// debug messages, with %A%, %BC%, %PC% and the other registers in it
+// replaced by their values like bgb does.
+func (c *Cpu) debugPrint() {
+	if len(c.notifyPrint) == 0 {
+		return
+	}
+	msg, ok := c.debugMessage(c.pc.Word())
+	if !ok {
+		return
+	}
+	var pairs []string
+	for _, r := range []struct {
+		name string
+		v    *register8
+	}{{"A", c.a}, {"F", c.f}, {"B", c.b}, {"C", c.c}, {"D", c.d}, {"E", c.e}, {"H", c.h}, {"L", c.l}} {
+		pairs = append(pairs, "%"+r.name+"%", fmt.Sprintf("$%02X", uint8(r.v.Byte())))
+	}
+	for _, r := range []struct {
+		name string
+		v    Word
+	}{{"AF", c.a.Word()}, {"BC", c.b.Word()}, {"DE", c.d.Word()}, {"HL", c.h.Word()},
+		{"SP", c.sp.Word()}, {"PC", c.pc.Word() - 1}} {
+		pairs = append(pairs, "%"+r.name+"%", fmt.Sprintf("$%04X", uint16(r.v)))
+	}
+	msg = strings.NewReplacer(pairs...).Replace(msg)
+	for _, out := range c.notifyPrint {
+		out <- msg
+	}
+}
+
+// debugMessage returns the message placed after a breakpoint at addr. The
+// message is not run by the cpu, so it is read from the bios or the bus
+// directly without taking any cycles.
+func (c *Cpu) debugMessage(addr Word) (string, bool) {
+	read := c.peekByte
+	if read(addr) != 0x18 { // jr n
+		return "", false
+	}
+	end := addr + 2 + Word(int8(read(addr+1)))
+	word := func(a Word) Word { return BytesToWord(read(a+1), read(a)) }
+	if word(addr+2) != debugMessageSig || word(addr+4) != 0x0000 {
+		return "", false
+	}
+	msg := []byte{}
+	for a := addr + 6; a < end; a++ {
+		msg = append(msg, byte(read(a)))
+	}
+	return string(msg), true
+}
+
+func (c *Cpu) cmdSetBreakpoint(data interface{}) {
+	if addr, ok := data.(Word); !ok {
+		panic("invalid command response type")
+	} else {
+		if c.breakpoints == nil {
+			c.breakpoints = map[Word]bool{}
+		}
+		c.breakpoints[addr] = true
+	}
+}
+
+func (c *Cpu) cmdClearBreakpoint(data interface{}) {
+	if addr, ok := data.(Word); !ok {
+		panic("invalid command response type")
+	} else {
+		delete(c.breakpoints, addr)
+	}
+}
+
+func (c *Cpu) cmdOnStop(resp interface{}) {
+	if resp, ok := resp.(chan chan Registers); !ok {
+		panic("invalid command response type")
+	} else {
+		stop := make(chan Registers)
+		c.notifyStop = append(c.notifyStop, stop)
+		resp <- stop
+	}
+}
+
+// cmdContinue resumes a cpu stopped on a breakpoint, running the instruction
+// it stopped before.
+func (c *Cpu) cmdContinue(data interface{}) {
+	c.resume = true
+	c.play()
+}
+
+// cmdStepOne runs the one instruction a stopped cpu is at and reports the
+// registers after it.
+func (c *Cpu) cmdStepOne(data interface{}) {
+	c.resume = true
+	c.step(false, 0)
+	c.resume = false
+	c.stopped()
+}
+
+// breakpoint returns true and stops the cpu when pc is at a breakpoint,
+// unless the cpu is resuming from it. While the rewind replays it asks the
+// replay instead, see Cpu.replay.
+func (c *Cpu) breakpoint() bool {
+	if c.replayAt != nil {
+		return c.replayAt()
+	}
+	if c.resume {
+		c.resume = false
+		return false
+	}
+	if !c.breakpoints[c.pc.Word()] {
+		return false
+	}
+	c.pause()
+	c.stopped()
+	return true
+}
+
+// stopped hands the registers to everyone listening for stops.
+func (c *Cpu) stopped() {
+	r := c.registers()
+	for _, stop := range c.notifyStop {
+		stop <- r
+	}
+}
+
+// SetBreakpoint stops the cpu before it runs the instruction at addr, see
+// OnStop.
+func (j Jibi) SetBreakpoint(addr Word) {
+	j.cpu.RunCommand(CmdSetBreakpoint, addr)
+}
+
+// ClearBreakpoint removes the breakpoint at addr.
+func (j Jibi) ClearBreakpoint(addr Word) {
+	j.cpu.RunCommand(CmdClearBreakpoint, addr)
+}
+
+// OnStop returns a channel receiving the registers whenever a breakpoint
+// or StepOne stops the cpu. The cpu waits for it to be read.
+func (j Jibi) OnStop() <-chan Registers {
+	resp := make(chan chan Registers)
+	j.cpu.RunCommand(CmdOnStop, resp)
+	return <-resp
+}
+
+// Continue resumes a cpu stopped on a breakpoint.
+func (j Jibi) Continue() {
+	j.cpu.RunCommand(CmdContinue, nil)
+}
+
+// StepOne runs one instruction of a stopped cpu.
+func (j Jibi) StepOne() {
+	j.cpu.RunCommand(CmdStepOne, nil)
+}
+
+// traceLine writes the registers and the 4 bytes at pc before an
+// instruction, in the format of gameboy doctor.
+func (c *Cpu) traceLine() {
+	pc := c.pc.Word()
+	fmt.Fprintf(c.trace, "A:%02X F:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X PC:%04X PCMEM:%02X,%02X,%02X,%02X\n",
+		uint8(c.a.Byte()), uint8(c.f.Byte()), uint8(c.b.Byte()), uint8(c.c.Byte()),
+		uint8(c.d.Byte()), uint8(c.e.Byte()), uint8(c.h.Byte()), uint8(c.l.Byte()),
+		uint16(c.sp.Word()), uint16(pc), uint8(c.peekByte(pc)), uint8(c.peekByte(pc+1)),
+		uint8(c.peekByte(pc+2)), uint8(c.peekByte(pc+3)))
+}
@@ -0,0 +1,101 @@
+package jibi
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestBreakpoints(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{0x00, 0x04, 0x18, 0xFC}) // NOP, INC B, JR -4
+	defer cpu.RunCommand(CmdStop, nil)
+	resp := make(chan chan Registers)
+	cpu.RunCommand(CmdOnStop, resp)
+	stop := <-resp
+	cpu.RunCommand(CmdSetBreakpoint, Word(0x0101))
+	cpu.RunCommand(CmdPlay, nil)
+
+	next := func() Registers {
+		select {
+		case r := <-stop:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("cpu did not stop")
+		}
+		return Registers{}
+	}
+	r := next()
+	if r.PC != 0x0101 {
+		t.Fatalf("stopped at 0x%04X", r.PC)
+	}
+	b := r.B
+	cpu.RunCommand(CmdStepOne, nil)
+	if r := next(); r.PC != 0x0102 || r.B != b+1 {
+		t.Errorf("step to 0x%04X with b 0x%02X", r.PC, r.B)
+	}
+	cpu.RunCommand(CmdContinue, nil)
+	if r := next(); r.PC != 0x0101 || r.B != b+1 {
+		t.Errorf("continue to 0x%04X with b 0x%02X", r.PC, r.B)
+	}
+	// without the breakpoint the loop runs on
+	cpu.RunCommand(CmdClearBreakpoint, Word(0x0101))
+	cpu.RunCommand(CmdSetBreakpoint, Word(0x0100))
+	cpu.RunCommand(CmdContinue, nil)
+	if r := next(); r.PC != 0x0100 || r.B != b+2 {
+		t.Errorf("continue to 0x%04X with b 0x%02X", r.PC, r.B)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{0x3E, 0x12, 0x04}) // LD A, 0x12; INC B
+	defer cpu.RunCommand(CmdStop, nil)
+	var trace bytes.Buffer
+	cpu.trace = &trace
+	regs := []Byte{0x01, 0xB0, 0x00, 0x13, 0x00, 0xD8, 0x01, 0x4D}
+	for i, r := range []*register8{cpu.a, cpu.f, cpu.b, cpu.c, cpu.d, cpu.e, cpu.h, cpu.l} {
+		r.set(regs[i])
+	}
+	cpu.step(false, 0)
+	cpu.step(false, 0)
+	want := "A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:3E,12,04,00\n" +
+		"A:12 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0102 PCMEM:04,00,00,00\n"
+	if trace.String() != want {
+		t.Errorf("trace\n%s", trace.String())
+	}
+}
+
+func TestDebugMessage(t *testing.T) {
+	code := []Byte{0x3E, 0x2A, 0x52, 0x18, 0x09, 0x64, 0x64, 0x00, 0x00} // LD A, 0x2A; LD D, D; JR
+	code = append(code, []Byte("A=%A%")...)
+	cpu := newCodeCpu(t, code)
+	defer cpu.RunCommand(CmdStop, nil)
+	resp := make(chan chan string)
+	cpu.RunCommand(CmdOnDebugMessage, resp)
+	msgs := <-resp
+	cpu.RunCommand(CmdPlay, nil)
+	select {
+	case m := <-msgs:
+		if m != "A=$2A" {
+			t.Errorf("%q", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message")
+	}
+}
+
+func TestDebugMessageCycles(t *testing.T) {
+	code := []Byte{0x52, 0x18, 0x06, 0x64, 0x64, 0x00, 0x00} // LD D, D; JR
+	code = append(code, []Byte("hi")...)
+	cpu := newCodeCpu(t, code)
+	defer cpu.RunCommand(CmdStop, nil)
+	msgs := make(chan string, 1)
+	cpu.notifyPrint = append(cpu.notifyPrint, msgs)
+	cpu.step(false, 0)
+	if m := <-msgs; m != "hi" {
+		t.Errorf("%q", m)
+	}
+	// reading the message runs no machine cycles
+	if cpu.t != 4 || cpu.div != 4 {
+		t.Errorf("%d cycles, div %d", cpu.t, cpu.div)
+	}
+}
@@ -0,0 +1,92 @@
+package jibi
+
+import (
+	"fmt"
+)
+
+// A MemoryDevice answers for a range of the address space, like the
+// cartridge, the apu or a debug stub. It is called on the scheduler goroutine
+// of the cpu, so it has to guard state it shares with other goroutines.
+type MemoryDevice interface {
+	Read(addr Word) Byte
+	Write(addr Word, b Byte)
+}
+
+// memoryDevices is the list of devices mapped with MapDevice, read on every
+// access.
+type memoryDevices struct {
+	rangeList[MemoryDevice]
+}
+
+// at returns the device mapped at addr, the last one mapped wins.
+func (ds *memoryDevices) at(addr Word) MemoryDevice {
+	devices := ds.load()
+	for i := len(devices) - 1; i >= 0; i-- {
+		if d := devices[i]; d.start <= addr && addr <= d.end {
+			return d.v
+		}
+	}
+	return nil
+}
+
+// MapDevice maps dev from start to end inclusive, over anything mapped
+// there before. The returned func unmaps it.
+func (m *RomOnlyMmu) MapDevice(start, end Word, dev MemoryDevice) func() {
+	return m.devices.add(start, end, dev)
+}
+
+// A memoryBlock is a part of the address space in the table of the Mmu.
+// Unlike a MemoryDevice its accesses are told whether they are made by the
+// hardware, see Mmu.Hardware.
+type memoryBlock struct {
+	read  func(addr Word, hw bool) Byte
+	write func(addr Word, b Byte, hw bool)
+}
+
+// deviceBlock returns the block of a device the Mmu maps itself, to which
+// hardware accesses are like any other.
+func deviceBlock(dev MemoryDevice) *memoryBlock {
+	return &memoryBlock{
+		read:  func(addr Word, hw bool) Byte { return dev.Read(addr) },
+		write: func(addr Word, b Byte, hw bool) { dev.Write(addr, b) },
+	}
+}
+
+// openBus is a block nothing answers for, reads see 0xFF and writes are
+// dropped.
+var openBus = deviceBlock(openBusDevice{})
+
+type openBusDevice struct{}
+
+func (openBusDevice) Read(addr Word) Byte     { return 0xFF }
+func (openBusDevice) Write(addr Word, b Byte) {}
+
+// A blockTable holds the block at every address, by page below oam and by
+// address from oam on, where the blocks are small.
+type blockTable struct {
+	pages [AddrOam >> 8]*memoryBlock
+	high  [0x10000 - int(AddrOam)]*memoryBlock
+}
+
+// set maps b from start to end inclusive. Below oam the range has to cover
+// whole pages.
+func (t *blockTable) set(start, end Word, b *memoryBlock) {
+	for a := int(start); a <= int(end); a++ {
+		if a >= int(AddrOam) {
+			t.high[a-int(AddrOam)] = b
+		} else if a&0xFF == 0 && a|0xFF <= int(end) {
+			t.pages[a>>8] = b
+			a |= 0xFF
+		} else {
+			panic(fmt.Sprintf("block 0x%04X-0x%04X does not cover pages", start, end))
+		}
+	}
+}
+
+// at returns the block at addr, nil if nothing is mapped there.
+func (t *blockTable) at(addr Word) *memoryBlock {
+	if addr >= AddrOam {
+		return t.high[addr-AddrOam]
+	}
+	return t.pages[addr>>8]
+}
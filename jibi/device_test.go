@@ -0,0 +1,95 @@
+package jibi
+
+import (
+	"testing"
+)
+
+// testDevice is a MemoryDevice of 16 bytes of ram.
+type testDevice struct {
+	mem [16]Byte
+}
+
+func (d *testDevice) Read(addr Word) Byte {
+	return d.mem[addr&0x0F]
+}
+
+func (d *testDevice) Write(addr Word, b Byte) {
+	d.mem[addr&0x0F] = b
+}
+
+func TestMapDevice(t *testing.T) {
+	mmu := NewMmu(nil, false)
+	mmu.Write(AddrRam, 0x12)
+
+	d := &testDevice{}
+	unmap := mmu.MapDevice(AddrRam, AddrRam+0x0F, d)
+	unmapStub := mmu.MapDevice(0xFEA0, 0xFEAF, d) // in unusable memory
+	if b := mmu.Read(AddrRam); b != 0x00 {
+		t.Errorf("read 0x%02X, not from the device", b)
+	}
+	mmu.Write(AddrRam+1, 0x34)
+	mmu.Write(0xFEA2, 0x56)
+	if d.mem[1] != 0x34 || d.mem[2] != 0x56 {
+		t.Errorf("device % X", d.mem[:4])
+	}
+	if !mmu.Mapped(Word(0xFEA0)) || mmu.Read(0xFEA1) != 0x34 {
+		t.Error("stub not mapped")
+	}
+
+	unmap()
+	unmapStub()
+	if b := mmu.Read(AddrRam); b != 0x12 {
+		t.Errorf("read 0x%02X after unmapping", b)
+	}
+	if mmu.Mapped(Word(0xFEA0)) {
+		t.Error("stub still mapped")
+	}
+}
+
+func TestBlockTable(t *testing.T) {
+	rom := make([]Byte, 0x8000)
+	rom[0x4000] = 0x42
+	mmu := NewMmu(&Cartridge{mapper: newRomOnly(rom, 0)}, false)
+	if b := mmu.Read(0x4000); b != 0x42 {
+		t.Errorf("rom read 0x%02X", b)
+	}
+
+	// the apu registers are open bus until the apu is set
+	if b := mmu.Read(AddrNR52); b != 0xFF {
+		t.Errorf("NR52 0x%02X without an apu", b)
+	}
+	mmu.SetApu(&Apu{})
+	if b := mmu.Read(AddrNR52); b != 0x70 {
+		t.Errorf("NR52 0x%02X with the apu off", b)
+	}
+
+	// SC reads the unused bits and, on the dmg, the fast clock bit as one
+	mmu.Write(AddrSC, 0x83)
+	if b := mmu.Read(AddrSC); b != 0xFF {
+		t.Errorf("SC 0x%02X", b)
+	}
+	if b := mmu.Hardware().Read(AddrSC); b != 0x81 {
+		t.Errorf("SC 0x%02X to the hardware", b)
+	}
+
+	var tbl blockTable
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("no panic for a part of a page")
+			}
+		}()
+		tbl.set(AddrRam, AddrRam+0x0F, openBus)
+	}()
+}
+
+func TestRangeList(t *testing.T) {
+	var l rangeList[int]
+	remove1 := l.add(0x00, 0x0F, 1)
+	l.add(0x10, 0x1F, 2)
+	remove1()
+	remove1() // removing twice is harmless
+	if items := l.load(); len(items) != 1 || items[0].v != 2 {
+		t.Errorf("%d items left", len(items))
+	}
+}
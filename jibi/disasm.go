@@ -0,0 +1,113 @@
+package jibi
+
+import (
+	"fmt"
+	"strings"
+)
+
+//go:generate go run gen_opcodes.go
+
+// An opMeta is the metadata of an sm83 opcode, generated from sm83.json.
+// Length is in bytes with the opcode and prefix, cycles are clock cycles
+// when a condition is not met and taken when it is, 0 for instructions
+// without a condition. Illegal opcodes have no name and length 0.
+//
+// Names carry the operands as placeholders filled in by Disassemble: d8 and
+// d16 are immediates, a8 an address in 0xFF00-0xFFFF, a16 an address, r8 a
+// relative jump and e8 a signed offset.
+type opMeta struct {
+	name                  string
+	length, cycles, taken uint8
+}
+
+// sm83Meta returns the metadata of o, a cb prefixed opcode as 0xCBxx.
+func sm83Meta(o opcode) opMeta {
+	if o&0xFF00 == 0xCB00 {
+		return sm83CbOps[o&0xFF]
+	}
+	return sm83Ops[o&0xFF]
+}
+
+// A DisasmLine is one disassembled instruction. Cycles are clock cycles,
+// when a condition is not met, and Taken when it is or 0 for instructions
+// without a condition.
+type DisasmLine struct {
+	Addr   Word
+	Bytes  []Byte
+	Text   string
+	Cycles uint8
+	Taken  uint8
+}
+
+func (l DisasmLine) String() string {
+	bs := make([]string, len(l.Bytes))
+	for i, b := range l.Bytes {
+		bs[i] = fmt.Sprintf("%02X", uint8(b))
+	}
+	cycles := fmt.Sprint(l.Cycles)
+	if l.Taken > 0 {
+		cycles += fmt.Sprintf("/%d", l.Taken)
+	}
+	return fmt.Sprintf("%04X  %-9s %-20s ; %s", uint16(l.Addr), strings.Join(bs, " "), l.Text, cycles)
+}
+
+// DisassembleOne decodes the instruction at the start of code, which is at
+// addr in the address space. Illegal opcodes and instructions cut off by the
+// end of code are a DB of their first byte.
+func DisassembleOne(code []Byte, addr Word) DisasmLine {
+	if len(code) == 0 {
+		return DisasmLine{Addr: addr}
+	}
+	o := opcode(code[0])
+	db := DisasmLine{Addr: addr, Bytes: code[:1], Text: fmt.Sprintf("DB $%02X", uint8(code[0]))}
+	if o == 0xCB {
+		if len(code) < 2 {
+			return db
+		}
+		m := sm83CbOps[code[1]]
+		return DisasmLine{Addr: addr, Bytes: code[:2], Text: m.name, Cycles: m.cycles}
+	}
+	m := sm83Ops[o]
+	n := int(m.length)
+	if n == 0 || len(code) < n {
+		return db
+	}
+	l := DisasmLine{Addr: addr, Bytes: code[:n], Cycles: m.cycles, Taken: m.taken}
+	text := m.name
+	switch {
+	case strings.Contains(text, "d16"):
+		text = strings.Replace(text, "d16", fmt.Sprintf("$%02X%02X", uint8(code[2]), uint8(code[1])), 1)
+	case strings.Contains(text, "a16"):
+		text = strings.Replace(text, "a16", fmt.Sprintf("$%02X%02X", uint8(code[2]), uint8(code[1])), 1)
+	case strings.Contains(text, "d8"):
+		text = strings.Replace(text, "d8", fmt.Sprintf("$%02X", uint8(code[1])), 1)
+	case strings.Contains(text, "a8"):
+		text = strings.Replace(text, "a8", fmt.Sprintf("$FF%02X", uint8(code[1])), 1)
+	case strings.Contains(text, "r8"):
+		to := addr + Word(n) + Word(int8(code[1]))
+		text = strings.Replace(text, "r8", fmt.Sprintf("$%04X", uint16(to)), 1)
+	case strings.Contains(text, "e8"):
+		e := int(int8(code[1]))
+		sign := "+"
+		if e < 0 {
+			sign, e = "-", -e
+		}
+		text = strings.Replace(text, "+e8", sign+fmt.Sprintf("$%02X", e), 1)
+		text = strings.Replace(text, "e8", sign+fmt.Sprintf("$%02X", e), 1)
+	}
+	l.Text = text
+	return l
+}
+
+// Disassemble decodes code, which is at addr in the address space, one
+// instruction after another.
+func Disassemble(code []Byte, addr Word) []DisasmLine {
+	var lines []DisasmLine
+	for len(code) > 0 {
+		l := DisassembleOne(code, addr)
+		lines = append(lines, l)
+		code = code[len(l.Bytes):]
+		addr += Word(len(l.Bytes))
+	}
+	return lines
+}
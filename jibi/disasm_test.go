@@ -0,0 +1,63 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	code := []Byte{
+		0x00,       // NOP
+		0x3E, 0x12, // LD A, $12
+		0xEA, 0x34, 0xC0, // LD (a16), A
+		0xE0, 0x40, // LDH (a8), A
+		0x20, 0xF6, // JR NZ, r8
+		0xF8, 0xFE, // LD HL, SP+e8
+		0xCB, 0x7E, // BIT 7, (HL)
+		0xD3,       // illegal
+		0xC3, 0x50, // JP a16 cut off
+	}
+	want := []struct {
+		addr   Word
+		text   string
+		cycles uint8
+		taken  uint8
+	}{
+		{0x0150, "NOP", 4, 0},
+		{0x0151, "LD A, $12", 8, 0},
+		{0x0153, "LD ($C034), A", 16, 0},
+		{0x0156, "LDH ($FF40), A", 12, 0},
+		{0x0158, "JR NZ, $0150", 8, 12},
+		{0x015A, "LD HL, SP-$02", 12, 0},
+		{0x015C, "BIT 7, (HL)", 12, 0},
+		{0x015E, "DB $D3", 0, 0},
+		{0x015F, "DB $C3", 0, 0},
+		{0x0160, "LD D, B", 4, 0},
+	}
+	lines := Disassemble(code, 0x0150)
+	if len(lines) != len(want) {
+		t.Fatalf("%d lines: %v", len(lines), lines)
+	}
+	for i, w := range want {
+		l := lines[i]
+		if l.Addr != w.addr || l.Text != w.text || l.Cycles != w.cycles || l.Taken != w.taken {
+			t.Errorf("%s, want %04X %s %d/%d", l, uint16(w.addr), w.text, w.cycles, w.taken)
+		}
+	}
+	if s := lines[4].String(); s != "0158  20 F6     JR NZ, $0150         ; 8/12" {
+		t.Errorf("%q", s)
+	}
+}
+
+// TestDisasmNames checks every legal opcode has a name.
+func TestDisasmNames(t *testing.T) {
+	for o, m := range sm83Ops {
+		if (m.name == "") != (m.length == 0) {
+			t.Errorf("0x%02X named %q with length %d", o, m.name, m.length)
+		}
+	}
+	for o, m := range sm83CbOps {
+		if m.name == "" || m.length != 2 {
+			t.Errorf("0xCB%02X named %q with length %d", o, m.name, m.length)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package jibi
+
+// dmaBytes are copied to oam by a dma transfer, one every machine cycle
+const dmaBytes = 0xA0
+
+// oamDma tracks the oam dma transfer in progress on the cpu side
+type oamDma struct {
+	active bool
+	src    Word
+	n      Word  // bytes copied
+	t      int32 // cycles toward the next byte, negative before the start
+}
+
+// dmaStartCycles pass between the write to DMA and the transfer starting
+const dmaStartCycles = 4
+
+// startDma starts copying from XX00, the page written to DMA. Pages from E0
+// read echo ram like the cpu does. A transfer in progress starts over.
+func (c *Cpu) startDma(page Byte) {
+	src := Word(page) << 8
+	if src >= AddrEcho {
+		src -= AddrEcho - AddrRam
+	}
+	c.dma = oamDma{active: true, src: src, t: -dmaStartCycles}
+}
+
+// oamDmaBlocked returns whether the cpu is shut out of address a while the
+// dma runs. The dma holds the buses to the cartridge, ram and vram, and oam,
+// which leaves the cpu the io registers and hram, where games wait for it to
+// finish. Opcodes fetched from elsewhere read 0xFF like the other reads.
+func (c *Cpu) oamDmaBlocked(a Word) bool {
+	return c.dma.active && a < AddrP1
+}
+
+// runDma copies a byte to oam for every machine cycle in t clock cycles.
+// The transfer starts a machine cycle after the write to DMA.
+func (c *Cpu) runDma(t uint8) {
+	if !c.dma.active {
+		return
+	}
+	for c.dma.t += int32(t); c.dma.t >= 4; c.dma.t -= 4 {
+		b := c.bus.Read(c.dma.src + c.dma.n)
+		c.bus.Write(AddrOam+c.dma.n, b)
+		if c.dma.n++; c.dma.n == dmaBytes {
+			c.dma = oamDma{}
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestOamDma(t *testing.T) {
+	cpu := newCodeCpu(t, nil) // NOPs
+	defer cpu.RunCommand(CmdStop, nil)
+	for i := Word(0); i < dmaBytes; i++ {
+		cpu.writeByte(AddrRam+i, Byte(i+1))
+	}
+	cpu.writeByte(AddrOam, Byte(0x55))
+	cpu.writeByte(AddrDMA, Byte(AddrRam>>8))
+	if b := cpu.readByte(AddrDMA); b != Byte(AddrRam>>8) {
+		t.Errorf("DMA 0x%02X", b)
+	}
+	for i := 0; i < dmaBytes; i++ {
+		cpu.step(false, 0)
+	}
+	// only io and hram are left to the cpu until the last byte is copied,
+	// the rest reads 0xFF and ignores writes
+	cpu.writeByte(AddrZero, Byte(0x66))
+	for _, a := range []Word{AddrRom, AddrVRam, AddrRam, AddrOam, AddrZero, AddrDMA} {
+		want := Byte(0xFF)
+		if a == AddrZero {
+			want = 0x66
+		} else if a == AddrDMA {
+			want = Byte(AddrRam >> 8)
+		}
+		if b := cpu.readByte(a); b != want {
+			t.Errorf("0x%04X reads 0x%02X during the transfer", a, b)
+		}
+	}
+	cpu.writeByte(AddrOam, Byte(0x55))
+	cpu.writeByte(AddrRam, Byte(0x55))
+	cpu.step(false, 0)
+	for i := Word(0); i < dmaBytes; i++ {
+		if b := cpu.readByte(AddrOam + i); b != Byte(i+1) {
+			t.Fatalf("oam[%d] 0x%02X", i, b)
+		}
+	}
+	if b := cpu.readByte(AddrRam); b != 0x01 {
+		t.Errorf("ram 0x%02X after the transfer", b)
+	}
+}
+
+// TestOamDmaStart starts the transfer with both ways of writing DMA, it
+// copies the first byte 2 machine cycles after the write and the last 160
+// later.
+func TestOamDmaStart(t *testing.T) {
+	for name, write := range map[string][]Byte{
+		"LDH (46),A":  {0xE0, 0x46},
+		"LD (FF46),A": {0xEA, 0x46, 0xFF},
+	} {
+		code := append([]Byte{0x3E, 0xC0}, write...) // LD A, 0xC0
+		cpu := newCodeCpu(t, code)
+		for i := Word(0); i < dmaBytes; i++ {
+			cpu.pokeByte(AddrRam+i, Byte(i+1))
+			cpu.pokeByte(AddrOam+i, 0x55)
+		}
+		cpu.step(false, 0)
+		cpu.step(false, 0)
+		if !cpu.dma.active {
+			t.Fatalf("%s: no transfer", name)
+		}
+		cpu.step(false, 0) // NOP
+		if b := cpu.peekByte(AddrOam); b != 0x55 {
+			t.Errorf("%s: oam[0] 0x%02X a machine cycle after the write", name, b)
+		}
+		cpu.step(false, 0)
+		if b := cpu.peekByte(AddrOam); b != 0x01 {
+			t.Errorf("%s: oam[0] 0x%02X 2 machine cycles after the write", name, b)
+		}
+		if b := cpu.peekByte(AddrOam + 1); b != 0x55 {
+			t.Errorf("%s: oam[1] 0x%02X 2 machine cycles after the write", name, b)
+		}
+		for i := 1; i < dmaBytes; i++ {
+			if !cpu.dma.active {
+				t.Fatalf("%s: done after %d bytes", name, i)
+			}
+			cpu.step(false, 0)
+		}
+		if cpu.dma.active || cpu.peekByte(AddrOam+dmaBytes-1) != dmaBytes {
+			t.Errorf("%s: not done, %d bytes", name, cpu.dma.n)
+		}
+		cpu.RunCommand(CmdStop, nil)
+	}
+}
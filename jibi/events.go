@@ -0,0 +1,142 @@
+package jibi
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// EventKinds is a set of hardware event kinds.
+type EventKinds uint8
+
+// The hardware event kinds.
+const (
+	EventVBlankStart EventKinds = 1 << iota
+	EventHBlank
+	EventLcdModeChange
+	EventTimerOverflow
+
+	EventsAll = EventVBlankStart | EventHBlank | EventLcdModeChange | EventTimerOverflow
+)
+
+func (k EventKinds) String() string {
+	var s []string
+	if k&EventVBlankStart != 0 {
+		s = append(s, "vblank")
+	}
+	if k&EventHBlank != 0 {
+		s = append(s, "hblank")
+	}
+	if k&EventLcdModeChange != 0 {
+		s = append(s, "mode")
+	}
+	if k&EventTimerOverflow != 0 {
+		s = append(s, "timer")
+	}
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, ",")
+}
+
+// The lcd modes of EventLcdModeChange.
+const (
+	LcdModeHBlank Byte = 0
+	LcdModeVBlank Byte = 1
+	LcdModeOam    Byte = 2
+	LcdModeVRam   Byte = 3
+)
+
+// An Event is a hardware event. Cycles is the cpu clock cycles since power
+// on when it happened, LY and Mode are the lcd line and mode for lcd events.
+type Event struct {
+	Kind   EventKinds
+	Cycles uint64
+	LY     Byte
+	Mode   Byte
+}
+
+// an eventSub is a subscriber and the kinds it wants
+type eventSub struct {
+	kinds EventKinds
+	c     chan Event
+}
+
+// An eventBus hands events from the cpu and gpu goroutines to subscribers.
+// Events are dropped for subscribers that fall behind, the hardware does not
+// wait for them.
+type eventBus struct {
+	cycles atomic.Uint64 // cpu clock cycles, stamped on gpu events
+
+	lock sync.Mutex
+	subs []eventSub
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{}
+}
+
+func (b *eventBus) subscribe(kinds EventKinds, size int) <-chan Event {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	c := make(chan Event, size)
+	b.subs = append(b.subs, eventSub{kinds, c})
+	return c
+}
+
+func (b *eventBus) unsubscribe(c <-chan Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for i, s := range b.subs {
+		if (<-chan Event)(s.c) == c {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			close(s.c)
+			return
+		}
+	}
+}
+
+// publish sends e, stamped with the current cycles if it has none, to every
+// subscriber of its kind.
+func (b *eventBus) publish(e Event) {
+	if e.Cycles == 0 {
+		e.Cycles = b.cycles.Load()
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, s := range b.subs {
+		if s.kinds&e.Kind == 0 {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+		}
+	}
+}
+
+// publishLcd publishes the lcd entering mode on line ly, and vblank or
+// hblank starting.
+func (g *Gpu) publishLcd(mode, ly Byte) {
+	if g.events == nil {
+		return
+	}
+	g.events.publish(Event{Kind: EventLcdModeChange, LY: ly, Mode: mode})
+	switch mode {
+	case LcdModeVBlank:
+		g.events.publish(Event{Kind: EventVBlankStart, LY: ly, Mode: mode})
+	case LcdModeHBlank:
+		g.events.publish(Event{Kind: EventHBlank, LY: ly, Mode: mode})
+	}
+}
+
+// Subscribe returns a channel receiving the events of kinds, buffering up to
+// size of them. Events that do not fit are dropped.
+func (j Jibi) Subscribe(kinds EventKinds, size int) <-chan Event {
+	return j.events.subscribe(kinds, size)
+}
+
+// Unsubscribe stops and closes a channel returned by Subscribe.
+func (j Jibi) Unsubscribe(c <-chan Event) {
+	j.events.unsubscribe(c)
+}
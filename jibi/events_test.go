@@ -0,0 +1,60 @@
+package jibi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBus(t *testing.T) {
+	b := newEventBus()
+	timer := b.subscribe(EventTimerOverflow, 1)
+	lcd := b.subscribe(EventVBlankStart|EventHBlank, 4)
+
+	b.cycles.Store(100)
+	b.publish(Event{Kind: EventTimerOverflow, Cycles: 42})
+	b.publish(Event{Kind: EventTimerOverflow}) // dropped, timer is full
+	b.publish(Event{Kind: EventHBlank, LY: 3})
+	b.publish(Event{Kind: EventLcdModeChange})
+
+	if e := <-timer; e.Kind != EventTimerOverflow || e.Cycles != 42 {
+		t.Errorf("%+v", e)
+	}
+	if e := <-lcd; e.Kind != EventHBlank || e.Cycles != 100 || e.LY != 3 {
+		t.Errorf("%+v", e)
+	}
+	select {
+	case e := <-timer:
+		t.Errorf("%+v", e)
+	case e := <-lcd:
+		t.Errorf("%+v", e)
+	default:
+	}
+
+	b.unsubscribe(timer)
+	if _, ok := <-timer; ok {
+		t.Error("timer not closed")
+	}
+	b.publish(Event{Kind: EventTimerOverflow})
+}
+
+func TestSubscribeVBlank(t *testing.T) {
+	j, err := New(busyRom(), Options{Skipbios: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	vblank := j.Subscribe(EventVBlankStart, 2)
+	j.Play()
+	var prev uint64
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-vblank:
+			if e.Mode != LcdModeVBlank || e.Cycles == 0 || e.Cycles < prev {
+				t.Errorf("%+v", e)
+			}
+			prev = e.Cycles
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package jibi
+
+// A fifoPixel is a pixel waiting in the background or the sprite fifo, the
+// color number before the palette is applied.
+type fifoPixel struct {
+	color   Byte  // 0-3, 0 is transparent for sprites
+	palette Byte  // cgb palette number, on the dmg 1 for OBP1
+	attr    Byte  // cgb map attributes or the oam attributes of the sprite
+	oam     uint8 // index of the sprite in oam
+	x       Byte  // x of the sprite
+	window  bool  // fetched from the window map
+}
+
+// a pixelFifo holds up to 16 pixels, shifted out one per dot.
+type pixelFifo struct {
+	px   [16]fifoPixel
+	head int
+	n    int
+}
+
+func (f *pixelFifo) push(p fifoPixel) {
+	f.px[(f.head+f.n)%len(f.px)] = p
+	f.n++
+}
+
+func (f *pixelFifo) pop() fifoPixel {
+	p := f.px[f.head]
+	f.head = (f.head + 1) % len(f.px)
+	f.n--
+	return p
+}
+
+// at returns the pixel i places from the front.
+func (f *pixelFifo) at(i int) *fifoPixel {
+	return &f.px[(f.head+i)%len(f.px)]
+}
+
+func (f *pixelFifo) clear() {
+	f.head, f.n = 0, 0
+}
+
+// a fetcher reads the tiles of the background or the window into the
+// background fifo, 2 dots each for the tile number and the 2 bytes of the
+// tile row, then waits for the fifo to be empty to push the 8 pixels.
+// SCX and SCY are read on every fetch and LCDC on every dot, so scroll
+// writes in hblank, or along the line, take effect where the hardware has
+// them. Only the fine scroll, the low 3 bits of SCX, is taken at the start
+// of the line.
+type fetcher struct {
+	step   uint8 // 0-5 while fetching, 6 when waiting to push
+	x      Byte  // tile column of the fetch, counted from the left of the line
+	window bool
+	row    Byte // row in the tile
+	tile   Byte
+	attr   Byte // cgb map attributes
+	lo, hi Byte
+}
+
+// a lineSprite is a sprite the oam scan found on the line.
+type lineSprite struct {
+	oam     uint8
+	y, x    Byte
+	fetched bool
+}
+
+// a pixelPipe is the state of the line being drawn in mode 3.
+type pixelPipe struct {
+	ly        Byte
+	cgb       bool   // cgb mode, read at the start of the line
+	dots      uint32 // dots into mode 3
+	delay     int    // dots of the first fetch, which is thrown away
+	discard   Byte   // pixels still to drop for SCX
+	lx        int    // pixels drawn
+	bg, obj   pixelFifo
+	fetch     fetcher
+	windowRow Byte // row of the window on the line
+
+	// the window keeps its own line counter, which only counts the lines
+	// it was drawn on, and starts on lines after LY matched WY in the frame
+	windowLine Byte
+	wyMatch    bool
+
+	sprites    []lineSprite // sprites on the line, in oam order
+	sprite     *lineSprite  // sprite being fetched
+	spriteDots int          // dots left of the sprite fetch
+
+	line [lcdWidth]Byte
+}
+
+// lineSpriteLimit is the most sprites the oam scan finds on a line.
+const lineSpriteLimit = 10
+
+// scanOam finds the sprites on line ly, the oam scan of mode 2. It stops at
+// lineSpriteLimit sprites, the ones later in oam are not drawn, which games
+// use to flicker sprites.
+func (g *Gpu) scanOam(ly Byte) {
+	p := &g.pipe
+	p.sprites = p.sprites[:0]
+	height := 8
+	if g.readByte(AddrLCDC)&0x04 != 0 {
+		height = 16
+	}
+	for i := uint8(0); i < 40 && len(p.sprites) < lineSpriteLimit; i++ {
+		a := AddrOam + Word(i)*4
+		y := g.readByte(a)
+		if top := int(ly) + 16 - int(y); top >= 0 && top < height {
+			p.sprites = append(p.sprites, lineSprite{oam: i, y: y, x: g.readByte(a + 1)})
+		}
+	}
+}
+
+// startLine readies the pipe to draw line ly.
+func (g *Gpu) startLine(ly Byte) {
+	p := &g.pipe
+	p.ly = ly
+	p.cgb = g.cgbMode()
+	p.dots = 0
+	p.delay = 6
+	p.discard = g.readByte(AddrSCX) & 0x07
+	if ly == g.readByte(AddrWY) {
+		p.wyMatch = true
+	}
+	p.lx = 0
+	p.bg.clear()
+	p.obj.clear()
+	p.fetch = fetcher{}
+	p.sprite = nil
+}
+
+// newFrame resets the window for the frame starting.
+func (p *pixelPipe) newFrame() {
+	p.windowLine = 0
+	p.wyMatch = false
+}
+
+// dot runs the pipe for a dot and returns true once the last pixel of the
+// line is drawn. Registers are read as the dot needs them, so writes in the
+// middle of the line show from where the pipe is.
+func (g *Gpu) dot() bool {
+	p := &g.pipe
+	p.dots++
+	if p.delay > 0 {
+		p.delay--
+		return false
+	}
+	if p.sprite != nil {
+		if p.spriteDots--; p.spriteDots == 0 {
+			g.fetchSprite(p.sprite)
+			p.sprite = nil
+		}
+		return false
+	}
+	lcdc := g.readByte(AddrLCDC)
+	if !p.fetch.window && g.windowStarts(lcdc) {
+		p.bg.clear()
+		p.fetch = fetcher{window: true}
+		p.windowRow = p.windowLine
+		p.windowLine++
+	}
+	if p.discard == 0 && lcdc&0x02 != 0 {
+		if s := p.nextSprite(); s != nil {
+			// the background fetch in progress finishes first
+			if p.bg.n == 0 || p.fetch.step > 0 && p.fetch.step < 6 {
+				g.fetchStep(lcdc)
+				return false
+			}
+			// the fetch takes 6 dots, this is the first
+			s.fetched = true
+			p.sprite, p.spriteDots = s, 5
+			return false
+		}
+	}
+	g.fetchStep(lcdc)
+	if p.bg.n == 0 {
+		return false
+	}
+	bg := p.bg.pop()
+	if p.discard > 0 {
+		p.discard--
+		return false
+	}
+	obj := fifoPixel{}
+	if p.obj.n > 0 {
+		obj = p.obj.pop()
+	}
+	p.line[p.lx] = g.mixPixel(bg, obj, lcdc)
+	p.lx++
+	return p.lx == len(p.line)
+}
+
+// nextSprite returns the first sprite in oam order that starts at or left of
+// the pixel being drawn and was not fetched yet.
+func (p *pixelPipe) nextSprite() *lineSprite {
+	for i := range p.sprites {
+		s := &p.sprites[i]
+		if !s.fetched && int(s.x) <= p.lx+8 {
+			return s
+		}
+	}
+	return nil
+}
+
+// windowStarts returns true when the window begins at the pixel being drawn,
+// which is at WX-7 on the lines after LY matched WY. WX and WY are read as
+// the line is drawn, so games can move the window between and along lines.
+func (g *Gpu) windowStarts(lcdc Byte) bool {
+	p := &g.pipe
+	if lcdc&0x20 == 0 || !p.cgb && lcdc&0x01 == 0 || g.layers&LayerWindow == 0 {
+		return false
+	}
+	return p.wyMatch && p.lx+7 >= int(g.readByte(AddrWX))
+}
+
+// fetchStep runs the background fetcher for a dot.
+func (g *Gpu) fetchStep(lcdc Byte) {
+	p := &g.pipe
+	f := &p.fetch
+	switch f.step {
+	case 1:
+		base, x, y := Word(0x9800), Byte(0), Byte(0)
+		if f.window {
+			if lcdc&0x40 != 0 {
+				base = 0x9C00
+			}
+			x, y = f.x, p.windowRow
+		} else {
+			if lcdc&0x08 != 0 {
+				base = 0x9C00
+			}
+			x, y = g.readByte(AddrSCX)>>3+f.x, p.ly+g.readByte(AddrSCY)
+		}
+		addr := base + Word(y>>3)*32 + Word(x&0x1F)
+		f.row = y & 0x07
+		f.tile = g.readVRam(addr, 0)
+		f.attr = 0
+		if p.cgb {
+			f.attr = g.readVRam(addr, 1)
+		}
+	case 3:
+		f.lo = g.readTileRow(lcdc, 0)
+	case 5:
+		f.hi = g.readTileRow(lcdc, 1)
+	}
+	if f.step < 6 {
+		f.step++
+		return
+	}
+	if p.bg.n > 0 {
+		return
+	}
+	for i := uint(0); i < 8; i++ {
+		bit := 7 - i
+		if f.attr&tileAttrXFlip != 0 {
+			bit = i
+		}
+		p.bg.push(fifoPixel{
+			color:   f.lo>>bit&0x01 | (f.hi>>bit&0x01)<<1,
+			palette: f.attr & tileAttrPalette,
+			attr:    f.attr,
+			window:  f.window,
+		})
+	}
+	f.x++
+	f.step = 0
+}
+
+// readTileRow reads byte b of the row of the tile being fetched. The row of
+// a background tile comes from SCY as it is at the read.
+func (g *Gpu) readTileRow(lcdc Byte, b Word) Byte {
+	p := &g.pipe
+	f := &p.fetch
+	if !f.window {
+		f.row = (p.ly + g.readByte(AddrSCY)) & 0x07
+	}
+	addr := 0x9000 + Word(int8(f.tile))*16
+	if lcdc&0x10 != 0 {
+		addr = 0x8000 + Word(f.tile)*16
+	}
+	row := f.row
+	if f.attr&tileAttrYFlip != 0 {
+		row = 7 - row
+	}
+	return g.readVRam(addr+Word(row)*2+b, uint8(f.attr&tileAttrBank)>>3)
+}
+
+// fetchSprite reads the row of s on the line and mixes it into the sprite
+// fifo. Where sprites overlap the one with the smaller x wins, the first in
+// oam when they have the same, and transparent pixels always lose. Cgb games
+// have the first in oam win instead, see objPriorityX.
+func (g *Gpu) fetchSprite(s *lineSprite) {
+	p := &g.pipe
+	a := AddrOam + Word(s.oam)*4
+	tile, attr := g.readByte(a+2), g.readByte(a+3)
+	height := Byte(8)
+	if g.readByte(AddrLCDC)&0x04 != 0 {
+		height = 16
+		tile &= 0xFE
+	}
+	row := p.ly + 16 - s.y
+	if attr&tileAttrYFlip != 0 {
+		row = height - 1 - row
+	}
+	bank := uint8(0)
+	palette := attr & 0x10 >> 4
+	if p.cgb {
+		bank = uint8(attr&tileAttrBank) >> 3
+		palette = attr & tileAttrPalette
+	}
+	addr := 0x8000 + Word(tile)*16 + Word(row)*2
+	lo, hi := g.readVRam(addr, bank), g.readVRam(addr+1, bank)
+	byX := !p.cgb || g.objPriorityX()
+	for p.obj.n < 8 {
+		p.obj.push(fifoPixel{})
+	}
+	for i := 0; i < 8; i++ {
+		at := int(s.x) - 8 + i - p.lx
+		if at < 0 {
+			continue
+		}
+		bit := uint(7 - i)
+		if attr&tileAttrXFlip != 0 {
+			bit = uint(i)
+		}
+		color := lo>>bit&0x01 | (hi>>bit&0x01)<<1
+		old := p.obj.at(at)
+		if color == 0 || old.color != 0 && !s.over(old, byX) {
+			continue
+		}
+		*old = fifoPixel{color: color, palette: palette, attr: attr, oam: s.oam, x: s.x}
+	}
+}
+
+// over returns true if s is drawn over the sprite pixel p, by x then by oam
+// index with byX set, else by oam index only.
+func (s *lineSprite) over(p *fifoPixel, byX bool) bool {
+	if byX && s.x != p.x {
+		return s.x < p.x
+	}
+	return s.oam < p.oam
+}
+
+// shade returns the shade palette register p gives color.
+func shade(p, color Byte) Byte {
+	return p >> (color * 2) & 0x03
+}
+
+// mixPixel returns the pixel the lcd shows for a background and a sprite
+// pixel, in the format of the lines handed to drawLine. A sprite covers the
+// background unless its BG over OBJ attribute is set and the background
+// color is not 0. On the cgb the priority attribute of the background tile
+// does the same, and LCDC bit 0 clear has sprites cover it regardless.
+func (g *Gpu) mixPixel(bg, obj fifoPixel, lcdc Byte) Byte {
+	p := &g.pipe
+	px := Byte(0)
+	bgColor := bg.color
+	if !p.cgb && lcdc&0x01 == 0 || !bg.window && g.layers&LayerBg == 0 {
+		bgColor = 0
+	} else if p.cgb {
+		px = bgColor | bg.palette<<2
+	} else {
+		px = shade(g.readByte(AddrBGP), bgColor)
+	}
+	if obj.color == 0 || lcdc&0x02 == 0 || g.layers&LayerObj == 0 {
+		return px
+	}
+	behind := obj.attr&tileAttrPriority != 0 || p.cgb && bg.attr&tileAttrPriority != 0
+	if behind && bgColor != 0 && (!p.cgb || lcdc&0x01 != 0) {
+		return px
+	}
+	if p.cgb {
+		return obj.color | obj.palette<<2 | pixelObj
+	}
+	obp := g.readByte(AddrOBP0)
+	if obj.palette != 0 {
+		obp = g.readByte(AddrOBP1)
+	}
+	// OBP1 shades are colors of cgb sprite palette 1
+	return shade(obp, obj.color) | obj.palette<<2 | pixelObj
+}
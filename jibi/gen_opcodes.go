@@ -0,0 +1,71 @@
+//go:build ignore
+// +build ignore
+
+// gen_opcodes writes opcodes_gen.go, the sm83 opcode metadata tables, from
+// sm83.json. Run it with go generate after changing the json.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strconv"
+)
+
+type op struct {
+	Opcode  string
+	Name    string
+	Bytes   int
+	Cycles  int
+	Taken   int
+	Illegal bool
+}
+
+type ops struct {
+	Base []op
+	Cb   []op
+}
+
+func table(b *bytes.Buffer, name, doc string, list []op) {
+	if len(list) != 256 {
+		log.Fatalf("%s: %d opcodes, want 256", name, len(list))
+	}
+	fmt.Fprintf(b, "\n// %s\nvar %s = [256]opMeta{\n", doc, name)
+	for i, o := range list {
+		n, err := strconv.ParseUint(o.Opcode, 0, 8)
+		if err != nil || int(n) != i {
+			log.Fatalf("%s: opcode %q at %d", name, o.Opcode, i)
+		}
+		if o.Illegal {
+			fmt.Fprintf(b, "\t0x%02X: {\"\", 0, %d, 0},\n", i, o.Cycles)
+			continue
+		}
+		fmt.Fprintf(b, "\t0x%02X: {%q, %d, %d, %d},\n", i, o.Name, o.Bytes, o.Cycles, o.Taken)
+	}
+	b.WriteString("}\n")
+}
+
+func main() {
+	data, err := ioutil.ReadFile("sm83.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	var all ops
+	if err := json.Unmarshal(data, &all); err != nil {
+		log.Fatal(err)
+	}
+	var b bytes.Buffer
+	b.WriteString("// Code generated by gen_opcodes.go from sm83.json. DO NOT EDIT.\n\npackage jibi\n")
+	table(&b, "sm83Ops", "sm83Ops are the opcodes without a prefix.", all.Base)
+	table(&b, "sm83CbOps", "sm83CbOps are the opcodes after the cb prefix.", all.Cb)
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("opcodes_gen.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,6 +1,8 @@
 package jibi
 
-import ()
+import (
+	"image"
+)
 
 // A Gpu is the graphics processing unit. It handles drawing the background,
 // window and sprites. It also triggers interrutps.
@@ -13,30 +15,69 @@ type Gpu struct {
 	// 0x1800-0x1BFF tile map 0
 	// 0x1C00-0x1FFF tile map 1
 
-	mmu     Mmu
-	mmuKeys AddressKeys
-	lcd     Lcd
-	clk     chan ClockType
+	mmu    Mmu
+	lcd    Lcd
+	cgb    bool
+	layers Layers     // layers shown
+	shades DmgPalette // colors of the dmg screen, DmgGrey when zero
 
-	bgBuffer []Byte // 256x256 background 2bit bitmap buffer
-	fgBuffer []Byte // 144x160 foreground 2bit bitmap buffer
+	states stateClock // the mode the gpu is in, clocked by the cpu
+
+	// the states, bound once as method values allocate, and the one the
+	// gpu runs next, which save states record
+	stateFns [gpuStates]CommanderStateFn
+	stateID  gpuStateID
+
+	// super gameboy colors and border, nil on other hardware
+	sgb       *sgbScreen
+	sgbBorder bool // draw 256 pixel lines with the border around the screen
+	sgbRow    int  // next border row to draw
+
+	pipe       pixelPipe      // the line being drawn
+	blankLine  [lcdWidth]Byte // drawn while the lcd is off
+	colors     [lcdWidth]Word // the line handed to a color lcd
+	hblank     uint32         // dots of the hblank after the line, 376 less mode 3
+	blankFrame bool           // the frame after the lcd is turned on is not shown
+
+	log    componentLog
+	notes  chan<- Notification // nil when the lcd shows notifications
+	events *eventBus
+
+	// pending VideoSnapshot requests
+	snapshots []chan VideoSnapshot
+
+	// pending Screenshot requests, and the ones the frame being drawn
+	// into screen is for
+	screenshots []chan *image.Gray
+	shooting    []chan *image.Gray
+	screen      *image.Gray
 
 	// metrics
+	frames        uint64
 	frameCounters []*Clock
 }
 
-// NewGpu creates a Gpu and starts a goroutine.
-func NewGpu(mmu Mmu, lcd Lcd, clk chan ClockType) *Gpu {
-	commander := NewCommander("gpu")
-	gpu := &Gpu{CommanderInterface: commander,
-		mmu: mmu, lcd: lcd, clk: clk,
-		bgBuffer: make([]Byte, 256*256),
-		fgBuffer: make([]Byte, int(lcdWidth)*int(lcdHeight)),
-	}
+// NewGpu creates a Gpu scheduled by cpu. If cgb is true the Gpu renders cgb
+// cartridges using the cgb tile attributes.
+func NewGpu(mmu Mmu, lcd Lcd, cpu *Cpu, cgb bool) *Gpu {
+	gpu := &Gpu{mmu: mmu, lcd: lcd, cgb: cgb, layers: LayersAll}
 	cmdHandlers := map[Command]CommandFn{
 		CmdFrameCounter: gpu.cmdFrameCounter,
+		CmdSnapshot:     gpu.cmdSnapshot,
+		CmdScreenshot:   gpu.cmdScreenshot,
+		CmdSetLayers:    gpu.cmdSetLayers,
+		CmdToggleLayers: gpu.cmdToggleLayers,
+		CmdNotify:       gpu.cmdNotify,
 	}
-	commander.start(gpu.stateScanlineOam, cmdHandlers, clk)
+	gpu.CommanderInterface = cpu.schedule("gpu", cmdHandlers, gpu)
+	gpu.stateFns = [gpuStates]CommanderStateFn{
+		gpuLcdOn:  gpu.stateLcdOn,
+		gpuOam:    gpu.stateScanlineOam,
+		gpuVram:   gpu.stateScanlineVram,
+		gpuHblank: gpu.stateHblank,
+		gpuVblank: gpu.stateVblank,
+	}
+	gpu.states = newStateClock(gpu.stateFns[gpuLcdOn])
 	mmu.SetGpu(gpu)
 	return gpu
 }
@@ -51,422 +92,330 @@ func (g *Gpu) cmdFrameCounter(resp interface{}) {
 	}
 }
 
-func (g *Gpu) readByte(addr Worder) Byte {
-	return g.mmu.ReadByteAt(addr, g.mmuKeys)
-}
-
-func (g *Gpu) writeByte(addr Worder, b Byter) {
-	g.mmu.WriteByteAt(addr, b, g.mmuKeys)
-}
-
-/*
-func paintTile(frameBuffer []Byte, tileData []Byte, x, y uint8, above, xflip, yflip bool, palette Byte) {
-	addr := 0
-	// convert tile data into 2bpp bitmap
-	for yOff := uint8(0); yOff < 8; yOff++ {
-		yInd := (uint16(y) + uint16(yOff)) * uint16(256)
-		l := tileData[addr]
-		h := tileData[addr+1]
-		addr += 2
-
-		for xOff := uint8(0); xOff < 8; xOff++ {
-			px := (((h >> (7 - xOff)) & 0x01) << 1) + (l>>(7-xOff))&0x01
-			ind := uint16(x) + uint16(xOff) + yInd
-			if uint32(ind) < uint32(len(frameBuffer)) {
-				frameBuffer[ind] = px
-			}
-		}
+// clock runs the gpu for t dots while it is playing.
+func (g *Gpu) clock(t uint32) {
+	if g.isPlaying() {
+		g.states.run(t)
 	}
 }
-*/
-func (g *Gpu) generateLine(line Byte) []Byte {
-	// get background
-	// TODO: bg wraps to the same X, not to X+1, same with Y
-	scy := g.readByte(AddrSCY)
-	scx := g.readByte(AddrSCX)
-	offset := uint16(line+scy)*256 + uint16(scx)
-	lbs := g.bgBuffer[offset : offset+uint16(lcdWidth)-1]
-	// TODO: draw up to 10 sprites
-
-	offset = uint16(line) * uint16(lcdWidth)
-	for i := range lbs {
-		b := g.fgBuffer[offset+uint16(i)]
-		if b > 0 {
-			lbs[i] = b
-		}
+
+// lcdOff stops the gpu when LCDC bit 7 is cleared, the mmu has already set
+// LY to 0 and STAT to mode 0. The lcd shows white until the gpu is played
+// again, which restarts it at the top of the screen.
+func (g *Gpu) lcdOff() {
+	g.pause()
+	g.stateID = gpuLcdOn
+	g.states.restart(g.stateFns[gpuLcdOn])
+	g.lcd.Blank()
+	for ly := Byte(0); ly < lcdHeight; ly++ {
+		g.drawBlankLine(ly)
 	}
-	return lbs
+	g.drawBorderRows(sgbHeight)
+	g.lcd.Blank()
 }
 
-type sprite struct {
-	t tile
-	x uint8
-	y uint8
-	// TODO: implement attribs
+func (g *Gpu) readByte(addr Word) Byte {
+	return g.mmu.Read(addr)
 }
 
-func newSprite(spriteData, tileData, palette []Byte) sprite {
-	y := uint8(spriteData[0]) - 16
-	x := uint8(spriteData[1]) - 8
-	t := newTile(tileData, palette)
-	spr := sprite{t, x, y}
-	return spr
+func (g *Gpu) writeByte(addr Word, b Byte) {
+	g.mmu.Write(addr, b)
 }
 
-func (spr sprite) Paint(buffer []Byte) {
-	spr.t.Paint(buffer, spr.x, spr.y)
+// readVRam reads from a vram bank, the gpu never uses the cpu selected bank.
+func (g *Gpu) readVRam(addr Word, bank uint8) Byte {
+	return g.mmu.ReadVRam(addr, bank)
 }
 
-func (g *Gpu) getSprites(sizeId Byte) []sprite {
-	height := uint8(8)
-	if sizeId == 1 {
-		height = 16
-	}
-	sprites := []sprite{}
-	obp0 := g.readByte(AddrOBP0)
-	obp1 := g.readByte(AddrOBP1)
-	for spriteAddr := AddrOam; spriteAddr < AddrOamEnd; spriteAddr += 4 {
-		spriteData := make([]Byte, 4)
-		spriteData[0] = g.readByte(spriteAddr)
-		spriteData[1] = g.readByte(spriteAddr + 1)
-		tileInd := g.readByte(spriteAddr + 2)
-		if height == 16 {
-			tileInd = tileInd & 0xFE
-		}
-		spriteData[2] = tileInd
-		spriteData[3] = g.readByte(spriteAddr + 3)
-		addrTile := 0x8800 + Word(Byte(tileInd+0x80))*16
-		obp := Byte(0)
-		if spriteData[3]&0x10 == 0 {
-			obp = obp0
-		} else {
-			obp = obp1
-		}
-		palette := byteToPalette(obp)
-		tileData := make([]Byte, height*2)
-		for i := range tileData {
-			tileData[i] = g.readByte(addrTile)
-			addrTile++
-		}
-		sprites = append(sprites, newSprite(spriteData, tileData, palette))
+// cgbMode returns true if a cgb cartridge is running on cgb hardware, as
+// opposed to a dmg cartridge in compatibility mode.
+func (g *Gpu) cgbMode() bool {
+	if !g.cgb {
+		return false
 	}
-	return sprites
+	return g.readByte(AddrKEY0)&0x04 == 0
 }
 
-type tile struct {
-	bitmap []Byte // 2bpp bitmap
+// drawLine hands line ly to the lcd, in color if the lcd shows color.
+func (g *Gpu) drawLine(ly Byte, line []Byte) {
+	if g.blankFrame {
+		g.drawBlankLine(ly)
+		return
+	}
+	g.shootLine(ly, line)
+	lcd, ok := g.lcd.(ColorLcd)
+	if !ok {
+		g.lcd.DrawLine(lineShades(line))
+		return
+	}
+	if g.sgb == nil {
+		lcd.DrawColorLine(g.lineColors(line))
+		return
+	}
+	g.drawColorLine(lcd, ly, g.sgb.colorLine(ly, line))
 }
 
-func newTile(tileData []Byte, palette []Byte) tile {
-	height := uint8(len(tileData) / 2)
-	bitmap := []Byte{}
-	// 8x8 tiles
-	// convert tile data into 2bpp bitmap
-	addr := 0
-	xMax := uint8(len(tileData) / 2)
-	for yOff := uint8(0); yOff < height; yOff++ {
-		l := tileData[addr]
-		h := tileData[addr+1]
-		addr += 2
-
-		for xOff := uint8(0); xOff < xMax; xOff++ {
-			px := (((h >> (7 - xOff)) & 0x01) << 1) + (l>>(7-xOff))&0x01
-			bitmap = append(bitmap, palette[px])
-		}
+// drawBlankLine hands the lcd a white line ly, what it shows while it is
+// off.
+func (g *Gpu) drawBlankLine(ly Byte) {
+	// the lcd may change the line it is handed
+	line := g.blankLine[:]
+	for i := range line {
+		line[i] = 0
+	}
+	g.shootLine(ly, line)
+	lcd, ok := g.lcd.(ColorLcd)
+	if !ok {
+		g.lcd.DrawLine(line)
+		return
 	}
-	return tile{bitmap}
+	white := dmgShades[0]
+	if !g.cgb {
+		white = g.dmgColors()[0]
+	}
+	colors := g.colors[:]
+	for i := range colors {
+		colors[i] = white
+	}
+	g.drawColorLine(lcd, ly, colors)
 }
 
-func (t tile) Paint(buffer []Byte, x, y uint8) {
-	width := uint16(0)
-	if len(buffer) == 65536 {
-		width = uint16(256)
-	} else if len(buffer) == int(lcdWidth)*int(lcdHeight) {
-		width = uint16(lcdWidth)
-	} else {
-		panic("unknown buffer type")
-	}
-	yMax := uint16(len(t.bitmap) / 8)
-	addr := 0
-	for yOff := uint16(0); yOff < yMax; yOff++ {
-		for xOff := uint16(0); xOff < 8; xOff++ {
-			px := t.bitmap[addr]
-			addr++
-			buffOff := uint16(x) + xOff + (uint16(y)+yOff)*width
-			if int(buffOff) < len(buffer) {
-				buffer[buffOff] = px
-			}
-		}
+// drawColorLine hands line ly to a color lcd, inside the sgb border when it
+// is shown.
+func (g *Gpu) drawColorLine(lcd ColorLcd, ly Byte, colors []Word) {
+	if g.sgb == nil || !g.sgbBorder {
+		lcd.DrawColorLine(colors)
+		return
 	}
+	if ly == 0 {
+		g.sgbRow = 0
+	}
+	g.drawBorderRows(sgbScreenY + int(ly))
+	lcd.DrawColorLine(g.sgb.borderLine(g.sgbRow, colors))
+	g.sgbRow++
 }
 
-func (g *Gpu) getWinTiles(tilemap, tileset Byte, palette []Byte) []tile {
-	addrTilemap := Word(0x9800)
-	if tilemap == 1 {
-		addrTilemap = 0x9C00
-	}
-	addrTileset := Word(0x8800)
-	if tileset == 1 {
-		addrTileset = 0x8000
-	}
-
-	tiles := []tile{}
-	for t := Word(0x0000); t < 0x0400; t++ {
-		tileData := make([]Byte, 16)
-		tileInd := g.readByte(addrTilemap + t)
-		addrTile := Word(0)
-		if tileset == 0 {
-			addrTile = addrTileset + Word(Byte(tileInd+0x80))*16
-		} else {
-			addrTile = addrTileset + Word(tileInd)*16
-		}
-		for i := Word(0); i < 16; i++ {
-			tileData[i] = g.readByte(addrTile + i)
-		}
-		tiles = append(tiles, newTile(tileData, palette))
+// drawBorderRows draws the rows of the sgb border up to row end, when the
+// border is shown.
+func (g *Gpu) drawBorderRows(end int) {
+	lcd, ok := g.lcd.(ColorLcd)
+	if !ok || g.sgb == nil || !g.sgbBorder {
+		return
+	}
+	for ; g.sgbRow < end; g.sgbRow++ {
+		lcd.DrawColorLine(g.sgb.borderLine(g.sgbRow, nil))
 	}
-
-	return tiles
 }
 
-func (g *Gpu) getBgTiles(tilemap, tileset Byte, palette []Byte) []tile {
-	addrTilemap := Word(0x9800)
-	if tilemap == 1 {
-		addrTilemap = 0x9C00
-	}
-	addrTileset := Word(0x8800)
-	if tileset == 1 {
-		addrTileset = 0x8000
-	}
-
-	tiles := []tile{}
-	for t := Word(0x0000); t < 0x0400; t++ {
-		tileData := make([]Byte, 16)
-		tileInd := g.readByte(addrTilemap + t)
-		addrTile := Word(0)
-		if tileset == 0 {
-			addrTile = addrTileset + Word(Byte(tileInd+0x80))*16
-		} else {
-			addrTile = addrTileset + Word(tileInd)*16
+// sgbVRam reads the 4KB an sgb vram transfer sees, the data of the tiles in
+// the first 20x13 cells of the background map.
+func (g *Gpu) sgbVRam() []Byte {
+	lcdc := g.readByte(AddrLCDC)
+	tilemap := Word(0x9800)
+	if lcdc&0x08 != 0 {
+		tilemap = 0x9C00
+	}
+	data := make([]Byte, 0, 0x1000)
+	for t := Word(0); t < 256; t++ {
+		ind := g.readVRam(tilemap+t/20*32+t%20, 0)
+		addr := 0x8800 + Word(Byte(ind+0x80))*16
+		if lcdc&0x10 != 0 {
+			addr = 0x8000 + Word(ind)*16
 		}
 		for i := Word(0); i < 16; i++ {
-			tileData[i] = g.readByte(addrTile + i)
+			data = append(data, g.readVRam(addr+i, 0))
 		}
-		tiles = append(tiles, newTile(tileData, palette))
 	}
-
-	return tiles
+	return data
 }
 
-func byteToPalette(p Byte) []Byte {
-	return []Byte{p & 0x03, p & 0x0C >> 2, p & 0x30 >> 4, p & 0xC0 >> 6}
+// pixelObj marks the pixels of a line that sprites painted, their palette
+// number is a sprite palette
+const pixelObj Byte = 0x20
+
+// lineShades returns the color numbers of the pixels of a line.
+func lineShades(line []Byte) []Byte {
+	for i := range line {
+		line[i] &= 0x03
+	}
+	return line
 }
 
-func (g *Gpu) generateFrame() {
-	g.lockAddr(AddrVRam) // TODO: this should be in scanline vram
-	defer g.unlockAddr(AddrVRam)
+// dmgShades are the 4 shades of the dmg as 15 bit rgb
+var dmgShades = [4]Word{0x7FFF, 0x56B5, 0x294A, 0x0000}
 
-	// clear foreground buffer
-	for i := range g.fgBuffer {
-		g.fgBuffer[i] = 0
+// dmgColors returns the colors the dmg shows its shades in.
+func (g *Gpu) dmgColors() DmgPalette {
+	if g.shades == (DmgPalette{}) {
+		return DmgGrey
 	}
+	return g.shades
+}
 
-	lcdc := g.readByte(AddrLCDC)
-	// read in map, tileset data
-	windowTilemap := (lcdc & 0x40) >> 6
-	windowDisplay := lcdc&0x20 == 0x20
-	bgTileset := (lcdc & 0x10) >> 4
-	bgTilemap := (lcdc & 0x08) >> 3
-	objSpriteSize := (lcdc & 0x04) >> 2
-	objDisplay := lcdc&0x02 == 0x02
-	bgWinDisplay := lcdc&0x01 == 0x01
-
-	// draw background
-	if bgWinDisplay {
-		x := uint8(0)
-		y := uint8(0)
-		bgp := g.readByte(AddrBGP)
-		palette := byteToPalette(bgp)
-		for _, bgtile := range g.getBgTiles(bgTilemap, bgTileset, palette) {
-			bgtile.Paint(g.bgBuffer, x, y)
-			x += 8
-			if x == 0 {
-				y += 8
-			}
-		}
-
-		if windowDisplay {
-			// TODO: this has to be handled line by line
-			// wx is read on screen redraw and after a scan line interrupt
-			// wy is read on screen redraw
-			wx := g.readByte(AddrWX)
-			wy := g.readByte(AddrWY)
-			x = uint8(wx) - 7
-			y = uint8(wy)
-			palette := byteToPalette(bgp)
-			for _, wintile := range g.getWinTiles(windowTilemap, bgTileset, palette) {
-				wintile.Paint(g.fgBuffer, x, y)
-				x += 8
-				if x == 0 {
-					y += 8
-				}
-			}
+// lineColors converts the pixels of a line to 15 bit rgb. On the cgb they
+// index palette memory, dmg cartridges use the shades of BGP, OBP0 and OBP1
+// as colors of palettes 0, 0 and 1 like the cgb bios sets them up. The dmg
+// shows its shades in the colors of g.shades. The colors are only good until
+// the next line.
+func (g *Gpu) lineColors(line []Byte) []Word {
+	colors := g.colors[:len(line)]
+	if !g.cgb {
+		shades := g.dmgColors()
+		for i, px := range line {
+			colors[i] = shades[px&0x03]
 		}
+		return colors
+	}
+	for i, px := range line {
+		colors[i] = g.mmu.ReadPaletteColor(px&pixelObj != 0, px>>2&0x07, px&0x03)
 	}
+	return colors
+}
 
-	// draw sprites (oam)
-	if objDisplay {
-		g.lockAddr(AddrOam) // TODO: this should be in scanline oam
-		sprites := g.getSprites(objSpriteSize)
-		g.unlockAddr(AddrOam)
-		for _, spr := range sprites {
-			spr.Paint(g.fgBuffer)
-		}
+// cgb bg map attributes, stored in vram bank 1 at the same offset as the
+// tile index. The attributes of sprites in oam have the same bits.
+const (
+	tileAttrPalette  Byte = 0x07
+	tileAttrBank     Byte = 0x08
+	tileAttrXFlip    Byte = 0x20
+	tileAttrYFlip    Byte = 0x40
+	tileAttrPriority Byte = 0x80
+)
+
+// objPriorityX returns true if overlapping sprites are prioritized by x
+// coordinate, as on the dmg. The cgb selects this with OPRI, the cgb bios
+// sets it when running dmg cartridges.
+func (g *Gpu) objPriorityX() bool {
+	if !g.cgb {
+		return true
 	}
-	/*
-		// draw sprites (oam)
-		if objDisplay {
-			addrTileset := Word(0x8000)
-			oamaddr := Word(0xFE00)
-			spriteSize := Word(16)
-			if bgSpriteSize == 1 {
-				spriteSize = 32
-			}
-			tileData := make([]Byte, spriteSize)
-
-			for sprite := Word(0x0000); sprite < 0x00A0; sprite += 4 {
-				x := uint8(g.readByte(oamaddr+sprite) - 8)
-				y := uint8(g.readByte(oamaddr+sprite+1) - 16)
-				tile := g.readByte(oamaddr + sprite + 2)
-				if bgSpriteSize == 1 {
-					tile = tile & 0xEF
-				}
-				attr := g.readByte(oamaddr + sprite + 3)
-				above := attr&0x80 == 0
-				yflip := attr&0x40 == 0x80
-				xflip := attr&0x20 == 0x40
-				palette := attr & 0x10 >> 1
-				ind := addrTileset + Word(tile)*spriteSize
-				for j := Word(0); j < spriteSize; j++ {
-					tileData[j] = g.readByte(ind + j)
-				}
-				paintTile(g.frameBuffer, tileData, x, y, above, xflip, yflip, palette)
-			}
-		}
-	*/
+	return g.readByte(AddrOPRI)&0x01 == 0x01
 }
 
-func (g *Gpu) lockAddr(addr Worder) {
-	g.mmuKeys = g.mmu.LockAddr(addr, g.mmuKeys)
+// a gpuStateID names a state of the gpu.
+type gpuStateID uint8
+
+const (
+	gpuLcdOn gpuStateID = iota
+	gpuOam
+	gpuVram
+	gpuHblank
+	gpuVblank
+	gpuStates
+)
+
+// next returns state s to run next, recording it for save states.
+func (g *Gpu) next(s gpuStateID, first bool, t, tnext uint32) (CommanderStateFn, bool, uint32, uint32) {
+	g.stateID = s
+	return g.stateFns[s], first, t, tnext
 }
 
-func (g *Gpu) unlockAddr(addr Worder) {
-	g.mmuKeys = g.mmu.UnlockAddr(addr, g.mmuKeys)
+// setStat sets the lcd mode and the LY=LYC coincidence flag in STAT, the mmu
+// raises the stat interrupt from them. It returns LY.
+func (g *Gpu) setStat(mode Byte) Byte {
+	ly := g.readByte(AddrLY)
+	stat := g.readByte(AddrSTAT)&0x78 | mode
+	if ly == g.readByte(AddrLYC) {
+		stat |= 0x04
+	}
+	g.mmu.Hardware().Write(AddrSTAT, stat)
+	return ly
 }
 
-func (g *Gpu) stateScanlineOam(first bool, t uint32) (CommanderStateFn, bool, uint32, uint32) {
-	g.lockAddr(AddrGpuRegs)
-	defer g.unlockAddr(AddrGpuRegs)
+// stateLcdOn starts the gpu when the lcd is turned on. The first line has no
+// oam scan, STAT shows mode 0 where mode 2 would be and the oam source of
+// the stat interrupt does not fire, and the frame is not shown.
+func (g *Gpu) stateLcdOn(first bool, t uint32) (CommanderStateFn, bool, uint32, uint32) {
 	if first {
-		//g.lockAddr(AddrOam)
-		stat := g.readByte(AddrSTAT)
-		stat = stat&0x7C | 0x2 // mode 2
-		ly := g.readByte(AddrLY)
-		lyc := g.readByte(AddrLYC)
-		if ly == lyc {
-			stat |= 0x04
-		} else {
-			stat &= (0x04 ^ 0xFF)
-		}
-		g.writeByte(AddrSTAT, stat)
-		if (ly == lyc) && (stat&(0x40|0x20) == (0x40 | 0x20)) { // lyc=ly and mode 2
-			g.mmu.SetInterrupt(InterruptLCDC, g.mmuKeys)
-		}
+		g.blankFrame = true
+		g.pipe.newFrame()
+		// compares LY with LYC
+		g.mmu.Hardware().Write(AddrLY, 0)
+		g.publishLcd(LcdModeHBlank, 0)
 	}
 	if t >= 80 {
 		t -= 80
-		//g.unlockAddr(AddrOam)
-		return g.stateScanlineVram, true, t, 172
+		g.pipe.sprites = g.pipe.sprites[:0]
+		g.startLine(0)
+		return g.next(gpuVram, true, t, 1)
 	}
-	return g.stateScanlineOam, false, t, 80
+	return g.next(gpuLcdOn, false, t, 80)
 }
 
-func (g *Gpu) stateScanlineVram(first bool, t uint32) (CommanderStateFn, bool, uint32, uint32) {
-	g.lockAddr(AddrGpuRegs)
-	defer g.unlockAddr(AddrGpuRegs)
+func (g *Gpu) stateScanlineOam(first bool, t uint32) (CommanderStateFn, bool, uint32, uint32) {
 	if first {
-		//g.lockAddr(AddrVRam)
-		stat := g.readByte(AddrSTAT)
-		stat = stat&0x7C | 0x3 // mode 3
-		g.writeByte(AddrSTAT, stat)
+		ly := g.setStat(LcdModeOam)
+		g.publishLcd(LcdModeOam, ly)
+	}
+	if t >= 80 {
+		t -= 80
 		ly := g.readByte(AddrLY)
-		g.lcd.DrawLine(g.generateLine(ly))
+		g.scanOam(ly)
+		g.startLine(ly)
+		return g.next(gpuVram, true, t, 1)
 	}
-	if t >= 172 {
-		t -= 172
-		//g.unlockAddr(AddrVRam)
-		return g.stateHblank, true, t, 204
+	return g.next(gpuOam, false, t, 80)
+}
+
+// stateScanlineVram draws the line a dot at a time for as many dots as there
+// are, mode 3 takes from 172 dots up depending on SCX, the window and the
+// sprites on the line.
+func (g *Gpu) stateScanlineVram(first bool, t uint32) (CommanderStateFn, bool, uint32, uint32) {
+	if first {
+		ly := g.setStat(LcdModeVRam)
+		g.publishLcd(LcdModeVRam, ly)
 	}
-	if !first {
-		panic("wasted gpu cycle")
+	for t > 0 {
+		t--
+		if g.dot() {
+			g.drawLine(g.pipe.ly, g.pipe.line[:])
+			g.hblank = 376 - g.pipe.dots
+			return g.next(gpuHblank, true, t, g.hblank)
+		}
 	}
-	return g.stateScanlineVram, false, t, 172
+	return g.next(gpuVram, false, t, 1)
 }
 
 func (g *Gpu) stateHblank(first bool, t uint32) (CommanderStateFn, bool, uint32, uint32) {
-	g.lockAddr(AddrGpuRegs)
-	defer g.unlockAddr(AddrGpuRegs)
 	if first {
-		stat := g.readByte(AddrSTAT)
-		stat = stat&0x7C | 0x1 // mode 1
-		ly := g.readByte(AddrLY)
-		lyc := g.readByte(AddrLYC)
-		if ly == lyc {
-			stat |= 0x04
-		} else {
-			stat &= (0x04 ^ 0xFF)
-		}
-		g.writeByte(AddrSTAT, stat)
-		if (ly == lyc) && (stat&(0x40|0x10) == (0x40 | 0x10)) { // lyc=ly and mode 1
-			g.mmu.SetInterrupt(InterruptLCDC, g.mmuKeys)
-		}
+		ly := g.setStat(LcdModeHBlank)
+		g.publishLcd(LcdModeHBlank, ly)
 	}
-	if t >= 204 {
-		t -= 204
+	if t >= g.hblank {
+		t -= g.hblank
 		ly := g.readByte(AddrLY)
 		ly++
-		g.mmu.WriteByteAt(AddrLY, ly, g.mmuKeys|AddressKeys(abElevated))
-		if ly == lcdHeight-1 {
-			return g.stateVblank, true, t, 456
+		g.mmu.Hardware().Write(AddrLY, ly)
+		if ly == lcdHeight {
+			return g.next(gpuVblank, true, t, 456)
 		}
-		return g.stateScanlineOam, true, t, 80
+		return g.next(gpuOam, true, t, 80)
 	}
-	if !first {
-		panic("wasted gpu cycle")
-	}
-	return g.stateHblank, false, t, 204
+	return g.next(gpuHblank, false, t, g.hblank)
 }
 
 func (g *Gpu) stateVblank(first bool, t uint32) (CommanderStateFn, bool, uint32, uint32) {
-	g.lockAddr(AddrGpuRegs)
-	defer g.unlockAddr(AddrGpuRegs)
 	if first {
-		stat := g.readByte(AddrSTAT)
-		stat = stat&0x7C | 0x0 // mode 0
-		ly := g.readByte(AddrLY)
-		lyc := g.readByte(AddrLYC)
-		if ly == lyc {
-			stat |= 0x04
-		} else {
-			stat &= (0x04 ^ 0xFF)
+		// line 144 starts like the others, the oam source of the stat
+		// interrupt fires before vblank
+		g.setStat(LcdModeOam)
+		ly := g.setStat(LcdModeVBlank)
+		g.mmu.SetInterrupt(InterruptVblank)
+		g.publishLcd(LcdModeVBlank, ly)
+		g.drawBorderRows(sgbHeight)
+		g.lcd.Blank()
+		if g.sgb != nil && g.sgb.pendingTransfer() {
+			g.sgb.transfer(g.sgbVRam())
 		}
-		g.writeByte(AddrSTAT, stat)
-		if (ly == lyc) && (stat&(0x40|0x04) == (0x40 | 0x04)) { // lyc=ly and mode 0
-			g.mmu.SetInterrupt(InterruptLCDC, g.mmuKeys)
+		g.pipe.newFrame()
+		g.blankFrame = false
+		g.frames++
+		if g.log.l != nil {
+			// the frame number allocates as an interface{}
+			g.log.Debug("frame", "n", g.frames)
 		}
-		g.mmu.SetInterrupt(InterruptVblank, g.mmuKeys)
-		g.lcd.Blank()
-		g.generateFrame()
+		g.takeSnapshots()
+		g.takeScreenshots()
 		for _, clk := range g.frameCounters {
 			clk.AddCycles(1)
 		}
@@ -477,14 +426,15 @@ func (g *Gpu) stateVblank(first bool, t uint32) (CommanderStateFn, bool, uint32,
 		ly++
 		if ly > lcdHeight-1+10 {
 			ly = 0
-			g.mmu.WriteByteAt(AddrLY, ly, g.mmuKeys|AddressKeys(abElevated))
-			return g.stateScanlineOam, true, t, 80
+			g.mmu.Hardware().Write(AddrLY, ly)
+			return g.next(gpuOam, true, t, 80)
 		}
-		g.mmu.WriteByteAt(AddrLY, ly, g.mmuKeys|AddressKeys(abElevated))
-		return g.stateVblank, false, t, 456
+		g.mmu.Hardware().Write(AddrLY, ly)
+		g.setStat(LcdModeVBlank)
+		return g.next(gpuVblank, false, t, 456)
 	}
 	if !first {
 		panic("wasted gpu cycle")
 	}
-	return g.stateVblank, false, t, 456
+	return g.next(gpuVblank, false, t, 456)
 }
@@ -0,0 +1,424 @@
+package jibi
+
+import (
+	"image"
+	"testing"
+)
+
+func TestLineColors(t *testing.T) {
+	g := &Gpu{mmu: NewMmu(nil, false)}
+	line := []Byte{0, 1, 2, 3 | pixelObj}
+	if c := g.lineColors(line); c[0] != 0x7FFF || c[1] != 0x56B5 || c[3] != 0 {
+		t.Errorf("dmg %04X", c)
+	}
+	g.shades = DmgGreen
+	if c := g.lineColors([]Byte{0, 1, 2, 3 | pixelObj}); c[0] != DmgGreen[0] || c[3] != DmgGreen[3] {
+		t.Errorf("dmg green %04X", c)
+	}
+
+	mmu := NewMmu(nil, true)
+	mmu.Write(AddrBCPS, 0x80|(2*8+1*2)) // bg palette 2 color 1
+	mmu.Write(AddrBCPD, 0x1F)
+	mmu.Write(AddrBCPD, 0x80) // bit 15 is ignored
+	mmu.Write(AddrOCPS, 0x80|(2*8+1*2))
+	mmu.Write(AddrOCPD, 0x00)
+	mmu.Write(AddrOCPD, 0x7C)
+	g = &Gpu{mmu: mmu, cgb: true}
+	line = []Byte{2<<2 | 1, 2<<2 | 1 | pixelObj, 2<<2 | 1 | tileAttrPriority, 0}
+	c := g.lineColors(line)
+	for i, want := range []Word{0x001F, 0x7C00, 0x001F, 0x0000} {
+		if c[i] != want {
+			t.Errorf("%d: %04X", i, c[i])
+		}
+	}
+}
+
+// newLineGpu returns a dmg gpu drawn by the test, with tile 1 a solid color
+// 3 tile and regs written to the gpu registers. LCDC bit 7 is left clear,
+// there is no gpu to start.
+func newLineGpu(regs map[Word]Byte) *Gpu {
+	g := &Gpu{mmu: NewMmu(nil, false), layers: LayersAll}
+	for a := Word(0x8010); a < 0x8020; a++ {
+		g.writeByte(a, Byte(0xFF))
+	}
+	g.writeByte(AddrBGP, Byte(0xE4))
+	g.writeByte(AddrOBP0, Byte(0xE4))
+	for a, b := range regs {
+		g.writeByte(a, b)
+	}
+	return g
+}
+
+// drawLineDots draws line ly and returns the dots mode 3 took, calling at
+// after every dot.
+func drawLineDots(g *Gpu, ly Byte, at func(dot uint32)) uint32 {
+	g.scanOam(ly)
+	g.startLine(ly)
+	for !g.dot() {
+		if at != nil {
+			at(g.pipe.dots)
+		}
+	}
+	return g.pipe.dots
+}
+
+func TestMode3Length(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		regs     map[Word]Byte
+		min, max uint32
+	}{
+		{"plain", map[Word]Byte{AddrLCDC: 0x11}, 172, 172},
+		{"scx", map[Word]Byte{AddrLCDC: 0x11, AddrSCX: 5}, 177, 177},
+		{"window", map[Word]Byte{AddrLCDC: 0x31, AddrWX: 87}, 178, 178},
+		{"sprite", map[Word]Byte{AddrLCDC: 0x13, AddrOam: 16, AddrOam + 1: 50}, 178, 183},
+		{"sprite off", map[Word]Byte{AddrLCDC: 0x11, AddrOam: 16, AddrOam + 1: 50}, 172, 172},
+		{"sprites", map[Word]Byte{AddrLCDC: 0x13, AddrOam: 16, AddrOam + 1: 50,
+			AddrOam + 4: 16, AddrOam + 5: 50}, 184, 189},
+	} {
+		if d := drawLineDots(newLineGpu(c.regs), 0, nil); d < c.min || d > c.max {
+			t.Errorf("%s: mode 3 took %d dots", c.name, d)
+		}
+	}
+}
+
+func TestLinePixels(t *testing.T) {
+	// tile 1 at map column 1 and the sprite over it at x 10-17
+	g := newLineGpu(map[Word]Byte{AddrLCDC: 0x13, 0x9801: 1, AddrSCX: 2,
+		AddrOam: 16, AddrOam + 1: 18, AddrOam + 2: 1, AddrOBP0: 0x40})
+	drawLineDots(g, 0, nil)
+	line := g.pipe.line
+	for x, want := range map[int]Byte{5: 0, 6: 3, 9: 3, 10: 1 | pixelObj, 17: 1 | pixelObj, 18: 0} {
+		if line[x] != want {
+			t.Errorf("pixel %d: 0x%02X", x, line[x])
+		}
+	}
+
+	// BGP written in the middle of the line shows from there on
+	g = newLineGpu(map[Word]Byte{AddrLCDC: 0x11})
+	drawLineDots(g, 0, func(dot uint32) {
+		if dot == 100 {
+			g.writeByte(AddrBGP, Byte(0xE5))
+		}
+	})
+	if line := g.pipe.line; line[0] != 0 || line[len(line)-1] != 1 {
+		t.Errorf("first 0x%02X last 0x%02X", line[0], line[len(line)-1])
+	}
+}
+
+func TestLineSpriteLimit(t *testing.T) {
+	// 12 sprites on line 0 after 2 lower down, a sprite every 8 pixels
+	regs := map[Word]Byte{AddrLCDC: 0x13}
+	for i := Word(0); i < 14; i++ {
+		regs[AddrOam+i*4] = 16
+		regs[AddrOam+i*4+1] = Byte(8 + i*8)
+		regs[AddrOam+i*4+2] = 1
+	}
+	regs[AddrOam], regs[AddrOam+4] = 40, 40
+	g := newLineGpu(regs)
+	drawLineDots(g, 0, nil)
+	if n := len(g.pipe.sprites); n != lineSpriteLimit {
+		t.Fatalf("%d sprites on the line", n)
+	}
+	for i, s := range g.pipe.sprites {
+		if want := uint8(i + 2); s.oam != want {
+			t.Errorf("sprite %d is oam %d", i, s.oam)
+		}
+	}
+	line := g.pipe.line
+	for x := 0; x < 8*14; x += 8 {
+		obj := line[x]&pixelObj != 0
+		if want := x >= 16 && x < 96; obj != want {
+			t.Errorf("pixel %d: 0x%02X", x, line[x])
+		}
+	}
+}
+
+func TestSpritePriority(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		x0, x1 Byte // x of oam 0 with OBP0 and oam 1 with OBP1
+		pixels map[int]Byte
+	}{
+		{"smaller x", 20, 18, map[int]Byte{10: 0x27, 12: 0x27, 17: 0x27, 18: 0x23}},
+		{"smaller x off the left", 6, 3, map[int]Byte{0: 0x27, 2: 0x27, 3: 0x23, 5: 0x23}},
+		{"same x", 20, 20, map[int]Byte{12: 0x23, 19: 0x23}},
+	} {
+		g := newLineGpu(map[Word]Byte{AddrLCDC: 0x13, AddrOBP1: 0xE4,
+			AddrOam: 16, AddrOam + 1: c.x0, AddrOam + 2: 1,
+			AddrOam + 4: 16, AddrOam + 5: c.x1, AddrOam + 6: 1, AddrOam + 7: 0x10})
+		drawLineDots(g, 0, nil)
+		for x, want := range c.pixels {
+			if px := g.pipe.line[x]; px != want {
+				t.Errorf("%s: pixel %d: 0x%02X", c.name, x, px)
+			}
+		}
+	}
+
+	// BG over OBJ hides the sprite where the background is not color 0,
+	// tile 1 at map column 1 is color 3
+	g := newLineGpu(map[Word]Byte{AddrLCDC: 0x13, 0x9801: 1, AddrBGP: 0x1B,
+		AddrOam: 16, AddrOam + 1: 12, AddrOam + 2: 1, AddrOam + 3: 0x80})
+	drawLineDots(g, 0, nil)
+	for x, want := range map[int]Byte{4: 0x23, 7: 0x23, 8: 0, 11: 0} {
+		if px := g.pipe.line[x]; px != want {
+			t.Errorf("bg over obj: pixel %d: 0x%02X", x, px)
+		}
+	}
+}
+
+func TestCgbTileAttributes(t *testing.T) {
+	g := &Gpu{mmu: NewMmu(nil, true), cgb: true, layers: LayersAll}
+	vbk := func(bank Byte) {
+		g.writeByte(AddrVBK, bank)
+	}
+	// tile 1 in bank 0 has color 1 on the left of row 0 and is color 2
+	// below, in bank 1 it is color 3
+	g.writeByte(Word(0x8010), Byte(0xF0))
+	for row := Word(1); row < 8; row++ {
+		g.writeByte(0x8011+row*2, Byte(0xFF))
+	}
+	vbk(1)
+	for a := Word(0x8010); a < 0x8020; a++ {
+		g.writeByte(a, Byte(0xFF))
+	}
+	// map columns 0-4 show tile 1 with these attributes, the sprite over
+	// column 4 is color 3 in palette 6
+	attrs := []Byte{5, tileAttrXFlip, tileAttrBank, tileAttrYFlip, tileAttrPriority | 2}
+	for i, attr := range attrs {
+		g.writeByte(0x9800+Word(i), attr)
+	}
+	vbk(0)
+	for i := range attrs {
+		g.writeByte(0x9800+Word(i), Byte(1))
+	}
+	for a, b := range map[Word]Byte{AddrOam: 16, AddrOam + 1: 40, AddrOam + 2: 1, AddrOam + 3: 0x0E} {
+		g.writeByte(a, b)
+	}
+
+	g.writeByte(AddrLCDC, Byte(0x13))
+	drawLineDots(g, 0, nil)
+	obj := 3 | 6<<2 | pixelObj
+	for x, want := range map[int]Byte{
+		0: 1 | 5<<2, 3: 1 | 5<<2, 4: 5 << 2, 7: 5 << 2, // palette
+		8: 0, 11: 0, 12: 1, 15: 1, // x flip
+		16: 3, 23: 3, // bank
+		24: 2, 31: 2, // y flip
+		32: 1 | 2<<2, 35: 1 | 2<<2, 36: obj, 39: obj, // priority
+		40: 0,
+	} {
+		if px := g.pipe.line[x]; px != want {
+			t.Errorf("pixel %d: 0x%02X, not 0x%02X", x, px, want)
+		}
+	}
+
+	// with LCDC bit 0 clear sprites cover the background regardless
+	g.writeByte(AddrLCDC, Byte(0x12))
+	drawLineDots(g, 0, nil)
+	if px := g.pipe.line[32]; px != obj {
+		t.Errorf("lcdc bit 0 clear: pixel 32: 0x%02X", px)
+	}
+}
+
+func TestCgbSpritePriority(t *testing.T) {
+	// oam 0 at x 12-19 in palette 1 and oam 1 at x 10-17 in palette 2
+	for _, c := range []struct {
+		opri    Byte
+		overlap Byte
+	}{
+		{0x00, 3 | 1<<2 | pixelObj}, // first in oam wins
+		{0x01, 3 | 2<<2 | pixelObj}, // smaller x wins, as on the dmg
+	} {
+		g := &Gpu{mmu: NewMmu(nil, true), cgb: true, layers: LayersAll}
+		g.writeByte(AddrOPRI, c.opri)
+		if b := g.mmu.Read(AddrOPRI); b != 0xFE|c.opri {
+			t.Errorf("OPRI reads 0x%02X", b)
+		}
+		for a := Word(0x8010); a < 0x8020; a++ {
+			g.writeByte(a, Byte(0xFF))
+		}
+		for a, b := range map[Word]Byte{AddrLCDC: 0x13,
+			AddrOam: 16, AddrOam + 1: 20, AddrOam + 2: 1, AddrOam + 3: 1,
+			AddrOam + 4: 16, AddrOam + 5: 18, AddrOam + 6: 1, AddrOam + 7: 2} {
+			g.writeByte(a, b)
+		}
+		drawLineDots(g, 0, nil)
+		for x, want := range map[int]Byte{10: 3 | 2<<2 | pixelObj, 12: c.overlap,
+			17: c.overlap, 18: 3 | 1<<2 | pixelObj} {
+			if px := g.pipe.line[x]; px != want {
+				t.Errorf("OPRI %d: pixel %d: 0x%02X, not 0x%02X", c.opri, x, px, want)
+			}
+		}
+	}
+}
+
+func TestWindowLines(t *testing.T) {
+	// the window map at 0x9800 is tile 2, its row r has color r&3, the
+	// background at 0x9C00 is tile 0
+	regs := map[Word]Byte{AddrLCDC: 0x39, AddrWX: 87}
+	for r := Word(0); r < 8; r++ {
+		regs[0x8020+r*2] = Byte(0xFF * (r & 1))
+		regs[0x8021+r*2] = Byte(0xFF * (r >> 1 & 1))
+	}
+	for a := Word(0x9800); a < 0x9820; a++ {
+		regs[a] = 2
+	}
+	for _, c := range []struct {
+		name   string
+		lines  []func(g *Gpu) // register writes before each line
+		colors []Byte         // pixel 80 of each line, 0xFF for the background
+	}{
+		{"counter", []func(g *Gpu){
+			nil, nil,
+			func(g *Gpu) { g.writeByte(AddrLCDC, Byte(0x19)) },
+			func(g *Gpu) { g.writeByte(AddrLCDC, Byte(0x39)) },
+			func(g *Gpu) { g.writeByte(AddrWX, Byte(200)) },
+			func(g *Gpu) { g.writeByte(AddrWX, Byte(87)) },
+		}, []Byte{0, 1, 0xFF, 2, 0xFF, 3}},
+		{"wy latched", []func(g *Gpu){
+			func(g *Gpu) { g.writeByte(AddrWY, Byte(1)) },
+			nil,
+			func(g *Gpu) { g.writeByte(AddrWY, Byte(0)) },
+		}, []Byte{0xFF, 0, 1}},
+		{"wy missed", []func(g *Gpu){
+			func(g *Gpu) { g.writeByte(AddrWY, Byte(1)) },
+			func(g *Gpu) { g.writeByte(AddrWY, Byte(0)) },
+			nil,
+		}, []Byte{0xFF, 0xFF, 0xFF}},
+	} {
+		g := newLineGpu(regs)
+		for ly, write := range c.lines {
+			if write != nil {
+				write(g)
+			}
+			drawLineDots(g, Byte(ly), nil)
+			want := c.colors[ly]
+			if window := want != 0xFF; g.pipe.fetch.window != window {
+				t.Errorf("%s: line %d: window %v", c.name, ly, g.pipe.fetch.window)
+			} else if !window {
+				want = 0
+			}
+			if px := g.pipe.line[80]; px != want {
+				t.Errorf("%s: line %d: pixel 80: 0x%02X", c.name, ly, px)
+			}
+		}
+	}
+}
+
+func TestScrollLines(t *testing.T) {
+	// tile 1 at map column 1 of row 0, row 1 is all tile 1
+	regs := map[Word]Byte{AddrLCDC: 0x11, 0x9801: 1}
+	for a := Word(0x9820); a < 0x9840; a++ {
+		regs[a] = 1
+	}
+	g := newLineGpu(regs)
+	for ly, c := range []struct {
+		scx, scy, lcdc Byte
+		first, last    int // pixels of tile 1 on the line
+	}{
+		{0, 0, 0x11, 8, 15},
+		{3, 0, 0x11, 5, 12},
+		{10, 0, 0x11, 0, 5},
+		{0, 7, 0x11, 0, 159}, // line 3 shows row 1
+		{0, 0, 0x19, -1, -1}, // the empty 0x9C00 map
+		{4, 0, 0x11, 4, 11},
+	} {
+		// what a hblank interrupt would write before the line
+		g.writeByte(AddrSCX, c.scx)
+		g.writeByte(AddrSCY, c.scy)
+		g.writeByte(AddrLCDC, c.lcdc)
+		drawLineDots(g, Byte(ly), nil)
+		first, last := -1, -1
+		for x, px := range g.pipe.line {
+			if px == 3 {
+				if first < 0 {
+					first = x
+				}
+				last = x
+			}
+		}
+		if first != c.first || last != c.last {
+			t.Errorf("line %d scx %d scy %d lcdc 0x%02X: tile 1 at %d-%d", ly, c.scx, c.scy, c.lcdc, first, last)
+		}
+	}
+}
+
+func TestStatVblankOam(t *testing.T) {
+	for _, c := range []struct {
+		stat Byte
+		irq  bool
+	}{
+		{0x20, true},  // the oam source at line 144
+		{0x28, false}, // held high by hblank
+		{0x00, false},
+	} {
+		g := newLineGpu(map[Word]Byte{AddrLCDC: 0x11})
+		lcd := NewLcd(false)
+		lcd.DisableRender()
+		g.lcd = lcd
+		hw := g.mmu.Hardware()
+		hw.Write(AddrLY, lcdHeight-1)
+		hw.Write(AddrSTAT, c.stat|LcdModeHBlank)
+		hw.Write(AddrIF, 0)
+		g.stateHblank(false, 0)
+		g.stateVblank(true, 0)
+		if irq := g.readByte(AddrIF)&Byte(InterruptLCDC) != 0; irq != c.irq {
+			t.Errorf("STAT 0x%02X: irq %t", c.stat, irq)
+		}
+		if mode := g.readByte(AddrSTAT) & 0x03; mode != LcdModeVBlank {
+			t.Errorf("STAT 0x%02X: mode %d", c.stat, mode)
+		}
+	}
+}
+
+func TestLcdOff(t *testing.T) {
+	rom := headerRom("LCDOFF", 2)
+	copy(rom[0x0100:], []Byte{
+		0x3E, 0xFF, 0xE0, 0x47, // LD A, 0xFF; LDH (BGP), A, a black screen
+		0x3E, 0x11, 0xE0, 0x40, // lcd off
+		0x40,                   // LD B, B
+		0x3E, 0x91, 0xE0, 0x40, // lcd on
+		0x40,       // LD B, B
+		0x18, 0xFE, // JR -2
+	})
+	breaks := 0
+	var first, second *image.Gray
+	shots := make(chan *image.Gray, 1)
+	_, done, err := runTestRom(rom, 60, Options{}, true, func(j Jibi, brk string) bool {
+		switch {
+		case brk != "":
+			breaks++
+			if breaks == 1 {
+				if ly, stat := j.Peek(AddrLY), j.Peek(AddrSTAT); ly != 0 || stat&0x03 != LcdModeHBlank {
+					t.Errorf("lcd off: LY %d STAT 0x%02X", ly, stat)
+				}
+			} else {
+				// the gpu has not drawn a line since the lcd was turned on,
+				// the request is queued before the cpu is played again
+				j.gpu.RunCommand(CmdScreenshot, shots)
+			}
+		case breaks == 2:
+			select {
+			case first = <-shots:
+				second = j.Screenshot()
+				return true
+			default:
+			}
+		}
+		return false
+	})
+	if err != nil || !done {
+		t.Fatalf("done %t: %v", done, err)
+	}
+	for name, c := range map[string]struct {
+		img   *image.Gray
+		shade uint8
+	}{"first": {first, tileShades[0]}, "second": {second, tileShades[3]}} {
+		for i, px := range c.img.Pix {
+			if px != c.shade {
+				t.Errorf("%s frame: pixel %d is 0x%02X", name, i, px)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package jibi
+
+// A MemoryHook is called with the address accessed and its value before and
+// after the access, a read sees the same value twice. Hooks run on the
+// scheduler goroutine of the cpu in the middle of the access, so they must be
+// quick and must not access the Mmu themselves.
+type MemoryHook func(addr Word, old, new Byte)
+
+// memoryHooks is the list of hooks, read on every access.
+type memoryHooks struct {
+	rangeList[MemoryHook]
+}
+
+// hooked returns whether a hook watches addr.
+func (hs *memoryHooks) hooked(addr Word) bool {
+	for _, h := range hs.load() {
+		if h.start <= addr && addr <= h.end {
+			return true
+		}
+	}
+	return false
+}
+
+// call calls the hooks watching addr.
+func (hs *memoryHooks) call(addr Word, old, new Byte) {
+	for _, h := range hs.load() {
+		if h.start <= addr && addr <= h.end {
+			h.v(addr, old, new)
+		}
+	}
+}
+
+// OnRead calls fn after every read from start to end inclusive, by any
+// component. The returned func removes it.
+func (m *RomOnlyMmu) OnRead(start, end Word, fn MemoryHook) func() {
+	return m.readHooks.add(start, end, fn)
+}
+
+// OnWrite calls fn after every write from start to end inclusive, by any
+// component, with the value read before and after the write. The returned
+// func removes it.
+func (m *RomOnlyMmu) OnWrite(start, end Word, fn MemoryHook) func() {
+	return m.writeHooks.add(start, end, fn)
+}
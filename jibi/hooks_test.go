@@ -0,0 +1,53 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestMemoryHooks(t *testing.T) {
+	mmu := NewMmu(nil, false)
+	type access struct {
+		addr     Word
+		old, new Byte
+	}
+	var writes, reads []access
+	remove := mmu.OnWrite(AddrRam, AddrRam+0xFF, func(addr Word, old, new Byte) {
+		writes = append(writes, access{addr, old, new})
+	})
+	mmu.OnWrite(AddrTAC, AddrTAC, func(addr Word, old, new Byte) {
+		writes = append(writes, access{addr, old, new})
+	})
+	mmu.OnRead(AddrRam+0x10, AddrRam+0x10, func(addr Word, old, new Byte) {
+		reads = append(reads, access{addr, old, new})
+	})
+
+	mmu.Write(AddrRam+0x10, 0x12)
+	mmu.Write(AddrRam+0x10, 0x34)
+	mmu.Write(AddrRam+0x100, 0x56) // not hooked
+	mmu.Write(AddrTAC, 0x05)
+	mmu.Read(AddrRam + 0x10)
+	mmu.Read(AddrRam + 0x11)
+	want := []access{
+		{AddrRam + 0x10, 0x00, 0x12},
+		{AddrRam + 0x10, 0x12, 0x34},
+		{AddrTAC, 0xF8, 0xFD}, // as the cpu reads it
+	}
+	if len(writes) != len(want) {
+		t.Fatalf("writes %v", writes)
+	}
+	for i := range want {
+		if writes[i] != want[i] {
+			t.Errorf("write %d: %v", i, writes[i])
+		}
+	}
+	if len(reads) != 1 || reads[0] != (access{AddrRam + 0x10, 0x34, 0x34}) {
+		t.Errorf("reads %v", reads)
+	}
+
+	remove()
+	writes = nil
+	mmu.Write(AddrRam, 0x78)
+	if len(writes) != 0 {
+		t.Errorf("removed hook called %v", writes)
+	}
+}
@@ -0,0 +1,192 @@
+package jibi
+
+import (
+	"time"
+)
+
+// huc3 modes selected by writing to 0x0000-0x1FFF, they decide what
+// 0xA000-0xBFFF accesses
+const (
+	huc3ModeRam       Byte = 0x0A
+	huc3ModeCommand   Byte = 0x0B // write rtc command
+	huc3ModeResponse  Byte = 0x0C // read rtc response
+	huc3ModeSemaphore Byte = 0x0D
+	huc3ModeIr        Byte = 0x0E
+)
+
+// huc3 is Hudson's mapper with ram, a real time clock and an infrared port.
+// The rtc is driven by byte sized commands, the high nibble is the command
+// and the low nibble the argument. A command is run when the game clears the
+// semaphore, the response nibble is then read back through the output latch.
+type huc3 struct {
+	rom     []Byte
+	ram     []Byte
+	romBank int
+	ramBank int
+	mode    Byte
+
+	clk      RtcClock
+	at       time.Time // time minutes and days were last updated
+	minutes  int       // minute of the day
+	days     int
+	command  Byte
+	response Byte // output latch
+	index    Byte // rtc memory index
+}
+
+func newHuc3(rom []Byte, ramSize cartridgeRamSize) *huc3 {
+	clk := RtcClock(systemClock{})
+	return &huc3{
+		rom:     rom,
+		ram:     make([]Byte, 0x2000*ramBanks(ramSize)),
+		romBank: 1,
+		clk:     clk,
+		at:      clk.Now(),
+	}
+}
+
+func (m *huc3) setRtcClock(clk RtcClock) {
+	m.clk = clk
+	m.at = clk.Now()
+}
+
+func (m *huc3) ReadRom(addr Word) Byte {
+	if addr < 0x4000 {
+		return m.rom[addr]
+	}
+	return romBank(m.rom, m.romBank, addr)
+}
+
+func (m *huc3) RomBank() int {
+	return m.romBank
+}
+
+func (m *huc3) Rom() []Byte {
+	return m.rom
+}
+
+func (m *huc3) WriteRom(addr Word, b Byte) {
+	switch {
+	case addr < 0x2000:
+		m.mode = b & 0x0F
+	case addr < 0x4000:
+		m.romBank = int(b & 0x7F)
+	case addr < 0x6000:
+		m.ramBank = int(b & 0x03)
+	}
+}
+
+func (m *huc3) ReadRam(addr Word) Byte {
+	switch m.mode {
+	case huc3ModeResponse:
+		return 0x80 | m.command&0x70 | m.response
+	case huc3ModeSemaphore:
+		return 0xFF // always ready
+	case huc3ModeIr:
+		return 0xC0 // no light
+	}
+	return bankedRam(m.ram, m.ramBank, addr)
+}
+
+func (m *huc3) WriteRam(addr Word, b Byte) {
+	switch m.mode {
+	case huc3ModeRam:
+		setBankedRam(m.ram, m.ramBank, addr, b)
+	case huc3ModeCommand:
+		m.command = b & 0x7F
+	case huc3ModeSemaphore:
+		if b&0x01 == 0 {
+			m.runCommand()
+		}
+	}
+}
+
+// update folds the time passed since the last update into minutes and days.
+func (m *huc3) update() {
+	now := m.clk.Now()
+	elapsed := int(now.Sub(m.at) / time.Minute)
+	if elapsed <= 0 {
+		return
+	}
+	m.at = m.at.Add(time.Duration(elapsed) * time.Minute)
+	m.minutes += elapsed
+	m.days = (m.days + m.minutes/1440) & 0xFFFF
+	m.minutes %= 1440
+}
+
+// saveRtc returns the clock in the mbc3 registers, the minutes as hours and
+// minutes and the days as a 16 bit count in DL and DH. There is nothing to
+// latch, the latched copy is the same.
+func (m *huc3) saveRtc() ([5]Byte, [5]Byte, time.Time) {
+	m.update()
+	r := [5]Byte{0, Byte(m.minutes % 60), Byte(m.minutes / 60),
+		Byte(m.days), Byte(m.days >> 8)}
+	return r, r, m.at
+}
+
+func (m *huc3) loadRtc(live, latched [5]Byte, at time.Time) {
+	m.minutes = int(live[2]%24)*60 + int(live[1]%60)
+	m.days = int(live[4])<<8 | int(live[3])
+	m.at = at
+}
+
+// nibble returns rtc memory at index, 0-2 are the minutes and 3-6 the days.
+func (m *huc3) nibble(index Byte) Byte {
+	if index < 3 {
+		return Byte(m.minutes>>(4*index)) & 0x0F
+	} else if index < 7 {
+		return Byte(m.days>>(4*(index-3))) & 0x0F
+	}
+	return 0
+}
+
+func (m *huc3) setNibble(index, v Byte) {
+	if index < 3 {
+		shift := 4 * uint(index)
+		m.minutes = (m.minutes &^ (0x0F << shift)) | int(v)<<shift
+		m.minutes %= 1440
+	} else if index < 7 {
+		shift := 4 * uint(index-3)
+		m.days = (m.days &^ (0x0F << shift)) | int(v)<<shift
+	}
+}
+
+func (m *huc3) runCommand() {
+	m.update()
+	arg := m.command & 0x0F
+	switch m.command >> 4 {
+	case 0x1: // read and increment
+		m.response = m.nibble(m.index)
+		m.index++
+	case 0x3: // write and increment
+		m.setNibble(m.index, arg)
+		m.index++
+	case 0x4: // set index low nibble
+		m.index = m.index&0xF0 | arg
+	case 0x5: // set index high nibble
+		m.index = m.index&0x0F | arg<<4
+	case 0x6: // status
+		m.response = 0x01
+	}
+}
+
+// ramBanks returns the number of 8KB ram banks, at least 1.
+func ramBanks(ramSize cartridgeRamSize) int {
+	if ramSize.banks() == 0 {
+		return 1
+	}
+	return ramSize.banks()
+}
+
+func bankedRam(ram []Byte, bank int, addr Word) Byte {
+	if len(ram) == 0 {
+		return 0xFF
+	}
+	return ram[(bank*0x2000+int(addr-AddrERam))%len(ram)]
+}
+
+func setBankedRam(ram []Byte, bank int, addr Word, b Byte) {
+	if len(ram) > 0 {
+		ram[(bank*0x2000+int(addr-AddrERam))%len(ram)] = b
+	}
+}
@@ -0,0 +1,62 @@
+package jibi
+
+import (
+	"testing"
+	"time"
+)
+
+func huc3Command(m *huc3, cmd Byte) Byte {
+	m.WriteRom(0x0000, huc3ModeCommand)
+	m.WriteRam(AddrERam, cmd)
+	m.WriteRom(0x0000, huc3ModeSemaphore)
+	m.WriteRam(AddrERam, 0xFE)
+	m.WriteRom(0x0000, huc3ModeResponse)
+	return m.ReadRam(AddrERam) & 0x0F
+}
+
+func TestHuc3Rtc(t *testing.T) {
+	clk := &FixedClock{time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := newHuc3(make([]Byte, 0x8000), 0x03)
+	m.setRtcClock(clk)
+
+	// set day 2, minute 0x123
+	huc3Command(m, 0x40)
+	huc3Command(m, 0x50)
+	for _, n := range []Byte{0x3, 0x2, 0x1, 0x2, 0x0, 0x0, 0x0} {
+		huc3Command(m, 0x30|n)
+	}
+
+	clk.Advance(1440*time.Minute + 2*time.Minute)
+
+	huc3Command(m, 0x40)
+	got := []Byte{}
+	for i := 0; i < 7; i++ {
+		got = append(got, huc3Command(m, 0x10))
+	}
+	want := []Byte{0x5, 0x2, 0x1, 0x3, 0x0, 0x0, 0x0}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%v != %v", got, want)
+		}
+	}
+}
+
+func TestHuc3Ram(t *testing.T) {
+	m := newHuc3(make([]Byte, 0x8000), 0x03)
+	m.WriteRom(0x4000, 0x02)
+	m.WriteRom(0x0000, 0x00)
+	m.WriteRam(0xA010, 0x42)
+	if m.ReadRam(0xA010) != 0x00 {
+		t.Errorf("ram written while read only")
+	}
+	m.WriteRom(0x0000, huc3ModeRam)
+	m.WriteRam(0xA010, 0x42)
+	m.WriteRom(0x4000, 0x00)
+	if m.ReadRam(0xA010) != 0x00 {
+		t.Errorf("ram bank not switched")
+	}
+	m.WriteRom(0x4000, 0x02)
+	if m.ReadRam(0xA010) != 0x42 {
+		t.Errorf("0x%02X", m.ReadRam(0xA010))
+	}
+}
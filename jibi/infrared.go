@@ -0,0 +1,66 @@
+package jibi
+
+import (
+	"sync"
+)
+
+// An InfraredTransceiver is whatever is on the other side of the cgb infrared
+// port. SetLight is called when the led is switched on or off, Light reports
+// whether light is currently being received.
+type InfraredTransceiver interface {
+	SetLight(on bool)
+	Light() bool
+}
+
+// darkInfrared never sees any light, like a cgb with nothing in front of it.
+type darkInfrared struct{}
+
+func (darkInfrared) SetLight(on bool) {}
+
+func (darkInfrared) Light() bool {
+	return false
+}
+
+// NewInfraredPair returns two connected transceivers, each one sees the light
+// of the other. This lets two Jibis in the same process talk over infrared.
+func NewInfraredPair() (InfraredTransceiver, InfraredTransceiver) {
+	lock := new(sync.Mutex)
+	leds := new([2]bool)
+	return &pairedInfrared{lock, leds, 0}, &pairedInfrared{lock, leds, 1}
+}
+
+type pairedInfrared struct {
+	lock *sync.Mutex
+	leds *[2]bool
+	side int
+}
+
+func (p *pairedInfrared) SetLight(on bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.leds[p.side] = on
+}
+
+func (p *pairedInfrared) Light() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.leds[1-p.side]
+}
+
+// readRP returns the infrared port register. Bit 1 is low while light is
+// received, but only if reading is enabled with bits 6-7.
+func (m *RomOnlyMmu) readRP() Byte {
+	rp := m.rp | 0x3E
+	if m.rp&0xC0 == 0xC0 && m.ir.Light() {
+		rp &^= 0x02
+	}
+	return rp
+}
+
+func (m *RomOnlyMmu) writeRP(b Byte) {
+	led := b&0x01 == 0x01
+	if led != (m.rp&0x01 == 0x01) {
+		m.ir.SetLight(led)
+	}
+	m.rp = b & 0xC1
+}
@@ -0,0 +1,43 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestInfrared(t *testing.T) {
+	a, b := NewMmu(nil, true), NewMmu(nil, true)
+	irA, irB := NewInfraredPair()
+	a.SetInfrared(irA)
+	b.SetInfrared(irB)
+	received := func() bool {
+		return b.Read(AddrRP)&0x02 == 0
+	}
+
+	b.Write(AddrRP, 0xC0) // enable reading
+	if rp := b.Read(AddrRP); rp != 0xFE {
+		t.Errorf("RP reads 0x%02X in the dark", rp)
+	}
+	a.Write(AddrRP, 0x01)
+	if !received() {
+		t.Error("led of the other side not seen")
+	}
+	if a.Read(AddrRP)&0x02 == 0 {
+		t.Error("own led seen")
+	}
+	b.Write(AddrRP, 0x00)
+	if received() {
+		t.Error("light seen with reading disabled")
+	}
+	b.Write(AddrRP, 0xC0)
+	a.Write(AddrRP, 0x00)
+	if received() {
+		t.Error("led still seen after switching it off")
+	}
+
+	// without a transceiver the port is dark
+	dark := NewMmu(nil, true)
+	dark.Write(AddrRP, 0xC1)
+	if dark.Read(AddrRP)&0x02 == 0 {
+		t.Error("light in the dark")
+	}
+}
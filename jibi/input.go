@@ -0,0 +1,102 @@
+package jibi
+
+import (
+	"fmt"
+	"sort"
+)
+
+// cycles in one frame, 154 lines of 456 cycles
+const cyclesPerFrame = 154 * 456
+
+// FrameCycle returns the cycle the given frame starts on.
+func FrameCycle(frame uint64) uint64 {
+	return frame * cyclesPerFrame
+}
+
+// An InputEvent presses or releases a key at a point in emulation time.
+// Cycle counts clock cycles since power on, see FrameCycle. Key is a Key or
+// a PlayerKey.
+type InputEvent struct {
+	Cycle uint64
+	Key   interface{}
+	Down  bool
+}
+
+type inputsByCycle []InputEvent
+
+func (s inputsByCycle) Len() int           { return len(s) }
+func (s inputsByCycle) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s inputsByCycle) Less(i, j int) bool { return s[i].Cycle < s[j].Cycle }
+
+func (c *Cpu) cmdQueueInput(data interface{}) {
+	if events, ok := data.([]InputEvent); !ok {
+		panic("invalid command response type")
+	} else {
+		c.inputs = append(c.inputs, events...)
+		// stable so events on the same cycle apply in the order given
+		sort.Stable(inputsByCycle(c.inputs))
+	}
+}
+
+// applyInputs hands every event that is due to the keypad, which runs on the
+// cpu goroutine so the very next instruction sees the new key state.
+func (c *Cpu) applyInputs() {
+	for len(c.inputs) > 0 && c.inputs[0].Cycle <= c.cycles {
+		e := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		if c.kp == nil {
+			continue
+		}
+		c.kp.setKey(e.Key, e.Down)
+	}
+}
+
+// setKey sets a key without the auto repeat handling of keyboard input, the
+// key stays down until it is released by another event.
+func (k *Keypad) setKey(data interface{}, down bool) {
+	keys, key := k.playerKey(data)
+	if down {
+		if keys[key].v == 1 {
+			keys[key] = valueChan{0, keys[key].c}
+			k.mmu.SetInterrupt(InterruptKeypad)
+		}
+	} else {
+		keys[key] = valueChan{1, keys[key].c}
+	}
+	k.updateP1(k.p1)
+}
+
+// checkInputKey returns an error unless key is a Key or a PlayerKey of one
+// of the sgb controllers.
+func checkInputKey(key interface{}) error {
+	switch k := key.(type) {
+	case Key:
+		if k > KeyStart {
+			return fmt.Errorf("invalid key %d", k)
+		}
+	case PlayerKey:
+		if k.Player < 0 || k.Player >= sgbPlayers {
+			return fmt.Errorf("invalid player %d", k.Player)
+		} else if k.Key > KeyStart {
+			return fmt.Errorf("invalid key %d", k.Key)
+		}
+	default:
+		return fmt.Errorf("invalid key %v, not a Key or PlayerKey", key)
+	}
+	return nil
+}
+
+// QueueInput schedules key presses and releases. Events are applied when the
+// cpu reaches their cycle, events in the past apply before the next
+// instruction. If an event has an invalid key none are queued.
+func (j Jibi) QueueInput(events ...InputEvent) error {
+	for _, e := range events {
+		if err := checkInputKey(e.Key); err != nil {
+			return fmt.Errorf("queue input: %s", err)
+		}
+	}
+	e := make([]InputEvent, len(events))
+	copy(e, events)
+	j.cpu.RunCommand(CmdQueueInput, e)
+	return nil
+}
@@ -0,0 +1,48 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestApplyInputs(t *testing.T) {
+	mmu := newTestMmu()
+	cpu := NewCpu(mmu, []Byte{})
+	defer cpu.RunCommand(CmdStop, nil)
+	kp := NewKeypad(mmu, cpu, false, false)
+	cpu.kp = kp
+
+	cpu.cmdQueueInput([]InputEvent{
+		{FrameCycle(2), KeyA, false},
+		{FrameCycle(1), KeyA, true},
+		{FrameCycle(1), KeyB, true},
+		{FrameCycle(1), KeyB, false},
+	})
+	want := []InputEvent{
+		{FrameCycle(1), KeyA, true},
+		{FrameCycle(1), KeyB, true},
+		{FrameCycle(1), KeyB, false},
+		{FrameCycle(2), KeyA, false},
+	}
+	for i, e := range want {
+		if cpu.inputs[i] != e {
+			t.Fatalf("%d: %v, not %v", i, cpu.inputs[i], e)
+		}
+	}
+	down := func(key Key) bool { return kp.keys[0][key].v == 0 }
+
+	cpu.cycles = FrameCycle(1) - 1
+	cpu.applyInputs()
+	if len(cpu.inputs) != 4 || down(KeyA) {
+		t.Errorf("applied early, %v", cpu.inputs)
+	}
+	cpu.cycles = FrameCycle(1)
+	cpu.applyInputs()
+	if len(cpu.inputs) != 1 || !down(KeyA) || down(KeyB) {
+		t.Errorf("on cycle, %v a:%t b:%t", cpu.inputs, down(KeyA), down(KeyB))
+	}
+	cpu.cycles = FrameCycle(3)
+	cpu.applyInputs()
+	if len(cpu.inputs) != 0 || down(KeyA) {
+		t.Errorf("late, %v", cpu.inputs)
+	}
+}
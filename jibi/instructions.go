@@ -7,45 +7,40 @@ import (
 // holds the instruction currently being fetched
 type instruction struct {
 	o opcode
-	p []Byte // params
+	p [2]Byte // params
+	n uint8   // number of params
 }
 
 func newInstruction(o opcode, ps ...Byte) instruction {
-	p := make([]Byte, len(ps))
-	copy(p, ps)
-	return instruction{o, p}
+	i := instruction{o: o, n: uint8(len(ps))}
+	copy(i.p[:], ps)
+	return i
 }
 
 func (i instruction) String() string {
 	ps := ""
-	for _, v := range i.p {
+	for _, v := range i.p[:i.n] {
 		ps += fmt.Sprintf("0x%02X ", v)
 	}
 	return fmt.Sprintf("%s [ 0x%02X %s]", i.o, uint16(i.o), ps)
 }
 
+// addWordR adds the signed byte b to a.
 // z reset
 // n reset
-// h and c set or reset according to operation
-func (c *Cpu) addWordR(a Worder, b Byter) Word {
-	fmt.Println(c.str())
-	panic("untested")
-	h := a.High()
+// h and c set or reset according to the unsigned addition of b to the low
+// byte of a, whatever the sign of b
+func (c *Cpu) addWordR(a Word, b Byter) Word {
 	l := a.Low()
-	bi := int8(b.Byte())
-	if bi < 0 {
-		b = Byte(uint8(-bi))
-		l = c.sub(l, b)
-		h = c.sbc(h, Byte(0))
-		c.f.resetFlag(flagZ)
-		c.f.resetFlag(flagN)
-		return BytesToWord(h, l)
+	e := b.Byte()
+	c.f.reset()
+	if l&0x0F+e&0x0F > 0x0F {
+		c.f.setFlag(flagH)
 	}
-	l = c.add(l, b)
-	h = c.adc(h, Byte(0))
-	c.f.resetFlag(flagZ)
-	c.f.resetFlag(flagN)
-	return BytesToWord(h, l)
+	if uint16(l)+uint16(e) > 0xFF {
+		c.f.setFlag(flagC)
+	}
+	return a.Word() + Word(int8(e))
 }
 
 func (c *Cpu) bit(b uint8, n Byter) {
@@ -69,8 +64,6 @@ func (c *Cpu) xor(a, b Byter) Byte {
 }
 
 func (c *Cpu) and(a, b Byter) Byte {
-	fmt.Println(c.str())
-	panic("untested")
 	r := a.Byte() & b.Byte()
 	c.f.reset()
 	if r == 0 {
@@ -122,8 +115,6 @@ func (c *Cpu) dec(a Byter) Byte {
 }
 
 func (c *Cpu) sbc(a, b Byter) Byte {
-	fmt.Println(c.str())
-	panic("inst")
 	carry := Byte(0)
 	if c.f.getFlag(flagC) {
 		carry = 1
@@ -137,12 +128,42 @@ func (c *Cpu) sbc(a, b Byter) Byte {
 	if a.Byte()&0x0F < (b.Byte()&0x0F + carry) {
 		c.f.setFlag(flagH)
 	}
-	if a.Byte() < b.Byte()+carry {
+	if uint16(a.Byte()) < uint16(b.Byte())+uint16(carry) {
 		c.f.setFlag(flagC)
 	}
 	return Byte(r)
 }
 
+// daa adjusts a to binary coded decimal after an addition or, with n set, a
+// subtraction of two bcd numbers. n is kept, h reset and c set when the
+// decimal result carried or borrowed.
+func (c *Cpu) daa(a Byter) Byte {
+	r := a.Byte()
+	if !c.f.getFlag(flagN) {
+		if c.f.getFlag(flagC) || r > 0x99 {
+			r += 0x60
+			c.f.setFlag(flagC)
+		}
+		if c.f.getFlag(flagH) || r&0x0F > 0x09 {
+			r += 0x06
+		}
+	} else {
+		if c.f.getFlag(flagC) {
+			r -= 0x60
+		}
+		if c.f.getFlag(flagH) {
+			r -= 0x06
+		}
+	}
+	if r == 0 {
+		c.f.setFlag(flagZ)
+	} else {
+		c.f.resetFlag(flagZ)
+	}
+	c.f.resetFlag(flagH)
+	return r
+}
+
 func (c *Cpu) sub(a, b Byter) Byte {
 	r := a.Byte() - b.Byte()
 	c.f.reset()
@@ -240,12 +261,14 @@ func (c *Cpu) rlc(n Byter) Byte {
 
 func (c *Cpu) jrF(f Byte, n int8) {
 	if c.f.getFlag(f) == true {
+		c.branched = true
 		c.jr(n)
 	}
 }
 
 func (c *Cpu) jrNF(f Byte, n int8) {
 	if c.f.getFlag(f) == false {
+		c.branched = true
 		c.jr(n)
 	}
 }
@@ -258,29 +281,33 @@ func (c *Cpu) jr(n int8) {
 	c.pc += register16(n)
 }
 
-func (c *Cpu) jp(addr Worder) {
-	c.pc = register16(addr.Word())
+func (c *Cpu) jp(addr Word) {
+	c.pc = register16(addr)
 }
 
-func (c *Cpu) callF(f Byte, addr Worder) {
-	fmt.Println(c.str())
-	panic("untested")
+func (c *Cpu) callF(f Byte, addr Word) {
 	if c.f.getFlag(f) == true {
+		c.branched = true
 		c.call(addr)
 	}
 }
 
-func (c *Cpu) call(addr Worder) {
-	c.push(c.pc)
+func (c *Cpu) call(addr Word) {
+	c.push(c.pc.Word())
 	c.jp(addr)
 }
 
 func (c *Cpu) pop() Word {
 	c.sp += 2
-	return c.readWord(c.sp - 2)
+	return c.readWord(c.sp.Word() - 2)
 }
 
-func (c *Cpu) push(w Worder) {
-	c.sp -= 2
-	c.writeWord(c.sp, w)
+// push takes a machine cycle to decrement sp before it writes, then writes
+// the high byte first.
+func (c *Cpu) push(w Word) {
+	c.tick()
+	c.sp--
+	c.writeByte(c.sp.Word(), w.High())
+	c.sp--
+	c.writeByte(c.sp.Word(), w.Low())
 }
@@ -0,0 +1,221 @@
+package jibi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+)
+
+// ReadPatchFile reads an ips or bps patch from filename and applies it to
+// rom, returning the patched rom. The format is told by the file header.
+func ReadPatchFile(rom []Byte, filename string) ([]Byte, error) {
+	patch, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(patch, []byte("PATCH")):
+		return ApplyIPS(rom, patch)
+	case bytes.HasPrefix(patch, []byte("BPS1")):
+		return ApplyBPS(rom, patch)
+	}
+	return nil, fmt.Errorf("%s: not an ips or bps patch", filename)
+}
+
+var errPatchTruncated = errors.New("patch truncated")
+
+// ApplyIPS returns a copy of rom with the ips patch applied. Records past the
+// end of the rom grow it.
+func ApplyIPS(rom []Byte, patch []byte) ([]Byte, error) {
+	if !bytes.HasPrefix(patch, []byte("PATCH")) {
+		return nil, errors.New("missing ips header")
+	}
+	out := make([]Byte, len(rom))
+	copy(out, rom)
+	p := patch[5:]
+	for {
+		if len(p) < 3 {
+			return nil, errPatchTruncated
+		}
+		if bytes.Equal(p[:3], []byte("EOF")) {
+			p = p[3:]
+			break
+		}
+		if len(p) < 5 {
+			return nil, errPatchTruncated
+		}
+		offset := int(p[0])<<16 | int(p[1])<<8 | int(p[2])
+		size := int(p[3])<<8 | int(p[4])
+		p = p[5:]
+		var data []Byte
+		if size == 0 { // run length encoded
+			if len(p) < 3 {
+				return nil, errPatchTruncated
+			}
+			size = int(p[0])<<8 | int(p[1])
+			data = make([]Byte, size)
+			for i := range data {
+				data[i] = Byte(p[2])
+			}
+			p = p[3:]
+		} else {
+			if len(p) < size {
+				return nil, errPatchTruncated
+			}
+			data = make([]Byte, size)
+			for i := range data {
+				data[i] = Byte(p[i])
+			}
+			p = p[size:]
+		}
+		if offset+size > len(out) {
+			grown := make([]Byte, offset+size)
+			copy(grown, out)
+			out = grown
+		}
+		copy(out[offset:], data)
+	}
+	// optional truncation extension
+	if len(p) == 3 {
+		size := int(p[0])<<16 | int(p[1])<<8 | int(p[2])
+		if size < len(out) {
+			out = out[:size]
+		}
+	}
+	return out, nil
+}
+
+// bps actions
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+// a bpsReader reads through a bps patch
+type bpsReader struct {
+	p   []byte
+	pos int
+	end int // start of the checksum footer
+	err error
+}
+
+func (r *bpsReader) byte() byte {
+	if r.pos >= r.end {
+		r.err = errPatchTruncated
+		return 0
+	}
+	b := r.p[r.pos]
+	r.pos++
+	return b
+}
+
+// number decodes a bps variable length number.
+func (r *bpsReader) number() int {
+	data, shift := 0, 1
+	for r.err == nil {
+		x := r.byte()
+		data += int(x&0x7F) * shift
+		if x&0x80 != 0 {
+			break
+		}
+		shift <<= 7
+		data += shift
+	}
+	return data
+}
+
+// signed decodes a bps relative offset.
+func (r *bpsReader) signed() int {
+	n := r.number()
+	if n&1 == 1 {
+		return -(n >> 1)
+	}
+	return n >> 1
+}
+
+func bytesCrc32(b []Byte) uint32 {
+	buf := make([]byte, len(b))
+	for i, v := range b {
+		buf[i] = byte(v)
+	}
+	return crc32.ChecksumIEEE(buf)
+}
+
+func le32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+// ApplyBPS returns the target rom built from rom and the bps patch. The
+// checksums of the patch, the source and the result are all checked.
+func ApplyBPS(rom []Byte, patch []byte) ([]Byte, error) {
+	if !bytes.HasPrefix(patch, []byte("BPS1")) || len(patch) < 4+12 {
+		return nil, errors.New("missing bps header")
+	}
+	footer := patch[len(patch)-12:]
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) != le32(footer[8:]) {
+		return nil, errors.New("bps patch checksum mismatch")
+	}
+	if bytesCrc32(rom) != le32(footer[0:]) {
+		return nil, errors.New("bps patch is for a different rom")
+	}
+	r := &bpsReader{p: patch, pos: 4, end: len(patch) - 12}
+	sourceSize := r.number()
+	targetSize := r.number()
+	r.pos += r.number() // skip metadata
+	if r.err != nil {
+		return nil, r.err
+	}
+	if sourceSize != len(rom) {
+		return nil, fmt.Errorf("bps source size %d, rom is %d", sourceSize, len(rom))
+	}
+
+	out := make([]Byte, targetSize)
+	outPos, sourceRel, targetRel := 0, 0, 0
+	for r.pos < r.end && r.err == nil {
+		data := r.number()
+		action, length := data&0x03, data>>2+1
+		if outPos+length > len(out) {
+			return nil, errors.New("bps patch writes past the target")
+		}
+		switch action {
+		case bpsSourceRead:
+			if outPos+length > len(rom) {
+				return nil, errors.New("bps patch reads past the source")
+			}
+			copy(out[outPos:], rom[outPos:outPos+length])
+		case bpsTargetRead:
+			for i := 0; i < length; i++ {
+				out[outPos+i] = Byte(r.byte())
+			}
+		case bpsSourceCopy:
+			sourceRel += r.signed()
+			if sourceRel < 0 || sourceRel+length > len(rom) {
+				return nil, errors.New("bps patch reads past the source")
+			}
+			copy(out[outPos:], rom[sourceRel:sourceRel+length])
+			sourceRel += length
+		case bpsTargetCopy:
+			targetRel += r.signed()
+			if targetRel < 0 || targetRel >= outPos {
+				return nil, errors.New("bps patch reads past the target")
+			}
+			// byte at a time, the copy may overlap what it writes
+			for i := 0; i < length; i++ {
+				out[outPos+i] = out[targetRel]
+				targetRel++
+			}
+		}
+		outPos += length
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if bytesCrc32(out) != le32(footer[4:]) {
+		return nil, errors.New("bps target checksum mismatch")
+	}
+	return out, nil
+}
@@ -0,0 +1,67 @@
+package jibi
+
+import (
+	"hash/crc32"
+	"testing"
+)
+
+func TestApplyIPS(t *testing.T) {
+	rom := []Byte{0, 1, 2, 3}
+	patch := []byte("PATCH" +
+		"\x00\x00\x01\x00\x02\xAA\xBB" + // 2 bytes at 1
+		"\x00\x00\x05\x00\x00\x00\x02\xCC" + // rle 2 bytes at 5
+		"EOF")
+	out, err := ApplyIPS(rom, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Byte{0, 0xAA, 0xBB, 3, 0, 0xCC, 0xCC}
+	if len(out) != len(want) {
+		t.Fatalf("%v", out)
+	}
+	for i := range want {
+		if out[i] != want[i] {
+			t.Fatalf("%v", out)
+		}
+	}
+	if rom[1] != 1 {
+		t.Error("source modified")
+	}
+	if _, err := ApplyIPS(rom, []byte("PATCH\x00\x00")); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func bpsPatch(source, target []Byte, body []byte) []byte {
+	p := append([]byte("BPS1"), body...)
+	le := func(v uint32) []byte {
+		return []byte{byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24)}
+	}
+	p = append(p, le(bytesCrc32(source))...)
+	p = append(p, le(bytesCrc32(target))...)
+	return append(p, le(crc32.ChecksumIEEE(p))...)
+}
+
+func TestApplyBPS(t *testing.T) {
+	source := []Byte{1, 2, 3, 4}
+	target := []Byte{1, 2, 9, 9, 9, 3, 4}
+	body := []byte{
+		0x84, 0x87, 0x80, // source size 4, target size 7, no metadata
+		0x84,    // source read 2
+		0x81, 9, // target read 1
+		0x87, 0x84, // target copy 2 from target +2
+		0x86, 0x84, // source copy 2 from source +2
+	}
+	out, err := ApplyBPS(source, bpsPatch(source, target, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range target {
+		if out[i] != target[i] {
+			t.Fatalf("%v", out)
+		}
+	}
+	if _, err := ApplyBPS([]Byte{1, 2, 3, 5}, bpsPatch(source, target, body)); err == nil {
+		t.Error("expected source checksum error")
+	}
+}
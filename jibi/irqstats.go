@@ -0,0 +1,107 @@
+package jibi
+
+import (
+	"fmt"
+)
+
+// InterruptStats are the statistics for one interrupt source. Latency is the
+// time from the IF bit being set to the cpu jumping to the vector, handler
+// time runs from the vector to the matching return. Times are in clock
+// cycles.
+type InterruptStats struct {
+	Interrupt     Interrupt
+	Count         int
+	MinLatency    uint64
+	MaxLatency    uint64
+	TotalLatency  uint64
+	HandlerCycles uint64
+}
+
+// AvgLatency returns the mean latency in clock cycles.
+func (s InterruptStats) AvgLatency() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.TotalLatency) / float64(s.Count)
+}
+
+func (s InterruptStats) String() string {
+	return fmt.Sprintf("%-6s count:%8d latency min:%6d avg:%9.1f max:%6d handler:%12d",
+		s.Interrupt, s.Count, s.MinLatency, s.AvgLatency(), s.MaxLatency,
+		s.HandlerCycles)
+}
+
+// an irqFrame is an interrupt handler that has not returned yet
+type irqFrame struct {
+	i     int
+	sp    Word // sp just after the return address was pushed
+	start uint64
+}
+
+// irqStats tracks interrupt statistics as the cpu runs.
+type irqStats struct {
+	stats   [5]InterruptStats
+	raised  [5]uint64 // cycle each pending interrupt was raised at
+	pending Byte
+	frames  []irqFrame
+}
+
+func newIrqStats() *irqStats {
+	s := &irqStats{}
+	for i := range s.stats {
+		s.stats[i].Interrupt = Interrupt(1 << uint(i))
+	}
+	return s
+}
+
+// flags notes newly raised interrupts in iflag, which is IF as the cpu saw
+// it at cycles, and remembers which are still pending after the cpu masked
+// them.
+func (s *irqStats) flags(iflag, masked Byte, cycles uint64) {
+	raised := iflag &^ s.pending
+	for i := range s.raised {
+		if raised&(1<<uint(i)) != 0 {
+			s.raised[i] = cycles
+		}
+	}
+	s.pending = masked & 0x1F
+}
+
+// dispatch records the cpu jumping to the vector of in with sp just after
+// the return address was pushed.
+func (s *irqStats) dispatch(in Interrupt, sp Word, cycles uint64) {
+	i := 0
+	for ; Interrupt(1<<uint(i)) != in; i++ {
+	}
+	st := &s.stats[i]
+	latency := cycles - s.raised[i]
+	if st.Count == 0 || latency < st.MinLatency {
+		st.MinLatency = latency
+	}
+	if latency > st.MaxLatency {
+		st.MaxLatency = latency
+	}
+	st.TotalLatency += latency
+	st.Count++
+	s.pending &^= Byte(in)
+	s.frames = append(s.frames, irqFrame{i, sp, cycles})
+}
+
+// ret closes every handler whose return address is at or below sp.
+func (s *irqStats) ret(sp Word, cycles uint64) {
+	for len(s.frames) > 0 && s.frames[len(s.frames)-1].sp <= sp {
+		f := s.frames[len(s.frames)-1]
+		s.frames = s.frames[:len(s.frames)-1]
+		s.stats[f.i].HandlerCycles += cycles - f.start
+	}
+}
+
+func (c *Cpu) cmdInterruptStats(resp interface{}) {
+	if resp, ok := resp.(chan []InterruptStats); !ok {
+		panic("invalid command response type")
+	} else {
+		stats := make([]InterruptStats, len(c.irqs.stats))
+		copy(stats, c.irqs.stats[:])
+		resp <- stats
+	}
+}
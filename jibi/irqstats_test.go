@@ -0,0 +1,43 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestIrqStats(t *testing.T) {
+	s := newIrqStats()
+	// vblank raised at 100, taken at 130 and returning at 200, with a timer
+	// interrupt nested in its handler
+	s.flags(Byte(InterruptVblank), Byte(InterruptVblank), 100)
+	s.flags(Byte(InterruptVblank), Byte(InterruptVblank), 120) // still pending
+	s.dispatch(InterruptVblank, 0xFFFC, 130)
+	s.flags(Byte(InterruptTimer), Byte(InterruptTimer), 150)
+	s.dispatch(InterruptTimer, 0xFFFA, 160)
+	s.ret(0xFFFA, 180) // the timer handler returns, sp is at its return address
+	if s.stats[0].HandlerCycles != 0 || s.stats[2].HandlerCycles != 20 {
+		t.Errorf("nested: vblank %d timer %d", s.stats[0].HandlerCycles, s.stats[2].HandlerCycles)
+	}
+	s.ret(0xFFFC, 200)
+	if len(s.frames) != 0 {
+		t.Errorf("%d handlers open", len(s.frames))
+	}
+
+	// a second vblank with more latency
+	s.flags(Byte(InterruptVblank), Byte(InterruptVblank), 1000)
+	s.dispatch(InterruptVblank, 0xFFFC, 1050)
+	s.ret(0xFFFC, 1060)
+
+	vblank := s.stats[0]
+	if vblank.Interrupt != InterruptVblank || vblank.Count != 2 ||
+		vblank.MinLatency != 30 || vblank.MaxLatency != 50 || vblank.AvgLatency() != 40 ||
+		vblank.HandlerCycles != 80 {
+		t.Errorf("vblank %+v", vblank)
+	}
+	timer := s.stats[2]
+	if timer.Interrupt != InterruptTimer || timer.Count != 1 || timer.MinLatency != 10 {
+		t.Errorf("timer %+v", timer)
+	}
+	if s.stats[1].Count != 0 || s.stats[1].AvgLatency() != 0 {
+		t.Errorf("lcdc %+v", s.stats[1])
+	}
+}
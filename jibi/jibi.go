@@ -2,6 +2,8 @@ package jibi
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"time"
 )
 
@@ -14,6 +16,122 @@ type Options struct {
 	Quick    bool
 	Squash   bool
 	Every    bool
+
+	// Debug pauses on ld b,b and prints the debug message following it,
+	// press c to continue.
+	Debug bool
+
+	// DebugMessages prints the debug message following every ld d,d.
+	DebugMessages bool
+
+	// Rewind keeps a snapshot of the machine every second for as many
+	// seconds, for Jibi.StepBack and Jibi.ContinueBack to go back to.
+	Rewind int
+
+	// IrqStats prints interrupt statistics when the Jibi stops.
+	IrqStats bool
+
+	// Profile prints the cycles spent per function when the Jibi stops,
+	// with functions named by Symbols if set.
+	Profile bool
+	Symbols *Symbols
+
+	// Coverage prints which opcodes were executed when the Jibi stops.
+	Coverage bool
+
+	// Bios replaces the built in dmg bios. A 0x900 byte cgb bios also
+	// switches the hardware to cgb.
+	Bios []Byte
+
+	// Cgb runs on cgb hardware without a cgb bios. Dmg cartridges are
+	// colorized like the cgb bios would, using Colorizations by cartridge
+	// title, then ColorKeys held during boot, then the built in palettes.
+	// See ParseColorKeys.
+	Cgb           bool
+	ColorKeys     []Key
+	Colorizations map[string]Colorization
+
+	// Shades are the colors the dmg screen shows, DmgGrey by default. See
+	// ParseDmgPalette.
+	Shades DmgPalette
+
+	// Sgb runs sgb cartridges on super gameboy hardware. The sgb colors
+	// the screen of a ColorLcd, with SgbBorder it draws 256x224 pictures
+	// with the border around the screen.
+	Sgb       bool
+	SgbBorder bool
+
+	// Tilt drives the accelerometer of mbc7 cartridges.
+	Tilt TiltSource
+
+	// RtcClock replaces the system time for cartridge real time clocks.
+	RtcClock RtcClock
+
+	// SaveFile keeps the battery backed ram of the cartridge. It is loaded
+	// at start, and written when it changes and when the Jibi stops. See
+	// SaveFileName.
+	SaveFile string
+
+	// ViewerDir is where the 8 key writes png images of the video memory,
+	// the tiles in vram as tiles-NNN.png and the sprites as sprites-NNN.png
+	// with their oam entries listed in sprites-NNN.txt.
+	ViewerDir string
+
+	// StateFile is where the 9 key saves the machine state and the 0 key
+	// loads it from.
+	StateFile string
+
+	// ForceState loads save states made for another cartridge, one with
+	// another title or header checksum, or by another version of the
+	// emulator. States of another kind of mapper never load.
+	ForceState bool
+
+	// Quit stops a running Jibi, after it saved, when it receives a signal.
+	Quit <-chan os.Signal
+
+	// Reload resets the Jibi with every rom received, see WatchRomFile.
+	Reload <-chan []Byte
+
+	// Strict panics on emulation the Jibi is not sure about, illegal
+	// opcodes and accesses to memory that is not emulated.
+	// Otherwise they are logged as warnings and the Jibi carries on.
+	Strict bool
+
+	// Macros are played when their key is typed.
+	Macros map[byte]Macro
+
+	// Cheats are enabled from the start, see ParseCheat and Jibi.SetCheat.
+	Cheats []Cheat
+
+	// Logger receives diagnostics from every component, by default they
+	// are dropped. See NewTextLogger.
+	Logger Logger
+
+	// Notifications receives the messages for the player when the frontend
+	// renders them itself, otherwise they are drawn over the lcd.
+	Notifications chan<- Notification
+
+	// Audio plays the sound, at SampleRate samples per second or 44100 if
+	// it is 0. See NewAudioWriter and AudioRing.
+	Audio      AudioSink
+	SampleRate int
+
+	// Wav records the sound as a wav file, in addition to playing it on
+	// Audio.
+	Wav io.WriteSeeker
+
+	// Trace receives a line per instruction in the gameboy doctor format,
+	// the registers and the 4 bytes at pc before it runs, to diff against
+	// the traces of other emulators. Wrap files in a bufio.Writer.
+	Trace io.Writer
+
+	// Infrared is the other side of the cgb infrared port, by default it
+	// never sees any light. See NewInfraredPair.
+	Infrared InfraredTransceiver
+
+	// Serial is plugged into the link port, by default nothing is. See
+	// DialSerial and ListenSerial.
+	Serial SerialDevice
 }
 
 // Jibi is the glue that holds everything together.
@@ -24,46 +142,155 @@ type Jibi struct {
 	cpu  *Cpu
 	lcd  Lcd
 	gpu  *Gpu
+	apu  *Apu
 	cart *Cartridge
 	kp   *Keypad
+
+	// rom patches to apply again after a reset
+	patches *[]romPatch
+
+	// subscribers keep their events after a reset
+	events *eventBus
+
+	// battery backed ram file, nil without Options.SaveFile or battery
+	save *saveFile
+
+	status *statusBox
 }
 
 // New returns a new Jibi in a Paused state.
-func New(rom []Byte, options Options) Jibi {
-	cart := NewCartridge(rom)
-	mmu := NewMmu(cart)
-	cpu := NewCpu(mmu, bios)
+func New(rom []Byte, options Options) (Jibi, error) {
+	b := bios
+	if options.Bios != nil {
+		b = options.Bios
+	}
+	if len(b) != biosSizeDmg && len(b) != biosSizeCgb {
+		return Jibi{}, fmt.Errorf("bios must be 0x%X or 0x%X bytes, not 0x%X",
+			biosSizeDmg, biosSizeCgb, len(b))
+	}
+	cart, err := NewCartridge(rom)
+	if err != nil {
+		return Jibi{}, err
+	}
+	if options.Tilt != nil {
+		cart.SetTilt(options.Tilt)
+	}
+	if options.RtcClock != nil {
+		cart.SetRtcClock(options.RtcClock)
+	}
+	var save *saveFile
+	if options.SaveFile != "" && cart.Battery() {
+		save, err = loadSaveFile(options.SaveFile, cart)
+		if err != nil {
+			return Jibi{}, err
+		}
+	}
+	cgb := len(b) == biosSizeCgb || options.Cgb
+	mmu := NewMmu(cart, cgb)
+	if cgb && len(b) != biosSizeCgb && !cart.color {
+		mmu.SetColorization(colorize(cart, options.ColorKeys, options.Colorizations))
+	}
+	if options.Infrared != nil {
+		mmu.SetInfrared(options.Infrared)
+	}
+	mmu.SetLogger(options.Logger)
+	mmu.SetStrict(options.Strict)
+	cpu := NewCpu(mmu, b)
+	cpu.log = newComponentLog(options.Logger, "cpu")
+	cpu.strict = options.Strict
+	if options.Serial != nil {
+		cpu.link = options.Serial
+	}
+	cpu.trace = options.Trace
 	lcd := NewLcd(options.Squash)
-	gpu := NewGpu(mmu, lcd, cpu.Clock())
-	kp := NewKeypad(mmu, options.Keypad)
+	gpu := NewGpu(mmu, lcd, cpu, cgb)
+	gpu.log = newComponentLog(options.Logger, "gpu")
+	gpu.notes = options.Notifications
+	gpu.shades = options.Shades
+	apu := NewApu(mmu, cpu)
+	apu.log = newComponentLog(options.Logger, "apu")
+	apu.sink = options.Audio
+	if options.SampleRate > 0 {
+		apu.rate = uint64(options.SampleRate)
+	}
+	if options.Wav != nil {
+		wav, err := NewWavWriter(options.Wav, int(apu.rate))
+		if err != nil {
+			return Jibi{}, err
+		}
+		apu.sink = MultiAudio(options.Audio, wav)
+	}
+	kp := NewKeypad(mmu, cpu, options.Keypad, options.Sgb && cart.super)
+	kp.log = newComponentLog(options.Logger, "keypad")
+	if options.Sgb && cart.super {
+		kp.screen = newSgbScreen()
+		gpu.sgb = kp.screen
+		gpu.sgbBorder = options.SgbBorder
+	}
+	cpu.kp = kp
+	if options.Rewind > 0 {
+		cpu.rewind = newRewind(options.Rewind, stateRequest{cart: cart, gpu: gpu, apu: apu})
+	}
+	events := newEventBus()
+	cpu.events = events
+	gpu.events = events
 
 	if options.Skipbios {
-		cpu.RunCommand(CmdUnloadBios, nil)
+		cpu.RunCommand(CmdSkipBios, cgb)
+	}
+	for _, c := range options.Cheats {
+		cpu.RunCommand(CmdSetCheat, cheatToggle{c, true})
 	}
 	if !options.Render {
 		lcd.DisableRender()
 	}
 
-	return Jibi{options, mmu, cpu, lcd, gpu, cart, kp}
+	status := &statusBox{s: Status{Title: cart.Title()}}
+	lcd.SetTitle(status.s.String())
+
+	return Jibi{options, mmu, cpu, lcd, gpu, apu, cart, kp, &[]romPatch{}, events, save, status}, nil
 }
 
-// RunCommand displatches a command to the correct piece.
-func (j Jibi) RunCommand(cmd Command, resp chan string) {
+// RunCommand displatches a command to the correct piece. Only commands that
+// take no response, or a string response, can be run on a Jibi.
+func (j Jibi) RunCommand(cmd Command, resp chan string) error {
+	switch cmd {
+	case CmdUnloadBios, CmdPlay, CmdPause, CmdStop:
+	case CmdString:
+		if resp == nil {
+			return fmt.Errorf("%s needs a response channel", cmd)
+		}
+	default:
+		return fmt.Errorf("%s can not be run on a Jibi", cmd)
+	}
 	if cmd < cmdCPU {
 		j.cpu.RunCommand(cmd, resp)
 	} else if cmd < cmdGPU {
 		j.gpu.RunCommand(cmd, resp)
 	} else if cmd < cmdKEYPAD {
 		j.kp.RunCommand(cmd, resp)
+	} else if cmd < cmdAPU {
+		j.apu.RunCommand(cmd, resp)
 	} else if cmd < cmdALL {
-		j.cpu.RunCommand(cmd, resp)
+		// the cpu runs the loop of them all, so it stops last
 		j.gpu.RunCommand(cmd, resp)
+		j.apu.RunCommand(cmd, resp)
 		j.kp.RunCommand(cmd, resp)
+		j.cpu.RunCommand(cmd, resp)
 	}
+	return nil
 }
 
-// Run starts the Jibi and waits till it ends before returning.
+// Run starts the Jibi and waits till it ends before returning. A rom from
+// Options.Reload stops the Jibi and starts a new one in its place.
 func (j Jibi) Run() {
+	for next, ok := j.run(); ok; next, ok = next.run() {
+	}
+}
+
+// run runs the Jibi until it ends, or until a new rom is loaded and returns
+// the Jibi that replaces it.
+func (j Jibi) run() (Jibi, bool) {
 	// metrics
 	cpuClk := j.cpu.Clock()
 	resp := make(chan chan ClockType)
@@ -93,8 +320,29 @@ func (j Jibi) Run() {
 		inst = <-respStr
 		tickerC = nil
 	}
-	if !j.O.Status {
-		tickerC = nil
+	var brk chan string
+	if j.O.Debug {
+		respStr := make(chan chan string)
+		j.cpu.RunCommand(CmdOnBreakpoint, respStr)
+		brk = <-respStr
+	}
+	var msgs chan string
+	if j.O.DebugMessages {
+		respStr := make(chan chan string)
+		j.cpu.RunCommand(CmdOnDebugMessage, respStr)
+		msgs = <-respStr
+	}
+	if j.O.Profile {
+		j.cpu.RunCommand(CmdProfileStart, nil)
+	}
+	if j.O.Coverage {
+		j.cpu.RunCommand(CmdCoverageStart, nil)
+	}
+	var saveC <-chan time.Time
+	if j.save != nil {
+		saveTicker := time.NewTicker(saveInterval)
+		defer saveTicker.Stop()
+		saveC = saveTicker.C
 	}
 	var timeout <-chan time.Time
 	if j.O.Quick {
@@ -109,13 +357,70 @@ func (j Jibi) Run() {
 	kpCps := ClockType(0)
 	kpLps := ClockType(0)
 	count := float64(-1)
+	var next Jibi
+	reloaded := false
 	for running := true; running; {
 		select {
 		case <-timeout:
-			fmt.Println("timeout")
+			j.log().Info("timeout")
+			running = false
+		case sig := <-j.O.Quit:
+			j.log().Info("quit", "signal", sig)
+			running = false
+		case <-saveC:
+			if err := j.flushSave(); err != nil {
+				j.log().Warn("save failed", "err", err)
+			}
+		case rom := <-j.O.Reload:
+			if err := j.flushSave(); err != nil {
+				j.log().Warn("save failed", "err", err)
+			}
+			n, err := New(rom, j.O)
+			if err != nil {
+				j.log().Warn("reload failed", "err", err)
+				continue
+			}
+			j.log().Info("reloading", "bytes", len(rom))
+			n.applyPatches(*j.patches)
+			n.events, n.cpu.events, n.gpu.events = j.events, j.events, j.events
+			n.Notify("Rom reloaded", 2*time.Second)
+			next, reloaded = n, true
 			running = false
 		case u := <-inst:
 			fmt.Println(u)
+		case b := <-brk:
+			fmt.Printf("%s\n%s\n", b, j.cpu)
+		case m := <-msgs:
+			fmt.Println(m)
+		case <-j.kp.cont:
+			j.cpu.RunCommand(CmdPlay, nil)
+		case key := <-j.kp.hotkey:
+			if m, ok := j.O.Macros[key]; ok {
+				j.log().Info("macro", "name", m.Name)
+				if err := j.PlayMacro(m); err != nil {
+					j.log().Warn("macro failed", "err", err)
+				} else {
+					j.Notify("Macro "+m.Name, time.Second)
+				}
+			} else if '1' <= key && key <= '3' {
+				j.ToggleLayers(Layers(1 << (key - '1')))
+			} else if key == '8' && j.O.ViewerDir != "" {
+				go j.writeViewers()
+			} else if key == '9' && j.O.StateFile != "" {
+				if err := j.saveStateFile(); err != nil {
+					j.log().Warn("save state failed", "err", err)
+					j.Notify("Save state failed", 2*time.Second)
+				} else {
+					j.Notify("State saved", time.Second)
+				}
+			} else if key == '0' && j.O.StateFile != "" {
+				if err := j.loadStateFile(); err != nil {
+					j.log().Warn("load state failed", "err", err)
+					j.Notify("Load state failed", 2*time.Second)
+				} else {
+					j.Notify("State loaded", time.Second)
+				}
+			}
 		case <-tickerC:
 			if count >= 10.0 {
 				cpuHz *= 0.9
@@ -154,6 +459,15 @@ func (j Jibi) Run() {
 
 			// skip first tick
 			if count > 0 {
+				st := Status{
+					Title: j.cart.Title(),
+					FPS:   gpuFps / count,
+					Speed: cpuHz / (dmgHz * count),
+				}
+				j.status.set(st)
+				j.lcd.SetTitle(st.String())
+			}
+			if count > 0 && j.O.Status {
 				to := time.After(2 * time.Second)
 				sc := make(chan string)
 				go func() {
@@ -190,13 +504,50 @@ func (j Jibi) Run() {
 					fmt.Println(s)
 				}
 			}
-			if j.O.Quick {
+			if j.O.Quick && j.O.Status {
 				running = false
 			}
 		}
 	}
 	ticker.Stop()
+	if j.O.IrqStats {
+		for _, s := range j.InterruptStats() {
+			fmt.Println(s)
+		}
+	}
+	if j.O.Profile {
+		j.Pause()
+		respProf := make(chan []FuncProfile)
+		j.cpu.RunCommand(CmdProfileReport, respProf)
+		fmt.Print(FormatProfile(<-respProf, j.O.Symbols))
+	}
+	if j.O.Coverage {
+		fmt.Print(FormatCoverage(j.Coverage()))
+	}
+	if err := j.flushSave(); err != nil {
+		j.log().Warn("save failed", "err", err)
+	}
 	j.Stop()
+	return next, reloaded
+}
+
+func (j Jibi) log() componentLog {
+	return newComponentLog(j.O.Logger, "jibi")
+}
+
+// InterruptStats returns the statistics for each interrupt source so far.
+func (j Jibi) InterruptStats() []InterruptStats {
+	resp := make(chan []InterruptStats)
+	j.cpu.RunCommand(CmdInterruptStats, resp)
+	return <-resp
+}
+
+// Coverage returns the opcodes executed since the Jibi started, if
+// Options.Coverage is set.
+func (j Jibi) Coverage() OpcodeCoverage {
+	resp := make(chan OpcodeCoverage)
+	j.cpu.RunCommand(CmdCoverageReport, resp)
+	return <-resp
 }
 
 // Play starts the Jibi and returns immediately.
@@ -0,0 +1,151 @@
+package jibi
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// busyRom turns the lcd on and loops writing vram, oam and the gpu registers
+// while the gpu renders, run with -race to check that nothing but the
+// scheduler touches memory.
+func busyRom() []Byte {
+	rom := make([]Byte, 0x8000)
+	copy(rom[0x0100:], []Byte{
+		0x3E, 0x91, // LD A, 0x91
+		0xE0, 0x40, // LDH (LCDC), A
+		0x21, 0x00, 0x80, // LD HL, 0x8000
+		0x04,       // INC B
+		0x78,       // LD A, B
+		0x22,       // LDI (HL), A
+		0xE0, 0x42, // LDH (SCY), A
+		0xF0, 0x44, // LDH A, (LY)
+		0xEA, 0x00, 0xFE, // LD (0xFE00), A
+		0xFA, 0x00, 0xFE, // LD A, (0xFE00)
+		0x7C,       // LD A, H
+		0xFE, 0x98, // CP 0x98
+		0x20, 0xEE, // JR NZ, -18
+		0x18, 0xE9, // JR -23
+	})
+	return rom
+}
+
+func TestBusyFrames(t *testing.T) {
+	for _, o := range []Options{{Skipbios: true}, {Skipbios: true, Cgb: true}} {
+		j, err := New(busyRom(), o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := make(chan chan ClockType)
+		j.gpu.RunCommand(CmdFrameCounter, resp)
+		frames := <-resp
+		j.Play()
+		to := time.After(10 * time.Second)
+		for n := ClockType(0); n < 5; {
+			select {
+			case f := <-frames:
+				n += f
+			case <-to:
+				t.Fatalf("cgb:%t timeout after %d frames", o.Cgb, n)
+			}
+		}
+		j.Stop()
+	}
+}
+
+func TestPeekRegisters(t *testing.T) {
+	j, err := New(busyRom(), Options{Skipbios: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	if r := j.Registers(); r.PC != 0x0100 || r.SP != 0xFFFE || r.A != 0x01 {
+		t.Errorf("%+v", r)
+	}
+	if err := j.Poke(AddrRam, 0x42); err != nil {
+		t.Fatal(err)
+	}
+	if b := j.Peek(AddrRam); b != 0x42 {
+		t.Errorf("peek 0x%02X", b)
+	}
+}
+
+func TestPeekBytes(t *testing.T) {
+	j, err := New(busyRom(), Options{Skipbios: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	for i, b := range []Byte{0x11, 0x22, 0x33} {
+		if err := j.Poke(AddrRam+Word(i), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bs := j.PeekBytes(AddrRam, 3); len(bs) != 3 || bs[0] != 0x11 || bs[2] != 0x33 {
+		t.Errorf("peek % X", bs)
+	}
+}
+
+func TestReload(t *testing.T) {
+	reload := make(chan []Byte)
+	j, err := New(busyRom(), Options{Skipbios: true, Reload: reload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.PatchROM(0x4000, []Byte{0x12}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan Jibi)
+	go func() {
+		next, ok := j.run()
+		if !ok {
+			t.Error("stopped without the new rom")
+		}
+		done <- next
+	}()
+	rom := busyRom()
+	rom[0x4001] = 0x34
+	reload <- rom
+	var next Jibi
+	select {
+	case next = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout")
+	}
+	defer next.Stop()
+	if next.cpu == j.cpu || next.gpu == j.gpu {
+		t.Error("machine not rebuilt")
+	}
+	if next.events != j.events {
+		t.Error("events not carried over")
+	}
+	if b := next.PeekBytes(0x4000, 2); b[0] != 0x12 || b[1] != 0x34 {
+		t.Errorf("rom % X, patch not applied to the new rom", b)
+	}
+}
+
+func TestWatchRomFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "game.gb")
+	if err := ioutil.WriteFile(name, make([]byte, 0x8000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := WatchRomFile(name, time.Millisecond)
+	rom := make([]byte, 0x8000)
+	rom[0x0100] = 0x76
+	if err := ioutil.WriteFile(name, rom[:0x0100], 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond) // too small to be a rom, not sent
+	if err := ioutil.WriteFile(name, rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-c:
+		if len(got) != len(rom) || got[0x0100] != 0x76 {
+			t.Errorf("%d bytes", len(got))
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("change not seen")
+	}
+}
@@ -15,6 +15,20 @@ import (
 // a      0x2F /
 // select 0x5C \
 // start  0x0A <enter>
+//
+// continue after a breakpoint 0x63 c
+//
+// toggle background, window, sprites 0x31-0x33 1-3
+//
+// second sgb controller
+// up     0x69 i
+// down   0x6B k
+// left   0x6A j
+// right  0x6C l
+// b      0x6E n
+// a      0x6D m
+// select 0x75 u
+// start  0x6F o
 
 // A Key is one of the 8 buttons.
 type Key uint8
@@ -53,21 +67,62 @@ func (k Key) String() string {
 	return "UNKNOWN"
 }
 
+// A PlayerKey is a key on one of the sgb multiplayer controllers. Player 0
+// is the main controller, a plain Key is always player 0.
+type PlayerKey struct {
+	Player int
+	Key    Key
+}
+
+// number of controllers the sgb can multiplex
+const sgbPlayers = 4
+
 type valueChan struct {
 	v Byte
 	c chan bool
 }
 
+func newKeys() map[Key]valueChan {
+	// A buffer of 1 is needed because we may get a keydown before the
+	// keyup for that key has been processed. The write to the chan is
+	// non-blocking so more than 1 keydown will simply be ignored, which
+	// is the desired behavior anyway.
+	return map[Key]valueChan{
+		KeyUp:     valueChan{1, make(chan bool, 1)},
+		KeyDown:   valueChan{1, make(chan bool, 1)},
+		KeyLeft:   valueChan{1, make(chan bool, 1)},
+		KeyRight:  valueChan{1, make(chan bool, 1)},
+		KeyB:      valueChan{1, make(chan bool, 1)},
+		KeyA:      valueChan{1, make(chan bool, 1)},
+		KeySelect: valueChan{1, make(chan bool, 1)},
+		KeyStart:  valueChan{1, make(chan bool, 1)},
+	}
+}
+
 // A Keypad manages reading the actual key input, and the button states.
 type Keypad struct {
 	CommanderInterface
 
-	mmu     Mmu
-	mmuKeys AddressKeys
+	mmu Mmu
 
 	p1013low bool
 
-	keys map[Key]valueChan
+	// one key map per controller, only the first is used unless an sgb
+	// enabled multiplayer
+	keys []map[Key]valueChan
+
+	// sgb state
+	sgb     *sgbReceiver
+	screen  *sgbScreen // colors and border set by sgb commands
+	p1      Byte       // last value written to P1, also kept without sgb
+	players int        // number of multiplexed controllers
+	player  int        // currently selected controller
+
+	log componentLog
+
+	done   chan bool // closed on stop
+	cont   chan bool // continue after a breakpoint
+	hotkey chan byte // keys that are not buttons, for macros
 }
 
 func setupInput() {
@@ -77,42 +132,36 @@ func setupInput() {
 	exec.Command("stty", "-F", "/dev/tty", "-echo").Run()
 }
 
-// NewKeypad returns a new Keypad object and starts up a goroutine.
-func NewKeypad(mmu Mmu, runSetup bool) *Keypad {
+// NewKeypad returns a new Keypad scheduled by cpu and starts up the goroutine
+// reading the keyboard. If sgb is true the Keypad decodes sgb command packets
+// written to P1.
+func NewKeypad(mmu Mmu, cpu *Cpu, runSetup bool, sgb bool) *Keypad {
 	if runSetup {
 		setupInput()
 	}
-	commander := NewCommander("keypad")
-	keys := map[Key]valueChan{
-		// A buffer of 1 is needed because we may get a keydown before the
-		// keyup for that key has been processed. The write to the chan is
-		// non-blocking so more than 1 keydown will simply be ignored, which
-		// is the desired behavior anyway.
-		KeyUp:     valueChan{1, make(chan bool, 1)},
-		KeyDown:   valueChan{1, make(chan bool, 1)},
-		KeyLeft:   valueChan{1, make(chan bool, 1)},
-		KeyRight:  valueChan{1, make(chan bool, 1)},
-		KeyB:      valueChan{1, make(chan bool, 1)},
-		KeyA:      valueChan{1, make(chan bool, 1)},
-		KeySelect: valueChan{1, make(chan bool, 1)},
-		KeyStart:  valueChan{1, make(chan bool, 1)},
+	keys := make([]map[Key]valueChan, sgbPlayers)
+	for i := range keys {
+		keys[i] = newKeys()
 	}
-	mmuKeys := AddressKeys(0)
-	mmuKeys = mmu.LockAddr(AddrP1, mmuKeys)
 	kp := &Keypad{
-		CommanderInterface: commander,
-		mmu:                mmu,
-		mmuKeys:            mmuKeys,
-		keys:               keys,
+		mmu:     mmu,
+		keys:    keys,
+		p1:      0x30,
+		players: 1,
+		done:    make(chan bool),
+		cont:    make(chan bool),
+		hotkey:  make(chan byte),
+	}
+	if sgb {
+		kp.sgb = newSgbReceiver()
 	}
 	cmdHandlers := map[Command]CommandFn{
-		CmdKeyDown:  kp.cmdKeyDown,
-		CmdKeyUp:    kp.cmdKeyUp,
-		CmdString:   kp.cmdString,
-		CmdKeyCheck: kp.cmdKeyCheck,
+		CmdKeyDown: kp.cmdKeyDown,
+		CmdKeyUp:   kp.cmdKeyUp,
+		CmdString:  kp.cmdString,
+		CmdStop:    kp.cmdStop,
 	}
-	// no state functions so cmds are synchronous
-	commander.start(nil, cmdHandlers, nil)
+	kp.CommanderInterface = cpu.schedule("keypad", cmdHandlers, nil)
 	go kp.loopKeyboard()
 	mmu.SetKeypad(kp)
 	return kp
@@ -134,7 +183,7 @@ func (k *Keypad) cmdString(resp interface{}) {
 
 func (k *Keypad) str() string {
 	s := ""
-	for key, vc := range k.keys {
+	for key, vc := range k.keys[0] {
 		if vc.v == 1 {
 			s += "  " + key.String() + "  "
 		} else {
@@ -144,84 +193,119 @@ func (k *Keypad) str() string {
 	return s
 }
 
+// playerKey returns the key map and key for Key or PlayerKey command data,
+// which was checked by checkInputKey.
+func (k *Keypad) playerKey(data interface{}) (map[Key]valueChan, Key) {
+	switch pk := data.(type) {
+	case Key:
+		return k.keys[0], pk
+	case PlayerKey:
+		if pk.Player < 0 || pk.Player >= sgbPlayers {
+			panic("invalid player")
+		}
+		return k.keys[pk.Player], pk.Key
+	}
+	panic("invalid command response type")
+}
+
 func (k *Keypad) cmdKeyDown(data interface{}) {
-	if key, ok := data.(Key); !ok {
-		panic("invalid command response type")
-	} else {
-		if k.keys[key].v == 1 { // inputs are pulled high
-			k.keys[key] = valueChan{0, k.keys[key].c}
-			c := k.keys[key].c
-			go func() {
-				// clear channel
+	keys, key := k.playerKey(data)
+	k.log.Debug("key down", "key", key)
+	if keys[key].v == 1 { // inputs are pulled high
+		keys[key] = valueChan{0, keys[key].c}
+		c := keys[key].c
+		go func() {
+			// clear channel
+			for loop := true; loop; {
+				select {
+				case <-c:
+				default:
+					loop = false
+				}
+			}
+			// loop while we get at least one keypress
+			for gotOne := true; gotOne; {
+				timeout := time.After(200 * time.Millisecond)
+				gotOne = false
 				for loop := true; loop; {
 					select {
 					case <-c:
-					default:
+						gotOne = true
+					case <-timeout:
 						loop = false
 					}
 				}
-				// loop while we get at least one keypress
-				for gotOne := true; gotOne; {
-					timeout := time.After(200 * time.Millisecond)
-					gotOne = false
-					for loop := true; loop; {
-						select {
-						case <-c:
-							gotOne = true
-						case <-timeout:
-							loop = false
-						}
-					}
-				}
-				k.RunCommand(CmdKeyUp, data)
-			}()
-			k.mmu.SetInterrupt(InterruptKeypad, k.mmuKeys)
-		} else {
-			// this chan has a buffer of 1, so even though the write is
-			// non-blocking one keypress can be queued.
-			select {
-			case k.keys[key].c <- true:
-			default:
 			}
+			k.RunCommand(CmdKeyUp, data)
+		}()
+		k.mmu.SetInterrupt(InterruptKeypad)
+	} else {
+		// this chan has a buffer of 1, so even though the write is
+		// non-blocking one keypress can be queued.
+		select {
+		case keys[key].c <- true:
+		default:
 		}
 	}
 }
 
 func (k *Keypad) cmdKeyUp(data interface{}) {
-	if key, ok := data.(Key); !ok {
-		panic("invalid command response type")
-	} else {
-		k.keys[key] = valueChan{1, k.keys[key].c}
+	keys, key := k.playerKey(data)
+	keys[key] = valueChan{1, keys[key].c}
+}
+
+// writeP1 updates P1 after the cpu writes b to it, and hands the write to
+// the sgb, which is sent packets as a sequence of writes.
+func (k *Keypad) writeP1(b Byte) {
+	if k.sgb != nil {
+		k.sgbWrite(b)
 	}
+	k.p1 = b
+	k.updateP1(b)
 }
 
-func (k *Keypad) cmdKeyCheck(data interface{}) {
-	b, _ := k.mmu.ReadIoByte(AddrP1, k.mmuKeys)
+// updateP1 puts the key state selected by b, the value written to P1, into
+// the low bits of P1.
+func (k *Keypad) updateP1(b Byte) {
 	p15 := (b & 0x20) >> 5
 	p14 := (b & 0x10) >> 4
 
-	p13 := (p14 | k.keys[KeyRight].v) & (p15 | k.keys[KeyA].v)
-	p12 := (p14 | k.keys[KeyLeft].v) & (p15 | k.keys[KeyB].v)
-	p11 := (p14 | k.keys[KeyUp].v) & (p15 | k.keys[KeySelect].v)
-	p10 := (p14 | k.keys[KeyDown].v) & (p15 | k.keys[KeyStart].v)
+	if p14 == 1 && p15 == 1 && k.players > 1 {
+		// multiplayer reads return the selected controller id
+		k.writeByte(AddrP1, Byte(0x0F-k.player))
+		return
+	}
+
+	keys := k.keys[k.player]
+	p13 := (p14 | keys[KeyRight].v) & (p15 | keys[KeyA].v)
+	p12 := (p14 | keys[KeyLeft].v) & (p15 | keys[KeyB].v)
+	p11 := (p14 | keys[KeyUp].v) & (p15 | keys[KeySelect].v)
+	p10 := (p14 | keys[KeyDown].v) & (p15 | keys[KeyStart].v)
 
 	p1310 := p10 | (p11 << 1) | (p12 << 2) | (p13 << 3)
 
 	k.writeByte(AddrP1, p1310)
 }
 
-func (kp *Keypad) readByte(addr Worder) Byte {
-	return kp.mmu.ReadByteAt(addr, kp.mmuKeys)
+func (k *Keypad) cmdStop(resp interface{}) {
+	close(k.done)
 }
 
 func (kp *Keypad) writeByte(addr Worder, b Byter) {
-	kp.mmu.WriteByteAt(addr, b, kp.mmuKeys)
+	kp.mmu.Hardware().Write(addr.Word(), b.Byte())
 }
 
 func (kp *Keypad) loopKeyboard() {
 	b := make([]byte, 1)
 	for {
 		os.Stdin.Read(b)
+		// a stopped keypad gives its last key up, the keypad that replaced
+		// it is already reading
+		select {
+		case <-kp.done:
+			return
+		default:
+		}
 		switch b[0] {
 		case 0x77: // w
 			kp.RunCommand(CmdKeyDown, KeyUp)
@@ -239,8 +323,34 @@ func (kp *Keypad) loopKeyboard() {
 			kp.RunCommand(CmdKeyDown, KeySelect)
 		case 0x0A: // <enter>
 			kp.RunCommand(CmdKeyDown, KeyStart)
+		case 0x69: // i
+			kp.RunCommand(CmdKeyDown, PlayerKey{1, KeyUp})
+		case 0x6B: // k
+			kp.RunCommand(CmdKeyDown, PlayerKey{1, KeyDown})
+		case 0x6A: // j
+			kp.RunCommand(CmdKeyDown, PlayerKey{1, KeyLeft})
+		case 0x6C: // l
+			kp.RunCommand(CmdKeyDown, PlayerKey{1, KeyRight})
+		case 0x6E: // n
+			kp.RunCommand(CmdKeyDown, PlayerKey{1, KeyB})
+		case 0x6D: // m
+			kp.RunCommand(CmdKeyDown, PlayerKey{1, KeyA})
+		case 0x75: // u
+			kp.RunCommand(CmdKeyDown, PlayerKey{1, KeySelect})
+		case 0x6F: // o
+			kp.RunCommand(CmdKeyDown, PlayerKey{1, KeyStart})
+		case 0x63: // c
+			select {
+			case kp.cont <- true:
+			default:
+			}
 		case 0x70: // p
 			panic("KeyPanic")
+		default:
+			select {
+			case kp.hotkey <- b[0]:
+			default:
+			}
 		}
 	}
 }
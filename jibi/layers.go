@@ -0,0 +1,65 @@
+package jibi
+
+import (
+	"strings"
+	"time"
+)
+
+// Layers is a set of rendering layers.
+type Layers uint8
+
+// The rendering layers.
+const (
+	LayerBg Layers = 1 << iota
+	LayerWindow
+	LayerObj
+
+	LayersAll = LayerBg | LayerWindow | LayerObj
+)
+
+func (l Layers) String() string {
+	var s []string
+	if l&LayerBg != 0 {
+		s = append(s, "bg")
+	}
+	if l&LayerWindow != 0 {
+		s = append(s, "window")
+	}
+	if l&LayerObj != 0 {
+		s = append(s, "obj")
+	}
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, ",")
+}
+
+func (g *Gpu) cmdSetLayers(data interface{}) {
+	if l, ok := data.(Layers); !ok {
+		panic("invalid command response type")
+	} else {
+		g.layers = l & LayersAll
+	}
+}
+
+func (g *Gpu) cmdToggleLayers(data interface{}) {
+	if l, ok := data.(Layers); !ok {
+		panic("invalid command response type")
+	} else {
+		g.layers ^= l & LayersAll
+		g.log.Info("layers", "bg", g.layers&LayerBg != 0,
+			"window", g.layers&LayerWindow != 0, "obj", g.layers&LayerObj != 0)
+		g.notify(Notification{"Layers " + g.layers.String(), time.Second})
+	}
+}
+
+// SetLayers shows the given layers and hides the others, starting with the
+// next frame. Games can still turn layers off themselves.
+func (j Jibi) SetLayers(l Layers) {
+	j.gpu.RunCommand(CmdSetLayers, l)
+}
+
+// ToggleLayers flips the visibility of the given layers.
+func (j Jibi) ToggleLayers(l Layers) {
+	j.gpu.RunCommand(CmdToggleLayers, l)
+}
@@ -0,0 +1,50 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestLayersString(t *testing.T) {
+	for l, s := range map[Layers]string{
+		0: "none", LayerBg: "bg", LayerWindow | LayerObj: "window,obj",
+		LayersAll: "bg,window,obj",
+	} {
+		if l.String() != s {
+			t.Errorf("%d: %q", l, l.String())
+		}
+	}
+}
+
+func TestLayers(t *testing.T) {
+	// bg tile 1 at x 6-13 and the sprite over it at x 10-17
+	bg := map[Word]Byte{AddrLCDC: 0x13, 0x9801: 1, AddrSCX: 2,
+		AddrOam: 16, AddrOam + 1: 18, AddrOam + 2: 1, AddrOBP0: 0x40}
+	// window tile 1 at x 8-15 over the blank bg map at 0x9C00
+	win := map[Word]Byte{AddrLCDC: 0x39, 0x9800: 1, AddrWX: 15}
+	for _, c := range []struct {
+		regs   map[Word]Byte
+		layers Layers
+		want   map[int]Byte
+	}{
+		{bg, LayersAll, map[int]Byte{6: 3, 9: 3, 10: 1 | pixelObj, 18: 0}},
+		{bg, LayerObj, map[int]Byte{6: 0, 9: 0, 10: 1 | pixelObj}},
+		{bg, LayerBg, map[int]Byte{6: 3, 9: 3, 10: 3, 17: 0}},
+		{win, LayersAll, map[int]Byte{7: 0, 8: 3, 15: 3, 16: 0}},
+		{win, LayerBg | LayerObj, map[int]Byte{8: 0, 15: 0}},
+	} {
+		g := newLineGpu(c.regs)
+		g.cmdSetLayers(c.layers)
+		drawLineDots(g, 0, nil)
+		for x, want := range c.want {
+			if b := g.pipe.line[x]; b != want {
+				t.Errorf("lcdc 0x%02X layers %s: pixel %d 0x%02X", c.regs[AddrLCDC], c.layers, x, b)
+			}
+		}
+	}
+
+	g := newLineGpu(nil)
+	g.cmdSetLayers(Layers(0xFF))
+	if g.layers != LayersAll {
+		t.Errorf("set %s", g.layers)
+	}
+}
@@ -2,6 +2,7 @@ package jibi
 
 import (
 	"fmt"
+	"time"
 )
 
 const (
@@ -13,6 +14,16 @@ type Lcd interface {
 	DrawLine(bl []Byte)
 	Blank()
 	DisableRender()
+	SetTitle(title string)
+	Notify(n Notification)
+}
+
+// A ColorLcd is an Lcd that shows colors. The gpu draws its lines with
+// DrawColorLine instead of DrawLine, as 15 bit rgb with red in the low 5 bits
+// like cgb palette memory.
+type ColorLcd interface {
+	Lcd
+	DrawColorLine(line []Word)
 }
 
 // An LcdASCII outputs as ascii characters to the terminal.
@@ -22,6 +33,10 @@ type LcdASCII struct {
 	lineIndex    uint8
 	prevDrawLine uint8
 	squash       bool
+
+	// notifications, the first is shown until noteUntil
+	notes     []Notification
+	noteUntil time.Time
 }
 
 func NewLcd(squash bool) Lcd {
@@ -91,6 +106,14 @@ func (lcd *LcdASCII) DrawLine(bl []Byte) {
 		}
 		ls += o
 	}
+	if lcd.lineIndex == 0 {
+		if t := lcd.note(); t != "" {
+			if len(t) > len(ls) {
+				t = t[:len(ls)]
+			}
+			ls = t + ls[len(t):]
+		}
+	}
 	if lcd.dr == false {
 		if lcd.squash {
 			fmt.Printf("\x1B[%d;H%s", drawLine, ls)
@@ -118,3 +141,31 @@ func (lcd *LcdASCII) Blank() {
 func (lcd *LcdASCII) DisableRender() {
 	lcd.dr = true
 }
+
+// SetTitle sets the terminal window title.
+func (lcd *LcdASCII) SetTitle(title string) {
+	if lcd.dr == false {
+		fmt.Printf("\x1B]0;%s\x07", title)
+	}
+}
+
+// Notify queues n to be drawn over the top line.
+func (lcd *LcdASCII) Notify(n Notification) {
+	lcd.notes = append(lcd.notes, n)
+}
+
+// note returns the text of the notification to show now, if any.
+func (lcd *LcdASCII) note() string {
+	now := time.Now()
+	for len(lcd.notes) > 0 {
+		if lcd.noteUntil.IsZero() {
+			lcd.noteUntil = now.Add(lcd.notes[0].Duration)
+		}
+		if now.Before(lcd.noteUntil) {
+			return lcd.notes[0].Text
+		}
+		lcd.notes = lcd.notes[1:]
+		lcd.noteUntil = time.Time{}
+	}
+	return ""
+}
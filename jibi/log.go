@@ -0,0 +1,139 @@
+package jibi
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// A LogLevel is the severity of a log message.
+type LogLevel int
+
+// Log levels, each includes the ones before it.
+const (
+	LogError LogLevel = iota
+	LogWarn
+	LogInfo
+	LogDebug
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogError:
+		return "error"
+	case LogWarn:
+		return "warn"
+	case LogInfo:
+		return "info"
+	case LogDebug:
+		return "debug"
+	}
+	return "UNKNOWN"
+}
+
+// ParseLogLevel returns the level named s.
+func ParseLogLevel(s string) (LogLevel, error) {
+	for l := LogError; l <= LogDebug; l++ {
+		if l.String() == s {
+			return l, nil
+		}
+	}
+	return LogError, fmt.Errorf("unknown log level %q", s)
+}
+
+// A Logger receives diagnostics from the Jibi. Component is the part that
+// logged it (cpu, mmu, gpu, apu, keypad, jibi) and kv are alternating keys and
+// values. A Logger is called from several goroutines at once.
+type Logger interface {
+	Log(level LogLevel, component, msg string, kv ...interface{})
+}
+
+// A TextLogger writes log messages as logfmt lines. Each component logs at
+// the default level unless given its own, both can be changed while running.
+type TextLogger struct {
+	lock   sync.Mutex
+	w      io.Writer
+	level  LogLevel
+	levels map[string]LogLevel
+}
+
+// NewTextLogger returns a TextLogger writing messages up to level to w.
+func NewTextLogger(w io.Writer, level LogLevel) *TextLogger {
+	return &TextLogger{w: w, level: level, levels: map[string]LogLevel{}}
+}
+
+// SetLevel sets the level for all components without their own level.
+func (l *TextLogger) SetLevel(level LogLevel) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.level = level
+}
+
+// SetComponentLevel sets the level for one component.
+func (l *TextLogger) SetComponentLevel(component string, level LogLevel) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.levels[component] = level
+}
+
+// Log writes the message if the component is logging at level.
+func (l *TextLogger) Log(level LogLevel, component, msg string, kv ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	max, ok := l.levels[component]
+	if !ok {
+		max = l.level
+	}
+	if level > max {
+		return
+	}
+	s := fmt.Sprintf("level=%s component=%s msg=%s", level, component, logValue(msg))
+	for i := 0; i < len(kv); i += 2 {
+		var v interface{} = "MISSING"
+		if i+1 < len(kv) {
+			v = kv[i+1]
+		}
+		s += fmt.Sprintf(" %v=%s", kv[i], logValue(fmt.Sprint(v)))
+	}
+	fmt.Fprintln(l.w, s)
+}
+
+func logValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\n") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+// a componentLog logs for one component, the zero value is silent
+type componentLog struct {
+	l         Logger
+	component string
+}
+
+func newComponentLog(l Logger, component string) componentLog {
+	return componentLog{l, component}
+}
+
+func (c componentLog) log(level LogLevel, msg string, kv ...interface{}) {
+	if c.l != nil {
+		c.l.Log(level, c.component, msg, kv...)
+	}
+}
+
+func (c componentLog) Error(msg string, kv ...interface{}) {
+	c.log(LogError, msg, kv...)
+}
+
+func (c componentLog) Warn(msg string, kv ...interface{}) {
+	c.log(LogWarn, msg, kv...)
+}
+
+func (c componentLog) Info(msg string, kv ...interface{}) {
+	c.log(LogInfo, msg, kv...)
+}
+
+func (c componentLog) Debug(msg string, kv ...interface{}) {
+	c.log(LogDebug, msg, kv...)
+}
@@ -0,0 +1,26 @@
+package jibi
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTextLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewTextLogger(buf, LogWarn)
+	l.SetComponentLevel("mmu", LogDebug)
+
+	cpu := newComponentLog(l, "cpu")
+	mmu := newComponentLog(l, "mmu")
+	cpu.Info("dropped")
+	cpu.Warn("kept", "pc", "0x0150")
+	mmu.Debug("ignored write", "addr", "0xFEA0", "region", "unusable memory")
+
+	want := "level=warn component=cpu msg=kept pc=0x0150\n" +
+		"level=debug component=mmu msg=\"ignored write\" addr=0xFEA0 region=\"unusable memory\"\n"
+	if buf.String() != want {
+		t.Errorf("%q", buf.String())
+	}
+
+	componentLog{}.Error("silent")
+}
@@ -0,0 +1,93 @@
+package jibi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A MacroStep presses or releases a key Frame frames after the macro was
+// triggered.
+type MacroStep struct {
+	Frame uint64
+	Key   interface{} // Key or PlayerKey
+	Down  bool
+}
+
+// A Macro is a named sequence of timed key presses.
+type Macro struct {
+	Name  string
+	Steps []MacroStep
+}
+
+// ParseMacro parses comma separated presses of the form key@frame+frames,
+// pressing key frame frames after the trigger and holding it for frames
+// frames, 1 if left out. Keys are named as by Key.String.
+func ParseMacro(name, s string) (Macro, error) {
+	m := Macro{Name: name}
+	for _, press := range strings.Split(s, ",") {
+		press = strings.TrimSpace(press)
+		at := strings.Index(press, "@")
+		if at < 0 {
+			return Macro{}, fmt.Errorf("macro %s: %q needs key@frame", name, press)
+		}
+		key, ok := ParseKey(press[:at])
+		if !ok {
+			return Macro{}, fmt.Errorf("macro %s: unknown key %q", name, press[:at])
+		}
+		timing := strings.SplitN(press[at+1:], "+", 2)
+		frame, err := strconv.ParseUint(timing[0], 10, 32)
+		if err != nil {
+			return Macro{}, fmt.Errorf("macro %s: invalid frame: %v", name, err)
+		}
+		hold := uint64(1)
+		if len(timing) == 2 {
+			hold, err = strconv.ParseUint(timing[1], 10, 32)
+			if err != nil || hold == 0 {
+				return Macro{}, fmt.Errorf("macro %s: invalid hold %q", name, timing[1])
+			}
+		}
+		m.Steps = append(m.Steps,
+			MacroStep{frame, key, true},
+			MacroStep{frame + hold, key, false})
+	}
+	return m, nil
+}
+
+// ParseKey returns the key named s as by Key.String.
+func ParseKey(s string) (Key, bool) {
+	for k := KeyUp; k <= KeyStart; k++ {
+		if k.String() == s {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// cmdPlayMacro queues the macro steps relative to the start of the next
+// frame, so a macro plays the same no matter when in a frame it was
+// triggered.
+func (c *Cpu) cmdPlayMacro(data interface{}) {
+	m, ok := data.(Macro)
+	if !ok {
+		panic("invalid command response type")
+	}
+	start := FrameCycle(c.cycles/cyclesPerFrame + 1)
+	events := make([]InputEvent, len(m.Steps))
+	for i, step := range m.Steps {
+		events[i] = InputEvent{start + FrameCycle(step.Frame), step.Key, step.Down}
+	}
+	c.cmdQueueInput(events)
+}
+
+// PlayMacro triggers a macro, its frames count from the next frame. A
+// macro with an invalid key is not played.
+func (j Jibi) PlayMacro(m Macro) error {
+	for _, step := range m.Steps {
+		if err := checkInputKey(step.Key); err != nil {
+			return fmt.Errorf("macro %s: %s", m.Name, err)
+		}
+	}
+	j.cpu.RunCommand(CmdPlayMacro, m)
+	return nil
+}
@@ -0,0 +1,68 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestParseMacro(t *testing.T) {
+	m, err := ParseMacro("jump", "right@0+10, a@5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MacroStep{
+		{0, KeyRight, true}, {10, KeyRight, false},
+		{5, KeyA, true}, {6, KeyA, false},
+	}
+	if len(m.Steps) != len(want) {
+		t.Fatalf("%v", m.Steps)
+	}
+	for i := range want {
+		if m.Steps[i] != want[i] {
+			t.Errorf("%d: %v != %v", i, m.Steps[i], want[i])
+		}
+	}
+	for _, s := range []string{"a", "x@1", "a@1+0", "a@b"} {
+		if _, err := ParseMacro("bad", s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestPlayMacro(t *testing.T) {
+	cpu := NewCpu(newTestMmu(), []Byte{})
+	defer cpu.RunCommand(CmdStop, nil)
+
+	cpu.cycles = FrameCycle(3) + 100
+	cpu.cmdPlayMacro(Macro{"m", []MacroStep{{2, KeyA, false}, {0, KeyA, true}}})
+	if len(cpu.inputs) != 2 ||
+		cpu.inputs[0] != (InputEvent{FrameCycle(4), KeyA, true}) ||
+		cpu.inputs[1] != (InputEvent{FrameCycle(6), KeyA, false}) {
+		t.Errorf("%v", cpu.inputs)
+	}
+}
+
+func TestInvalidInput(t *testing.T) {
+	j, err := New(busyRom(), Options{Skipbios: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	for _, key := range []interface{}{
+		Key(8), PlayerKey{-1, KeyA}, PlayerKey{sgbPlayers, KeyA},
+		PlayerKey{1, Key(8)}, "a", nil,
+	} {
+		if err := j.QueueInput(InputEvent{0, KeyA, true}, InputEvent{0, key, true}); err == nil {
+			t.Errorf("%#v: queued", key)
+		}
+		if err := j.PlayMacro(Macro{"m", []MacroStep{{0, key, true}}}); err == nil {
+			t.Errorf("%#v: played", key)
+		}
+	}
+	if err := j.QueueInput(InputEvent{0, PlayerKey{3, KeyStart}, true}); err != nil {
+		t.Error(err)
+	}
+	m, _ := ParseMacro("m", "a@0")
+	if err := j.PlayMacro(m); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,129 @@
+package jibi
+
+import (
+	"fmt"
+)
+
+// A Mapper is the memory bank controller on a cartridge. Reads from
+// 0x0000-0x7FFF and 0xA000-0xBFFF go through it, as do writes to rom space,
+// which set its control registers.
+type Mapper interface {
+	ReadRom(addr Word) Byte
+	WriteRom(addr Word, b Byte)
+	ReadRam(addr Word) Byte
+	WriteRam(addr Word, b Byte)
+
+	// RomBank returns the bank mapped at 0x4000-0x7FFF.
+	RomBank() int
+
+	// Rom returns the whole rom image.
+	Rom() []Byte
+}
+
+// A cartridgeSlot is the MemoryDevice of the cartridge, the rom with the
+// cheats patched in and the ram, both through the mapper.
+type cartridgeSlot struct {
+	mapper Mapper
+	cheats *romCheats
+}
+
+func (c *cartridgeSlot) Read(addr Word) Byte {
+	if addr < AddrVRam {
+		return c.cheats.patch(addr, c.mapper.ReadRom(addr))
+	}
+	return c.mapper.ReadRam(addr)
+}
+
+func (c *cartridgeSlot) Write(addr Word, b Byte) {
+	if addr < AddrVRam {
+		c.mapper.WriteRom(addr, b)
+	} else {
+		c.mapper.WriteRam(addr, b)
+	}
+}
+
+// newMapper returns the mapper for a cartridge type, or an error for types
+// that are not emulated.
+func newMapper(ct cartridgeType, rom []Byte, ramSize cartridgeRamSize) (Mapper, error) {
+	switch ct {
+	case 0x00, 0x08, 0x09:
+		return newRomOnly(rom, ramSize), nil
+	case 0x01, 0x02, 0x03:
+		return newMbc1(rom, ramSize), nil
+	case 0x05, 0x06:
+		return newMbc2(rom), nil
+	case 0x0F, 0x10, 0x11, 0x12, 0x13:
+		return newMbc3(rom, ramSize), nil
+	case 0x19, 0x1A, 0x1B:
+		return newMbc5(rom, ramSize, false), nil
+	case 0x1C, 0x1D, 0x1E:
+		return newMbc5(rom, ramSize, true), nil
+	case 0x22:
+		return newMbc7(rom), nil
+	case 0xFD:
+		return newTama5(rom), nil
+	case 0xFE:
+		return newHuc3(rom, ramSize), nil
+	}
+	switch ct {
+	case 0x0B, 0x0C, 0x0D, 0x1F:
+		return nil, fmt.Errorf("cartridge type %s is not supported", ct)
+	}
+	return nil, fmt.Errorf("unknown cartridge type 0x%02X", uint8(ct))
+}
+
+// romOnly is a cartridge without a mapper, 32KB of rom and optionally 8KB of
+// ram.
+type romOnly struct {
+	rom []Byte
+	ram []Byte
+}
+
+func newRomOnly(rom []Byte, ramSize cartridgeRamSize) *romOnly {
+	var ram []Byte
+	if ramSize.banks() > 0 {
+		ram = make([]Byte, 0x2000)
+	}
+	return &romOnly{rom, ram}
+}
+
+func (m *romOnly) ReadRom(addr Word) Byte {
+	if int(addr) < len(m.rom) {
+		return m.rom[addr]
+	}
+	return 0xFF
+}
+
+func (m *romOnly) WriteRom(addr Word, b Byte) {
+}
+
+func (m *romOnly) RomBank() int {
+	return 1
+}
+
+func (m *romOnly) Rom() []Byte {
+	return m.rom
+}
+
+func (m *romOnly) ReadRam(addr Word) Byte {
+	if m.ram == nil {
+		return 0xFF
+	}
+	return m.ram[addr-AddrERam]
+}
+
+func (m *romOnly) WriteRam(addr Word, b Byte) {
+	if m.ram != nil {
+		m.ram[addr-AddrERam] = b
+	}
+}
+
+// romBank returns the byte at addr in 0x4000-0x7FFF for a switchable bank,
+// banks past the end of the rom wrap around.
+func romBank(rom []Byte, bank int, addr Word) Byte {
+	banks := len(rom) / 0x4000
+	if banks == 0 {
+		return 0xFF
+	}
+	return rom[(bank%banks)*0x4000+int(addr-0x4000)]
+}
@@ -0,0 +1,75 @@
+package jibi
+
+// mbc1 is the first Nintendo mapper, up to 2MB of rom and 32KB of ram. The
+// two bit bank2 register extends the rom bank in mode 0, and in mode 1 also
+// selects the ram bank and the rom bank mapped at 0x0000-0x3FFF.
+type mbc1 struct {
+	rom        []Byte
+	ram        []Byte
+	ramEnabled bool
+	bank1      int // 5 bits, 0 reads as 1
+	bank2      int // 2 bits
+	mode       Byte
+}
+
+func newMbc1(rom []Byte, ramSize cartridgeRamSize) *mbc1 {
+	return &mbc1{
+		rom:   rom,
+		ram:   make([]Byte, 0x2000*ramSize.banks()),
+		bank1: 1,
+	}
+}
+
+func (m *mbc1) ReadRom(addr Word) Byte {
+	if addr < 0x4000 {
+		if m.mode == 0 {
+			return m.rom[addr]
+		}
+		return romBank(m.rom, m.bank2<<5, addr+0x4000)
+	}
+	return romBank(m.rom, m.RomBank(), addr)
+}
+
+func (m *mbc1) RomBank() int {
+	return m.bank2<<5 | m.bank1
+}
+
+func (m *mbc1) Rom() []Byte {
+	return m.rom
+}
+
+func (m *mbc1) WriteRom(addr Word, b Byte) {
+	switch {
+	case addr < 0x2000:
+		m.ramEnabled = b&0x0F == 0x0A
+	case addr < 0x4000:
+		m.bank1 = int(b & 0x1F)
+		if m.bank1 == 0 {
+			m.bank1 = 1
+		}
+	case addr < 0x6000:
+		m.bank2 = int(b & 0x03)
+	default:
+		m.mode = b & 0x01
+	}
+}
+
+func (m *mbc1) ramBank() int {
+	if m.mode == 0 {
+		return 0
+	}
+	return m.bank2
+}
+
+func (m *mbc1) ReadRam(addr Word) Byte {
+	if !m.ramEnabled {
+		return 0xFF
+	}
+	return bankedRam(m.ram, m.ramBank(), addr)
+}
+
+func (m *mbc1) WriteRam(addr Word, b Byte) {
+	if m.ramEnabled {
+		setBankedRam(m.ram, m.ramBank(), addr, b)
+	}
+}
@@ -0,0 +1,80 @@
+package jibi
+
+import (
+	"testing"
+)
+
+// bankedRom returns a rom of n banks with every bank starting with its
+// number.
+func bankedRom(n int) []Byte {
+	rom := make([]Byte, n*0x4000)
+	for b := 0; b < n; b++ {
+		rom[b*0x4000] = Byte(b)
+	}
+	return rom
+}
+
+func TestMbc1Rom(t *testing.T) {
+	m := newMbc1(bankedRom(128), 0x00)
+	for _, c := range []struct {
+		addr Word
+		b    Byte
+		lo   Byte // bank at 0x0000
+		hi   Byte // bank at 0x4000
+	}{
+		{0x2000, 0x00, 0x00, 0x01}, // bank 0 reads as 1
+		{0x2000, 0x05, 0x00, 0x05},
+		{0x2000, 0xE3, 0x00, 0x03}, // 5 bits
+		{0x4000, 0x01, 0x00, 0x23},
+		{0x6000, 0x01, 0x20, 0x23}, // mode 1 banks 0x0000 too
+		{0x2000, 0x00, 0x20, 0x21},
+		{0x6000, 0x00, 0x00, 0x21},
+	} {
+		m.WriteRom(c.addr, c.b)
+		if lo, hi := m.ReadRom(0x0000), m.ReadRom(0x4000); lo != c.lo || hi != c.hi {
+			t.Errorf("write 0x%02X to 0x%04X: banks 0x%02X 0x%02X", c.b, c.addr, lo, hi)
+		}
+	}
+
+	// banks past the end of a small rom wrap around
+	m = newMbc1(bankedRom(4), 0x00)
+	m.WriteRom(0x2000, 0x06)
+	if hi := m.ReadRom(0x4000); hi != 0x02 {
+		t.Errorf("bank 0x%02X", hi)
+	}
+}
+
+func TestMbc1Ram(t *testing.T) {
+	m := newMbc1(bankedRom(4), 0x03)
+	m.WriteRam(0xA000, 0x42)
+	if m.ReadRam(0xA000) != 0xFF {
+		t.Error("ram enabled")
+	}
+	m.WriteRom(0x0000, 0x0A)
+	m.WriteRam(0xA000, 0x42)
+	m.WriteRom(0x4000, 0x02)
+	if m.ReadRam(0xA000) != 0x42 {
+		t.Error("ram banked in mode 0")
+	}
+	m.WriteRom(0x6000, 0x01)
+	if m.ReadRam(0xA000) != 0x00 {
+		t.Error("ram not banked in mode 1")
+	}
+	m.WriteRam(0xA000, 0x43)
+	m.WriteRom(0x6000, 0x00)
+	if m.ReadRam(0xA000) != 0x42 {
+		t.Errorf("0x%02X", m.ReadRam(0xA000))
+	}
+	m.WriteRom(0x0000, 0x00)
+	if m.ReadRam(0xA000) != 0xFF {
+		t.Error("ram not disabled")
+	}
+
+	// no ram
+	m = newMbc1(bankedRom(4), 0x00)
+	m.WriteRom(0x0000, 0x0A)
+	m.WriteRam(0xA000, 0x42)
+	if m.ReadRam(0xA000) != 0xFF {
+		t.Error("ram without ram")
+	}
+}
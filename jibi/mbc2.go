@@ -0,0 +1,62 @@
+package jibi
+
+// mbc2 is Nintendo's small mapper with up to 256KB of rom and 512 nibbles of
+// ram built in. Bit 8 of the address decides what a write to 0x0000-0x3FFF
+// sets, clear enables ram and set selects the rom bank. The ram repeats
+// through 0xA000-0xBFFF and its upper nibble reads as ones.
+type mbc2 struct {
+	rom        []Byte
+	ram        []Byte
+	ramEnabled bool
+	romBank    int // 4 bits, 0 reads as 1
+}
+
+func newMbc2(rom []Byte) *mbc2 {
+	return &mbc2{
+		rom:     rom,
+		ram:     make([]Byte, 0x200),
+		romBank: 1,
+	}
+}
+
+func (m *mbc2) ReadRom(addr Word) Byte {
+	if addr < 0x4000 {
+		return m.rom[addr]
+	}
+	return romBank(m.rom, m.romBank, addr)
+}
+
+func (m *mbc2) RomBank() int {
+	return m.romBank
+}
+
+func (m *mbc2) Rom() []Byte {
+	return m.rom
+}
+
+func (m *mbc2) WriteRom(addr Word, b Byte) {
+	if addr >= 0x4000 {
+		return
+	}
+	if addr&0x0100 == 0 {
+		m.ramEnabled = b&0x0F == 0x0A
+		return
+	}
+	m.romBank = int(b & 0x0F)
+	if m.romBank == 0 {
+		m.romBank = 1
+	}
+}
+
+func (m *mbc2) ReadRam(addr Word) Byte {
+	if !m.ramEnabled {
+		return 0xFF
+	}
+	return 0xF0 | m.ram[addr&0x01FF]
+}
+
+func (m *mbc2) WriteRam(addr Word, b Byte) {
+	if m.ramEnabled {
+		m.ram[addr&0x01FF] = b & 0x0F
+	}
+}
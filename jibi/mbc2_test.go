@@ -0,0 +1,44 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestMbc2(t *testing.T) {
+	m := newMbc2(bankedRom(16))
+	m.WriteRom(0x2000, 0x05) // bit 8 clear, ram enable
+	if hi := m.ReadRom(0x4000); hi != 0x01 {
+		t.Errorf("bank 0x%02X", hi)
+	}
+	for _, c := range []struct {
+		b    Byte
+		bank Byte
+	}{
+		{0x00, 0x01},
+		{0x07, 0x07},
+		{0xFC, 0x0C}, // 4 bits
+	} {
+		m.WriteRom(0x2100, c.b)
+		if hi := m.ReadRom(0x4000); hi != c.bank {
+			t.Errorf("write 0x%02X: bank 0x%02X", c.b, hi)
+		}
+	}
+
+	m.WriteRam(0xA000, 0x42)
+	if m.ReadRam(0xA000) != 0xFF {
+		t.Error("ram enabled")
+	}
+	m.WriteRom(0x3100, 0x0A)
+	m.WriteRam(0xA000, 0x42)
+	if m.ReadRam(0xA000) != 0xFF {
+		t.Error("ram enabled with bit 8 set")
+	}
+	m.WriteRom(0x3000, 0x0A)
+	m.WriteRam(0xA001, 0x5A)
+	if b := m.ReadRam(0xA001); b != 0xFA {
+		t.Errorf("0x%02X", b)
+	}
+	if b := m.ReadRam(0xB801); b != 0xFA {
+		t.Errorf("echo 0x%02X", b)
+	}
+}
@@ -0,0 +1,181 @@
+package jibi
+
+import (
+	"time"
+)
+
+// mbc3 rtc registers, selected by writing to 0x4000-0x5FFF
+const (
+	mbc3RtcS  Byte = 0x08
+	mbc3RtcM  Byte = 0x09
+	mbc3RtcH  Byte = 0x0A
+	mbc3RtcDL Byte = 0x0B
+	mbc3RtcDH Byte = 0x0C // bit 0 day bit 8, bit 6 halt, bit 7 day carry
+)
+
+// mbc3 is Nintendo's mapper with up to 2MB of rom, 32KB of ram and a real
+// time clock. The clock registers are mapped into ram space in place of a
+// ram bank, reads see a copy latched by writing 0x00 then 0x01 to
+// 0x6000-0x7FFF.
+type mbc3 struct {
+	rom        []Byte
+	ram        []Byte
+	ramEnabled bool
+	romBank    int
+	ramBank    Byte // 0x00-0x03 ram, 0x08-0x0C rtc
+	latch      Byte // last write to 0x6000-0x7FFF
+
+	clk     RtcClock
+	at      time.Time // time the counter was last updated
+	seconds int64     // seconds counted, 512 days wrap into the carry
+	halt    bool
+	carry   bool
+	latched [5]Byte
+}
+
+func newMbc3(rom []Byte, ramSize cartridgeRamSize) *mbc3 {
+	clk := RtcClock(systemClock{})
+	return &mbc3{
+		rom:     rom,
+		ram:     make([]Byte, 0x2000*ramSize.banks()),
+		romBank: 1,
+		latch:   0xFF,
+		clk:     clk,
+		at:      clk.Now(),
+	}
+}
+
+func (m *mbc3) setRtcClock(clk RtcClock) {
+	m.clk = clk
+	m.at = clk.Now()
+}
+
+func (m *mbc3) ReadRom(addr Word) Byte {
+	if addr < 0x4000 {
+		return m.rom[addr]
+	}
+	return romBank(m.rom, m.romBank, addr)
+}
+
+func (m *mbc3) RomBank() int {
+	return m.romBank
+}
+
+func (m *mbc3) Rom() []Byte {
+	return m.rom
+}
+
+func (m *mbc3) WriteRom(addr Word, b Byte) {
+	switch {
+	case addr < 0x2000:
+		m.ramEnabled = b&0x0F == 0x0A
+	case addr < 0x4000:
+		m.romBank = int(b & 0x7F)
+		if m.romBank == 0 {
+			m.romBank = 1
+		}
+	case addr < 0x6000:
+		m.ramBank = b & 0x0F
+	default:
+		if m.latch == 0x00 && b == 0x01 {
+			m.latchRtc()
+		}
+		m.latch = b
+	}
+}
+
+func (m *mbc3) ReadRam(addr Word) Byte {
+	if !m.ramEnabled {
+		return 0xFF
+	}
+	if m.ramBank >= mbc3RtcS && m.ramBank <= mbc3RtcDH {
+		return m.latched[m.ramBank-mbc3RtcS]
+	} else if m.ramBank < 0x04 {
+		return bankedRam(m.ram, int(m.ramBank), addr)
+	}
+	return 0xFF
+}
+
+func (m *mbc3) WriteRam(addr Word, b Byte) {
+	if !m.ramEnabled {
+		return
+	}
+	if m.ramBank >= mbc3RtcS && m.ramBank <= mbc3RtcDH {
+		m.setRtc(m.ramBank, b)
+	} else if m.ramBank < 0x04 && len(m.ram) > 0 {
+		setBankedRam(m.ram, int(m.ramBank), addr, b)
+	}
+}
+
+// update folds the whole seconds passed since the last update into the
+// counter, unless the clock is halted.
+func (m *mbc3) update() {
+	now := m.clk.Now()
+	elapsed := int64(now.Sub(m.at) / time.Second)
+	if elapsed <= 0 {
+		return
+	}
+	m.at = m.at.Add(time.Duration(elapsed) * time.Second)
+	if m.halt {
+		return
+	}
+	m.seconds += elapsed
+	if m.seconds >= 512*86400 {
+		m.carry = true
+		m.seconds %= 512 * 86400
+	}
+}
+
+// rtc returns the live clock registers.
+func (m *mbc3) rtc() [5]Byte {
+	days := m.seconds / 86400
+	dh := Byte(days>>8) & 0x01
+	if m.halt {
+		dh |= 0x40
+	}
+	if m.carry {
+		dh |= 0x80
+	}
+	return [5]Byte{
+		Byte(m.seconds % 60),
+		Byte(m.seconds / 60 % 60),
+		Byte(m.seconds / 3600 % 24),
+		Byte(days),
+		dh,
+	}
+}
+
+func (m *mbc3) latchRtc() {
+	m.update()
+	m.latched = m.rtc()
+}
+
+// setRtc writes a clock register, the latched copy follows so the game reads
+// back what it wrote.
+func (m *mbc3) setRtc(reg, b Byte) {
+	m.update()
+	r := m.rtc()
+	r[reg-mbc3RtcS] = b
+	m.setClock(r)
+	m.latched[reg-mbc3RtcS] = b
+}
+
+// setClock sets the counter from the clock registers.
+func (m *mbc3) setClock(r [5]Byte) {
+	s, min, h := int64(r[0]%60), int64(r[1]%60), int64(r[2]%24)
+	days := int64(r[4]&0x01)<<8 | int64(r[3])
+	m.seconds = days*86400 + h*3600 + min*60 + s
+	m.halt = r[4]&0x40 != 0
+	m.carry = r[4]&0x80 != 0
+}
+
+func (m *mbc3) saveRtc() ([5]Byte, [5]Byte, time.Time) {
+	m.update()
+	return m.rtc(), m.latched, m.at
+}
+
+func (m *mbc3) loadRtc(live, latched [5]Byte, at time.Time) {
+	m.setClock(live)
+	m.latched = latched
+	m.at = at
+}
@@ -0,0 +1,96 @@
+package jibi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMbc3Rom(t *testing.T) {
+	m := newMbc3(bankedRom(128), 0x00)
+	for _, c := range []struct {
+		b    Byte
+		bank Byte
+	}{
+		{0x00, 0x01}, // bank 0 reads as 1
+		{0x05, 0x05},
+		{0x45, 0x45}, // 7 bits, no gap at 0x20
+		{0x20, 0x20},
+		{0xFF, 0x7F},
+	} {
+		m.WriteRom(0x2000, c.b)
+		if hi := m.ReadRom(0x4000); hi != c.bank {
+			t.Errorf("write 0x%02X: bank 0x%02X", c.b, hi)
+		}
+	}
+}
+
+func TestMbc3Ram(t *testing.T) {
+	m := newMbc3(bankedRom(4), 0x03)
+	m.WriteRam(0xA000, 0x42)
+	if m.ReadRam(0xA000) != 0xFF {
+		t.Error("ram enabled")
+	}
+	m.WriteRom(0x0000, 0x0A)
+	m.WriteRom(0x4000, 0x03)
+	m.WriteRam(0xA000, 0x42)
+	m.WriteRom(0x4000, 0x00)
+	if m.ReadRam(0xA000) != 0x00 {
+		t.Error("ram bank not switched")
+	}
+	m.WriteRom(0x4000, 0x03)
+	if m.ReadRam(0xA000) != 0x42 {
+		t.Errorf("0x%02X", m.ReadRam(0xA000))
+	}
+}
+
+func mbc3Rtc(m *mbc3) [5]Byte {
+	var r [5]Byte
+	for i := range r {
+		m.WriteRom(0x4000, mbc3RtcS+Byte(i))
+		r[i] = m.ReadRam(0xA000)
+	}
+	return r
+}
+
+func TestMbc3Rtc(t *testing.T) {
+	clk := &FixedClock{time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := newMbc3(bankedRom(4), 0x03)
+	m.setRtcClock(clk)
+	m.WriteRom(0x0000, 0x0A)
+
+	// day 255 23:59:58
+	for i, b := range []Byte{58, 59, 23, 0xFF, 0x00} {
+		m.WriteRom(0x4000, mbc3RtcS+Byte(i))
+		m.WriteRam(0xA000, b)
+	}
+	clk.Advance(3 * time.Second)
+	if r := mbc3Rtc(m); r != [5]Byte{58, 59, 23, 0xFF, 0x00} {
+		t.Errorf("not latched %v", r)
+	}
+	m.WriteRom(0x6000, 0x00)
+	m.WriteRom(0x6000, 0x01)
+	if r := mbc3Rtc(m); r != [5]Byte{1, 0, 0, 0x00, 0x01} {
+		t.Errorf("latched %v", r)
+	}
+
+	// halted, and latching needs 0x00 first
+	m.WriteRom(0x4000, mbc3RtcDH)
+	m.WriteRam(0xA000, 0x41)
+	clk.Advance(time.Hour)
+	m.WriteRom(0x6000, 0x01)
+	m.WriteRom(0x6000, 0x00)
+	m.WriteRom(0x6000, 0x01)
+	if r := mbc3Rtc(m); r != [5]Byte{1, 0, 0, 0x00, 0x41} {
+		t.Errorf("halted %v", r)
+	}
+
+	// day counter overflow sets the carry
+	m.WriteRom(0x4000, mbc3RtcDH)
+	m.WriteRam(0xA000, 0x01)
+	clk.Advance(256 * 24 * time.Hour)
+	m.WriteRom(0x6000, 0x00)
+	m.WriteRom(0x6000, 0x01)
+	if r := mbc3Rtc(m); r != [5]Byte{1, 0, 0, 0x00, 0x80} {
+		t.Errorf("carry %v", r)
+	}
+}
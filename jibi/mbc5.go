@@ -0,0 +1,66 @@
+package jibi
+
+// mbc5 maps up to 8MB of rom with a 9 bit bank, where unlike the older
+// mappers bank 0 can be mapped at 0x4000, and up to 128KB of ram. On rumble
+// cartridges bit 3 of the ram bank drives the motor, which is not emulated.
+type mbc5 struct {
+	rom        []Byte
+	ram        []Byte
+	ramEnabled bool
+	romBank    int // 9 bits
+	ramBank    int // 4 bits
+	rumble     bool
+}
+
+func newMbc5(rom []Byte, ramSize cartridgeRamSize, rumble bool) *mbc5 {
+	return &mbc5{
+		rom:     rom,
+		ram:     make([]Byte, 0x2000*ramSize.banks()),
+		romBank: 1,
+		rumble:  rumble,
+	}
+}
+
+func (m *mbc5) ReadRom(addr Word) Byte {
+	if addr < 0x4000 {
+		return m.rom[addr]
+	}
+	return romBank(m.rom, m.romBank, addr)
+}
+
+func (m *mbc5) RomBank() int {
+	return m.romBank
+}
+
+func (m *mbc5) Rom() []Byte {
+	return m.rom
+}
+
+func (m *mbc5) WriteRom(addr Word, b Byte) {
+	switch {
+	case addr < 0x2000:
+		m.ramEnabled = b&0x0F == 0x0A
+	case addr < 0x3000:
+		m.romBank = m.romBank&0x100 | int(b)
+	case addr < 0x4000:
+		m.romBank = int(b&0x01)<<8 | m.romBank&0xFF
+	case addr < 0x6000:
+		if m.rumble {
+			b &= 0x07
+		}
+		m.ramBank = int(b & 0x0F)
+	}
+}
+
+func (m *mbc5) ReadRam(addr Word) Byte {
+	if !m.ramEnabled {
+		return 0xFF
+	}
+	return bankedRam(m.ram, m.ramBank, addr)
+}
+
+func (m *mbc5) WriteRam(addr Word, b Byte) {
+	if m.ramEnabled {
+		setBankedRam(m.ram, m.ramBank, addr, b)
+	}
+}
@@ -0,0 +1,54 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestMbc5Rom(t *testing.T) {
+	m := newMbc5(bankedRom(512), 0x00, false)
+	for _, c := range []struct {
+		addr Word
+		b    Byte
+		hi   int // bank at 0x4000
+	}{
+		{0x2000, 0x00, 0x000}, // bank 0 can be mapped
+		{0x2000, 0x05, 0x005},
+		{0x3000, 0x01, 0x105},
+		{0x2FFF, 0xFF, 0x1FF},
+		{0x3000, 0x00, 0x0FF},
+	} {
+		m.WriteRom(c.addr, c.b)
+		if m.RomBank() != c.hi || m.ReadRom(0x4000) != Byte(c.hi) {
+			t.Errorf("write 0x%02X to 0x%04X: bank 0x%03X", c.b, c.addr, m.RomBank())
+		}
+	}
+}
+
+func TestMbc5Ram(t *testing.T) {
+	for _, rumble := range []bool{false, true} {
+		m := newMbc5(bankedRom(4), 0x04, rumble)
+		m.WriteRom(0x0000, 0x0A)
+		for bank := Byte(0); bank < 16; bank++ {
+			m.WriteRom(0x4000, bank)
+			m.WriteRam(0xA000, bank)
+		}
+		m.WriteRom(0x4000, 0x03)
+		want := Byte(0x03)
+		if rumble {
+			want = 0x0B // the motor bit is not part of the bank
+		}
+		if b := m.ReadRam(0xA000); b != want {
+			t.Errorf("rumble %t: 0x%02X", rumble, b)
+		}
+	}
+}
+
+func TestNewMapper(t *testing.T) {
+	rom := make([]Byte, 0x8000)
+	for ct, ok := range map[Byte]bool{0x00: true, 0x1B: true, 0x1E: true, 0x0B: false, 0x1F: false, 0x42: false} {
+		rom[0x0147] = ct
+		if _, err := NewCartridge(rom); (err == nil) != ok {
+			t.Errorf("type 0x%02X: %v", ct, err)
+		}
+	}
+}
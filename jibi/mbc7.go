@@ -0,0 +1,299 @@
+package jibi
+
+import (
+	"sync"
+)
+
+// A TiltSource reports how far the cartridge is tilted on each axis, from -1
+// to 1, for the mbc7 accelerometer. Positive x is right, positive y is down.
+type TiltSource interface {
+	Tilt() (x, y float64)
+}
+
+// A ManualTilt is a TiltSource set directly by a frontend, for example from
+// an analog stick or from keys.
+type ManualTilt struct {
+	lock sync.Mutex
+	x, y float64
+}
+
+// Set sets the tilt, values are clamped to -1 and 1.
+func (t *ManualTilt) Set(x, y float64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.x = clampTilt(x)
+	t.y = clampTilt(y)
+}
+
+// Tilt returns the last set tilt.
+func (t *ManualTilt) Tilt() (float64, float64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.x, t.y
+}
+
+func clampTilt(v float64) float64 {
+	if v < -1 {
+		return -1
+	} else if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// the accelerometer reads 0x81D0 when flat and about 0x70 away at 1g
+const (
+	mbc7TiltCenter = 0x81D0
+	mbc7TiltRange  = 0x70
+)
+
+// mbc7 is the mapper used by Kirby Tilt 'n' Tumble, it has no ram but a
+// 93LC56 eeprom and a two axis accelerometer mapped into 0xA000-0xAFFF.
+type mbc7 struct {
+	rom  []Byte
+	bank int
+
+	ramEnable1 bool // 0x0A written to 0x0000-0x1FFF
+	ramEnable2 bool // 0x40 written to 0x4000-0x5FFF
+
+	tilt    TiltSource
+	erased  bool // latch erased and ready to latch a new sample
+	latchX  Word
+	latchY  Word
+	eeprom  *eeprom93lc56
+	eepromR Byte // last value written to the eeprom register
+}
+
+func newMbc7(rom []Byte) *mbc7 {
+	return &mbc7{
+		rom:    rom,
+		bank:   1,
+		tilt:   &ManualTilt{},
+		latchX: 0x8000,
+		latchY: 0x8000,
+		eeprom: newEeprom93lc56(),
+	}
+}
+
+// SetTilt sets the TiltSource used by the accelerometer.
+func (m *mbc7) SetTilt(t TiltSource) {
+	m.tilt = t
+}
+
+func (m *mbc7) ReadRom(addr Word) Byte {
+	if addr < 0x4000 {
+		return m.rom[addr]
+	}
+	return romBank(m.rom, m.bank, addr)
+}
+
+func (m *mbc7) RomBank() int {
+	return m.bank
+}
+
+func (m *mbc7) Rom() []Byte {
+	return m.rom
+}
+
+func (m *mbc7) WriteRom(addr Word, b Byte) {
+	switch {
+	case addr < 0x2000:
+		m.ramEnable1 = b&0x0F == 0x0A
+		if !m.ramEnable1 {
+			m.ramEnable2 = false
+		}
+	case addr < 0x4000:
+		m.bank = int(b & 0x7F)
+	case addr < 0x6000:
+		m.ramEnable2 = m.ramEnable1 && b == 0x40
+	}
+}
+
+func (m *mbc7) ReadRam(addr Word) Byte {
+	if !m.ramEnable1 || !m.ramEnable2 || addr >= 0xB000 {
+		return 0xFF
+	}
+	switch addr & 0x00F0 {
+	case 0x20:
+		return m.latchX.Low()
+	case 0x30:
+		return m.latchX.High()
+	case 0x40:
+		return m.latchY.Low()
+	case 0x50:
+		return m.latchY.High()
+	case 0x60:
+		return 0x00
+	case 0x80:
+		do := Byte(0)
+		if m.eeprom.do {
+			do = 1
+		}
+		return m.eepromR&0xC2 | do
+	}
+	return 0xFF
+}
+
+func (m *mbc7) WriteRam(addr Word, b Byte) {
+	if !m.ramEnable1 || !m.ramEnable2 || addr >= 0xB000 {
+		return
+	}
+	switch addr & 0x00F0 {
+	case 0x00:
+		if b == 0x55 {
+			m.erased = true
+			m.latchX = 0x8000
+			m.latchY = 0x8000
+		}
+	case 0x10:
+		if b == 0xAA && m.erased {
+			m.erased = false
+			x, y := m.tilt.Tilt()
+			m.latchX = Word(mbc7TiltCenter + int(x*mbc7TiltRange))
+			m.latchY = Word(mbc7TiltCenter + int(y*mbc7TiltRange))
+		}
+	case 0x80:
+		m.eepromR = b
+		m.eeprom.write(b&0x80 == 0x80, b&0x40 == 0x40, b&0x02 == 0x02)
+	}
+}
+
+// eeprom93lc56 is a 93LC56 serial eeprom in 16bit mode, 128 words. Commands
+// are a start bit, 2 opcode bits and 8 address bits clocked in on the rising
+// edge of clk while cs is high.
+type eeprom93lc56 struct {
+	data     []Byte // 128 big endian words
+	cs       bool
+	clk      bool
+	do       bool
+	writable bool
+
+	state eepromState
+	shift uint32
+	bits  int
+	addr  int
+}
+
+type eepromState uint8
+
+const (
+	eepromIdle eepromState = iota
+	eepromStart
+	eepromCommand
+	eepromRead
+	eepromWrite
+	eepromWriteAll
+)
+
+func newEeprom93lc56() *eeprom93lc56 {
+	e := &eeprom93lc56{data: make([]Byte, 256), do: true}
+	for i := range e.data {
+		e.data[i] = 0xFF
+	}
+	return e
+}
+
+func (e *eeprom93lc56) word(addr int) uint32 {
+	return uint32(e.data[addr*2])<<8 | uint32(e.data[addr*2+1])
+}
+
+func (e *eeprom93lc56) setWord(addr int, w uint32) {
+	if e.writable {
+		e.data[addr*2] = Byte(w >> 8)
+		e.data[addr*2+1] = Byte(w)
+	}
+}
+
+func (e *eeprom93lc56) write(cs, clk, di bool) {
+	if !cs {
+		e.state = eepromIdle
+		e.cs = false
+		e.clk = clk
+		return
+	}
+	if !e.cs {
+		e.state = eepromStart
+		e.do = true
+	}
+	rising := clk && !e.clk
+	e.cs = cs
+	e.clk = clk
+	if !rising {
+		return
+	}
+
+	bit := uint32(0)
+	if di {
+		bit = 1
+	}
+	switch e.state {
+	case eepromStart:
+		if di {
+			e.state = eepromCommand
+			e.shift = 0
+			e.bits = 0
+		}
+	case eepromCommand:
+		e.shift = e.shift<<1 | bit
+		e.bits++
+		if e.bits == 10 {
+			e.command(int(e.shift>>8&0x03), int(e.shift&0xFF))
+		}
+	case eepromRead:
+		e.do = e.shift&0x8000 == 0x8000
+		e.shift = e.shift << 1 & 0xFFFF
+		e.bits++
+		if e.bits == 16 {
+			// sequential read continues with the next word
+			e.addr = (e.addr + 1) & 0x7F
+			e.shift = e.word(e.addr)
+			e.bits = 0
+		}
+	case eepromWrite, eepromWriteAll:
+		e.shift = e.shift<<1 | bit
+		e.bits++
+		if e.bits == 16 {
+			if e.state == eepromWrite {
+				e.setWord(e.addr, e.shift)
+			} else {
+				for a := 0; a < 128; a++ {
+					e.setWord(a, e.shift)
+				}
+			}
+			e.do = true // ready
+			e.state = eepromIdle
+		}
+	}
+}
+
+func (e *eeprom93lc56) command(op, addr int) {
+	e.addr = addr & 0x7F
+	e.shift = 0
+	e.bits = 0
+	e.state = eepromIdle
+	switch op {
+	case 0x02: // READ
+		e.do = false // dummy bit
+		e.shift = e.word(e.addr)
+		e.state = eepromRead
+	case 0x01: // WRITE
+		e.state = eepromWrite
+	case 0x03: // ERASE
+		e.setWord(e.addr, 0xFFFF)
+		e.do = true
+	case 0x00:
+		switch addr >> 6 {
+		case 0x00: // EWDS
+			e.writable = false
+		case 0x01: // WRAL
+			e.state = eepromWriteAll
+		case 0x02: // ERAL
+			for a := 0; a < 128; a++ {
+				e.setWord(a, 0xFFFF)
+			}
+			e.do = true
+		case 0x03: // EWEN
+			e.writable = true
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package jibi
+
+import (
+	"testing"
+)
+
+// eepromSend clocks bits into the eeprom, msb first, and returns what was
+// clocked out.
+func eepromSend(e *eeprom93lc56, bits uint32, n int) uint32 {
+	out := uint32(0)
+	for i := n - 1; i >= 0; i-- {
+		di := bits>>uint(i)&0x01 == 0x01
+		e.write(true, false, di)
+		e.write(true, true, di)
+		out <<= 1
+		if e.do {
+			out |= 1
+		}
+	}
+	return out
+}
+
+func eepromCmd(e *eeprom93lc56, cmd uint32) {
+	e.write(false, false, false)
+	e.write(true, false, false)
+	eepromSend(e, 1<<10|cmd, 11)
+}
+
+func TestEeprom93lc56(t *testing.T) {
+	e := newEeprom93lc56()
+
+	// WRITE while disabled
+	eepromCmd(e, 0x1<<8|0x05)
+	eepromSend(e, 0x1234, 16)
+	if e.word(0x05) != 0xFFFF {
+		t.Errorf("0x%04X", e.word(0x05))
+	}
+
+	// EWEN then WRITE
+	eepromCmd(e, 0x3<<6)
+	eepromCmd(e, 0x1<<8|0x05)
+	eepromSend(e, 0x1234, 16)
+	if e.word(0x05) != 0x1234 {
+		t.Errorf("0x%04X", e.word(0x05))
+	}
+
+	// READ
+	eepromCmd(e, 0x2<<8|0x05)
+	if e.do {
+		t.Error("missing dummy bit")
+	}
+	if w := eepromSend(e, 0, 16); w != 0x1234 {
+		t.Errorf("0x%04X", w)
+	}
+
+	// ERASE
+	eepromCmd(e, 0x3<<8|0x05)
+	if e.word(0x05) != 0xFFFF {
+		t.Errorf("0x%04X", e.word(0x05))
+	}
+}
+
+func TestMbc7Accelerometer(t *testing.T) {
+	m := newMbc7(make([]Byte, 0x8000))
+	tilt := &ManualTilt{}
+	tilt.Set(1, -1)
+	m.SetTilt(tilt)
+
+	// registers are disabled
+	if b := m.ReadRam(0xA020); b != 0xFF {
+		t.Errorf("0x%02X", b)
+	}
+
+	m.WriteRom(0x0000, 0x0A)
+	m.WriteRom(0x4000, 0x40)
+	m.WriteRam(0xA000, 0x55)
+	m.WriteRam(0xA010, 0xAA)
+	x := BytesToWord(m.ReadRam(0xA030), m.ReadRam(0xA020))
+	y := BytesToWord(m.ReadRam(0xA050), m.ReadRam(0xA040))
+	if x != mbc7TiltCenter+mbc7TiltRange {
+		t.Errorf("0x%04X", x)
+	}
+	if y != mbc7TiltCenter-mbc7TiltRange {
+		t.Errorf("0x%04X", y)
+	}
+}
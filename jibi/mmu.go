@@ -2,7 +2,6 @@ package jibi
 
 import (
 	"fmt"
-	"sync"
 )
 
 // A list of all the special memory addresses.
@@ -11,10 +10,13 @@ const (
 	AddrVRam   Word = 0x8000
 	AddrERam   Word = 0xA000
 	AddrRam    Word = 0xC000
+	AddrEcho   Word = 0xE000 // mirrors AddrRam up to AddrOam
 	AddrOam    Word = 0xFE00
 	AddrOamEnd Word = 0xFEA0
 
 	AddrP1   Word = 0xFF00
+	AddrSB   Word = 0xFF01
+	AddrSC   Word = 0xFF02
 	AddrDIV  Word = 0xFF04
 	AddrTIMA Word = 0xFF05
 	AddrTMA  Word = 0xFF06
@@ -36,368 +38,508 @@ const (
 	AddrWX         Word = 0xFF4B
 	AddrGpuRegsEnd Word = 0xFF4C
 
+	AddrCgbRegs    Word = 0xFF4C
+	AddrKEY0       Word = 0xFF4C
+	AddrKEY1       Word = 0xFF4D
+	AddrVBK        Word = 0xFF4F
+	AddrBOOT       Word = 0xFF50
+	AddrRP         Word = 0xFF56
+	AddrBCPS       Word = 0xFF68
+	AddrBCPD       Word = 0xFF69
+	AddrOCPS       Word = 0xFF6A
+	AddrOCPD       Word = 0xFF6B
+	AddrOPRI       Word = 0xFF6C
+	AddrSVBK       Word = 0xFF70
+	AddrCgbRegsEnd Word = 0xFF80
+
 	AddrZero Word = 0xFF80
 	AddrIE   Word = 0xFFFF
 )
 
 // An Mmu is the memory management unit. Its purpose is to dispatch read and
 // write requeststo the appropriate module (cpu, gpu, etc) based on the memory
-// address. The Mmu is controlled by the cpu.
+// address. It is the Bus of the cpu, and every component reaches memory
+// through it on the goroutine of the scheduler, see Cpu.schedule.
 type Mmu interface {
-	LockAddr(addr Worder, ak AddressKeys) AddressKeys
-	UnlockAddr(addr Worder, ak AddressKeys) AddressKeys
-	ReadByteAt(addr Worder, ak AddressKeys) Byte
-	WriteByteAt(addr Worder, b Byter, ak AddressKeys)
-	ReadIoByte(addr Worder, ak AddressKeys) (Byte, bool)
+	Bus
+	Hardware() Bus
+	ReadVRam(addr Word, bank uint8) Byte
+	ReadPaletteColor(obj bool, pal, color Byte) Word
 	SetKeypad(kp *Keypad)
 	SetGpu(gpu *Gpu)
-	SetInterrupt(in Interrupt, ak AddressKeys)
+	SetApu(apu *Apu)
+	SetColorization(cz Colorization)
+	SetInfrared(ir InfraredTransceiver)
+	SetLogger(l Logger)
+	SetStrict(strict bool)
+	Mapped(addr Worder) bool
+	SetInterrupt(in Interrupt)
+	OnRead(start, end Word, fn MemoryHook) func()
+	OnWrite(start, end Word, fn MemoryHook) func()
+	MapDevice(start, end Word, dev MemoryDevice) func()
+	SetCheats(cheats []Cheat)
+	WriteBankByte(addr Word, bank int, b Byte) bool
+	RomBank() int
+	Rom() []Byte
 }
 
 type RomOnlyMmu struct {
 	// memory blocks and io
-	rom     []Byte
+	mapper  Mapper
 	vram    []Byte
 	ram     []Byte
 	oam     []Byte
-	ioP1    *mmio
+	p1      Byte
+	link    linkPort
 	div     Byte
 	tima    Byte
 	tma     Byte
 	tac     Byte
-	ioIF    *mmio
+	iflag   Byte
 	gpuregs []Byte
+	cgbregs []Byte
+	key0    Byte
+	vbk     Byte
+	svbk    Byte
+	boot    Byte
+	opri    Byte
+	rp      Byte
+	bgPal   *cgbPalette
+	objPal  *cgbPalette
 	zero    []Byte
 	ie      Byte
 
-	// memory locks
-	locks []*sync.Mutex
+	// cgb hardware
+	cgb bool
+
+	// level of the stat interrupt line
+	statLine bool
 
 	// internal state
-	kp  *Keypad
-	gpu *Gpu
+	kp     *Keypad
+	gpu    *Gpu
+	ir     InfraredTransceiver
+	log    componentLog
+	strict bool // panic on accesses that are not emulated
+
+	readHooks, writeHooks memoryHooks
+	devices               memoryDevices
+	blocks                blockTable
+	cheats                romCheats
 }
 
-// NewMmu creates a new Mmu with an optional bios that replaces 0x0000-0x00FF.
-func NewMmu(cart *Cartridge) Mmu {
-	var rom []Byte
+// NewMmu creates a new Mmu. If cgb is true the Mmu also maps the cgb only
+// registers at 0xFF4C-0xFF7F.
+func NewMmu(cart *Cartridge, cgb bool) Mmu {
+	var mapper Mapper = newRomOnly(nil, 0)
 	if cart != nil {
-		rom = cart.Rom
-	}
-	locks := make([]*sync.Mutex, abLast+1)
-	for i := uint16(1); i <= uint16(abLast); i = i << 1 {
-		locks[i] = new(sync.Mutex)
+		mapper = cart.mapper
 	}
 	mmu := &RomOnlyMmu{
-		rom:     rom,
-		vram:    make([]Byte, 0x2000),
-		ram:     make([]Byte, 0x2000),
+		mapper:  mapper,
+		vram:    make([]Byte, 0x4000), // 2 banks on cgb
+		ram:     make([]Byte, 0x8000), // 8 banks on cgb
 		oam:     make([]Byte, 0xA0),
-		ioP1:    newMmio(AddrP1),
 		div:     Byte(0),
 		tima:    Byte(0),
 		tma:     Byte(0),
 		tac:     Byte(0),
-		ioIF:    newMmio(AddrIF),
 		gpuregs: make([]Byte, 12),
+		cgbregs: make([]Byte, AddrCgbRegsEnd-AddrCgbRegs),
+		bgPal:   newCgbPalette(),
+		objPal:  newCgbPalette(),
 		zero:    make([]Byte, 0x100),
-		locks:   locks,
+		cgb:     cgb,
+		ir:      darkInfrared{},
+		link:    linkPort{cgb: cgb},
 	}
+	mmu.mapBlocks()
 	return mmu
 }
 
-type addressBlock uint16
-type AddressKeys uint16
+func (m *RomOnlyMmu) SetKeypad(kp *Keypad) {
+	m.kp = kp
+}
 
-const (
-	abNil addressBlock = iota
-	abRom addressBlock = 1 << iota
-	abVRam
-	abERam
-	abRam
-	abOam
-	abP1
-	abDIV
-	abTIMA
-	abTMA
-	abTAC
-	abIF
-	abGpuRegs
-	abZero
-	abIE
-	abElevated
-	abLast = abIE
-)
+func (m *RomOnlyMmu) SetGpu(gpu *Gpu) {
+	m.gpu = gpu
+}
+
+func (m *RomOnlyMmu) SetApu(apu *Apu) {
+	m.blocks.set(AddrApuRegs, AddrApuRegsEnd-1, deviceBlock(apu))
+}
+
+func (m *RomOnlyMmu) SetInfrared(ir InfraredTransceiver) {
+	m.ir = ir
+}
 
-func (a addressBlock) String() string {
-	switch a {
-	case abNil:
-		return "abNil"
-	case abRom:
-		return "abRom"
-	case abVRam:
-		return "abVRam"
-	case abERam:
-		return "abERam"
-	case abRam:
-		return "abRam"
-	case abOam:
-		return "abOam"
-	case abIF:
-		return "abIF"
-	case abGpuRegs:
-		return "abGpuRegs"
-	case abZero:
-		return "abZero"
-	case abIE:
-		return "abIE"
+func (m *RomOnlyMmu) SetLogger(l Logger) {
+	m.log = newComponentLog(l, "mmu")
+}
+
+func (m *RomOnlyMmu) SetStrict(strict bool) {
+	m.strict = strict
+}
+
+// unhandled reports an access the mmu cannot carry out, to memory it does not
+// emulate. In strict mode it panics, otherwise the access is logged and
+// carries on like an access to nothing on the hardware, reads return 0xFF
+// and writes are ignored.
+func (m *RomOnlyMmu) unhandled(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if m.strict {
+		panic(msg)
 	}
-	return "abUNKNOWN"
+	m.log.Warn(msg)
 }
 
-func (m *RomOnlyMmu) SetKeypad(kp *Keypad) {
-	m.kp = kp
+// RomBank returns the cartridge rom bank mapped at 0x4000-0x7FFF.
+func (m *RomOnlyMmu) RomBank() int {
+	return m.mapper.RomBank()
 }
 
-func (m *RomOnlyMmu) SetGpu(gpu *Gpu) {
-	m.gpu = gpu
+// Rom returns the cartridge rom image.
+func (m *RomOnlyMmu) Rom() []Byte {
+	return m.mapper.Rom()
 }
 
-func (m *RomOnlyMmu) selectAddressBlock(addr Worder, rw string) (addressBlock, Word) {
-	a := addr.Word()
-	if a < AddrVRam {
-		return abRom, 0
-	} else if AddrVRam <= a && a < AddrERam {
-		return abVRam, AddrVRam
-	} else if AddrERam <= a && a < AddrRam {
-		return abERam, AddrERam
-	} else if AddrRam <= a && a < AddrOam {
-		return abRam, AddrRam
-	} else if AddrOam <= a && a < AddrOamEnd {
-		return abOam, AddrOam
-	} else if AddrP1 == a {
-		return abP1, AddrP1
-	} else if AddrDIV == a {
-		return abDIV, AddrDIV
-	} else if AddrTIMA == a {
-		return abTIMA, AddrTIMA
-	} else if AddrTMA == a {
-		return abTMA, AddrTMA
-	} else if AddrTAC == a {
-		return abTAC, AddrTAC
-	} else if AddrIF == a {
-		return abIF, AddrIF
-	} else if AddrGpuRegs <= a && a < AddrGpuRegsEnd {
-		return abGpuRegs, AddrGpuRegs
-	} else if AddrZero <= a && a < AddrIE {
-		return abZero, AddrZero
-	} else if AddrIE == a {
-		return abIE, AddrIE
+// ramOffset returns the offset in ram of an offset into the ram block. The
+// upper 4KB is bank 1, or on the cgb the bank selected by SVBK where bank 0
+// also selects bank 1.
+func (m *RomOnlyMmu) ramOffset(off Word) Word {
+	off &= 0x1FFF
+	if off < 0x1000 || !m.cgb {
+		return off
 	}
+	bank := Word(m.svbk)
+	if bank == 0 {
+		bank = 1
+	}
+	return bank*0x1000 + off - 0x1000
+}
+
+// Mapped returns true if addr is emulated memory or has a device mapped.
+func (m *RomOnlyMmu) Mapped(addr Worder) bool {
+	return m.devices.at(addr.Word()) != nil || m.blocks.at(addr.Word()) != nil
+}
+
+// ioReadMasks are the bits of the io registers that always read as one,
+// unused and write only bits, by offset from AddrP1. The sound registers
+// have their own, see apuReadMasks, and addresses that are not registers
+// read 0xFF anyway. Hardware reads see the stored bits.
+var ioReadMasks = [AddrZero - AddrP1]Byte{
+	AddrP1 - AddrP1:   0xC0,
+	AddrSC - AddrP1:   0x7C, // bit 1 too on the dmg
+	AddrTAC - AddrP1:  0xF8,
+	AddrIF - AddrP1:   0xE0,
+	AddrSTAT - AddrP1: 0x80,
+	AddrKEY1 - AddrP1: 0x7E,
+	AddrVBK - AddrP1:  0xFE,
+	0xFF51 - AddrP1:   0xFF, // HDMA1-4
+	0xFF52 - AddrP1:   0xFF,
+	0xFF53 - AddrP1:   0xFF,
+	0xFF54 - AddrP1:   0xFF,
+	AddrRP - AddrP1:   0x3C,
+	AddrBCPS - AddrP1: 0x40,
+	AddrOCPS - AddrP1: 0x40,
+	AddrOPRI - AddrP1: 0xFE,
+	AddrSVBK - AddrP1: 0xF8,
+}
+
+// Read reads addr the way the cpu sees it.
+func (m *RomOnlyMmu) Read(addr Word) Byte {
+	return m.read(addr, false)
+}
 
+// Write writes addr the way the cpu does.
+func (m *RomOnlyMmu) Write(addr Word, b Byte) {
+	m.write(addr, b, false)
+}
+
+// Hardware returns the Bus the components see their own io registers
+// through. Reads are not masked and writes set the bits the cpu can only
+// read, without the side effects of a cpu write like DIV and LY resetting.
+func (m *RomOnlyMmu) Hardware() Bus {
+	return hardwareBus{m}
+}
+
+type hardwareBus struct {
+	m *RomOnlyMmu
+}
+
+func (h hardwareBus) Read(addr Word) Byte {
+	return h.m.read(addr, true)
+}
+
+func (h hardwareBus) Write(addr Word, b Byte) {
+	h.m.write(addr, b, true)
+}
+
+func (m *RomOnlyMmu) read(addr Word, hw bool) Byte {
+	b := m.visibleByteAt(addr, hw)
+	m.readHooks.call(addr, b, b)
+	return b
+}
+
+// visibleByteAt reads addr from the device mapped there, or from the block
+// of the Mmu with the io read masks applied to reads that are not by the
+// hardware.
+func (m *RomOnlyMmu) visibleByteAt(addr Word, hw bool) Byte {
+	if d := m.devices.at(addr); d != nil {
+		return d.Read(addr)
+	}
+	blk := m.blocks.at(addr)
+	if blk == nil {
+		m.unmapped(addr, "read")
+		return 0xFF // open bus, nothing drives the data lines
+	}
+	b := blk.read(addr, hw)
+	if AddrP1 <= addr && addr < AddrZero && !hw {
+		b |= m.ioReadMask(addr)
+	}
+	return b
+}
+
+// ioReadMask returns the bits of the io register at addr that read as one.
+func (m *RomOnlyMmu) ioReadMask(addr Word) Byte {
+	mask := ioReadMasks[addr-AddrP1]
+	if addr == AddrSC && !m.cgb {
+		mask |= 0x02 // no fast clock
+	}
+	return mask
+}
+
+// unmapped reports an access to an address no block is mapped at. Addresses
+// that are not connected on the hardware either are only logged.
+func (m *RomOnlyMmu) unmapped(addr Word, rw string) {
 	u, v := m.getAddressInfo(addr)
 	if !v {
-		if rw == "" {
-			rw = "access"
-		}
-		panic(fmt.Sprintf("unhandled memory %s: 0x%04X - %s", rw, a, u))
+		m.unhandled("unhandled memory %s: 0x%04X - %s", rw, addr, u)
+		return
 	}
-	return abNil, 0
+	m.log.Debug("ignored "+rw, "addr", fmt.Sprintf("0x%04X", addr), "region", u)
 }
 
-// LockAddr gets a lock for an address if not already in the provided
-// AddressKeys and appends it and returns this new key set.
-func (m *RomOnlyMmu) LockAddr(addr Worder, ak AddressKeys) AddressKeys {
-	blk, _ := m.selectAddressBlock(addr, "lock")
-	if addressBlock(ak)&blk == blk {
-		// already have the key
-		return ak
+func (m *RomOnlyMmu) write(addr Word, b Byte, hw bool) {
+	if !m.writeHooks.hooked(addr) {
+		m.writeByteAt(addr, b, hw)
+		return
 	}
-	m.locks[blk].Lock()
-	return ak | AddressKeys(blk)
+	old := m.visibleByteAt(addr, hw)
+	m.writeByteAt(addr, b, hw)
+	m.writeHooks.call(addr, old, m.visibleByteAt(addr, hw))
 }
 
-func (m *RomOnlyMmu) UnlockAddr(addr Worder, ak AddressKeys) AddressKeys {
-	blk, _ := m.selectAddressBlock(addr, "unlock")
-	if addressBlock(ak)&blk != blk {
-		// don't have the key
-		return ak
+func (m *RomOnlyMmu) writeByteAt(addr Word, b Byte, hw bool) {
+	if d := m.devices.at(addr); d != nil {
+		d.Write(addr, b)
+	} else if blk := m.blocks.at(addr); blk != nil {
+		blk.write(addr, b, hw)
+	} else {
+		m.unmapped(addr, "write")
 	}
-	m.locks[blk].Unlock()
-	return ak & AddressKeys(blk^0xFFFF)
 }
 
-func (m *RomOnlyMmu) ReadByteAt(addr Worder, ak AddressKeys) Byte {
-	blk, start := m.selectAddressBlock(addr, "read")
-	owner := addressBlock(ak)&blk == blk
-	if blk == abRom {
-		if owner {
-			return m.rom[addr.Word()-start]
-		}
+// mapBlocks fills the table with the memory the Mmu emulates. The apu
+// registers read as open bus until SetApu maps the apu.
+func (m *RomOnlyMmu) mapBlocks() {
+	cart := deviceBlock(&cartridgeSlot{m.mapper, &m.cheats})
+	m.blocks.set(AddrRom, AddrVRam-1, cart)
+	m.blocks.set(AddrVRam, AddrERam-1, &memoryBlock{m.readVRamBank, m.writeVRamBank})
+	m.blocks.set(AddrERam, AddrRam-1, cart)
+	// echo ram is the same block, ramOffset folds it back
+	m.blocks.set(AddrRam, AddrOam-1, &memoryBlock{m.readRam, m.writeRam})
+	m.blocks.set(AddrOam, AddrOamEnd-1, &memoryBlock{m.readOam, m.writeOam})
+	io := &memoryBlock{m.readIo, m.writeIo}
+	for _, a := range []Word{AddrP1, AddrDIV, AddrTIMA, AddrTMA, AddrTAC, AddrIF, AddrIE} {
+		m.blocks.set(a, a, io)
 	}
-	if blk == abVRam {
-		if owner {
-			return m.vram[addr.Word()-start]
-		}
-	} else if blk == abRam {
-		if owner {
-			return m.ram[(addr.Word()-start)&0x1FFF]
-		}
-	} else if blk == abOam {
-		if owner {
-			return m.oam[addr.Word()-start]
-		}
-	} else if blk == abP1 {
-		return m.ioP1.readByte(owner)
-	} else if blk == abDIV {
-		if owner {
-			return m.div
-		}
-	} else if blk == abTIMA {
-		if owner {
-			return m.tima
-		}
-	} else if blk == abTMA {
-		if owner {
-			return m.tma
-		}
-	} else if blk == abTAC {
-		if owner {
-			return m.tac
-		}
-	} else if blk == abIF {
-		return m.ioIF.readByte(owner)
-	} else if blk == abGpuRegs {
-		if owner {
-			return m.gpuregs[addr.Word()-start]
-		}
-	} else if blk == abZero {
-		if owner {
-			return m.zero[addr.Word()-start]
-		}
-	} else if blk == abIE {
-		if owner {
-			return m.ie
-		}
+	m.blocks.set(AddrSB, AddrSC, deviceBlock(&m.link))
+	m.blocks.set(AddrApuRegs, AddrApuRegsEnd-1, openBus)
+	m.blocks.set(AddrGpuRegs, AddrGpuRegsEnd-1, &memoryBlock{m.readGpuReg, m.writeGpuReg})
+	if m.cgb {
+		m.blocks.set(AddrCgbRegs, AddrCgbRegsEnd-1, &memoryBlock{m.readCgbReg, m.writeCgbReg})
 	}
-	if u, v := m.getAddressInfo(addr); !v {
-		if !owner {
-			panic(fmt.Sprintf("unauthorized read: 0x%04X", addr.Word()))
-		}
-		panic(fmt.Sprintf("unhandled memory read: 0x%04X - %s", addr.Word(), u))
+	m.blocks.set(AddrZero, AddrIE-1, &memoryBlock{m.readZero, m.writeZero})
+}
+
+func (m *RomOnlyMmu) readVRamBank(addr Word, hw bool) Byte {
+	return m.vram[Word(m.vbk)*0x2000+addr-AddrVRam]
+}
+
+func (m *RomOnlyMmu) writeVRamBank(addr Word, b Byte, hw bool) {
+	m.vram[Word(m.vbk)*0x2000+addr-AddrVRam] = b
+}
+
+func (m *RomOnlyMmu) readRam(addr Word, hw bool) Byte {
+	return m.ram[m.ramOffset(addr-AddrRam)]
+}
+
+func (m *RomOnlyMmu) writeRam(addr Word, b Byte, hw bool) {
+	m.ram[m.ramOffset(addr-AddrRam)] = b
+}
+
+func (m *RomOnlyMmu) readOam(addr Word, hw bool) Byte {
+	return m.oam[addr-AddrOam]
+}
+
+func (m *RomOnlyMmu) writeOam(addr Word, b Byte, hw bool) {
+	m.oam[addr-AddrOam] = b
+}
+
+func (m *RomOnlyMmu) readZero(addr Word, hw bool) Byte {
+	return m.zero[addr-AddrZero]
+}
+
+func (m *RomOnlyMmu) writeZero(addr Word, b Byte, hw bool) {
+	m.zero[addr-AddrZero] = b
+}
+
+// readIo reads the single io registers that belong to no component's block.
+func (m *RomOnlyMmu) readIo(addr Word, hw bool) Byte {
+	switch addr {
+	case AddrP1:
+		return m.p1
+	case AddrDIV:
+		return m.div
+	case AddrTIMA:
+		return m.tima
+	case AddrTMA:
+		return m.tma
+	case AddrTAC:
+		return m.tac
+	case AddrIF:
+		return m.iflag
 	}
-	return 0
+	return m.ie
 }
 
-func (m *RomOnlyMmu) WriteByteAt(addr Worder, b Byter, ak AddressKeys) {
-	blk, start := m.selectAddressBlock(addr, "write")
-	owner := addressBlock(ak)&blk == blk
-	elevated := addressBlock(ak)&abElevated == abElevated
-	if blk == abRom {
-		return
-	} else if blk == abVRam {
-		if owner {
-			m.vram[addr.Word()-start] = b.Byte()
-			return
+func (m *RomOnlyMmu) writeIo(addr Word, b Byte, hw bool) {
+	switch addr {
+	case AddrP1:
+		if hw {
+			m.p1 = b
+		} else if m.kp != nil {
+			// the keypad puts the keys the write selects in P1
+			m.kp.writeP1(b)
 		}
-	} else if blk == abRam {
-		if owner {
-			m.ram[(addr.Word()-start)&0x1FFF] = b.Byte()
-			return
+	case AddrDIV:
+		if hw {
+			m.div = b
+		} else {
+			m.div = Byte(0) // reset on write
 		}
-	} else if blk == abOam {
-		if owner {
-			m.oam[addr.Word()-start] = b.Byte()
-			return
-		}
-	} else if blk == abP1 {
-		m.ioP1.writeByte(b, owner)
-		if !owner {
-			m.kp.RunCommand(CmdKeyCheck, nil)
+	case AddrTIMA:
+		m.tima = b
+	case AddrTMA:
+		m.tma = b
+	case AddrTAC:
+		m.tac = b
+	case AddrIF:
+		m.iflag = b & 0x1F
+	case AddrIE:
+		m.ie = b
+	}
+}
+
+func (m *RomOnlyMmu) readGpuReg(addr Word, hw bool) Byte {
+	return m.gpuregs[addr-AddrGpuRegs]
+}
+
+// writeGpuReg writes a gpu register. Turning the lcd on with LCDC bit 7 plays
+// the gpu, turning it off stops it at LY 0 in mode 0.
+func (m *RomOnlyMmu) writeGpuReg(a Word, b Byte, hw bool) {
+	start := AddrGpuRegs
+	if a == AddrLCDC {
+		prevBit7 := m.gpuregs[a-start] & 0x80
+		bit7 := b & 0x80
+		if prevBit7 == 0 && bit7 != 0 {
+			m.gpu.play()
+		} else if prevBit7 != 0 && bit7 == 0 {
+			m.gpuregs[AddrLY-start] = 0
+			m.gpuregs[AddrSTAT-start] &^= 0x03
+			m.statLine = false
+			m.gpu.lcdOff()
 		}
+	}
+	if a == AddrSTAT {
+		m.writeStat(b, hw)
 		return
-	} else if blk == abDIV {
-		if owner {
-			if elevated {
-				m.div = b.Byte() // reset on write
-			} else {
-				m.div = Byte(0)
-			}
-			return
-		}
-	} else if blk == abTIMA {
-		if owner {
-			m.tima = b.Byte()
-			return
-		}
-	} else if blk == abTMA {
-		if owner {
-			m.tma = b.Byte()
-			return
+	}
+	if a == AddrLY {
+		if !hw {
+			b = 0 // reset on write
 		}
-	} else if blk == abTAC {
-		if owner {
-			m.tac = b.Byte()
-			return
+	}
+	m.gpuregs[a-start] = b
+	if a == AddrLY || a == AddrLYC {
+		m.compareLY()
+	}
+}
+
+// statLine returns the level of the stat interrupt line for stat, the or of
+// every enabled source.
+func statLine(stat Byte) bool {
+	mode := stat & 0x03
+	return stat&0x40 != 0 && stat&0x04 != 0 ||
+		stat&0x20 != 0 && mode == LcdModeOam ||
+		stat&0x10 != 0 && mode == LcdModeVBlank ||
+		stat&0x08 != 0 && mode == LcdModeHBlank
+}
+
+// writeStat writes STAT and raises the stat interrupt when the line goes
+// high, a source becoming true while the line is already high is blocked.
+// The gpu sets the mode and coincidence bits with hardware writes, the cpu
+// only the source enables. On the dmg a cpu write briefly enables every
+// source, which fires the interrupt in hblank, vblank or on LY=LYC.
+func (m *RomOnlyMmu) writeStat(stat Byte, hw bool) {
+	prev := m.gpuregs[AddrSTAT-AddrGpuRegs]
+	if !hw {
+		stat = stat&0x78 | prev&0x07
+		if !m.cgb {
+			m.setStatLine(statLine(0x58 | prev))
 		}
-	} else if blk == abIF {
-		m.ioIF.writeByte(b, owner)
+	}
+	m.gpuregs[AddrSTAT-AddrGpuRegs] = stat
+	m.setStatLine(statLine(stat))
+}
+
+// compareLY sets the LY=LYC coincidence flag in STAT when LY or LYC
+// change, the gpu moving to the next line or the cpu writing LYC in the
+// middle of one, and raises the stat interrupt when its source is enabled.
+// The flag keeps its value while the lcd is off.
+func (m *RomOnlyMmu) compareLY() {
+	regs := m.gpuregs
+	if regs[AddrLCDC-AddrGpuRegs]&0x80 == 0 {
 		return
-	} else if blk == abGpuRegs {
-		if owner {
-			a := addr.Word()
-			bb := b.Byte()
-			if a == AddrLCDC {
-				prevBit7 := m.gpuregs[a-start] & 0x80
-				bit7 := bb & 0x80
-				if prevBit7 == 0 && bit7 != 0 {
-					m.gpu.RunCommand(CmdPlay, nil)
-				} else if prevBit7 != 0 && bit7 == 0 {
-					m.gpu.RunCommand(CmdPause, nil)
-					m.gpuregs[AddrLY-start] = 0
-				}
-			}
-			if a == AddrLY {
-				if !elevated {
-					bb = 0 // reset on write
-				}
-			}
-			m.gpuregs[a-start] = bb
-			return
-		}
-	} else if blk == abZero {
-		if owner {
-			m.zero[addr.Word()-start] = b.Byte()
-			return
-		}
-	} else if blk == abIE {
-		if owner {
-			m.ie = b.Byte()
-			return
-		}
 	}
-	if u, v := m.getAddressInfo(addr); !v {
-		if !owner {
-			panic(fmt.Sprintf("unauthorized write: 0x%04X 0x%02X", addr.Word(), b.Byte()))
-		}
-		panic(fmt.Sprintf("unhandled memory write: 0x%04X - %s", addr.Word(), u))
+	stat := regs[AddrSTAT-AddrGpuRegs] &^ 0x04
+	if regs[AddrLY-AddrGpuRegs] == regs[AddrLYC-AddrGpuRegs] {
+		stat |= 0x04
+	}
+	regs[AddrSTAT-AddrGpuRegs] = stat
+	m.setStatLine(statLine(stat))
+}
+
+func (m *RomOnlyMmu) setStatLine(line bool) {
+	if line && !m.statLine {
+		m.SetInterrupt(InterruptLCDC)
 	}
+	m.statLine = line
 }
 
-func (m *RomOnlyMmu) ReadIoByte(addr Worder, ak AddressKeys) (Byte, bool) {
-	blk, _ := m.selectAddressBlock(addr, "write")
-	owner := addressBlock(ak)&blk == blk
-	if blk == abP1 {
-		return m.ioP1.readIoByte(owner)
-	} else if blk == abIF {
-		return m.ioIF.readIoByte(owner)
+// ReadVRam reads from a specific vram bank regardless of VBK.
+func (m *RomOnlyMmu) ReadVRam(addr Word, bank uint8) Byte {
+	if addr < AddrVRam || addr >= AddrERam {
+		m.unhandled("banked read outside vram: 0x%04X", addr)
+		return 0xFF
 	}
-	panic(fmt.Sprintf("unhandled queued write: 0x%04X", addr.Word()))
+	return m.vram[Word(bank&0x01)*0x2000+addr-AddrVRam]
 }
 
 // incomplete, used for debugging
 // a return value of true means we can ignore this address
-func (m *RomOnlyMmu) getAddressInfo(addr Worder) (string, bool) {
+func (m *RomOnlyMmu) getAddressInfo(addr Word) (string, bool) {
 	a := addr.Word()
 	if 0x9C00 <= a && a <= 0x9FFF {
 		return "Background Map Data 2", false
@@ -407,10 +549,6 @@ func (m *RomOnlyMmu) getAddressInfo(addr Worder) (string, bool) {
 		return "unusable memory", true
 	} else if a == 0xFF00 {
 		return "Register for reading joy pad info and determining system type. (R/W)", false
-	} else if a == 0xFF01 {
-		return "Serial transfer data (R/W)", true
-	} else if a == 0xFF02 {
-		return "SIO control (R/W)", true
 	} else if a == 0xFF03 {
 		return "no clue", true
 	} else if a == 0xFF04 {
@@ -471,8 +609,6 @@ func (m *RomOnlyMmu) getAddressInfo(addr Worder) (string, bool) {
 		return "Sound on/off (R/W)", true
 	} else if 0xFF27 <= a && a <= 0xFF2F {
 		return "no clue", true
-	} else if 0xFF30 <= a && a <= 0xFF3F {
-		return "Sound Sample RAM", true
 	} else if a == 0xFF47 {
 		return "BGP", false
 	} else if 0xFF4C == a {
@@ -485,67 +621,7 @@ func (m *RomOnlyMmu) getAddressInfo(addr Worder) (string, bool) {
 	return "unknown", false
 }
 
-// memory mapped io
-type mmio struct {
-	addr Word
-
-	// accessed by owner
-	value Byte
-
-	// accessed through lock
-	read   Byte
-	write  Byte
-	queued bool
-	lock   *sync.Mutex
-}
-
-func newMmio(addr Worder) *mmio {
-	m := &mmio{addr: addr.Word(),
-		lock: new(sync.Mutex)}
-	return m
-}
-
-func (m *mmio) readByte(owner bool) Byte {
-	if owner {
-		return m.value
-	}
-	m.lock.Lock()
-	defer m.lock.Unlock()
-	return m.read
-}
-
-func (m *mmio) writeByte(b Byter, owner bool) {
-	if owner {
-		m.lock.Lock()
-		defer m.lock.Unlock()
-		m.value = b.Byte()
-		m.read = m.value
-		if !m.queued {
-			m.write = m.value
-		}
-	} else {
-		m.lock.Lock()
-		defer m.lock.Unlock()
-		if m.queued {
-			//panic(fmt.Sprintf("overwritten io write: 0x%04X", m.addr))
-		}
-		m.queued = true
-		m.write = b.Byte()
-	}
-}
-
-func (m *mmio) readIoByte(owner bool) (Byte, bool) {
-	if owner {
-		m.lock.Lock()
-		defer m.lock.Unlock()
-		q := m.queued
-		m.queued = false
-		return m.write, q
-	}
-	panic(fmt.Sprintf("unhandled io read: 0x%04X", m.addr))
-}
-
-func (mmu *RomOnlyMmu) SetInterrupt(in Interrupt, ak AddressKeys) {
-	iflags := mmu.ReadByteAt(AddrIF, ak)
-	mmu.WriteByteAt(AddrIF, iflags|Byte(in), ak)
+// SetInterrupt requests interrupt in, setting its bit in IF.
+func (m *RomOnlyMmu) SetInterrupt(in Interrupt) {
+	m.write(AddrIF, m.iflag|Byte(in), true)
 }
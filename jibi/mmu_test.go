@@ -0,0 +1,223 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestStatBlocking(t *testing.T) {
+	mmu := NewMmu(nil, false)
+	irq := func() bool {
+		fired := mmu.Read(AddrIF)&Byte(InterruptLCDC) != 0
+		mmu.Write(AddrIF, 0)
+		return fired
+	}
+
+	// hblank and oam sources
+	mmu.Hardware().Write(AddrSTAT, 0x28|LcdModeVRam)
+	irq()
+	for i, step := range []struct {
+		mode Byte
+		irq  bool
+	}{
+		{LcdModeHBlank, true},
+		{LcdModeOam, false}, // the line is still high
+		{LcdModeVRam, false},
+		{LcdModeHBlank, true},
+	} {
+		mmu.Hardware().Write(AddrSTAT, 0x28|step.mode)
+		if irq() != step.irq {
+			t.Errorf("%d: mode %d irq %t", i, step.mode, !step.irq)
+		}
+	}
+
+	// LY=LYC while in hblank with both enabled fires once
+	mmu.Hardware().Write(AddrSTAT, 0x48|LcdModeVRam)
+	irq()
+	mmu.Hardware().Write(AddrSTAT, 0x48|LcdModeHBlank)
+	mmu.Hardware().Write(AddrSTAT, 0x48|0x04|LcdModeHBlank)
+	if !irq() {
+		t.Error("no hblank irq")
+	}
+	mmu.Hardware().Write(AddrSTAT, 0x48|0x04|LcdModeHBlank)
+	if irq() {
+		t.Error("lyc irq while the line is high")
+	}
+
+	// the cpu only writes the enables
+	mmu.Hardware().Write(AddrSTAT, 0x00|LcdModeVRam)
+	mmu.Write(AddrSTAT, 0x07)
+	if s := mmu.Read(AddrSTAT); s != 0x80|LcdModeVRam {
+		t.Errorf("STAT 0x%02X", s)
+	}
+}
+
+func TestStatWriteGlitch(t *testing.T) {
+	for _, cgb := range []bool{false, true} {
+		mmu := NewMmu(nil, cgb)
+		mmu.Hardware().Write(AddrSTAT, LcdModeHBlank)
+		mmu.Write(AddrSTAT, 0x00)
+		fired := mmu.Read(AddrIF)&Byte(InterruptLCDC) != 0
+		if fired == cgb {
+			t.Errorf("cgb:%t irq %t", cgb, fired)
+		}
+	}
+}
+
+func TestLYCompare(t *testing.T) {
+	mmu := NewMmu(nil, false)
+	// the lcd on without a gpu to start
+	mmu.(*RomOnlyMmu).gpuregs[AddrLCDC-AddrGpuRegs] = 0x80
+	mmu.Hardware().Write(AddrSTAT, 0x40|LcdModeVRam)
+	mmu.Write(AddrLYC, 10)
+	for i, step := range []struct {
+		addr Word
+		b    Byte
+		flag bool
+		irq  bool
+	}{
+		{AddrLY, 9, false, false},
+		{AddrLY, 10, true, true},
+		{AddrLYC, 11, false, false}, // written in the middle of the line
+		{AddrLYC, 10, true, true},
+		{AddrLY, 11, false, false},
+		{AddrLY, 0, false, false},
+	} {
+		if step.addr == AddrLY {
+			mmu.Hardware().Write(AddrLY, step.b)
+		} else {
+			mmu.Write(AddrLYC, step.b)
+		}
+		flag := mmu.Read(AddrSTAT)&0x04 != 0
+		irq := mmu.Read(AddrIF)&Byte(InterruptLCDC) != 0
+		mmu.Write(AddrIF, 0)
+		if flag != step.flag || irq != step.irq {
+			t.Errorf("%d: 0x%04X=%d: flag %t irq %t", i, step.addr, step.b, flag, irq)
+		}
+	}
+
+	// the flag holds while the lcd is off
+	mmu.Hardware().Write(AddrLY, 10)
+	mmu.(*RomOnlyMmu).gpuregs[AddrLCDC-AddrGpuRegs] = 0
+	mmu.Write(AddrLYC, 0)
+	if mmu.Read(AddrSTAT)&0x04 == 0 {
+		t.Error("flag cleared with the lcd off")
+	}
+}
+
+func TestWramBanks(t *testing.T) {
+	for _, cgb := range []bool{false, true} {
+		mmu := NewMmu(nil, cgb)
+		if cgb {
+		}
+		for bank := Byte(0); bank < 8; bank++ {
+			if cgb {
+				mmu.Write(AddrSVBK, bank)
+			}
+			mmu.Write(0xD000, 0x10|bank)
+			mmu.Write(0xC000, 0x20|bank)
+		}
+		want := []Byte{0x17, 0x17, 0x17, 0x17, 0x17, 0x17, 0x17, 0x17}
+		if cgb {
+			want = []Byte{0x11, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17}
+			if r := mmu.Read(AddrSVBK); r != 0xFF {
+				t.Errorf("SVBK 0x%02X", r)
+			}
+		}
+		for bank := Byte(0); bank < 8; bank++ {
+			if cgb {
+				mmu.Write(AddrSVBK, bank)
+			}
+			if r := mmu.Read(0xD000); r != want[bank] {
+				t.Errorf("cgb %t bank %d: 0x%02X", cgb, bank, r)
+			}
+			if r := mmu.Read(0xC000); r != 0x27 {
+				t.Errorf("cgb %t bank 0 0x%02X", cgb, r)
+			}
+		}
+	}
+}
+
+func TestEchoRam(t *testing.T) {
+	mmu := NewMmu(nil, true)
+	mmu.Write(AddrSVBK, 3)
+	mmu.Write(AddrRam, 0x12)
+	mmu.Write(0xD000, 0x34)
+	if r := mmu.Read(AddrEcho); r != 0x12 {
+		t.Errorf("0x%04X: 0x%02X", AddrEcho, r)
+	}
+	// the banked half follows SVBK
+	if r := mmu.Read(0xF000); r != 0x34 {
+		t.Errorf("0xF000: 0x%02X", r)
+	}
+	mmu.Write(0xFDFF, 0x56)
+	if r := mmu.Read(0xDDFF); r != 0x56 {
+		t.Errorf("0xDDFF: 0x%02X", r)
+	}
+}
+
+func TestUnmappedMemory(t *testing.T) {
+	mmu := NewMmu(nil, false)
+	for _, a := range []Word{AddrOamEnd, 0xFEFF, 0xFF03, 0xFF4C, 0xFF4D, AddrSVBK} {
+		mmu.Write(a, 0x12)
+		if r := mmu.Read(a); r != 0xFF {
+			t.Errorf("0x%04X: 0x%02X", a, r)
+		}
+	}
+}
+
+func TestIoReadMasks(t *testing.T) {
+	for _, cgb := range []bool{false, true} {
+		mmu := NewMmu(nil, cgb)
+		for _, r := range []struct {
+			addr         Word
+			onDmg, onCgb Byte
+		}{
+			{AddrSC, 0x7E, 0x7C},
+			{AddrTAC, 0xF8, 0xF8},
+			{AddrIF, 0xE0, 0xE0},
+			{AddrSTAT, 0x80, 0x80},
+			{AddrKEY1, 0xFF, 0x7E},
+			{0xFF51, 0xFF, 0xFF},
+		} {
+			mmu.Write(r.addr, 0x00)
+			want := r.onDmg
+			if cgb {
+				want = r.onCgb
+			}
+			if b := mmu.Read(r.addr); b != want {
+				t.Errorf("cgb %t 0x%04X: 0x%02X", cgb, r.addr, b)
+			}
+		}
+	}
+}
+
+func TestHardwareBus(t *testing.T) {
+	mmu := NewMmu(nil, false)
+	hw := mmu.Hardware()
+	// no read masks
+	mmu.Write(AddrSC, 0x81)
+	if b := hw.Read(AddrSC); b != 0x81 {
+		t.Errorf("SC 0x%02X", b)
+	}
+	// read only bits and registers the cpu resets on write
+	hw.Write(AddrDIV, 0x12)
+	hw.Write(AddrLY, 0x34)
+	hw.Write(AddrSTAT, 0x03)
+	if d, l, s := mmu.Read(AddrDIV), mmu.Read(AddrLY), mmu.Read(AddrSTAT); d != 0x12 || l != 0x34 || s != 0x83 {
+		t.Errorf("hardware writes DIV 0x%02X LY 0x%02X STAT 0x%02X", d, l, s)
+	}
+	mmu.Write(AddrDIV, 0x12)
+	mmu.Write(AddrLY, 0x34)
+	mmu.Write(AddrSTAT, 0x00)
+	if d, l, s := mmu.Read(AddrDIV), mmu.Read(AddrLY), mmu.Read(AddrSTAT); d != 0 || l != 0 || s != 0x83 {
+		t.Errorf("cpu writes DIV 0x%02X LY 0x%02X STAT 0x%02X", d, l, s)
+	}
+
+	mmu.SetStrict(true)
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic in strict mode")
+		}
+	}()
+	mmu.ReadVRam(AddrRam, 0)
+}
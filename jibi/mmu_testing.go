@@ -8,31 +8,78 @@ func newTestMmu() Mmu {
 	return TestMmu{make([]Byte, 0x10000)}
 }
 
-func (tm TestMmu) LockAddr(addr Worder, ak AddressKeys) AddressKeys {
-	return AddressKeys(0)
+func (tm TestMmu) Read(addr Word) Byte {
+	return tm.ram[addr]
 }
 
-func (tm TestMmu) UnlockAddr(addr Worder, ak AddressKeys) AddressKeys {
-	return AddressKeys(0)
+func (tm TestMmu) Write(addr Word, b Byte) {
+	tm.ram[addr] = b
 }
 
-func (tm TestMmu) ReadByteAt(addr Worder, ak AddressKeys) Byte {
-	return tm.ram[addr.Word()]
+func (tm TestMmu) Hardware() Bus {
+	return tm
 }
 
-func (tm TestMmu) WriteByteAt(addr Worder, b Byter, ak AddressKeys) {
-	tm.ram[addr.Word()] = b.Byte()
+func (tm TestMmu) ReadVRam(addr Word, bank uint8) Byte {
+	return tm.ram[addr]
 }
 
-func (tm TestMmu) ReadIoByte(addr Worder, ak AddressKeys) (Byte, bool) {
-	return tm.ram[addr.Word()], true
+func (tm TestMmu) ReadPaletteColor(obj bool, pal, color Byte) Word {
+	return 0
 }
 
 func (tm TestMmu) SetGpu(gpu *Gpu) {
 }
 
+func (tm TestMmu) SetApu(apu *Apu) {
+}
+
+func (tm TestMmu) SetColorization(cz Colorization) {
+}
+
+func (tm TestMmu) SetInfrared(ir InfraredTransceiver) {
+}
+
+func (tm TestMmu) RomBank() int {
+	return 1
+}
+
+func (tm TestMmu) Rom() []Byte {
+	return tm.ram[:0x8000]
+}
+
+func (tm TestMmu) SetLogger(l Logger) {
+}
+
+func (tm TestMmu) SetStrict(strict bool) {
+}
+
+func (tm TestMmu) Mapped(addr Worder) bool {
+	return true
+}
+
 func (tm TestMmu) SetKeypad(kp *Keypad) {
 }
 
-func (tm TestMmu) SetInterrupt(in Interrupt, ak AddressKeys) {
+func (tm TestMmu) SetInterrupt(in Interrupt) {
+	tm.ram[AddrIF] |= Byte(in)
+}
+
+func (tm TestMmu) OnRead(start, end Word, fn MemoryHook) func() {
+	return func() {}
+}
+
+func (tm TestMmu) OnWrite(start, end Word, fn MemoryHook) func() {
+	return func() {}
+}
+
+func (tm TestMmu) MapDevice(start, end Word, dev MemoryDevice) func() {
+	return func() {}
+}
+
+func (tm TestMmu) SetCheats(cheats []Cheat) {
+}
+
+func (tm TestMmu) WriteBankByte(addr Word, bank int, b Byte) bool {
+	return false
 }
@@ -0,0 +1,105 @@
+package jibi
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mooneyeRom returns a rom that ends on a ld b,b with regs in B, C, D, E, H
+// and L like mooneye-gb's test roms do.
+func mooneyeRom(regs [6]Byte) []Byte {
+	rom := headerRom("MOONEYE", 2)
+	var code []Byte
+	for i, op := range []Byte{0x06, 0x0E, 0x16, 0x1E, 0x26, 0x2E} { // LD r, d8
+		code = append(code, op, regs[i])
+	}
+	code = append(code,
+		0x40,       // LD B, B
+		0x18, 0xFE) // JR -2
+	copy(rom[0x0100:], []Byte{0x18, 0x4E}) // JR 0x0150, past the header
+	copy(rom[0x0150:], code)
+	return rom
+}
+
+func TestRunMooneye(t *testing.T) {
+	r, err := RunMooneye(mooneyeRom(mooneyePass), 30, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Finished || !r.Passed || !strings.Contains(r.Output, "B:03 C:05 D:08 E:0D H:15 L:22") {
+		t.Errorf("%+v", r)
+	}
+
+	r, err = RunMooneye(mooneyeRom([6]Byte{0x42, 0x42, 0x42, 0x42, 0x42, 0x42}), 30, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Finished || r.Passed {
+		t.Errorf("%+v", r)
+	}
+
+	// a rom that never reaches the breakpoint
+	r, err = RunMooneye(busyRom(), 10, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Finished || r.Passed || r.Frames < 10 {
+		t.Errorf("%+v", r)
+	}
+}
+
+func TestMooneyeScoreboard(t *testing.T) {
+	dir := t.TempDir()
+	for name, rom := range map[string][]Byte{
+		"timer/pass.gb":  mooneyeRom(mooneyePass),
+		"timer/fail.gb":  mooneyeRom([6]Byte{0x42, 0x42, 0x42, 0x42, 0x42, 0x42}),
+		"ppu/broken.gb":  {0x00},
+		"ppu/readme.txt": nil,
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, len(rom))
+		for i, b := range rom {
+			data[i] = byte(b)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := RunMooneyeSuite(dir, 30, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 3 || s.Passed() != 1 || s[0].Rom != "ppu/broken.gb" || s[0].Err == nil {
+		t.Fatalf("%+v", s)
+	}
+	out := s.String()
+	for _, line := range []string{"ok   timer/pass.gb", "FAIL timer/fail.gb: failed", "ppu: 0/1",
+		"timer: 1/2", "passed 1/3"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("no %q in\n%s", line, out)
+		}
+	}
+}
+
+// TestMooneyeRoms runs mooneye-gb's acceptance roms from the directory in
+// JIBI_MOONEYE, testdata/mooneye by default, and logs the scoreboard. It
+// skips when there are none.
+func TestMooneyeRoms(t *testing.T) {
+	dir := os.Getenv("JIBI_MOONEYE")
+	if dir == "" {
+		dir = filepath.Join("testdata", "mooneye")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Skip(err)
+	}
+	s, err := RunMooneyeSuite(dir, 600, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("\n" + s.String())
+}
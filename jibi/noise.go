@@ -0,0 +1,73 @@
+package jibi
+
+// noiseDivisors are the base periods selected by the low bits of NR43.
+var noiseDivisors = [8]uint32{8, 16, 32, 48, 64, 80, 96, 112}
+
+// a noise is the noise channel, it plays the low bit of a linear feedback
+// shift register, 15 bits wide or 7 for a more tonal noise
+type noise struct {
+	on      bool
+	shift   Byte
+	width7  bool
+	divisor Byte
+	timer   uint32 // cycles until the next shift
+	lfsr    uint16
+	len     lengthCounter
+	env     envelope
+}
+
+// period returns the cycles between two shifts.
+func (n *noise) period() uint32 {
+	return noiseDivisors[n.divisor] << n.shift
+}
+
+func (n *noise) dac() bool {
+	return n.env.dac()
+}
+
+// output returns the 4 bit output, 0 while the channel is off.
+func (n *noise) output() Byte {
+	if !n.on || n.lfsr&0x01 != 0 {
+		return 0
+	}
+	return n.env.volume
+}
+
+func (n *noise) tick(c uint32) {
+	if !n.on || n.shift >= 14 { // shifts of 14 and 15 never clock
+		return
+	}
+	if n.timer == 0 {
+		n.timer = n.period()
+	}
+	for c >= n.timer {
+		c -= n.timer
+		n.timer = n.period()
+		x := (n.lfsr ^ n.lfsr>>1) & 0x01
+		n.lfsr = n.lfsr>>1 | x<<14
+		if n.width7 {
+			n.lfsr = n.lfsr&^0x40 | x<<6
+		}
+	}
+	n.timer -= c
+}
+
+// writePoly sets the clock and width from NR43.
+func (n *noise) writePoly(b Byte) {
+	n.shift = b >> 4
+	n.width7 = b&0x08 != 0
+	n.divisor = b & 0x07
+}
+
+// writeControl sets the length enable from NR44 and triggers the channel if
+// bit 7 is set.
+func (n *noise) writeControl(b Byte, frameStep uint8) {
+	n.len.enable(b&0x40 != 0, frameStep, &n.on)
+	if b&0x80 != 0 {
+		n.on = n.dac()
+		n.len.trigger(64, frameStep)
+		n.timer = n.period()
+		n.lfsr = 0x7FFF
+		n.env.trigger()
+	}
+}
@@ -0,0 +1,38 @@
+package jibi
+
+import (
+	"time"
+)
+
+// A Notification is a short message for the player, like "Rom reloaded".
+type Notification struct {
+	Text     string
+	Duration time.Duration
+}
+
+func (g *Gpu) cmdNotify(data interface{}) {
+	if n, ok := data.(Notification); !ok {
+		panic("invalid command response type")
+	} else {
+		g.notify(n)
+	}
+}
+
+// notify hands n to the frontend if it renders its own notifications, or
+// else to the lcd. Notifications are dropped when the frontend falls behind.
+func (g *Gpu) notify(n Notification) {
+	if g.notes == nil {
+		g.lcd.Notify(n)
+		return
+	}
+	select {
+	case g.notes <- n:
+	default:
+		g.log.Debug("notification dropped", "text", n.Text)
+	}
+}
+
+// Notify shows text on screen for d, after any notifications before it.
+func (j Jibi) Notify(text string, d time.Duration) {
+	j.gpu.RunCommand(CmdNotify, Notification{text, d})
+}
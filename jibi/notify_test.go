@@ -0,0 +1,52 @@
+package jibi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	notes := make(chan Notification, 1)
+	j, err := New(busyRom(), Options{Skipbios: true, Notifications: notes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	j.Notify("State 3 loaded", time.Second)
+	select {
+	case n := <-notes:
+		if n != (Notification{"State 3 loaded", time.Second}) {
+			t.Errorf("%+v", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no notification")
+	}
+
+	// a full channel drops notifications instead of blocking the gpu
+	g := &Gpu{notes: notes}
+	g.notify(Notification{"first", time.Second})
+	g.notify(Notification{"second", time.Second})
+	if n := <-notes; n.Text != "first" || len(notes) != 0 {
+		t.Errorf("%q then %d more", n.Text, len(notes))
+	}
+}
+
+func TestLcdNotes(t *testing.T) {
+	lcd := &LcdASCII{}
+	if s := lcd.note(); s != "" {
+		t.Errorf("%q with no notes", s)
+	}
+	lcd.Notify(Notification{"Rom reloaded", time.Hour})
+	lcd.Notify(Notification{"SRAM saved", time.Hour})
+	if s := lcd.note(); s != "Rom reloaded" {
+		t.Errorf("first %q", s)
+	}
+	lcd.noteUntil = time.Now().Add(-time.Millisecond)
+	if s := lcd.note(); s != "SRAM saved" {
+		t.Errorf("second %q", s)
+	}
+	lcd.noteUntil = time.Now().Add(-time.Millisecond)
+	if s := lcd.note(); s != "" || len(lcd.notes) != 0 {
+		t.Errorf("%q after the last, %d left", s, len(lcd.notes))
+	}
+}
@@ -0,0 +1,240 @@
+package jibi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+// TestOpcodeTiming checks opcodes_gen.go is up to date with sm83.json and
+// commandTable follows it.
+func TestOpcodeTiming(t *testing.T) {
+	data, err := ioutil.ReadFile("sm83.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all struct {
+		Base, Cb []struct {
+			Opcode               string
+			Name                 string
+			Bytes, Cycles, Taken uint8
+			Illegal              bool
+		}
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		t.Fatal(err)
+	}
+	for i, o := range append(all.Base, all.Cb...) {
+		op := opcode(i)
+		if i >= 0x100 {
+			op = opcode(0xCB00 | i&0xFF)
+		}
+		want := opMeta{o.Name, o.Bytes, o.Cycles, o.Taken}
+		if m := sm83Meta(op); m != want {
+			t.Errorf("%s: %+v, sm83.json has %+v, run go generate", opcodeName(op), m, want)
+		}
+		cmd := commandTable[op]
+		if o.Illegal || opcodeFuncs[op] == nil {
+			continue
+		}
+		b := o.Bytes - 1
+		if i >= 0x100 {
+			b--
+		}
+		taken := uint8(0)
+		if o.Taken > 0 {
+			taken = o.Taken - o.Cycles
+		}
+		if cmd.s != o.Name || cmd.b != b || cmd.t != o.Cycles || cmd.taken != taken {
+			t.Errorf("%s: %q %d %d %d", opcodeName(op), cmd.s, cmd.b, cmd.t, cmd.taken)
+		}
+	}
+}
+
+// TestOpcodeAudit checks every sm83 opcode has metadata and an entry in
+// commandTable, and logs the ones still to implement. Run with -v for the
+// report.
+func TestOpcodeAudit(t *testing.T) {
+	legal := map[opcode]bool{}
+	var gaps []opcode
+	for _, o := range legalOpcodes() {
+		legal[o] = true
+		if sm83Meta(o).length == 0 {
+			t.Errorf("0x%02X has no length", uint16(o))
+		}
+		if _, ok := commandTable[o]; !ok || !implemented(o) {
+			gaps = append(gaps, o)
+		}
+	}
+	for o := opcode(0); o < 0x100; o++ {
+		if !legal[o] && o != 0xCB && implemented(o) {
+			t.Errorf("illegal opcode 0x%02X is implemented", uint16(o))
+		}
+	}
+	report := fmt.Sprintf("not implemented: %d/%d\n", len(gaps), len(legal))
+	for _, o := range gaps {
+		cmd := commandTable[o]
+		report += fmt.Sprintf("  %s %-14s %d %2d\n", opcodeName(o), cmd.s, cmd.b, cmd.t)
+	}
+	t.Log(report)
+}
+
+// runOp executes opcode o with immediate bytes ps on cpu.
+func runOp(cpu *Cpu, o opcode, ps ...Byte) {
+	cpu.inst = newInstruction(o, ps...)
+	cpu.execute()
+}
+
+// flagsOf returns F for the flags z, n, h and c.
+func flagsOf(z, n, h, c bool) Byte {
+	f := Byte(0)
+	for i, set := range []bool{z, n, h, c} {
+		if set {
+			f |= 0x80 >> uint(i)
+		}
+	}
+	return f
+}
+
+func TestAdcSbcFlags(t *testing.T) {
+	cpu := newCodeCpu(t, nil)
+	defer cpu.RunCommand(CmdStop, nil)
+	for a := 0; a < 0x100; a++ {
+		for b := 0; b < 0x100; b++ {
+			for carry := 0; carry < 2; carry++ {
+				r := a + b + carry
+				want := flagsOf(r&0xFF == 0, false, a&0x0F+b&0x0F+carry > 0x0F, r > 0xFF)
+				cpu.a.set(Byte(a))
+				cpu.b.set(Byte(b))
+				cpu.f.set(flagsOf(false, false, false, carry == 1))
+				runOp(cpu, 0x88) // ADC A, B
+				if cpu.a.Byte() != Byte(r) || cpu.f.Byte() != want {
+					t.Fatalf("ADC 0x%02X+0x%02X+%d: A 0x%02X F 0x%02X, want 0x%02X 0x%02X",
+						a, b, carry, cpu.a.Byte(), cpu.f.Byte(), Byte(r), want)
+				}
+
+				r = a - b - carry
+				want = flagsOf(r&0xFF == 0, true, a&0x0F-b&0x0F-carry < 0, r < 0)
+				cpu.a.set(Byte(a))
+				cpu.f.set(flagsOf(false, false, false, carry == 1))
+				runOp(cpu, 0xDE, Byte(b)) // SBC A, #
+				if cpu.a.Byte() != Byte(r) || cpu.f.Byte() != want {
+					t.Fatalf("SBC 0x%02X-0x%02X-%d: A 0x%02X F 0x%02X, want 0x%02X 0x%02X",
+						a, b, carry, cpu.a.Byte(), cpu.f.Byte(), Byte(r), want)
+				}
+			}
+		}
+	}
+}
+
+// bcd returns n, 0 to 99, in binary coded decimal.
+func bcd(n int) Byte {
+	return Byte(n/10<<4 | n%10)
+}
+
+func TestDaa(t *testing.T) {
+	cpu := newCodeCpu(t, nil)
+	defer cpu.RunCommand(CmdStop, nil)
+	// every sum and difference of two bcd numbers
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 100; y++ {
+			cpu.a.set(bcd(x))
+			cpu.b.set(bcd(y))
+			runOp(cpu, 0x80) // ADD A, B
+			runOp(cpu, 0x27)
+			r := (x + y) % 100
+			want := flagsOf(r == 0, false, false, x+y > 99)
+			if cpu.a.Byte() != bcd(r) || cpu.f.Byte() != want {
+				t.Fatalf("%d+%d: A 0x%02X F 0x%02X, want 0x%02X 0x%02X",
+					x, y, cpu.a.Byte(), cpu.f.Byte(), bcd(r), want)
+			}
+
+			cpu.a.set(bcd(x))
+			runOp(cpu, 0x90) // SUB B
+			runOp(cpu, 0x27)
+			r = (x - y + 100) % 100
+			want = flagsOf(r == 0, true, false, x < y)
+			if cpu.a.Byte() != bcd(r) || cpu.f.Byte() != want {
+				t.Fatalf("%d-%d: A 0x%02X F 0x%02X, want 0x%02X 0x%02X",
+					x, y, cpu.a.Byte(), cpu.f.Byte(), bcd(r), want)
+			}
+		}
+	}
+	// inputs that are not bcd, as the hardware adjusts them
+	for _, c := range []struct {
+		a, f, r, rf Byte
+	}{
+		{0x9A, 0x00, 0x00, 0x90},
+		{0x0F, 0x00, 0x15, 0x00},
+		{0xFF, 0x00, 0x65, 0x10},
+		{0x00, 0x70, 0x9A, 0x50},
+		{0xFF, 0x40, 0xFF, 0x40},
+	} {
+		cpu.a.set(c.a)
+		cpu.f.set(c.f)
+		runOp(cpu, 0x27)
+		if cpu.a.Byte() != c.r || cpu.f.Byte() != c.rf {
+			t.Errorf("DAA 0x%02X F 0x%02X: A 0x%02X F 0x%02X, want 0x%02X 0x%02X",
+				c.a, c.f, cpu.a.Byte(), cpu.f.Byte(), c.r, c.rf)
+		}
+	}
+}
+
+func TestLdHlSpE8(t *testing.T) {
+	cpu := newCodeCpu(t, nil)
+	defer cpu.RunCommand(CmdStop, nil)
+	for _, sp := range []int{0x0000, 0x000F, 0x00FF, 0xC0F8, 0xFFF8, 0xFFFF} {
+		for e := 0; e < 0x100; e++ {
+			r := Word(sp + int(int8(e)))
+			want := flagsOf(false, false, sp&0x0F+e&0x0F > 0x0F, sp&0xFF+e > 0xFF)
+			cpu.sp = register16(sp)
+			cpu.f.set(Byte(0xF0))
+			runOp(cpu, 0xF8, Byte(e))
+			if cpu.h.Word() != r || cpu.f.Byte() != want || cpu.sp.Word() != Word(sp) {
+				t.Fatalf("LD HL, 0x%04X%+d: HL 0x%04X F 0x%02X, want 0x%04X 0x%02X",
+					sp, int8(e), cpu.h.Word(), cpu.f.Byte(), r, want)
+			}
+		}
+	}
+}
+
+func TestAnd(t *testing.T) {
+	cpu := newCodeCpu(t, nil)
+	defer cpu.RunCommand(CmdStop, nil)
+	for a := 0; a < 0x100; a += 0x0F {
+		for h := 0; h < 0x100; h += 0x11 {
+			cpu.a.set(Byte(a))
+			cpu.h.set(Byte(h))
+			cpu.f.set(Byte(0xF0))
+			runOp(cpu, 0xA4) // AND H
+			want := flagsOf(a&h == 0, false, true, false)
+			if cpu.a.Byte() != Byte(a&h) || cpu.f.Byte() != want {
+				t.Fatalf("AND 0x%02X&0x%02X: A 0x%02X F 0x%02X, want 0x%02X 0x%02X",
+					a, h, cpu.a.Byte(), cpu.f.Byte(), a&h, want)
+			}
+		}
+	}
+}
+
+func TestCallF(t *testing.T) {
+	cpu := newCodeCpu(t, nil)
+	defer cpu.RunCommand(CmdStop, nil)
+	for _, z := range []bool{false, true} {
+		cpu.pc = 0x0203 // after the instruction
+		cpu.sp = 0xFFFE
+		cpu.f.set(flagsOf(z, false, false, false))
+		cpu.branched = false
+		runOp(cpu, 0xCC, 0x40, 0x01) // CALL Z, 0x0140
+		if !z {
+			if cpu.pc.Word() != 0x0203 || cpu.sp.Word() != 0xFFFE || cpu.branched {
+				t.Errorf("NZ: PC 0x%04X SP 0x%04X", cpu.pc.Word(), cpu.sp.Word())
+			}
+			continue
+		}
+		ret := BytesToWord(cpu.readByte(Word(0xFFFD)), cpu.readByte(Word(0xFFFC)))
+		if cpu.pc.Word() != 0x0140 || cpu.sp.Word() != 0xFFFC || ret != 0x0203 || !cpu.branched {
+			t.Errorf("Z: PC 0x%04X SP 0x%04X return 0x%04X", cpu.pc.Word(), cpu.sp.Word(), ret)
+		}
+	}
+}
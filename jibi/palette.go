@@ -0,0 +1,42 @@
+package jibi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A DmgPalette is the 4 colors the dmg screen shows its shades in, from the
+// lightest to the darkest, as 15bit rgb like cgb palette memory. The gpu
+// converts the lines of dmg games with it before a ColorLcd gets them, cgb
+// and sgb colors are left alone.
+type DmgPalette [4]Word
+
+var (
+	// DmgGrey is the grey of the gameboy pocket, the default.
+	DmgGrey = DmgPalette(dmgShades)
+
+	// DmgGreen is the pea green of the original gameboy.
+	DmgGreen = DmgPalette(rgb4(0x9BBC0F, 0x8BAC0F, 0x306230, 0x0F380F))
+)
+
+// ParseDmgPalette parses green, grey or gray, or 4 comma separated 24bit
+// hex colors from the lightest to the darkest.
+func ParseDmgPalette(s string) (DmgPalette, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "green":
+		return DmgGreen, nil
+	case "grey", "gray":
+		return DmgGrey, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return DmgPalette{}, fmt.Errorf("dmg palette needs green, grey or 4 colors, got %q", s)
+	}
+	colors, err := parseColors(parts)
+	if err != nil {
+		return DmgPalette{}, err
+	}
+	var p DmgPalette
+	copy(p[:], colors)
+	return p, nil
+}
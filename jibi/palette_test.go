@@ -0,0 +1,28 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestParseDmgPalette(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		want DmgPalette
+	}{
+		{"green", DmgGreen},
+		{"Grey", DmgGrey},
+		{"gray", DmgGrey},
+		{"FFFFFF, #aaaaaa,555555,000000", DmgGrey},
+		{"F8F8F8,000000,000000,0000F8", DmgPalette{0x7FFF, 0, 0, 0x7C00}},
+	} {
+		p, err := ParseDmgPalette(c.s)
+		if err != nil || p != c.want {
+			t.Errorf("%q: %04X %v", c.s, p, err)
+		}
+	}
+	for _, s := range []string{"", "blue", "FFFFFF,000000", "FFFFFF,000000,000000,GGGGGG"} {
+		if _, err := ParseDmgPalette(s); err == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package jibi
+
+import (
+	"fmt"
+)
+
+// a romPatch replaces bytes of the rom image starting at offset
+type romPatch struct {
+	rom    []Byte
+	offset int
+	data   []Byte
+}
+
+// a poke is a single byte written to the address space
+type poke struct {
+	addr Word
+	b    Byte
+	err  chan error
+}
+
+// a peek is a single byte read from the address space
+type peek struct {
+	addr Word
+	b    chan Byte
+}
+
+// a peekBytes is n bytes read from the address space starting at addr
+type peekBytes struct {
+	addr Word
+	n    int
+	b    chan []Byte
+}
+
+func (c *Cpu) cmdPatchRom(data interface{}) {
+	if p, ok := data.(romPatch); !ok {
+		panic("invalid command response type")
+	} else {
+		copy(p.rom[p.offset:], p.data)
+	}
+}
+
+// cmdPoke writes to the address space like the cpu would, except for rom,
+// where the byte in the currently mapped bank is replaced. Memory that is not
+// emulated is an error, even outside strict mode.
+func (c *Cpu) cmdPoke(data interface{}) {
+	p, ok := data.(poke)
+	if !ok {
+		panic("invalid command response type")
+	}
+	if p.addr >= AddrVRam {
+		if !c.mmu.Mapped(p.addr) {
+			p.err <- fmt.Errorf("poke 0x%04X: memory not emulated", uint16(p.addr))
+			return
+		}
+		c.pokeByte(p.addr, p.b)
+		p.err <- nil
+		return
+	}
+	rom := c.mmu.Rom()
+	offset := int(p.addr)
+	if p.addr >= 0x4000 {
+		offset = c.mmu.RomBank()*0x4000 + int(p.addr-0x4000)
+	}
+	if len(rom) > 0 {
+		rom[offset%len(rom)] = p.b
+	}
+	p.err <- nil
+}
+
+func (c *Cpu) cmdPeek(data interface{}) {
+	if p, ok := data.(peek); !ok {
+		panic("invalid command response type")
+	} else {
+		p.b <- c.peekByte(p.addr)
+	}
+}
+
+func (c *Cpu) cmdPeekBytes(data interface{}) {
+	p, ok := data.(peekBytes)
+	if !ok {
+		panic("invalid command response type")
+	}
+	bs := make([]Byte, p.n)
+	for i := range bs {
+		bs[i] = c.peekByte(p.addr + Word(i))
+	}
+	p.b <- bs
+}
+
+// Peek reads addr the way the cpu would between two instructions. Vram and
+// oam read what they hold even while the gpu or the oam dma shuts the cpu
+// out of them.
+func (j Jibi) Peek(addr Word) Byte {
+	b := make(chan Byte)
+	j.cpu.RunCommand(CmdPeek, peek{addr, b})
+	return <-b
+}
+
+// PeekBytes reads n bytes from addr like Peek, all between the same two
+// instructions. Reads past 0xFFFF wrap to 0x0000.
+func (j Jibi) PeekBytes(addr Word, n int) []Byte {
+	b := make(chan []Byte)
+	j.cpu.RunCommand(CmdPeekBytes, peekBytes{addr, n, b})
+	return <-b
+}
+
+// Poke writes b to addr right away, also to vram and oam while the gpu or
+// the oam dma shuts the cpu out of them. Writes to rom replace the byte in
+// the currently mapped bank until the next reset, see PatchROM for lasting
+// changes.
+func (j Jibi) Poke(addr Word, b Byte) error {
+	err := make(chan error)
+	j.cpu.RunCommand(CmdPoke, poke{addr, b, err})
+	return <-err
+}
+
+// PatchROM replaces the rom bytes starting at offset in the rom image. The
+// patch applies right away and again after every reset.
+func (j Jibi) PatchROM(offset int, b []Byte) error {
+	if offset < 0 || offset+len(b) > len(j.cart.Rom) {
+		return fmt.Errorf("patch 0x%X+%d outside rom of %d bytes", offset, len(b), len(j.cart.Rom))
+	}
+	data := make([]Byte, len(b))
+	copy(data, b)
+	*j.patches = append(*j.patches, romPatch{offset: offset, data: data})
+	j.cpu.RunCommand(CmdPatchRom, romPatch{j.cart.Rom, offset, data})
+	return nil
+}
+
+// applyPatches applies patches to a newly loaded rom, skipping any that no
+// longer fit.
+func (j Jibi) applyPatches(patches []romPatch) {
+	for _, p := range patches {
+		j.PatchROM(p.offset, p.data)
+	}
+}
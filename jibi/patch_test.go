@@ -0,0 +1,98 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestPokePatch(t *testing.T) {
+	rom := make([]Byte, 0x10000)
+	rom[0x0147] = 0x01 // mbc1
+	rom[0x0148] = 0x01 // 4 banks
+	j, err := New(rom, Options{Skipbios: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+
+	for _, c := range []struct {
+		addr Word
+		b    Byte
+	}{
+		{0xC123, 0x12}, // ram
+		{0xFF80, 0x34}, // zero page
+		{0x0150, 0x56}, // rom bank 0
+		{0x4010, 0x78}, // rom bank 1
+	} {
+		if err := j.Poke(c.addr, c.b); err != nil {
+			t.Errorf("poke 0x%04X: %v", c.addr, err)
+		}
+		if b := j.Peek(c.addr); b != c.b {
+			t.Errorf("peek 0x%04X: 0x%02X", c.addr, b)
+		}
+	}
+	if j.cart.Rom[0x4010] != 0x78 {
+		t.Error("poke to bank 1 missed the rom image")
+	}
+	if err := j.Poke(0xFEA0, 0x01); err == nil {
+		t.Error("poked unusable memory")
+	}
+
+	// pokes to rom replace the byte, they do not reach the mapper
+	if err := j.Poke(0x2000, 0x02); err != nil {
+		t.Fatal(err)
+	}
+	if b := j.Peek(0x2000); b != 0x02 || j.Peek(0x4010) != 0x78 {
+		t.Errorf("poke to the mapper read 0x%02X", b)
+	}
+	if err := j.PatchROM(0x4020, []Byte{0x9A, 0xBC}); err != nil {
+		t.Fatal(err)
+	}
+	if b := j.PeekBytes(0x4020, 2); b[0] != 0x9A || b[1] != 0xBC {
+		t.Errorf("patched bank 1 reads % X", b)
+	}
+	for _, p := range []struct {
+		offset, n int
+	}{
+		{-1, 1}, {0xFFFF, 2}, {0x10000, 1},
+	} {
+		if err := j.PatchROM(p.offset, make([]Byte, p.n)); err == nil {
+			t.Errorf("patched 0x%X+%d", p.offset, p.n)
+		}
+	}
+	if len(*j.patches) != 1 {
+		t.Errorf("%d patches kept for a reload", len(*j.patches))
+	}
+}
+
+// TestPokeBlocked checks that pokes and peeks reach vram and oam while the
+// gpu or the oam dma shuts the cpu out of them.
+func TestPokeBlocked(t *testing.T) {
+	cpu := newCodeCpu(t, nil)
+	defer cpu.RunCommand(CmdStop, nil)
+	for _, c := range []struct {
+		name  string
+		block func()
+	}{
+		{"mode 3", func() { cpu.mmu.Hardware().Write(AddrSTAT, LcdModeVRam) }},
+		{"dma", func() { cpu.startDma(0xC0) }},
+	} {
+		c.block()
+		for _, a := range []Word{AddrVRam, AddrOam} {
+			if cpu.readByte(a) != 0xFF {
+				t.Fatalf("%s: 0x%04X not blocked", c.name, a)
+			}
+			errs := make(chan error, 1)
+			cpu.cmdPoke(poke{a, 0x5A, errs})
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+			b := make(chan Byte, 1)
+			cpu.cmdPeek(peek{a, b})
+			if v := <-b; v != 0x5A {
+				t.Errorf("%s: peek 0x%04X: 0x%02X", c.name, a, v)
+			}
+			cpu.mmu.Hardware().Write(a, 0)
+		}
+		cpu.mmu.Hardware().Write(AddrSTAT, LcdModeHBlank)
+	}
+}
@@ -0,0 +1,245 @@
+package jibi
+
+import (
+	"image"
+	"sync"
+)
+
+// printer packet commands
+const (
+	printerInit  = 0x01
+	printerPrint = 0x02
+	printerData  = 0x04
+	printerNul   = 0x0F
+)
+
+// printer status bits
+const (
+	printerChecksumError = 0x01
+	printerPrinting      = 0x02
+	printerFull          = 0x04
+	printerUnprocessed   = 0x08
+)
+
+// printer packet bytes, in the order they are sent
+const (
+	printerMagic1 = iota
+	printerMagic2
+	printerCommand
+	printerCompression
+	printerLengthLo
+	printerLengthHi
+	printerPacketData
+	printerChecksumLo
+	printerChecksumHi
+	printerAlive
+	printerStatus
+)
+
+// a data packet is two rows of 20 tiles, a full buffer is a whole screen
+const (
+	printerPacketSize = 20 * 2 * 16
+	printerBufferSize = 9 * printerPacketSize
+)
+
+// printerBusyPolls is how many status replies report printing after a print
+// command, games wait for the bit to clear
+const printerBusyPolls = 4
+
+// A Printer is a SerialDevice emulating the Game Boy Printer, it writes every
+// image printed to a png file.
+type Printer struct {
+	dir   string
+	print func(img *image.Gray) error
+
+	// packet being received
+	state      int
+	cmd        Byte
+	compressed bool
+	length     int
+	data       []Byte
+	sum        uint16
+	check      uint16
+
+	buf    []Byte // tile data, two rows of tiles per data packet
+	status Byte
+	busy   int // status replies left that report printing
+
+	lock sync.Mutex
+	err  error
+}
+
+// NewPrinter returns a printer writing its prints to dir.
+func NewPrinter(dir string) *Printer {
+	p := &Printer{dir: dir}
+	p.print = p.writePng
+	return p
+}
+
+// Transfer takes the next byte of a packet, the printer answers with 0x81 and
+// its status in the two bytes following the checksum and 0x00 otherwise.
+func (p *Printer) Transfer(out Byte) Byte {
+	reply := Byte(0x00)
+	switch p.state {
+	case printerMagic1:
+		if out != 0x88 {
+			return reply
+		}
+	case printerMagic2:
+		if out != 0x33 {
+			p.state = printerMagic1
+			return reply
+		}
+	case printerCommand:
+		p.cmd = out
+		p.sum = uint16(out)
+		p.data = p.data[:0]
+	case printerCompression:
+		p.compressed = out&0x01 != 0
+		p.sum += uint16(out)
+	case printerLengthLo:
+		p.length = int(out)
+		p.sum += uint16(out)
+	case printerLengthHi:
+		p.length |= int(out) << 8
+		p.sum += uint16(out)
+		if p.length == 0 {
+			p.state = printerChecksumLo
+			return reply
+		}
+	case printerPacketData:
+		p.data = append(p.data, out)
+		p.sum += uint16(out)
+		if len(p.data) < p.length {
+			return reply
+		}
+	case printerChecksumLo:
+		p.check = uint16(out)
+	case printerChecksumHi:
+		p.check |= uint16(out) << 8
+		p.packet()
+	case printerAlive:
+		reply = 0x81
+	case printerStatus:
+		reply = p.status
+		if p.busy > 0 {
+			reply |= printerPrinting
+			p.busy--
+		}
+		p.state = printerMagic1
+		return reply
+	}
+	p.state++
+	return reply
+}
+
+func (p *Printer) Poll(reply Byte) (Byte, bool) {
+	return 0, false
+}
+
+// packet runs the command of a packet once its checksum is in.
+func (p *Printer) packet() {
+	if p.sum != p.check {
+		p.status |= printerChecksumError
+		return
+	}
+	p.status &^= printerChecksumError
+	switch p.cmd {
+	case printerInit:
+		p.buf = p.buf[:0]
+		p.status = 0
+		p.busy = 0
+	case printerData:
+		data := p.data
+		if p.compressed {
+			data = printerDecompress(data)
+		}
+		if n := printerBufferSize - len(p.buf); len(data) > n {
+			data = data[:n]
+		}
+		p.buf = append(p.buf, data...)
+		if len(p.buf) > 0 {
+			p.status |= printerUnprocessed
+		}
+		if len(p.buf) == printerBufferSize {
+			p.status |= printerFull
+		}
+	case printerPrint:
+		if len(p.data) < 4 {
+			return
+		}
+		img := printerImage(p.buf, p.data[2])
+		p.buf = p.buf[:0]
+		p.status &^= printerUnprocessed | printerFull
+		p.busy = printerBusyPolls
+		if err := p.print(img); err != nil {
+			p.lock.Lock()
+			p.err = err
+			p.lock.Unlock()
+		}
+	}
+}
+
+// printerDecompress expands run length encoded data. A control byte with bit
+// 7 set repeats the next byte (c&0x7F)+2 times, otherwise the c+1 bytes
+// following it are copied.
+func printerDecompress(data []Byte) []Byte {
+	var out []Byte
+	for i := 0; i < len(data); {
+		c := data[i]
+		i++
+		if c&0x80 != 0 {
+			if i == len(data) {
+				break
+			}
+			for n := int(c&0x7F) + 2; n > 0; n-- {
+				out = append(out, data[i])
+			}
+			i++
+			continue
+		}
+		n := int(c) + 1
+		if i+n > len(data) {
+			n = len(data) - i
+		}
+		out = append(out, data[i:i+n]...)
+		i += n
+	}
+	return out
+}
+
+// printerImage draws the tiles in buf, 20 per row, with the 4 shades of
+// palette. A palette of 0 is the default 0xE4.
+func printerImage(buf []Byte, palette Byte) *image.Gray {
+	if palette == 0 {
+		palette = 0xE4
+	}
+	rows := len(buf) / (20 * 16)
+	img := image.NewGray(image.Rect(0, 0, 160, rows*8))
+	for y := 0; y < rows*8; y++ {
+		for x := 0; x < 160; x++ {
+			tile := (y/8)*20 + x/8
+			lo := buf[tile*16+(y%8)*2]
+			hi := buf[tile*16+(y%8)*2+1]
+			bit := uint(7 - x%8)
+			color := lo>>bit&0x01 | (hi>>bit&0x01)<<1
+			shade := palette >> (2 * color) & 0x03
+			img.Pix[y*img.Stride+x] = 0xFF - uint8(shade)*0x55
+		}
+	}
+	return img
+}
+
+// writePng writes img to the first print-NNN.png file that does not exist
+// yet in dir.
+func (p *Printer) writePng(img *image.Gray) error {
+	_, err := writePngFile(p.dir, "print", img)
+	return err
+}
+
+// Err returns the error of the last print that could not be written, if any.
+func (p *Printer) Err() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.err
+}
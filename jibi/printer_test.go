@@ -0,0 +1,137 @@
+package jibi
+
+import (
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sendPacket sends a printer packet and returns the alive and status replies.
+func sendPacket(p *Printer, cmd Byte, compressed bool, data []Byte) (Byte, Byte) {
+	comp := Byte(0)
+	if compressed {
+		comp = 1
+	}
+	packet := []Byte{0x88, 0x33, cmd, comp, Byte(len(data)), Byte(len(data) >> 8)}
+	packet = append(packet, data...)
+	sum := uint16(0)
+	for _, b := range packet[2:] {
+		sum += uint16(b)
+	}
+	packet = append(packet, Byte(sum), Byte(sum>>8))
+	for _, b := range packet {
+		if r := p.Transfer(b); r != 0 {
+			panic("reply before the checksum")
+		}
+	}
+	return p.Transfer(0), p.Transfer(0)
+}
+
+func TestPrinter(t *testing.T) {
+	var prints []*image.Gray
+	p := NewPrinter("")
+	p.print = func(img *image.Gray) error {
+		prints = append(prints, img)
+		return nil
+	}
+	if alive, status := sendPacket(p, printerInit, false, nil); alive != 0x81 || status != 0 {
+		t.Errorf("init 0x%02X 0x%02X", alive, status)
+	}
+	// a tile of color 1 then 19 of color 3, and one row of color 0
+	tiles := make([]Byte, printerPacketSize)
+	for i := 0; i < 16; i += 2 {
+		tiles[i] = 0xFF
+	}
+	for i := 16; i < 20*16; i++ {
+		tiles[i] = 0xFF
+	}
+	if _, status := sendPacket(p, printerData, false, tiles); status != printerUnprocessed {
+		t.Errorf("data status 0x%02X", status)
+	}
+	sendPacket(p, printerData, false, nil)
+	if _, status := sendPacket(p, printerPrint, false, []Byte{1, 0x13, 0xE4, 0x40}); status&printerPrinting == 0 {
+		t.Errorf("print status 0x%02X", status)
+	}
+	for i := 0; i < printerBusyPolls; i++ {
+		sendPacket(p, printerNul, false, nil)
+	}
+	if _, status := sendPacket(p, printerNul, false, nil); status != 0 {
+		t.Errorf("done status 0x%02X", status)
+	}
+	if len(prints) != 1 {
+		t.Fatalf("%d prints", len(prints))
+	}
+	img := prints[0]
+	if b := img.Bounds(); b.Dx() != 160 || b.Dy() != 16 {
+		t.Fatalf("%v", b)
+	}
+	for _, c := range []struct {
+		x, y int
+		v    uint8
+	}{{0, 0, 0xAA}, {8, 0, 0x00}, {159, 7, 0x00}, {0, 8, 0xFF}} {
+		if v := img.GrayAt(c.x, c.y).Y; v != c.v {
+			t.Errorf("%d,%d: 0x%02X", c.x, c.y, v)
+		}
+	}
+
+	// a bad checksum is reported and the packet ignored
+	p.Transfer(0x88)
+	p.Transfer(0x33)
+	for _, b := range []Byte{printerData, 0, 1, 0, 0xFF, 0, 0} {
+		p.Transfer(b)
+	}
+	if _, status := p.Transfer(0), p.Transfer(0); status != printerChecksumError {
+		t.Errorf("checksum status 0x%02X", status)
+	}
+}
+
+func TestPrinterDecompress(t *testing.T) {
+	out := printerDecompress([]Byte{0x81, 0xAA, 0x01, 0x12, 0x34})
+	want := []Byte{0xAA, 0xAA, 0xAA, 0x12, 0x34}
+	if len(out) != len(want) {
+		t.Fatalf("% X", out)
+	}
+	for i := range want {
+		if out[i] != want[i] {
+			t.Fatalf("% X", out)
+		}
+	}
+}
+
+func TestPrinterPng(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jibi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := NewPrinter(dir)
+	sendPacket(p, printerInit, false, nil)
+	var runs []Byte
+	for i := 0; i < printerPacketSize/128; i++ {
+		runs = append(runs, 0x80|126, 0x00)
+	}
+	sendPacket(p, printerData, true, runs)
+	sendPacket(p, printerPrint, false, []Byte{1, 0, 0, 0})
+	sendPacket(p, printerData, false, make([]Byte, printerPacketSize))
+	sendPacket(p, printerPrint, false, []Byte{1, 0, 0, 0})
+	if err := p.Err(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"print-001.png", "print-002.png"} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := img.Bounds(); b.Dx() != 160 || b.Dy() != 16 {
+			t.Errorf("%s %v", name, b)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package jibi
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A FuncProfile is the time spent in one function, identified by the address
+// it was called at. Inclusive cycles count the functions it called, exclusive
+// cycles only its own instructions.
+type FuncProfile struct {
+	Bank      int
+	Addr      Word
+	Calls     int
+	Inclusive uint64
+	Exclusive uint64
+}
+
+// a profFrame is an entry on the shadow call stack
+type profFrame struct {
+	f     *FuncProfile
+	sp    Word   // sp just after the call pushed the return address
+	start uint64 // cycles at entry
+}
+
+// A profiler attributes cycles to functions by keeping a shadow call stack
+// from the calls, rsts, interrupts and returns the cpu executes.
+type profiler struct {
+	cycles uint64
+	funcs  map[profKey]*FuncProfile
+	stack  []profFrame
+}
+
+type profKey struct {
+	bank int
+	addr Word
+}
+
+func newProfiler(bank int, pc, sp Word) *profiler {
+	p := &profiler{funcs: map[profKey]*FuncProfile{}}
+	p.call(bank, pc, sp)
+	return p
+}
+
+func (p *profiler) call(bank int, addr, sp Word) {
+	if addr < 0x4000 {
+		bank = 0
+	}
+	k := profKey{bank, addr}
+	f, ok := p.funcs[k]
+	if !ok {
+		f = &FuncProfile{Bank: bank, Addr: addr}
+		p.funcs[k] = f
+	}
+	f.Calls++
+	p.stack = append(p.stack, profFrame{f, sp, p.cycles})
+}
+
+// ret pops every frame whose return address is at or below sp, which also
+// unwinds functions that left without a ret.
+func (p *profiler) ret(sp Word) {
+	for len(p.stack) > 1 && p.stack[len(p.stack)-1].sp <= sp {
+		p.pop()
+	}
+}
+
+func (p *profiler) pop() {
+	frame := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	// a recursive call is already counted by its outer frame
+	for _, outer := range p.stack {
+		if outer.f == frame.f {
+			return
+		}
+	}
+	frame.f.Inclusive += p.cycles - frame.start
+}
+
+// step accounts for one executed instruction, op was fetched with the stack
+// pointer at sp and left it at newSp and the program counter at pc.
+func (p *profiler) step(op opcode, t uint8, bank int, sp, newSp, pc Word) {
+	p.cycles += uint64(t)
+	p.stack[len(p.stack)-1].f.Exclusive += uint64(t)
+	switch callKind(op, sp, newSp) {
+	case opCall:
+		p.call(bank, pc, newSp)
+	case opRet:
+		p.ret(sp)
+	}
+}
+
+const (
+	opOther = iota
+	opCall
+	opRet
+)
+
+// callKind returns whether op, which moved sp to newSp, was a taken call or
+// rst, or a taken return.
+func callKind(op opcode, sp, newSp Word) int {
+	switch op {
+	case 0xC4, 0xCC, 0xCD, 0xD4, 0xDC, // call
+		0xC7, 0xCF, 0xD7, 0xDF, 0xE7, 0xEF, 0xF7, 0xFF: // rst
+		if newSp == sp-2 {
+			return opCall
+		}
+	case 0xC0, 0xC8, 0xC9, 0xD0, 0xD8, 0xD9: // ret, reti
+		if newSp == sp+2 {
+			return opRet
+		}
+	}
+	return opOther
+}
+
+// report returns the profile of every function called, with open frames
+// counted up to now.
+func (p *profiler) report() []FuncProfile {
+	open := map[*FuncProfile]uint64{}
+	for _, frame := range p.stack {
+		if _, ok := open[frame.f]; !ok {
+			open[frame.f] = p.cycles - frame.start
+		}
+	}
+	funcs := []FuncProfile{}
+	for _, f := range p.funcs {
+		fp := *f
+		fp.Inclusive += open[f]
+		funcs = append(funcs, fp)
+	}
+	sort.Sort(funcsByExclusive(funcs))
+	return funcs
+}
+
+func (c *Cpu) cmdProfileStart(resp interface{}) {
+	c.prof = newProfiler(c.mmu.RomBank(), c.pc.Word(), c.sp.Word())
+}
+
+func (c *Cpu) cmdProfileReport(resp interface{}) {
+	if resp, ok := resp.(chan []FuncProfile); !ok {
+		panic("invalid command response type")
+	} else if c.prof == nil {
+		resp <- nil
+	} else {
+		resp <- c.prof.report()
+	}
+}
+
+// FormatProfile returns a table of funcs named by syms, which may be nil,
+// heaviest first.
+func FormatProfile(funcs []FuncProfile, syms *Symbols) string {
+	total := uint64(0)
+	for _, f := range funcs {
+		total += f.Exclusive
+	}
+	if total == 0 {
+		total = 1
+	}
+	s := fmt.Sprintf("%6s %6s %12s %6s %12s %10s  %s\n",
+		"excl%", "incl%", "exclusive", "", "inclusive", "calls", "function")
+	for _, f := range funcs {
+		s += fmt.Sprintf("%5.1f%% %5.1f%% %12d %5.1fms %12d %10d  %s\n",
+			100*float64(f.Exclusive)/float64(total),
+			100*float64(f.Inclusive)/float64(total),
+			f.Exclusive, 1e3*float64(f.Exclusive)/(4.194304*1e6),
+			f.Inclusive, f.Calls, syms.Name(f.Bank, f.Addr))
+	}
+	return s
+}
+
+type funcsByExclusive []FuncProfile
+
+func (f funcsByExclusive) Len() int      { return len(f) }
+func (f funcsByExclusive) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+func (f funcsByExclusive) Less(i, j int) bool {
+	return f[i].Exclusive > f[j].Exclusive
+}
@@ -0,0 +1,48 @@
+package jibi
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// An addrRange is a value for the addresses from start to end inclusive.
+type addrRange[T any] struct {
+	start, end Word
+	v          T
+}
+
+// A rangeList is a list of values for address ranges that is read on every
+// access without locking. Changes replace the whole list, so it can be
+// changed from any goroutine while the scheduler reads it.
+type rangeList[T any] struct {
+	lock  sync.Mutex
+	items atomic.Pointer[[]*addrRange[T]]
+}
+
+// add appends v for start to end and returns a func that removes it.
+func (l *rangeList[T]) add(start, end Word, v T) func() {
+	r := &addrRange[T]{start, end, v}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	items := append(append([]*addrRange[T](nil), l.load()...), r)
+	l.items.Store(&items)
+	return func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		var items []*addrRange[T]
+		for _, o := range l.load() {
+			if o != r {
+				items = append(items, o)
+			}
+		}
+		l.items.Store(&items)
+	}
+}
+
+// load returns the list as it is now, it must not be changed.
+func (l *rangeList[T]) load() []*addrRange[T] {
+	if p := l.items.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
@@ -10,12 +10,12 @@ type register8 struct {
 	mask Byte
 }
 
-func newFlagsRegister8() register8 {
-	return register8{new(Byte), nil, 0xF0}
+func newFlagsRegister8() *register8 {
+	return &register8{new(Byte), nil, 0xF0}
 }
 
-func newRegister8(lrp *register8) register8 {
-	return register8{new(Byte), lrp, 0xFF}
+func newRegister8(lrp *register8) *register8 {
+	return &register8{new(Byte), lrp, 0xFF}
 }
 
 func (r register8) String() string {
@@ -26,7 +26,7 @@ func (r register8) Word() Word {
 	if r.lrp == nil {
 		panic("lower register is nil")
 	}
-	return BytesToWord(r, r.lrp)
+	return BytesToWord(r.Byte(), r.lrp.Byte())
 }
 
 func (r register8) High() Byte {
@@ -0,0 +1,190 @@
+package jibi
+
+import (
+	"fmt"
+)
+
+// rewindCycles pass between two snapshots kept for stepping backwards, a
+// second
+const rewindCycles = dmgHz
+
+// a rewind keeps snapshots of the machine, oldest first. The debugger steps
+// backwards by loading one and running the cpu forward again to the
+// instruction it wants, which lands where the cpu was as long as nothing
+// from outside the machine changed on the way: the keys, the link port and
+// the real time clock are not replayed.
+type rewind struct {
+	req    stateRequest // the cartridge, gpu and apu saved with the cpu
+	states []*machineState
+	max    int
+	next   uint64 // cycle of the next snapshot
+}
+
+// newRewind returns a rewind keeping up to seconds snapshots of the machine
+// req describes.
+func newRewind(seconds int, req stateRequest) *rewind {
+	return &rewind{req: req, max: seconds}
+}
+
+// snapshot keeps the machine every rewindCycles, the oldest snapshot goes
+// once max are kept.
+func (c *Cpu) snapshot() {
+	r := c.rewind
+	if r == nil || c.cycles < r.next {
+		return
+	}
+	r.next = c.cycles + rewindCycles
+	req := r.req
+	req.s = &machineState{}
+	if err := c.saveState(req); err != nil {
+		c.log.Error("rewind off", "err", err)
+		c.rewind = nil
+		return
+	}
+	if len(r.states) == r.max {
+		r.states = append(r.states[:0], r.states[1:]...)
+	}
+	r.states = append(r.states, req.s)
+}
+
+// replay loads s and runs the cpu up to the first instruction start at or
+// after cycle end, without stopping on breakpoints or telling anyone what it
+// runs. at, if not nil, is called at every instruction start before, with
+// its cycle. Instructions start where breakpoints stop the cpu, after an
+// interrupt is dispatched.
+func (c *Cpu) replay(s *machineState, end uint64, at func(cycle uint64)) error {
+	r := c.rewind
+	req := r.req
+	req.s = s
+	if err := c.loadState(req); err != nil {
+		return err
+	}
+	inst, brk, prints, trace := c.notifyInst, c.notifyBreak, c.notifyPrint, c.trace
+	watches, link, prof, cov := c.watches, c.link, c.prof, c.cov
+	c.notifyInst, c.notifyBreak, c.notifyPrint, c.trace = nil, nil, nil, nil
+	c.watches, c.link, c.prof, c.cov = nil, noSerial{}, nil, nil
+	c.rewind = nil // no snapshots of the replay
+	done := false
+	c.replayAt = func() bool {
+		cycle := c.cycles + uint64(c.ticked)
+		if cycle >= end {
+			done = true
+			return true
+		}
+		if at != nil {
+			at(cycle)
+		}
+		return false
+	}
+	// a halted cpu starts no instructions, it stops on the first step
+	// boundary
+	for !done && !((c.halted || c.locked) && c.cycles >= end) {
+		c.step(false, 0)
+	}
+	c.replayAt = nil
+	c.notifyInst, c.notifyBreak, c.notifyPrint, c.trace = inst, brk, prints, trace
+	c.watches, c.link, c.prof, c.cov = watches, link, prof, cov
+	c.rewind = r
+	if watches != nil {
+		watches.take() // the hooks saw the replay too
+	}
+	return nil
+}
+
+// rewindTo takes a stopped cpu back to the last instruction start before
+// the current one with pc matching, searching the snapshots from the newest
+// back. Without one the cpu is left where it was.
+func (c *Cpu) rewindTo(match func(pc Word) bool) error {
+	r := c.rewind
+	if r == nil {
+		return fmt.Errorf("no snapshots to go back to, see Options.Rewind")
+	}
+	if c.isPlaying() {
+		return fmt.Errorf("the cpu is running")
+	}
+	now := c.cycles
+	last := len(r.states) - 1
+	for last >= 0 && r.states[last].Cpu.Cycles > now {
+		last--
+	}
+	if last < 0 {
+		return fmt.Errorf("no snapshot before cycle %d", now)
+	}
+	end := now
+	for i := last; i >= 0; i-- {
+		var found uint64
+		ok := false
+		err := c.replay(r.states[i], end, func(cycle uint64) {
+			if match(c.pc.Word()) {
+				found, ok = cycle, true
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := c.replay(r.states[i], found, nil); err != nil {
+				return err
+			}
+			// the snapshots after it are of a future that may not come
+			r.states = r.states[:i+1]
+			r.next = r.states[i].Cpu.Cycles + rewindCycles
+			return nil
+		}
+		end = r.states[i].Cpu.Cycles
+	}
+	if err := c.replay(r.states[last], now, nil); err != nil {
+		return err
+	}
+	return fmt.Errorf("not found in the %d snapshots kept", last+1)
+}
+
+// cmdStepBack takes a stopped cpu back to before the instruction it ran
+// last and reports the registers there.
+func (c *Cpu) cmdStepBack(data interface{}) {
+	resp, ok := data.(chan error)
+	if !ok {
+		panic("invalid command response type")
+	}
+	err := c.rewindTo(func(pc Word) bool { return true })
+	if err != nil {
+		resp <- fmt.Errorf("step back: %s", err)
+		return
+	}
+	resp <- nil
+	c.stopped()
+}
+
+// cmdContinueBack takes a stopped cpu back to the last time it was about to
+// run an instruction with a breakpoint and reports the registers there.
+func (c *Cpu) cmdContinueBack(data interface{}) {
+	resp, ok := data.(chan error)
+	if !ok {
+		panic("invalid command response type")
+	}
+	err := c.rewindTo(func(pc Word) bool { return c.breakpoints[pc] })
+	if err != nil {
+		resp <- fmt.Errorf("continue back: %s", err)
+		return
+	}
+	resp <- nil
+	c.stopped()
+}
+
+// StepBack takes a stopped cpu back to before the instruction it ran last,
+// like undoing StepOne. It needs Options.Rewind, and goes back as far as the
+// snapshots kept reach.
+func (j Jibi) StepBack() error {
+	err := make(chan error)
+	j.cpu.RunCommand(CmdStepBack, err)
+	return <-err
+}
+
+// ContinueBack runs a stopped cpu backwards, to the last time it was about
+// to run an instruction with a breakpoint, like Continue in reverse. The cpu
+// stays where it is if no breakpoint was hit as far as the snapshots reach.
+func (j Jibi) ContinueBack() error {
+	err := make(chan error)
+	j.cpu.RunCommand(CmdContinueBack, err)
+	return <-err
+}
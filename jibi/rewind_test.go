@@ -0,0 +1,82 @@
+package jibi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStepBack(t *testing.T) {
+	rom := make([]Byte, 0x8000)
+	copy(rom[0x0100:], []Byte{0x00, 0x04, 0x18, 0xFC}) // NOP, INC B, JR -4
+	j, err := New(rom, Options{Skipbios: true, Rewind: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	stop := j.OnStop()
+	next := func() Registers {
+		select {
+		case r := <-stop:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("cpu did not stop")
+		}
+		return Registers{}
+	}
+	j.Play()
+	time.Sleep(20 * time.Millisecond)
+	j.SetBreakpoint(0x0101)
+	hit := next()
+	if hit.PC != 0x0101 {
+		t.Fatalf("stopped at 0x%04X", hit.PC)
+	}
+
+	j.StepOne()
+	if r := next(); r.PC != 0x0102 || r.B != hit.B+1 {
+		t.Fatalf("step to 0x%04X with b 0x%02X", r.PC, r.B)
+	}
+	if err := j.StepBack(); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r != hit {
+		t.Errorf("stepped back to %+v, not %+v", r, hit)
+	}
+	if err := j.StepBack(); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r.PC != 0x0100 || r.B != hit.B || r.Cycles != hit.Cycles-4 {
+		t.Errorf("stepped back to 0x%04X with b 0x%02X at %d", r.PC, r.B, r.Cycles)
+	}
+
+	// the breakpoint was passed before it was set, a loop of 20 cycles ago
+	if err := j.ContinueBack(); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r.PC != 0x0101 || r.B != hit.B-1 || r.Cycles != hit.Cycles-20 {
+		t.Errorf("continued back to 0x%04X with b 0x%02X at %d", r.PC, r.B, r.Cycles)
+	}
+	j.Continue()
+	if r := next(); r != hit {
+		t.Errorf("continued to %+v, not %+v", r, hit)
+	}
+
+	j.ClearBreakpoint(0x0101)
+	j.SetBreakpoint(0x0150)
+	if err := j.ContinueBack(); err == nil {
+		t.Error("continued back to a breakpoint never hit")
+	}
+	if r := j.Registers(); r != hit {
+		t.Errorf("left at %+v, not %+v", r, hit)
+	}
+}
+
+func TestStepBackOff(t *testing.T) {
+	j, err := New(make([]Byte, 0x8000), Options{Skipbios: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	if err := j.StepBack(); err == nil {
+		t.Error("stepped back without Options.Rewind")
+	}
+}
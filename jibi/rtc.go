@@ -0,0 +1,83 @@
+package jibi
+
+import (
+	"time"
+)
+
+// A RtcClock is the time source for cartridge real time clocks. The default
+// is the system time, tests and movies can supply their own.
+type RtcClock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// A FixedClock is a RtcClock that only moves when told to.
+type FixedClock struct {
+	T time.Time
+}
+
+// Now returns the current fixed time.
+func (c *FixedClock) Now() time.Time {
+	return c.T
+}
+
+// Advance moves the clock forward by d.
+func (c *FixedClock) Advance(d time.Duration) {
+	c.T = c.T.Add(d)
+}
+
+// an rtcMapper is a mapper with a real time clock
+type rtcMapper interface {
+	setRtcClock(clk RtcClock)
+}
+
+// rtcFooterLen is the size of the clock kept after the ram in the save file,
+// in the layout other emulators use: the clock registers and their latched
+// copy as 32 bit little endian words, then the unix time of the save as a 64
+// bit one. Some write the time as 32 bits, 44 bytes in all.
+const rtcFooterLen = 48
+
+// an rtcSaver is a mapper with a real time clock kept in the save file, the
+// registers in the mbc3 layout and the time they were counted up to
+type rtcSaver interface {
+	saveRtc() (live, latched [5]Byte, at time.Time)
+	loadRtc(live, latched [5]Byte, at time.Time)
+}
+
+// rtcFooter returns the save file footer of m's clock.
+func rtcFooter(m rtcSaver) []Byte {
+	live, latched, at := m.saveRtc()
+	f := make([]Byte, rtcFooterLen)
+	for i := range live {
+		f[i*4] = live[i]
+		f[20+i*4] = latched[i]
+	}
+	unix := uint64(at.Unix())
+	for i := 0; i < 8; i++ {
+		f[40+i] = Byte(unix >> (8 * uint(i)))
+	}
+	return f
+}
+
+// loadRtcFooter sets m's clock from a save file footer, the time passed since
+// the save counts. Anything but a footer leaves the clock alone.
+func loadRtcFooter(m rtcSaver, f []Byte) {
+	if len(f) != rtcFooterLen && len(f) != rtcFooterLen-4 {
+		return
+	}
+	var live, latched [5]Byte
+	for i := range live {
+		live[i] = f[i*4]
+		latched[i] = f[20+i*4]
+	}
+	var unix uint64
+	for i, b := range f[40:] {
+		unix |= uint64(b) << (8 * uint(i))
+	}
+	m.loadRtc(live, latched, time.Unix(int64(unix), 0))
+}
@@ -0,0 +1,87 @@
+package jibi
+
+// A ChannelState is what a sound channel is playing, for frontends that draw
+// the channels next to the game like an oscilloscope.
+type ChannelState struct {
+	On  bool
+	Dac bool
+
+	// Volume is the envelope volume, 0-15, for the wave channel it is the
+	// output level, 0 mute, 1 full, 2 half and 3 quarter.
+	Volume         Byte
+	EnvelopeUp     bool
+	EnvelopePeriod Byte // in 64Hz ticks, 0 holds the volume
+
+	Freq uint16  // 11 bit frequency, or NR43 for the noise channel
+	Hz   float64 // tone of the square and wave channels, shifts of the noise
+
+	// Samples are the last outputs of the channel, -15 to 15, oldest
+	// first. They are taken at the output sample rate, so only while an
+	// AudioSink plays them.
+	Samples []int8
+}
+
+// Channels returns the state of the 4 sound channels.
+func (j Jibi) Channels() [4]ChannelState {
+	resp := make(chan [4]ChannelState)
+	j.apu.RunCommand(CmdChannels, resp)
+	return <-resp
+}
+
+func (a *Apu) cmdChannels(resp interface{}) {
+	if resp, ok := resp.(chan [4]ChannelState); !ok {
+		panic("invalid command response type")
+	} else {
+		resp <- a.channels()
+	}
+}
+
+func (a *Apu) channels() [4]ChannelState {
+	chs := [4]ChannelState{
+		a.ch1.state(), a.ch2.state(), a.ch3.state(), a.ch4.state(),
+	}
+	for i := range chs {
+		s := make([]int8, 0, apuScopeSamples)
+		s = append(s, a.scope[i][a.scopePos:]...)
+		chs[i].Samples = append(s, a.scope[i][:a.scopePos]...)
+	}
+	return chs
+}
+
+func (e *envelope) state() ChannelState {
+	return ChannelState{
+		Dac:            e.dac(),
+		Volume:         e.volume,
+		EnvelopeUp:     e.up,
+		EnvelopePeriod: e.period,
+	}
+}
+
+func (s *square) state() ChannelState {
+	st := s.env.state()
+	st.On = s.on
+	st.Freq = s.freq
+	st.Hz = dmgHz / float64(s.period()*8)
+	return st
+}
+
+func (w *wave) state() ChannelState {
+	return ChannelState{
+		On:     w.on,
+		Dac:    w.dac,
+		Volume: w.volume,
+		Freq:   w.freq,
+		Hz:     dmgHz / float64(w.period()*32),
+	}
+}
+
+func (n *noise) state() ChannelState {
+	st := n.env.state()
+	st.On = n.on
+	st.Freq = uint16(n.shift<<4 | n.divisor)
+	if n.width7 {
+		st.Freq |= 0x08
+	}
+	st.Hz = dmgHz / float64(n.period())
+	return st
+}
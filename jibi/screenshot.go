@@ -0,0 +1,54 @@
+package jibi
+
+import (
+	"image"
+)
+
+func (g *Gpu) cmdScreenshot(resp interface{}) {
+	if resp, ok := resp.(chan *image.Gray); !ok {
+		panic("invalid command response type")
+	} else {
+		g.screenshots = append(g.screenshots, resp)
+	}
+}
+
+// shootLine copies line ly into the screenshot being taken, which starts
+// with the first line of the frame after the request.
+func (g *Gpu) shootLine(ly Byte, line []Byte) {
+	if ly == 0 && g.screen == nil && len(g.screenshots) > 0 {
+		g.screen = image.NewGray(image.Rect(0, 0, int(lcdWidth), int(lcdHeight)))
+		g.shooting, g.screenshots = g.screenshots, nil
+		for i := range g.screen.Pix {
+			g.screen.Pix[i] = tileShades[0]
+		}
+	}
+	if g.screen == nil || ly >= lcdHeight {
+		return
+	}
+	row := g.screen.Pix[int(ly)*g.screen.Stride:]
+	for x, px := range line {
+		row[x] = tileShades[px&0x03]
+	}
+}
+
+// takeScreenshots answers the requests the frame that was just drawn was
+// taken for.
+func (g *Gpu) takeScreenshots() {
+	if g.screen == nil {
+		return
+	}
+	for _, resp := range g.shooting {
+		resp <- g.screen
+	}
+	g.screen, g.shooting = nil, nil
+}
+
+// Screenshot returns the next frame as the dmg lcd shows it, in the 4
+// shades from white to black. On the cgb the shades are the color numbers,
+// not the colors of the palettes. Like VideoSnapshot it blocks until the
+// frame is done.
+func (j Jibi) Screenshot() *image.Gray {
+	resp := make(chan *image.Gray, 1)
+	j.gpu.RunCommand(CmdScreenshot, resp)
+	return <-resp
+}
@@ -0,0 +1,137 @@
+package jibi
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// A SerialDevice is whatever is plugged into the link port. Transfer is called
+// when the gameboy clocks a byte out with its internal clock, it returns the
+// byte shifted in from the other side. Poll is called regularly to check
+// whether the other side clocked a byte in, in which case reply is shifted
+// out to it and the byte received is returned with true.
+type SerialDevice interface {
+	Transfer(out Byte) Byte
+	Poll(reply Byte) (Byte, bool)
+}
+
+// noSerial is an empty link port, the data line floats high and nothing ever
+// clocks a transfer.
+type noSerial struct{}
+
+func (noSerial) Transfer(out Byte) Byte {
+	return 0xFF
+}
+
+func (noSerial) Poll(reply Byte) (Byte, bool) {
+	return 0, false
+}
+
+// the internal clock shifts a bit every serialBitCycles, 8192Hz, or 16 times
+// as fast with the cgb fast clock
+const serialBitCycles = 512
+
+// serialClock tracks the transfer in progress on the cpu side
+type serialClock struct {
+	t    uint32 // cycles into an internal clock transfer
+	poll uint32 // cycles since the device was last polled
+}
+
+// serial runs the link port for t clock cycles. A transfer started with the
+// internal clock completes after 8 bits worth of cycles, one waiting for the
+// external clock completes when the device reports the other side clocked
+// it.
+func (c *Cpu) serial(t uint8) {
+	// the hardware reads the bits that are unused on the dmg as 0
+	sc := c.mmu.Hardware().Read(AddrSC)
+	if sc&0x81 == 0x81 {
+		c.sio.t += uint32(t)
+		n := uint32(8 * serialBitCycles)
+		if sc&0x02 != 0 {
+			n /= 16
+		}
+		if c.sio.t >= n {
+			c.sio.t = 0
+			c.linkCycle()
+			c.serialDone(c.link.Transfer(c.readByte(AddrSB)), sc)
+		}
+		return
+	}
+	c.sio.t = 0
+	c.sio.poll += uint32(t)
+	if c.sio.poll < serialBitCycles {
+		return
+	}
+	c.sio.poll = 0
+	c.linkCycle()
+	if in, ok := c.link.Poll(c.readByte(AddrSB)); ok && sc&0x80 != 0 {
+		c.serialDone(in, sc)
+	}
+}
+
+// serialDone ends a transfer with the byte received.
+func (c *Cpu) serialDone(in Byte, sc Byte) {
+	c.writeByte(AddrSB, in)
+	c.writeByte(AddrSC, sc&^0x80)
+	c.setInterrupt(InterruptSerial)
+}
+
+// A SerialCapture is a SerialDevice recording the bytes the gameboy sends,
+// like the results test roms print. Nothing answers, transfers read 0xFF.
+type SerialCapture struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+	w    io.Writer
+}
+
+// NewSerialCapture returns a capture that also copies every byte to w, if w
+// is not nil.
+func NewSerialCapture(w io.Writer) *SerialCapture {
+	return &SerialCapture{w: w}
+}
+
+func (s *SerialCapture) Transfer(out Byte) Byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.buf.WriteByte(byte(out))
+	if s.w != nil {
+		s.w.Write([]byte{byte(out)})
+	}
+	return 0xFF
+}
+
+func (s *SerialCapture) Poll(reply Byte) (Byte, bool) {
+	return 0, false
+}
+
+// String returns everything sent so far.
+func (s *SerialCapture) String() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.buf.String()
+}
+
+// A linkPort holds SB and SC, the registers of the link port. The cpu shifts
+// the bits in and out, see Cpu.serial.
+type linkPort struct {
+	sb, sc Byte
+	cgb    bool
+}
+
+func (p *linkPort) Read(addr Word) Byte {
+	if addr == AddrSB {
+		return p.sb
+	}
+	return p.sc
+}
+
+func (p *linkPort) Write(addr Word, b Byte) {
+	if addr == AddrSB {
+		p.sb = b
+	} else if p.cgb {
+		p.sc = b & 0x83 // bit 1 is the cgb fast clock
+	} else {
+		p.sc = b & 0x81
+	}
+}
@@ -0,0 +1,203 @@
+package jibi
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+// a testSerial is the other side of the link, it answers every transfer with
+// the next byte of in and can clock one byte into the gameboy
+type testSerial struct {
+	in    []Byte
+	out   []Byte
+	clock *Byte // clocked in by the next poll
+}
+
+func (s *testSerial) Transfer(out Byte) Byte {
+	s.out = append(s.out, out)
+	b := s.in[0]
+	s.in = s.in[1:]
+	return b
+}
+
+func (s *testSerial) Poll(reply Byte) (Byte, bool) {
+	if s.clock == nil {
+		return 0, false
+	}
+	b := *s.clock
+	s.clock = nil
+	s.out = append(s.out, reply)
+	return b, true
+}
+
+// runSerial steps the cpu till the transfer completes and returns the cycles
+// it took. The interrupt it requests is dispatched by one more step, which
+// also runs the NOP at 0x58.
+func runSerial(t *testing.T, cpu *Cpu) uint64 {
+	start := cpu.cycles
+	for cpu.readByte(AddrSC)&0x80 != 0 {
+		if cpu.cycles-start > 70224 {
+			t.Fatal("transfer did not complete")
+		}
+		cpu.step(false, 0)
+	}
+	n := cpu.cycles - start
+	cpu.step(false, 0)
+	return n
+}
+
+func TestSerialInternalClock(t *testing.T) {
+	cpu := newFrameCpu(t)
+	defer cpu.RunCommand(CmdStop, nil)
+	link := &testSerial{in: []Byte{0x34}}
+	cpu.link = link
+	cpu.writeByte(AddrIE, Byte(InterruptSerial))
+	cpu.writeByte(AddrSB, Byte(0x12))
+	cpu.writeByte(AddrSC, Byte(0x81))
+	if n := runSerial(t, cpu); n < 4096 || n > 4096+24 {
+		t.Errorf("%d cycles", n)
+	}
+	if len(link.out) != 1 || link.out[0] != 0x12 {
+		t.Errorf("sent % X", link.out)
+	}
+	if sb := cpu.readByte(AddrSB); sb != 0x34 {
+		t.Errorf("received 0x%02X", sb)
+	}
+	if pc := cpu.pc.Word(); pc != 0x59 {
+		t.Errorf("no interrupt, pc 0x%04X", pc)
+	}
+	if sc := cpu.readByte(AddrSC); sc != 0x7F {
+		t.Errorf("SC 0x%02X", sc)
+	}
+}
+
+func TestSerialExternalClock(t *testing.T) {
+	cpu := newFrameCpu(t)
+	defer cpu.RunCommand(CmdStop, nil)
+	link := &testSerial{}
+	cpu.link = link
+	cpu.writeByte(AddrIE, Byte(InterruptSerial))
+	cpu.writeByte(AddrSB, Byte(0x12))
+	cpu.writeByte(AddrSC, Byte(0x80))
+	runFrame(cpu)
+	if cpu.readByte(AddrSC)&0x80 == 0 || len(link.out) != 0 {
+		t.Fatal("completed without a clock")
+	}
+	b := Byte(0x56)
+	link.clock = &b
+	runSerial(t, cpu)
+	if len(link.out) != 1 || link.out[0] != 0x12 {
+		t.Errorf("sent % X", link.out)
+	}
+	if sb := cpu.readByte(AddrSB); sb != 0x56 {
+		t.Errorf("received 0x%02X", sb)
+	}
+	if pc := cpu.pc.Word(); pc != 0x59 {
+		t.Errorf("no interrupt, pc 0x%04X", pc)
+	}
+}
+
+func TestSerialConn(t *testing.T) {
+	ca, cb := net.Pipe()
+	a, b := NewSerialConn(ca), NewSerialConn(cb)
+	resp := make(chan Byte)
+	go func() {
+		resp <- a.Transfer(0x12)
+	}()
+	var in Byte
+	for ok := false; !ok; {
+		in, ok = b.Poll(0x34)
+	}
+	if in != 0x12 {
+		t.Errorf("b received 0x%02X", in)
+	}
+	if r := <-resp; r != 0x34 {
+		t.Errorf("a received 0x%02X", r)
+	}
+	b.Close()
+	if r := a.Transfer(0x12); r != 0xFF {
+		t.Errorf("disconnected 0x%02X", r)
+	}
+}
+
+func TestSerialCapture(t *testing.T) {
+	cpu := newFrameCpu(t)
+	defer cpu.RunCommand(CmdStop, nil)
+	var out bytes.Buffer
+	capture := NewSerialCapture(&out)
+	cpu.link = capture
+	for _, c := range "ok\n" {
+		cpu.writeByte(AddrSB, Byte(c))
+		cpu.writeByte(AddrSC, Byte(0x81))
+		runSerial(t, cpu)
+		if sb := cpu.readByte(AddrSB); sb != 0xFF {
+			t.Errorf("received 0x%02X", sb)
+		}
+	}
+	if s := capture.String(); s != "ok\n" || out.String() != s {
+		t.Errorf("%q %q", s, out.String())
+	}
+}
+
+func TestSerialRecordReplay(t *testing.T) {
+	// a transfer the gameboy clocks, then one the other side clocks
+	// and returns the bytes received
+	exchange := func(cpu *Cpu, clock func()) [2]Byte {
+		cpu.writeByte(AddrSB, Byte(0x12))
+		cpu.writeByte(AddrSC, Byte(0x81))
+		runSerial(t, cpu)
+		first := cpu.readByte(AddrSB)
+		cpu.writeByte(AddrSB, Byte(0x78))
+		cpu.writeByte(AddrSC, Byte(0x80))
+		runFrame(cpu)
+		clock()
+		runSerial(t, cpu)
+		return [2]Byte{first, cpu.readByte(AddrSB)}
+	}
+
+	cpu := newFrameCpu(t)
+	defer cpu.RunCommand(CmdStop, nil)
+	link := &testSerial{in: []Byte{0x34}}
+	rec := NewSerialRecorder(link)
+	cpu.link = rec
+	exchange(cpu, func() {
+		b := Byte(0x56)
+		link.clock = &b
+	})
+	var log bytes.Buffer
+	if _, err := rec.WriteTo(&log); err != nil {
+		t.Fatal(err)
+	}
+	events, err := ReadSerialLog(&log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rec.Events()
+	if len(want) != 2 || !want[0].Clocked || want[0].Out != 0x12 || want[0].In != 0x34 ||
+		want[1].Clocked || want[1].Out != 0x78 || want[1].In != 0x56 ||
+		want[1].Cycle <= want[0].Cycle {
+		t.Fatalf("recorded %+v", want)
+	}
+	if len(events) != 2 || events[0] != want[0] || events[1] != want[1] {
+		t.Errorf("read %+v", events)
+	}
+
+	cpu = newFrameCpu(t)
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.link = NewSerialReplay(events)
+	sb := exchange(cpu, func() {
+		if cpu.cycles >= events[1].Cycle || cpu.readByte(AddrSC)&0x80 == 0 {
+			t.Error("clocked in early")
+		}
+	})
+	if sb != [2]Byte{0x34, 0x56} {
+		t.Errorf("received % X", sb)
+	}
+	if cpu.cycles < events[1].Cycle {
+		t.Errorf("clocked in at %d, recorded at %d", cpu.cycles, events[1].Cycle)
+	}
+	if _, err := ReadSerialLog(bytes.NewBufferString("12 X 00 00\n")); err == nil {
+		t.Error("read an invalid kind")
+	}
+}
@@ -0,0 +1,167 @@
+package jibi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// A SerialEvent is a byte exchanged over the link port at a point in
+// emulation time. Cycle counts clock cycles since power on, like
+// InputEvent. Clocked is set when the gameboy clocked the transfer and unset
+// when the other side did. Out is the byte the gameboy shifted out and In
+// the byte it shifted in.
+type SerialEvent struct {
+	Cycle   uint64
+	Clocked bool
+	Out, In Byte
+}
+
+// a serialTimed device is told the cpu cycle before every Transfer and Poll
+type serialTimed interface {
+	serialCycle(cycle uint64)
+}
+
+// linkCycle tells the device on the link port the cycle, if it wants it.
+func (c *Cpu) linkCycle() {
+	if d, ok := c.link.(serialTimed); ok {
+		d.serialCycle(c.cycles)
+	}
+}
+
+// A SerialRecorder is a SerialDevice that records every byte exchanged with
+// the device it wraps, to be replayed by a SerialReplay.
+type SerialRecorder struct {
+	dev    SerialDevice
+	lock   sync.Mutex
+	cycle  uint64
+	events []SerialEvent
+}
+
+// NewSerialRecorder returns a recorder for the link to dev.
+func NewSerialRecorder(dev SerialDevice) *SerialRecorder {
+	return &SerialRecorder{dev: dev}
+}
+
+func (r *SerialRecorder) serialCycle(cycle uint64) {
+	r.cycle = cycle
+	if d, ok := r.dev.(serialTimed); ok {
+		d.serialCycle(cycle)
+	}
+}
+
+func (r *SerialRecorder) Transfer(out Byte) Byte {
+	in := r.dev.Transfer(out)
+	r.record(SerialEvent{r.cycle, true, out, in})
+	return in
+}
+
+func (r *SerialRecorder) Poll(reply Byte) (Byte, bool) {
+	in, ok := r.dev.Poll(reply)
+	if ok {
+		r.record(SerialEvent{r.cycle, false, reply, in})
+	}
+	return in, ok
+}
+
+func (r *SerialRecorder) record(e SerialEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, e)
+}
+
+// Events returns the bytes exchanged so far.
+func (r *SerialRecorder) Events() []SerialEvent {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]SerialEvent(nil), r.events...)
+}
+
+// WriteTo writes the bytes exchanged so far as a serial log, one event per
+// line: the cycle, T for a transfer the gameboy clocked or P for one the
+// other side clocked, and the bytes sent and received in hex.
+func (r *SerialRecorder) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, e := range r.Events() {
+		kind := 'P'
+		if e.Clocked {
+			kind = 'T'
+		}
+		m, err := fmt.Fprintf(w, "%d %c %02X %02X\n", e.Cycle, kind, e.Out, e.In)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadSerialLog reads a serial log written by SerialRecorder.WriteTo.
+func ReadSerialLog(r io.Reader) ([]SerialEvent, error) {
+	var events []SerialEvent
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		var e SerialEvent
+		var kind rune
+		_, err := fmt.Sscanf(s.Text(), "%d %c %X %X",
+			&e.Cycle, &kind, &e.Out, &e.In)
+		if err != nil {
+			return nil, fmt.Errorf("serial log line %d: %s", line, err)
+		}
+		switch kind {
+		case 'T':
+			e.Clocked = true
+		case 'P':
+		default:
+			return nil, fmt.Errorf("serial log line %d: invalid kind %c", line, kind)
+		}
+		events = append(events, e)
+	}
+	return events, s.Err()
+}
+
+// A SerialReplay is a SerialDevice that plays back the other side of a
+// recorded link. Transfers the gameboy clocks are answered with the bytes
+// recorded for them, in order. Transfers the other side clocked are clocked
+// in again once the cpu reaches their cycle, but never ahead of a transfer
+// recorded before them that the gameboy has not clocked yet, and are dropped
+// when the gameboy clocks one recorded after them first. Once the recording
+// runs out the link port is empty.
+type SerialReplay struct {
+	events []SerialEvent
+	cycle  uint64
+}
+
+// NewSerialReplay returns a replay of events, as recorded by a
+// SerialRecorder.
+func NewSerialReplay(events []SerialEvent) *SerialReplay {
+	return &SerialReplay{events: append([]SerialEvent(nil), events...)}
+}
+
+func (r *SerialReplay) serialCycle(cycle uint64) {
+	r.cycle = cycle
+}
+
+func (r *SerialReplay) Transfer(out Byte) Byte {
+	for i, e := range r.events {
+		if e.Clocked {
+			r.events = r.events[i+1:]
+			return e.In
+		}
+	}
+	r.events = nil
+	return 0xFF
+}
+
+func (r *SerialReplay) Poll(reply Byte) (Byte, bool) {
+	if len(r.events) == 0 {
+		return 0, false
+	}
+	e := r.events[0]
+	if e.Clocked || e.Cycle > r.cycle {
+		return 0, false
+	}
+	r.events = r.events[1:]
+	return e.In, true
+}
@@ -0,0 +1,136 @@
+package jibi
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// messages between two ends of a SerialConn, each is the kind followed by a
+// data byte
+const (
+	serialClocked = 'T' // the sender clocked a transfer, reply expected
+	serialReply   = 'R' // the reply to a transfer
+)
+
+// serialTimeout is how long Transfer waits for the other side, which may be
+// paused or gone, before it sees a floating data line
+const serialTimeout = time.Second
+
+// A SerialConn is a link cable to another Jibi over a network connection.
+// Either side may clock a transfer. Transfers clocked by both sides at once
+// read 0xFF on each side.
+type SerialConn struct {
+	conn    net.Conn
+	wlock   sync.Mutex
+	clocked chan Byte // transfers clocked by the other side
+	replies chan Byte // replies to transfers clocked by this side
+}
+
+// NewSerialConn returns a link cable over conn.
+func NewSerialConn(conn net.Conn) *SerialConn {
+	s := &SerialConn{
+		conn:    conn,
+		clocked: make(chan Byte, 1),
+		replies: make(chan Byte, 1),
+	}
+	go s.read()
+	return s
+}
+
+// DialSerial connects a link cable to the Jibi listening at addr.
+func DialSerial(addr string) (*SerialConn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewSerialConn(conn), nil
+}
+
+// ListenSerial waits for a Jibi to connect a link cable at addr.
+func ListenSerial(addr string) (*SerialConn, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewSerialConn(conn), nil
+}
+
+func (s *SerialConn) read() {
+	defer close(s.clocked)
+	defer close(s.replies)
+	b := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(s.conn, b); err != nil {
+			return
+		}
+		switch b[0] {
+		case serialClocked:
+			s.clocked <- Byte(b[1])
+		case serialReply:
+			s.replies <- Byte(b[1])
+		default:
+			return
+		}
+	}
+}
+
+func (s *SerialConn) send(kind byte, b Byte) error {
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+	_, err := s.conn.Write([]byte{kind, byte(b)})
+	return err
+}
+
+// Transfer sends out to the other side and waits for its reply.
+func (s *SerialConn) Transfer(out Byte) Byte {
+	// drop replies that came after their transfer timed out
+	for len(s.replies) > 0 {
+		<-s.replies
+	}
+	if s.send(serialClocked, out) != nil {
+		return 0xFF
+	}
+	timeout := time.NewTimer(serialTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case in, ok := <-s.replies:
+			if !ok {
+				return 0xFF
+			}
+			return in
+		case _, ok := <-s.clocked:
+			if !ok {
+				return 0xFF
+			}
+			// both sides clocked, neither drives the data line
+			s.send(serialReply, 0xFF)
+		case <-timeout.C:
+			return 0xFF
+		}
+	}
+}
+
+// Poll replies to a transfer clocked by the other side, if there is one.
+func (s *SerialConn) Poll(reply Byte) (Byte, bool) {
+	select {
+	case in, ok := <-s.clocked:
+		if ok && s.send(serialReply, reply) == nil {
+			return in, true
+		}
+	default:
+	}
+	return 0, false
+}
+
+// Close disconnects the cable.
+func (s *SerialConn) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,103 @@
+package jibi
+
+// sgb commands
+const (
+	sgbPal01   Byte = 0x00 // set palettes 0 and 1
+	sgbPal23   Byte = 0x01
+	sgbPal03   Byte = 0x02
+	sgbPal12   Byte = 0x03
+	sgbAttrBlk Byte = 0x04 // palettes of blocks of the screen
+	sgbAttrLin Byte = 0x05 // palettes of rows and columns
+	sgbAttrDiv Byte = 0x06 // palettes of the two sides of a line
+	sgbAttrChr Byte = 0x07 // palettes of single cells
+	sgbPalSet  Byte = 0x0A // apply system palettes and an attribute file
+	sgbPalTrn  Byte = 0x0B // transfer system palettes
+	sgbMltReq  Byte = 0x11 // multiplayer request
+	sgbChrTrn  Byte = 0x13 // transfer border tiles
+	sgbPctTrn  Byte = 0x14 // transfer the border map and palettes
+	sgbAttrTrn Byte = 0x15 // transfer attribute files
+	sgbMaskEn  Byte = 0x17 // freeze or blank the screen
+)
+
+// An sgbReceiver decodes sgb command packets sent bit by bit over P14/P15.
+// A packet starts with a reset pulse (both low), then 128 data bits, lsb
+// first, where P14 low is a 0 and P15 low is a 1, each followed by both high.
+// A 0 stop bit ends the packet. The low 3 bits of the first byte of a command
+// are the number of packets it spans.
+type sgbReceiver struct {
+	packet []Byte
+	bit    int  // bits received, -1 while waiting for a reset pulse
+	ready  bool // lines were released since the last pulse
+	data   []Byte
+}
+
+func newSgbReceiver() *sgbReceiver {
+	return &sgbReceiver{packet: make([]Byte, 16), bit: -1}
+}
+
+// write handles a P1 write and returns a command once all its packets are
+// complete.
+func (s *sgbReceiver) write(p1 Byte) []Byte {
+	switch p1 & 0x30 {
+	case 0x00:
+		s.bit = 0
+		s.ready = false
+		s.packet = make([]Byte, 16)
+	case 0x30:
+		s.ready = true
+	default:
+		if s.bit < 0 || !s.ready {
+			return nil
+		}
+		s.ready = false
+		one := p1&0x30 == 0x10
+		if s.bit == 128 {
+			s.bit = -1
+			if one {
+				return nil // bad stop bit
+			}
+			return s.command(s.packet)
+		}
+		if one {
+			s.packet[s.bit/8] |= 1 << uint(s.bit%8)
+		}
+		s.bit++
+	}
+	return nil
+}
+
+// command collects the packets of a command and returns it once complete.
+func (s *sgbReceiver) command(packet []Byte) []Byte {
+	s.data = append(s.data, packet...)
+	n := int(s.data[0] & 0x07)
+	if n == 0 {
+		n = 1
+	}
+	if len(s.data) < n*16 {
+		return nil
+	}
+	data := s.data
+	s.data = nil
+	return data
+}
+
+// sgbWrite feeds a P1 write to the packet receiver, runs completed commands
+// and selects the next multiplayer controller.
+func (k *Keypad) sgbWrite(b Byte) {
+	if data := k.sgb.write(b); data != nil {
+		switch data[0] >> 3 {
+		case sgbMltReq:
+			k.players = []int{1, 2, 1, 4}[data[1]&0x03]
+			k.player = 0
+		default:
+			if k.screen != nil {
+				k.screen.command(data)
+			}
+		}
+	}
+	// releasing both lines selects the next controller
+	if b&0x30 == 0x30 && k.p1&0x30 != 0x30 && k.players > 1 {
+		k.player = (k.player + 1) % k.players
+	}
+	k.p1 = b
+}
@@ -0,0 +1,196 @@
+package jibi
+
+import (
+	"testing"
+)
+
+// sgbPacketWrites returns the P1 writes sending a 16 byte packet the way
+// the sgb bios expects.
+func sgbPacketWrites(packet []Byte) []Byte {
+	w := []Byte{0x00, 0x30}
+	for i := 0; i < 128; i++ {
+		if packet[i/8]>>uint(i%8)&0x01 != 0 {
+			w = append(w, 0x10, 0x30)
+		} else {
+			w = append(w, 0x20, 0x30)
+		}
+	}
+	return append(w, 0x20, 0x30)
+}
+
+// sendSgbPacket writes a 16 byte packet to r and returns the command it
+// completed.
+func sendSgbPacket(r *sgbReceiver, packet []Byte) []Byte {
+	var data []Byte
+	for _, b := range sgbPacketWrites(packet) {
+		if d := r.write(b); d != nil {
+			data = d
+		}
+	}
+	return data
+}
+
+func TestSgbReceiver(t *testing.T) {
+	r := newSgbReceiver()
+	first := make([]Byte, 16)
+	first[0] = sgbAttrBlk<<3 | 2
+	second := make([]Byte, 16)
+	second[0] = 0x42
+	if data := sendSgbPacket(r, first); data != nil {
+		t.Fatal("command after the first of 2 packets")
+	}
+	data := sendSgbPacket(r, second)
+	if len(data) != 32 || data[0] != first[0] || data[16] != 0x42 {
+		t.Errorf("% X", data)
+	}
+}
+
+func TestSgbScreen(t *testing.T) {
+	s := newSgbScreen()
+	pal := make([]Byte, 16)
+	pal[0] = sgbPal01<<3 | 1
+	pal[1], pal[2] = 0x1F, 0x00  // color 0 red
+	pal[9], pal[10] = 0xE0, 0x03 // palette 1 color 1 green
+	s.command(pal)
+
+	// palette 1 inside cells 2-4, 1-3 and on their edge
+	blk := make([]Byte, 16)
+	blk[0] = sgbAttrBlk<<3 | 1
+	blk[1] = 1
+	copy(blk[2:], []Byte{0x01, 0x01, 2, 1, 4, 3})
+	s.command(blk)
+	line := make([]Byte, lcdWidth)
+	line[8*2] = 1
+	line[8*3] = 1 | pixelObj
+	line[8*5] = 1
+	c := s.colorLine(8, line)
+	if c[0] != 0x001F || c[8*2] != 0x03E0 || c[8*3] != 0x03E0 || c[8*5] != 0 {
+		t.Errorf("%04X %04X %04X %04X", c[0], c[8*2], c[8*3], c[8*5])
+	}
+
+	// frozen lines keep showing
+	mask := make([]Byte, 16)
+	mask[0] = sgbMaskEn<<3 | 1
+	mask[1] = sgbMaskFreeze
+	s.command(mask)
+	if c := s.colorLine(8, make([]Byte, lcdWidth)); c[0] != 0x001F || c[8*2] != 0x03E0 {
+		t.Errorf("frozen %04X %04X", c[0], c[8*2])
+	}
+	mask[1] = sgbMaskBlack
+	s.command(mask)
+	if c := s.colorLine(8, line); c[0] != 0 {
+		t.Errorf("black %04X", c[0])
+	}
+}
+
+func TestSgbBorder(t *testing.T) {
+	s := newSgbScreen()
+	// tile 1 is color 1 in every pixel
+	chr := make([]Byte, 16)
+	chr[0] = sgbChrTrn<<3 | 1
+	s.command(chr)
+	if !s.pendingTransfer() {
+		t.Fatal("no transfer pending")
+	}
+	data := make([]Byte, 0x1000)
+	for i := 32; i < 32+16; i += 2 {
+		data[i] = 0xFF
+	}
+	s.transfer(data)
+
+	// tile 1 in the top left with border palette 4
+	pct := make([]Byte, 16)
+	pct[0] = sgbPctTrn<<3 | 1
+	s.command(pct)
+	data = make([]Byte, 0x1000)
+	data[0], data[1] = 1, 0x00
+	data[0x800+2], data[0x800+3] = 0x00, 0x7C // palette 4 color 1 blue
+	s.transfer(data)
+	if s.pendingTransfer() {
+		t.Fatal("transfer still pending")
+	}
+
+	screen := make([]Word, lcdWidth)
+	for i := range screen {
+		screen[i] = 0x1234
+	}
+	top := s.borderLine(0, nil)
+	if len(top) != sgbWidth || top[0] != 0x7C00 || top[8] != dmgShades[0] {
+		t.Errorf("top %04X %04X", top[0], top[8])
+	}
+	row := s.borderLine(sgbScreenY, screen)
+	if row[sgbScreenX-1] != dmgShades[0] || row[sgbScreenX] != 0x1234 ||
+		row[sgbScreenX+int(lcdWidth)] != dmgShades[0] {
+		t.Errorf("row %04X", row[sgbScreenX-1:sgbScreenX+1])
+	}
+}
+
+func TestSgbMultiplayer(t *testing.T) {
+	mmu := NewMmu(nil, false)
+	keys := make([]map[Key]valueChan, sgbPlayers)
+	for i := range keys {
+		keys[i] = newKeys()
+	}
+	kp := &Keypad{
+		mmu:     mmu,
+		keys:    keys,
+		p1:      0x30,
+		players: 1,
+		sgb:     newSgbReceiver(),
+	}
+	p1 := func(b Byte) Byte {
+		kp.writeP1(b)
+		return mmu.Read(AddrP1) & 0x0F
+	}
+	mltReq := func(n Byte) {
+		packet := make([]Byte, 16)
+		packet[0] = sgbMltReq<<3 | 1
+		packet[1] = n
+		for _, b := range sgbPacketWrites(packet) {
+			kp.writeP1(b)
+		}
+	}
+	kp.keys[2][KeyA] = valueChan{0, kp.keys[2][KeyA].c}
+
+	// one controller, other players are not read
+	if b := p1(0x30); b != 0x0F {
+		t.Errorf("single id %X", b)
+	}
+	if b := p1(0x10); b != 0x0F {
+		t.Errorf("single buttons %X", b)
+	}
+
+	// four controllers, releasing both lines selects the next one
+	mltReq(0x03)
+	if kp.players != 4 {
+		t.Fatalf("%d players", kp.players)
+	}
+	first := kp.player
+	for i := 0; i < 2*sgbPlayers; i++ {
+		want := (first + i) % sgbPlayers
+		if b := p1(0x30); kp.player != want || b != Byte(0x0F-want) {
+			t.Fatalf("%d: player %d id %X, not %d", i, kp.player, b, want)
+		}
+		if pressed := p1(0x10) != 0x0F; pressed != (want == 2) {
+			t.Errorf("player %d reads a as pressed %v", want, pressed)
+		}
+	}
+
+	// two controllers alternate
+	mltReq(0x01)
+	seen := map[int]bool{}
+	for i := 0; i < 4; i++ {
+		seen[kp.player] = true
+		p1(0x10)
+		p1(0x30)
+	}
+	if len(seen) != 2 || !seen[0] || !seen[1] {
+		t.Errorf("two players selected %v", seen)
+	}
+
+	// back to one
+	mltReq(0x00)
+	if kp.player != 0 || p1(0x30) != 0x0F {
+		t.Errorf("player %d after the request for one", kp.player)
+	}
+}
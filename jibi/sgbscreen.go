@@ -0,0 +1,356 @@
+package jibi
+
+import (
+	"sync"
+)
+
+// the super gameboy picture is 256x224 with the gameboy screen at 48,40
+const (
+	sgbWidth   = 256
+	sgbHeight  = 224
+	sgbScreenX = 48
+	sgbScreenY = 40
+)
+
+// the screen is colored in 8x8 cells
+const (
+	sgbCellsX = 20
+	sgbCellsY = 18
+)
+
+// sgbTransparent marks border pixels that show the screen color 0
+const sgbTransparent Word = 0xFFFF
+
+// sgb MASK_EN modes
+const (
+	sgbMaskOff    = 0
+	sgbMaskFreeze = 1
+	sgbMaskBlack  = 2
+	sgbMaskColor0 = 3
+)
+
+// An sgbScreen is what the super gameboy makes of the gameboy screen. The
+// keypad runs the commands sent over P1 and the gpu colors lines with it and
+// does the vram transfers commands ask for.
+type sgbScreen struct {
+	lock sync.Mutex
+
+	pals    [4][4]Word // color 0 is shared by all 4
+	attr    [sgbCellsX * sgbCellsY]Byte
+	mask    Byte
+	frozen  [][]Word // lines shown while frozen
+	sysPals []Byte   // 512 palettes of 4 colors from PAL_TRN
+	files   []Byte   // 45 attribute files from ATTR_TRN
+
+	// the border, drawn around the screen when it is shown
+	tiles      []Byte // 256 4bpp snes tiles
+	borderMap  []Byte // 32x28 tiles, tile number and attributes
+	borderPals [4][16]Word
+	border     []Word // sgbWidth*sgbHeight rendered from the above
+
+	trn Byte // vram transfer pending for the next frame
+	chr Byte // tile half CHR_TRN is loading
+}
+
+func newSgbScreen() *sgbScreen {
+	s := &sgbScreen{
+		sysPals:   make([]Byte, 0x1000),
+		files:     make([]Byte, 0xFD2),
+		tiles:     make([]Byte, 256*32),
+		borderMap: make([]Byte, 32*28*2),
+		border:    make([]Word, sgbWidth*sgbHeight),
+		trn:       0xFF,
+	}
+	s.frozen = make([][]Word, lcdHeight)
+	for i := range s.frozen {
+		s.frozen[i] = make([]Word, lcdWidth)
+	}
+	for i := range s.pals {
+		s.pals[i] = dmgShades
+	}
+	for i := range s.border {
+		s.border[i] = sgbTransparent
+	}
+	return s
+}
+
+// command runs a command made of one or more packets.
+func (s *sgbScreen) command(data []Byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch cmd := data[0] >> 3; cmd {
+	case sgbPal01:
+		s.setPals(0, 1, data)
+	case sgbPal23:
+		s.setPals(2, 3, data)
+	case sgbPal03:
+		s.setPals(0, 3, data)
+	case sgbPal12:
+		s.setPals(1, 2, data)
+	case sgbAttrBlk:
+		s.attrBlk(data)
+	case sgbAttrLin:
+		s.attrLin(data)
+	case sgbAttrDiv:
+		s.attrDiv(data)
+	case sgbAttrChr:
+		s.attrChr(data)
+	case sgbPalSet:
+		s.palSet(data)
+	case sgbPalTrn, sgbAttrTrn, sgbPctTrn:
+		s.trn = cmd
+	case sgbChrTrn:
+		s.trn = cmd
+		s.chr = data[1] & 0x01
+	case sgbMaskEn:
+		s.mask = data[1] & 0x03
+	}
+}
+
+func sgbColor(lo, hi Byte) Word {
+	return Word(lo) | Word(hi&0x7F)<<8
+}
+
+// setPals sets colors 1-3 of palettes a and b and the shared color 0.
+func (s *sgbScreen) setPals(a, b int, data []Byte) {
+	c0 := sgbColor(data[1], data[2])
+	for i := range s.pals {
+		s.pals[i][0] = c0
+	}
+	for i := 0; i < 3; i++ {
+		s.pals[a][i+1] = sgbColor(data[3+i*2], data[4+i*2])
+		s.pals[b][i+1] = sgbColor(data[9+i*2], data[10+i*2])
+	}
+}
+
+func (s *sgbScreen) setAttr(x, y int, pal Byte) {
+	if x >= 0 && x < sgbCellsX && y >= 0 && y < sgbCellsY {
+		s.attr[y*sgbCellsX+x] = pal & 0x03
+	}
+}
+
+// attrBlk colors the inside, the surrounding line and the outside of blocks.
+// When only one of inside and outside is set the line takes its palette.
+func (s *sgbScreen) attrBlk(data []Byte) {
+	n := int(data[1] & 0x1F)
+	for i := 0; i < n && 2+i*6+6 <= len(data); i++ {
+		b := data[2+i*6:]
+		ctrl, pals := b[0]&0x07, b[1]
+		in, line, out := pals&0x03, pals>>2&0x03, pals>>4&0x03
+		if ctrl == 0x01 {
+			ctrl, line = 0x03, in
+		} else if ctrl == 0x04 {
+			ctrl, line = 0x06, out
+		}
+		x1, y1 := int(b[2]&0x1F), int(b[3]&0x1F)
+		x2, y2 := int(b[4]&0x1F), int(b[5]&0x1F)
+		for y := 0; y < sgbCellsY; y++ {
+			for x := 0; x < sgbCellsX; x++ {
+				inside := x > x1 && x < x2 && y > y1 && y < y2
+				onLine := !inside && x >= x1 && x <= x2 && y >= y1 && y <= y2
+				if inside && ctrl&0x01 != 0 {
+					s.setAttr(x, y, in)
+				} else if onLine && ctrl&0x02 != 0 {
+					s.setAttr(x, y, line)
+				} else if !inside && !onLine && ctrl&0x04 != 0 {
+					s.setAttr(x, y, out)
+				}
+			}
+		}
+	}
+}
+
+// attrLin colors whole rows (bit 7 set) or columns.
+func (s *sgbScreen) attrLin(data []Byte) {
+	n := int(data[1])
+	for i := 0; i < n && 2+i < len(data); i++ {
+		b := data[2+i]
+		line, pal := int(b&0x1F), b>>5&0x03
+		if b&0x80 != 0 {
+			for x := 0; x < sgbCellsX; x++ {
+				s.setAttr(x, line, pal)
+			}
+		} else {
+			for y := 0; y < sgbCellsY; y++ {
+				s.setAttr(line, y, pal)
+			}
+		}
+	}
+}
+
+// attrDiv colors the two sides of a row (bit 6 set) or column, and the line.
+func (s *sgbScreen) attrDiv(data []Byte) {
+	after, before, on := data[1]&0x03, data[1]>>2&0x03, data[1]>>4&0x03
+	div := int(data[2] & 0x1F)
+	for y := 0; y < sgbCellsY; y++ {
+		for x := 0; x < sgbCellsX; x++ {
+			c := x
+			if data[1]&0x40 != 0 {
+				c = y
+			}
+			switch {
+			case c < div:
+				s.setAttr(x, y, before)
+			case c == div:
+				s.setAttr(x, y, on)
+			default:
+				s.setAttr(x, y, after)
+			}
+		}
+	}
+}
+
+// attrChr colors cells one after another from x,y, 4 per byte msb first,
+// left to right or top to bottom.
+func (s *sgbScreen) attrChr(data []Byte) {
+	x, y := int(data[1]&0x1F), int(data[2]&0x1F)
+	n := int(data[3]) | int(data[4]&0x01)<<8
+	down := data[5]&0x01 != 0
+	for i := 0; i < n && 6+i/4 < len(data); i++ {
+		s.setAttr(x, y, data[6+i/4]>>uint(6-2*(i%4)))
+		if down {
+			if y++; y == sgbCellsY {
+				y = 0
+				x++
+			}
+		} else {
+			if x++; x == sgbCellsX {
+				x = 0
+				y++
+			}
+		}
+	}
+}
+
+// palSet loads 4 system palettes and optionally an attribute file, and may
+// cancel the mask.
+func (s *sgbScreen) palSet(data []Byte) {
+	for i := range s.pals {
+		n := (int(data[1+i*2]) | int(data[2+i*2]&0x01)<<8) * 8
+		for c := range s.pals[i] {
+			s.pals[i][c] = sgbColor(s.sysPals[n+c*2], s.sysPals[n+c*2+1])
+		}
+	}
+	// color 0 of palette 0 is shared
+	for i := range s.pals {
+		s.pals[i][0] = s.pals[0][0]
+	}
+	if f := int(data[9] & 0x3F); data[9]&0x80 != 0 && f < 45 {
+		s.loadAttrFile(f)
+	}
+	if data[9]&0x40 != 0 {
+		s.mask = sgbMaskOff
+	}
+}
+
+// loadAttrFile sets the cells from an attribute file, 90 bytes of 4 cells
+// each, msb first.
+func (s *sgbScreen) loadAttrFile(f int) {
+	file := s.files[f*90:]
+	for i := range s.attr {
+		s.attr[i] = file[i/4] >> uint(6-2*(i%4)) & 0x03
+	}
+}
+
+// pendingTransfer returns whether a command waits for vram data.
+func (s *sgbScreen) pendingTransfer() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.trn != 0xFF
+}
+
+// transfer hands the 4KB the gameboy shows to the pending command.
+func (s *sgbScreen) transfer(data []Byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch s.trn {
+	case sgbPalTrn:
+		copy(s.sysPals, data)
+	case sgbAttrTrn:
+		copy(s.files, data)
+	case sgbChrTrn:
+		copy(s.tiles[int(s.chr)*0x1000:], data)
+		s.drawBorder()
+	case sgbPctTrn:
+		copy(s.borderMap, data)
+		for p := range s.borderPals {
+			for c := range s.borderPals[p] {
+				i := 0x800 + p*32 + c*2
+				s.borderPals[p][c] = sgbColor(data[i], data[i+1])
+			}
+		}
+		s.drawBorder()
+	}
+	s.trn = 0xFF
+}
+
+// drawBorder renders the border map. Color 0 is transparent and shows color
+// 0 of the screen palettes.
+func (s *sgbScreen) drawBorder() {
+	for y := 0; y < sgbHeight; y++ {
+		for x := 0; x < sgbWidth; x++ {
+			e := (y/8*32 + x/8) * 2
+			tile, attr := int(s.borderMap[e]), s.borderMap[e+1]
+			tx, ty := x%8, y%8
+			if attr&0x40 != 0 {
+				tx = 7 - tx
+			}
+			if attr&0x80 != 0 {
+				ty = 7 - ty
+			}
+			t := s.tiles[tile*32:]
+			bit := uint(7 - tx)
+			c := t[ty*2]>>bit&0x01 | (t[ty*2+1]>>bit&0x01)<<1 |
+				(t[16+ty*2]>>bit&0x01)<<2 | (t[16+ty*2+1]>>bit&0x01)<<3
+			color := sgbTransparent
+			if c != 0 {
+				color = s.borderPals[attr>>2&0x03][c]
+			}
+			s.border[y*sgbWidth+x] = color
+		}
+	}
+}
+
+// colorLine colors line ly of shades with the palettes of its cells, or shows
+// what the mask asks for.
+func (s *sgbScreen) colorLine(ly Byte, line []Byte) []Word {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	colors := make([]Word, len(line))
+	switch s.mask {
+	case sgbMaskFreeze:
+		copy(colors, s.frozen[ly])
+		return colors
+	case sgbMaskBlack:
+		return colors
+	case sgbMaskColor0:
+		for i := range colors {
+			colors[i] = s.pals[0][0]
+		}
+		return colors
+	}
+	row := s.attr[int(ly)/8*sgbCellsX:]
+	for i, px := range line {
+		colors[i] = s.pals[row[i/8]][px&0x03]
+	}
+	copy(s.frozen[ly], colors)
+	return colors
+}
+
+// borderLine returns row y of the border with line, if not nil, in the
+// screen area. Transparent border pixels show color 0.
+func (s *sgbScreen) borderLine(y int, line []Word) []Word {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	out := make([]Word, sgbWidth)
+	copy(out, s.border[y*sgbWidth:])
+	for x, c := range out {
+		if c == sgbTransparent {
+			out[x] = s.pals[0][0]
+		}
+	}
+	if line != nil {
+		copy(out[sgbScreenX:sgbScreenX+int(lcdWidth)], line)
+	}
+	return out
+}
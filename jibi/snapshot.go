@@ -0,0 +1,60 @@
+package jibi
+
+// A VideoSnapshot is a copy of the video memory taken between two frames, so
+// tile, map and sprite viewers all see the same state.
+type VideoSnapshot struct {
+	Frame uint64 // frames completed before the snapshot
+	VRam  []Byte // 0x2000 bytes per bank, bank 1 follows bank 0 on cgb
+	Oam   []Byte
+	Regs  []Byte // 0xFF40-0xFF4B
+}
+
+func (g *Gpu) cmdSnapshot(resp interface{}) {
+	if resp, ok := resp.(chan VideoSnapshot); !ok {
+		panic("invalid command response type")
+	} else {
+		g.snapshots = append(g.snapshots, resp)
+	}
+}
+
+// takeSnapshots answers the pending snapshot requests, it runs once the
+// frame has been drawn.
+func (g *Gpu) takeSnapshots() {
+	if len(g.snapshots) == 0 {
+		return
+	}
+	banks := uint8(1)
+	if g.cgb {
+		banks = 2
+	}
+	s := VideoSnapshot{
+		Frame: g.frames,
+		VRam:  make([]Byte, 0, int(banks)*0x2000),
+		Oam:   make([]Byte, 0, AddrOamEnd-AddrOam),
+		Regs:  make([]Byte, 0, AddrGpuRegsEnd-AddrGpuRegs),
+	}
+	for bank := uint8(0); bank < banks; bank++ {
+		for a := AddrVRam; a < AddrERam; a++ {
+			s.VRam = append(s.VRam, g.readVRam(a, bank))
+		}
+	}
+	for a := AddrOam; a < AddrOamEnd; a++ {
+		s.Oam = append(s.Oam, g.readByte(a))
+	}
+	for a := AddrGpuRegs; a < AddrGpuRegsEnd; a++ {
+		s.Regs = append(s.Regs, g.readByte(a))
+	}
+	for _, resp := range g.snapshots {
+		resp <- s
+	}
+	g.snapshots = nil
+}
+
+// VideoSnapshot returns a copy of vram, oam and the gpu registers taken at
+// the end of the next frame. It blocks until the frame is done, so it never
+// returns while the Jibi is paused.
+func (j Jibi) VideoSnapshot() VideoSnapshot {
+	resp := make(chan VideoSnapshot, 1)
+	j.gpu.RunCommand(CmdSnapshot, resp)
+	return <-resp
+}
@@ -0,0 +1,34 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestVideoSnapshot(t *testing.T) {
+	for _, o := range []Options{{Skipbios: true}, {Skipbios: true, Cgb: true}} {
+		j, err := New(busyRom(), o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.Play()
+		banks := 1
+		if o.Cgb {
+			banks = 2
+		}
+		var last uint64
+		for i := 0; i < 3; i++ {
+			s := j.VideoSnapshot()
+			if i > 0 && s.Frame <= last {
+				t.Errorf("cgb:%t frame %d after %d", o.Cgb, s.Frame, last)
+			}
+			last = s.Frame
+			if len(s.VRam) != banks*0x2000 || len(s.Oam) != 0xA0 || len(s.Regs) != 12 {
+				t.Fatalf("cgb:%t lengths %d %d %d", o.Cgb, len(s.VRam), len(s.Oam), len(s.Regs))
+			}
+			if s.Regs[AddrLCDC-AddrGpuRegs] != 0x91 {
+				t.Errorf("cgb:%t LCDC 0x%02X", o.Cgb, s.Regs[AddrLCDC-AddrGpuRegs])
+			}
+		}
+		j.Stop()
+	}
+}
@@ -0,0 +1,138 @@
+package jibi
+
+// squareDuties are the 8 step waveforms of the square channels, 12.5%, 25%,
+// 50% and 75% high.
+var squareDuties = [4][8]Byte{
+	{0, 0, 0, 0, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0, 1, 1, 1},
+	{0, 1, 1, 1, 1, 1, 1, 0},
+}
+
+// a square is a square wave channel, channel 1 also sweeps its frequency
+type square struct {
+	on    bool
+	duty  Byte
+	freq  uint16 // 11 bits
+	timer uint32 // cycles until the next duty step
+	pos   uint8  // duty step
+	len   lengthCounter
+	env   envelope
+
+	sweeps      bool
+	sweepPeriod Byte
+	sweepDown   bool
+	sweepShift  Byte
+	sweepTimer  Byte
+	sweepOn     bool
+	shadow      uint16 // frequency the sweep works from
+}
+
+// period returns the cycles between two duty steps.
+func (s *square) period() uint32 {
+	return (2048 - uint32(s.freq)) * 4
+}
+
+func (s *square) dac() bool {
+	return s.env.dac()
+}
+
+// output returns the 4 bit output, 0 while the channel is off.
+func (s *square) output() Byte {
+	if !s.on {
+		return 0
+	}
+	return squareDuties[s.duty][s.pos] * s.env.volume
+}
+
+func (s *square) tick(n uint32) {
+	if s.timer == 0 {
+		s.timer = s.period()
+	}
+	for n >= s.timer {
+		n -= s.timer
+		s.timer = s.period()
+		s.pos = (s.pos + 1) % 8
+	}
+	s.timer -= n
+}
+
+// writeSweep sets the sweep from NR10.
+func (s *square) writeSweep(b Byte) {
+	s.sweepPeriod = b >> 4 & 0x07
+	s.sweepDown = b&0x08 != 0
+	s.sweepShift = b & 0x07
+}
+
+// writeDutyLength sets the duty and length from NRx1.
+func (s *square) writeDutyLength(b Byte) {
+	s.duty = b >> 6
+	s.len.n = 64 - int(b&0x3F)
+}
+
+// writeControl sets the high frequency bits and the length enable from NRx4
+// and triggers the channel if bit 7 is set.
+func (s *square) writeControl(b Byte, frameStep uint8) {
+	s.freq = s.freq&0xFF | uint16(b&0x07)<<8
+	s.len.enable(b&0x40 != 0, frameStep, &s.on)
+	if b&0x80 != 0 {
+		s.trigger(frameStep)
+	}
+}
+
+func (s *square) trigger(frameStep uint8) {
+	s.on = s.dac()
+	s.len.trigger(64, frameStep)
+	s.timer = s.period()
+	s.env.trigger()
+	if !s.sweeps {
+		return
+	}
+	s.shadow = s.freq
+	s.sweepTimer = s.sweepPeriod
+	if s.sweepTimer == 0 {
+		s.sweepTimer = 8
+	}
+	s.sweepOn = s.sweepPeriod != 0 || s.sweepShift != 0
+	if s.sweepShift != 0 {
+		s.sweepFreq()
+	}
+}
+
+// sweepFreq returns the next sweep frequency, turning the channel off if it
+// overflows 11 bits.
+func (s *square) sweepFreq() uint16 {
+	d := s.shadow >> s.sweepShift
+	f := s.shadow + d
+	if s.sweepDown {
+		f = s.shadow - d
+	}
+	if f > 2047 {
+		s.on = false
+	}
+	return f
+}
+
+func (s *square) clockSweep() {
+	if !s.sweeps {
+		return
+	}
+	if s.sweepTimer > 0 {
+		s.sweepTimer--
+	}
+	if s.sweepTimer != 0 {
+		return
+	}
+	s.sweepTimer = s.sweepPeriod
+	if s.sweepTimer == 0 {
+		s.sweepTimer = 8
+	}
+	if !s.sweepOn || s.sweepPeriod == 0 {
+		return
+	}
+	if f := s.sweepFreq(); f <= 2047 && s.sweepShift != 0 {
+		s.shadow = f
+		s.freq = f
+		s.sweepFreq()
+	}
+}
@@ -0,0 +1,625 @@
+package jibi
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"time"
+)
+
+// stateVersion changes whenever the save state layout does, older states are
+// refused rather than loaded wrong.
+const stateVersion = 5
+
+// Version is the version of the emulator. Save states record it, the
+// machine may not resume the same in another version.
+const Version = "0.2.0"
+
+// A machineState is everything a save state restores. It is gob encoded, so
+// the fields are exported even though the type is not.
+type machineState struct {
+	Version  int
+	Emulator string // Version of the emulator that saved it
+	Title    string
+	Checksum Word // global checksum of the cartridge header
+	Cpu      cpuState
+	Mmu      mmuState
+	Gpu      gpuState
+	Apu      apuState
+	Mapper   mapperState
+}
+
+type cpuState struct {
+	A, F, B, C, D, E, H, L Byte
+	SP, PC                 Word
+	Ime                    Bit
+	Ei                     uint8
+	Halted, HaltBug        bool
+	Locked                 bool
+	Div                    Word
+	Cycles, Instructions   uint64
+	BiosFinished           bool
+
+	// the oam dma and the link port transfer in progress
+	DmaActive     bool
+	DmaSrc, DmaN  Word
+	DmaT          int32
+	SioT, SioPoll uint32
+}
+
+// a gpuState is the gpu in the middle of its frame, the state it runs next
+// and the line it is drawing.
+type gpuState struct {
+	State      gpuStateID
+	First      bool
+	T, TNext   uint32
+	Playing    bool
+	Hblank     uint32
+	BlankFrame bool
+	SgbRow     int
+	Pipe       []int64 // see pixelPipe.regs
+	Line       []Byte
+}
+
+type apuState struct {
+	Regs     []Byte
+	Channels []int64 // see Apu.channelRegs
+}
+
+type mmuState struct {
+	VRam, Ram, Oam, Zero    []Byte
+	GpuRegs, CgbRegs        []Byte
+	IF, IE                  Byte
+	Sb, Sc                  Byte
+	Div, Tima, Tma, Tac     Byte
+	Key0, Vbk, Svbk, Boot   Byte
+	Opri, Rp                Byte
+	BgPalIndex, ObjPalIndex Byte
+	BgPal, ObjPal           []Byte
+	StatLine                bool
+}
+
+type mapperState struct {
+	Kind string // see mapperKind
+	Regs []int64
+	Ram  []Byte
+}
+
+// a stateMmu is an mmu that can be saved, between two steps of the scheduler
+type stateMmu interface {
+	saveState() mmuState
+	loadState(s mmuState)
+}
+
+// a stateMapper is a mapper with registers to save, its ram is saved through
+// batteryMapper
+type stateMapper interface {
+	mapperRegs() []int64
+	setMapperRegs(r []int64)
+}
+
+// mapperKind names the kind of a mapper, the registers saved from one kind
+// do not load into another.
+func mapperKind(m Mapper) string {
+	t := reflect.TypeOf(m)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// checkMapperState returns an error unless s was saved from a mapper of the
+// same kind as m, with as many registers as it has.
+func checkMapperState(m Mapper, s mapperState) error {
+	if k := mapperKind(m); s.Kind != k {
+		return fmt.Errorf("state of a %s mapper, not %s", s.Kind, k)
+	}
+	if sm, ok := m.(stateMapper); ok {
+		if n := len(sm.mapperRegs()); len(s.Regs) != n {
+			return fmt.Errorf("%d %s registers, not %d", len(s.Regs), s.Kind, n)
+		}
+	}
+	return nil
+}
+
+func copyBytes(b []Byte) []Byte {
+	c := make([]Byte, len(b))
+	copy(c, b)
+	return c
+}
+
+func (m *RomOnlyMmu) saveState() mmuState {
+	return mmuState{
+		VRam: copyBytes(m.vram), Ram: copyBytes(m.ram),
+		Oam: copyBytes(m.oam), Zero: copyBytes(m.zero),
+		GpuRegs: copyBytes(m.gpuregs), CgbRegs: copyBytes(m.cgbregs),
+		IF: m.iflag, IE: m.ie,
+		Sb: m.link.sb, Sc: m.link.sc,
+		Div: m.div, Tima: m.tima, Tma: m.tma, Tac: m.tac,
+		Key0: m.key0, Vbk: m.vbk, Svbk: m.svbk, Boot: m.boot, Opri: m.opri, Rp: m.rp,
+		BgPalIndex: m.bgPal.index, BgPal: copyBytes(m.bgPal.data),
+		ObjPalIndex: m.objPal.index, ObjPal: copyBytes(m.objPal.data),
+		StatLine: m.statLine,
+	}
+}
+
+func (m *RomOnlyMmu) loadState(s mmuState) {
+	copy(m.vram, s.VRam)
+	copy(m.ram, s.Ram)
+	copy(m.oam, s.Oam)
+	copy(m.zero, s.Zero)
+	copy(m.gpuregs, s.GpuRegs)
+	copy(m.cgbregs, s.CgbRegs)
+	m.iflag, m.ie = s.IF, s.IE
+	m.link.sb, m.link.sc = s.Sb, s.Sc
+	m.div, m.tima, m.tma, m.tac = s.Div, s.Tima, s.Tma, s.Tac
+	m.key0, m.vbk, m.svbk, m.boot = s.Key0, s.Vbk, s.Svbk, s.Boot
+	m.opri, m.rp = s.Opri, s.Rp
+	m.bgPal.index, m.objPal.index = s.BgPalIndex, s.ObjPalIndex
+	copy(m.bgPal.data, s.BgPal)
+	copy(m.objPal.data, s.ObjPal)
+	m.statLine = s.StatLine
+}
+
+func boolReg(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (m *mbc1) mapperRegs() []int64 {
+	return []int64{boolReg(m.ramEnabled), int64(m.bank1), int64(m.bank2), int64(m.mode)}
+}
+
+func (m *mbc1) setMapperRegs(r []int64) {
+	m.ramEnabled, m.bank1, m.bank2, m.mode = r[0] != 0, int(r[1]), int(r[2]), Byte(r[3])
+}
+
+func (m *mbc2) mapperRegs() []int64 {
+	return []int64{boolReg(m.ramEnabled), int64(m.romBank)}
+}
+
+func (m *mbc2) setMapperRegs(r []int64) {
+	m.ramEnabled, m.romBank = r[0] != 0, int(r[1])
+}
+
+func (m *mbc3) mapperRegs() []int64 {
+	m.update()
+	r := []int64{boolReg(m.ramEnabled), int64(m.romBank), int64(m.ramBank), int64(m.latch),
+		m.seconds, boolReg(m.halt), boolReg(m.carry)}
+	for _, b := range m.latched {
+		r = append(r, int64(b))
+	}
+	return r
+}
+
+// setMapperRegs restores the clock as it was saved, the time the state was
+// kept does not count.
+func (m *mbc3) setMapperRegs(r []int64) {
+	m.ramEnabled, m.romBank, m.ramBank, m.latch = r[0] != 0, int(r[1]), Byte(r[2]), Byte(r[3])
+	m.seconds, m.halt, m.carry = r[4], r[5] != 0, r[6] != 0
+	for i := range m.latched {
+		m.latched[i] = Byte(r[7+i])
+	}
+	m.at = m.clk.Now()
+}
+
+func (m *mbc5) mapperRegs() []int64 {
+	return []int64{boolReg(m.ramEnabled), int64(m.romBank), int64(m.ramBank)}
+}
+
+func (m *mbc5) setMapperRegs(r []int64) {
+	m.ramEnabled, m.romBank, m.ramBank = r[0] != 0, int(r[1]), int(r[2])
+}
+
+func (m *mbc7) mapperRegs() []int64 {
+	e := m.eeprom
+	return []int64{boolReg(m.ramEnable1), boolReg(m.ramEnable2), int64(m.bank),
+		boolReg(m.erased), int64(m.latchX), int64(m.latchY), int64(m.eepromR),
+		boolReg(e.cs), boolReg(e.clk), boolReg(e.do), boolReg(e.writable),
+		int64(e.state), int64(e.shift), int64(e.bits), int64(e.addr)}
+}
+
+func (m *mbc7) setMapperRegs(r []int64) {
+	m.ramEnable1, m.ramEnable2, m.bank = r[0] != 0, r[1] != 0, int(r[2])
+	m.erased, m.latchX, m.latchY, m.eepromR = r[3] != 0, Word(r[4]), Word(r[5]), Byte(r[6])
+	e := m.eeprom
+	e.cs, e.clk, e.do, e.writable = r[7] != 0, r[8] != 0, r[9] != 0, r[10] != 0
+	e.state, e.shift, e.bits, e.addr = eepromState(r[11]), uint32(r[12]), int(r[13]), int(r[14])
+}
+
+func (m *tama5) mapperRegs() []int64 {
+	return []int64{int64(m.reg), int64(m.romBank), int64(m.data), int64(m.addr),
+		int64(m.command), int64(m.read), int64(m.offset)}
+}
+
+func (m *tama5) setMapperRegs(r []int64) {
+	m.reg, m.romBank, m.data, m.addr = Byte(r[0]), int(r[1]), Byte(r[2]), Byte(r[3])
+	m.command, m.read, m.offset = Byte(r[4]), Byte(r[5]), time.Duration(r[6])
+}
+
+func (m *huc3) mapperRegs() []int64 {
+	m.update()
+	return []int64{int64(m.romBank), int64(m.ramBank), int64(m.mode), int64(m.minutes),
+		int64(m.days), int64(m.command), int64(m.response), int64(m.index)}
+}
+
+func (m *huc3) setMapperRegs(r []int64) {
+	m.romBank, m.ramBank, m.mode = int(r[0]), int(r[1]), Byte(r[2])
+	m.minutes, m.days = int(r[3]), int(r[4])
+	m.command, m.response, m.index = Byte(r[5]), Byte(r[6]), Byte(r[7])
+	m.at = m.clk.Now()
+}
+
+// a regReader reads back registers saved as a []int64, in the order they
+// were saved.
+type regReader []int64
+
+func (r *regReader) next() int64 {
+	if len(*r) == 0 {
+		return 0
+	}
+	v := (*r)[0]
+	*r = (*r)[1:]
+	return v
+}
+
+func (r *regReader) bool() bool {
+	return r.next() != 0
+}
+
+func (f *pixelFifo) regs() []int64 {
+	r := []int64{int64(f.n)}
+	for i := 0; i < f.n; i++ {
+		p := f.at(i)
+		r = append(r, int64(p.color), int64(p.palette), int64(p.attr), int64(p.oam),
+			int64(p.x), boolReg(p.window))
+	}
+	return r
+}
+
+func (f *pixelFifo) setRegs(r *regReader) {
+	f.clear()
+	for n := r.next(); n > 0; n-- {
+		f.push(fifoPixel{color: Byte(r.next()), palette: Byte(r.next()), attr: Byte(r.next()),
+			oam: uint8(r.next()), x: Byte(r.next()), window: r.bool()})
+	}
+}
+
+// regs saves the pipe in the middle of a line, the fetch and the fifos.
+func (p *pixelPipe) regs() []int64 {
+	sprite := int64(-1)
+	for i := range p.sprites {
+		if p.sprite == &p.sprites[i] {
+			sprite = int64(i)
+		}
+	}
+	f := p.fetch
+	r := []int64{int64(p.ly), boolReg(p.cgb), int64(p.dots), int64(p.delay), int64(p.discard),
+		int64(p.lx), int64(p.windowRow), int64(p.windowLine), boolReg(p.wyMatch),
+		sprite, int64(p.spriteDots),
+		int64(f.step), int64(f.x), boolReg(f.window), int64(f.row), int64(f.tile),
+		int64(f.attr), int64(f.lo), int64(f.hi)}
+	r = append(r, p.bg.regs()...)
+	r = append(r, p.obj.regs()...)
+	r = append(r, int64(len(p.sprites)))
+	for _, s := range p.sprites {
+		r = append(r, int64(s.oam), int64(s.y), int64(s.x), boolReg(s.fetched))
+	}
+	return r
+}
+
+func (p *pixelPipe) setRegs(r *regReader) {
+	p.ly, p.cgb, p.dots, p.delay = Byte(r.next()), r.bool(), uint32(r.next()), int(r.next())
+	p.discard, p.lx, p.windowRow = Byte(r.next()), int(r.next()), Byte(r.next())
+	p.windowLine, p.wyMatch = Byte(r.next()), r.bool()
+	sprite, spriteDots := r.next(), int(r.next())
+	p.fetch = fetcher{step: uint8(r.next()), x: Byte(r.next()), window: r.bool(),
+		row: Byte(r.next()), tile: Byte(r.next()), attr: Byte(r.next()),
+		lo: Byte(r.next()), hi: Byte(r.next())}
+	p.bg.setRegs(r)
+	p.obj.setRegs(r)
+	p.sprites = p.sprites[:0]
+	for n := r.next(); n > 0; n-- {
+		p.sprites = append(p.sprites, lineSprite{oam: uint8(r.next()), y: Byte(r.next()),
+			x: Byte(r.next()), fetched: r.bool()})
+	}
+	p.sprite, p.spriteDots = nil, spriteDots
+	if sprite >= 0 && int(sprite) < len(p.sprites) {
+		p.sprite = &p.sprites[sprite]
+	}
+}
+
+func (g *Gpu) saveState() gpuState {
+	return gpuState{
+		State: g.stateID, First: g.states.first, T: g.states.t, TNext: g.states.tnext,
+		Playing: g.isPlaying(), Hblank: g.hblank, BlankFrame: g.blankFrame,
+		SgbRow: g.sgbRow, Pipe: g.pipe.regs(), Line: copyBytes(g.pipe.line[:]),
+	}
+}
+
+// loadState carries on from the state the gpu was saved in, in the middle of
+// the line where it was.
+func (g *Gpu) loadState(s gpuState) {
+	if s.State >= gpuStates {
+		s.State = gpuLcdOn
+	}
+	g.stateID = s.State
+	g.states = stateClock{state: g.stateFns[s.State], first: s.First, t: s.T, tnext: s.TNext}
+	if s.Playing {
+		g.play()
+	} else {
+		g.pause()
+	}
+	g.hblank, g.blankFrame, g.sgbRow = s.Hblank, s.BlankFrame, s.SgbRow
+	r := regReader(s.Pipe)
+	g.pipe.setRegs(&r)
+	copy(g.pipe.line[:], s.Line)
+}
+
+func (l lengthCounter) regs() []int64 {
+	return []int64{int64(l.n), boolReg(l.enabled)}
+}
+
+func (l *lengthCounter) setRegs(r *regReader) {
+	l.n, l.enabled = int(r.next()), r.bool()
+}
+
+func (e envelope) regs() []int64 {
+	return []int64{int64(e.initial), boolReg(e.up), int64(e.period), int64(e.volume), int64(e.timer)}
+}
+
+func (e *envelope) setRegs(r *regReader) {
+	e.initial, e.up, e.period = Byte(r.next()), r.bool(), Byte(r.next())
+	e.volume, e.timer = Byte(r.next()), Byte(r.next())
+}
+
+func (s *square) regs() []int64 {
+	r := []int64{boolReg(s.on), int64(s.duty), int64(s.freq), int64(s.timer), int64(s.pos),
+		int64(s.sweepPeriod), boolReg(s.sweepDown), int64(s.sweepShift), int64(s.sweepTimer),
+		boolReg(s.sweepOn), int64(s.shadow)}
+	r = append(r, s.len.regs()...)
+	return append(r, s.env.regs()...)
+}
+
+func (s *square) setRegs(r *regReader) {
+	s.on, s.duty, s.freq, s.timer = r.bool(), Byte(r.next()), uint16(r.next()), uint32(r.next())
+	s.pos, s.sweepPeriod, s.sweepDown = uint8(r.next()), Byte(r.next()), r.bool()
+	s.sweepShift, s.sweepTimer, s.sweepOn = Byte(r.next()), Byte(r.next()), r.bool()
+	s.shadow = uint16(r.next())
+	s.len.setRegs(r)
+	s.env.setRegs(r)
+}
+
+func (w *wave) regs() []int64 {
+	r := []int64{boolReg(w.on), boolReg(w.dac), int64(w.volume), int64(w.freq), int64(w.timer),
+		int64(w.pos)}
+	r = append(r, w.len.regs()...)
+	for _, b := range w.ram {
+		r = append(r, int64(b))
+	}
+	return r
+}
+
+func (w *wave) setRegs(r *regReader) {
+	w.on, w.dac, w.volume, w.freq = r.bool(), r.bool(), Byte(r.next()), uint16(r.next())
+	w.timer, w.pos = uint32(r.next()), uint8(r.next())
+	w.len.setRegs(r)
+	for i := range w.ram {
+		w.ram[i] = Byte(r.next())
+	}
+}
+
+func (n *noise) regs() []int64 {
+	r := []int64{boolReg(n.on), int64(n.shift), boolReg(n.width7), int64(n.divisor),
+		int64(n.timer), int64(n.lfsr)}
+	r = append(r, n.len.regs()...)
+	return append(r, n.env.regs()...)
+}
+
+func (n *noise) setRegs(r *regReader) {
+	n.on, n.shift, n.width7, n.divisor = r.bool(), Byte(r.next()), r.bool(), Byte(r.next())
+	n.timer, n.lfsr = uint32(r.next()), uint16(r.next())
+	n.len.setRegs(r)
+	n.env.setRegs(r)
+}
+
+// channelRegs saves the channels and the frame sequencer, the samples waiting for
+// the sink are not saved.
+func (a *Apu) channelRegs() []int64 {
+	r := []int64{boolReg(a.power), int64(a.frameT), int64(a.frameStep), int64(a.sampleT)}
+	r = append(r, a.ch1.regs()...)
+	r = append(r, a.ch2.regs()...)
+	r = append(r, a.ch3.regs()...)
+	return append(r, a.ch4.regs()...)
+}
+
+func (a *Apu) setChannelRegs(r *regReader) {
+	a.power, a.frameT, a.frameStep = r.bool(), uint32(r.next()), uint8(r.next())
+	a.sampleT = uint64(r.next())
+	a.ch1.setRegs(r)
+	a.ch2.setRegs(r)
+	a.ch3.setRegs(r)
+	a.ch4.setRegs(r)
+}
+
+func (a *Apu) saveState() apuState {
+	return apuState{Regs: copyBytes(a.regs[:]), Channels: a.channelRegs()}
+}
+
+func (a *Apu) loadState(s apuState) {
+	copy(a.regs[:], s.Regs)
+	r := regReader(s.Channels)
+	a.setChannelRegs(&r)
+}
+
+// a stateRequest asks the cpu to save the machine into s, or to load it from
+// s, between two instructions
+type stateRequest struct {
+	cart *Cartridge
+	gpu  *Gpu
+	apu  *Apu
+	s    *machineState
+	err  chan error
+}
+
+func (c *Cpu) cmdSaveState(data interface{}) {
+	req, ok := data.(stateRequest)
+	if !ok {
+		panic("invalid command response type")
+	}
+	req.err <- c.saveState(req)
+}
+
+// saveState saves the machine into req.s.
+func (c *Cpu) saveState(req stateRequest) error {
+	mmu, ok := c.mmu.(stateMmu)
+	if !ok {
+		return fmt.Errorf("save state: mmu can not be saved")
+	}
+	s := req.s
+	s.Version = stateVersion
+	s.Emulator = Version
+	s.Title = req.cart.Title()
+	s.Checksum = req.cart.globalChecksum()
+	s.Cpu = cpuState{
+		A: c.a.Byte(), F: c.f.Byte(), B: c.b.Byte(), C: c.c.Byte(),
+		D: c.d.Byte(), E: c.e.Byte(), H: c.h.Byte(), L: c.l.Byte(),
+		SP: c.sp.Word(), PC: c.pc.Word(), Ime: c.ime, Ei: c.ei, Div: c.div,
+		Halted: c.halted, HaltBug: c.haltBug, Locked: c.locked,
+		Cycles: c.cycles, Instructions: c.instructions,
+		BiosFinished: c.biosFinished,
+		DmaActive:    c.dma.active,
+		DmaSrc:       c.dma.src, DmaN: c.dma.n, DmaT: c.dma.t,
+		SioT: c.sio.t, SioPoll: c.sio.poll,
+	}
+	s.Mmu = mmu.saveState()
+	if req.gpu != nil {
+		s.Gpu = req.gpu.saveState()
+	}
+	if req.apu != nil {
+		s.Apu = req.apu.saveState()
+	}
+	s.Mapper.Kind = mapperKind(req.cart.mapper)
+	if m, ok := req.cart.mapper.(stateMapper); ok {
+		s.Mapper.Regs = m.mapperRegs()
+	}
+	if m, ok := req.cart.mapper.(batteryMapper); ok {
+		s.Mapper.Ram = copyBytes(m.batteryRam())
+	}
+	return nil
+}
+
+func (c *Cpu) cmdLoadState(data interface{}) {
+	req, ok := data.(stateRequest)
+	if !ok {
+		panic("invalid command response type")
+	}
+	req.err <- c.loadState(req)
+}
+
+// loadState loads the machine from req.s.
+func (c *Cpu) loadState(req stateRequest) error {
+	mmu, ok := c.mmu.(stateMmu)
+	if !ok {
+		return fmt.Errorf("load state: mmu can not be loaded")
+	}
+	if err := checkMapperState(req.cart.mapper, req.s.Mapper); err != nil {
+		return fmt.Errorf("load state: %s", err)
+	}
+	s := req.s.Cpu
+	c.a.set(s.A)
+	c.f.set(s.F)
+	c.b.set(s.B)
+	c.c.set(s.C)
+	c.d.set(s.D)
+	c.e.set(s.E)
+	c.h.set(s.H)
+	c.l.set(s.L)
+	c.sp = register16(s.SP)
+	c.pc = register16(s.PC)
+	c.ime, c.ei, c.div = s.Ime, s.Ei, s.Div
+	c.halted, c.haltBug, c.locked = s.Halted, s.HaltBug, s.Locked
+	c.cycles, c.instructions = s.Cycles, s.Instructions
+	c.biosFinished = s.BiosFinished
+	c.dma = oamDma{active: s.DmaActive, src: s.DmaSrc, n: s.DmaN, t: s.DmaT}
+	c.sio = serialClock{t: s.SioT, poll: s.SioPoll}
+	mmu.loadState(req.s.Mmu)
+	if req.gpu != nil {
+		req.gpu.loadState(req.s.Gpu)
+	}
+	if req.apu != nil {
+		req.apu.loadState(req.s.Apu)
+	}
+	c.tac, c.divW = req.s.Mmu.Tac, false
+	if m, ok := req.cart.mapper.(stateMapper); ok {
+		m.setMapperRegs(req.s.Mapper.Regs)
+	}
+	if m, ok := req.cart.mapper.(batteryMapper); ok {
+		copy(m.batteryRam(), req.s.Mapper.Ram)
+	}
+	return nil
+}
+
+// SaveState writes the state of the machine to w, to be resumed with
+// LoadState. The Jibi keeps running.
+func (j Jibi) SaveState(w io.Writer) error {
+	var s machineState
+	err := make(chan error)
+	j.cpu.RunCommand(CmdSaveState, stateRequest{j.cart, j.gpu, j.apu, &s, err})
+	if e := <-err; e != nil {
+		return e
+	}
+	return gob.NewEncoder(w).Encode(s)
+}
+
+// LoadState resumes the machine from a state written by SaveState for the
+// same cartridge, by the same version of the emulator. Options.ForceState
+// loads states of other cartridges and versions anyway.
+func (j Jibi) LoadState(r io.Reader) error {
+	var s machineState
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return fmt.Errorf("load state: %s", err)
+	}
+	if s.Version != stateVersion {
+		return fmt.Errorf("load state: version %d, not %d", s.Version, stateVersion)
+	}
+	if !j.O.ForceState {
+		if s.Title != j.cart.Title() || s.Checksum != j.cart.globalChecksum() {
+			return fmt.Errorf("load state: state of %q (checksum 0x%04X), not %q (checksum 0x%04X)",
+				s.Title, s.Checksum, j.cart.Title(), j.cart.globalChecksum())
+		}
+		if s.Emulator != Version {
+			return fmt.Errorf("load state: saved by jibi %s, this is %s", s.Emulator, Version)
+		}
+	}
+	err := make(chan error)
+	j.cpu.RunCommand(CmdLoadState, stateRequest{j.cart, j.gpu, j.apu, &s, err})
+	return <-err
+}
+
+// saveStateFile saves the state to Options.StateFile.
+func (j Jibi) saveStateFile() error {
+	f, err := os.Create(j.O.StateFile)
+	if err != nil {
+		return err
+	}
+	if err := j.SaveState(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadStateFile loads the state from Options.StateFile.
+func (j Jibi) loadStateFile() error {
+	f, err := os.Open(j.O.StateFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return j.LoadState(f)
+}
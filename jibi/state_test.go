@@ -0,0 +1,228 @@
+package jibi
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pauseSync pauses j and waits for the gpu to have seen it.
+func pauseSync(j Jibi) {
+	j.Pause()
+	resp := make(chan chan ClockType)
+	j.gpu.RunCommand(CmdFrameCounter, resp)
+	<-resp
+}
+
+func decodeState(t *testing.T, b []byte) machineState {
+	var s machineState
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSaveState(t *testing.T) {
+	rom := busyRom()
+	rom[0x0147] = 0x03 // mbc1+ram+battery
+	rom[0x0149] = 0x02
+	j, err := New(rom, Options{Skipbios: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	j.Play()
+	time.Sleep(20 * time.Millisecond)
+	pauseSync(j)
+	var saved bytes.Buffer
+	if err := j.SaveState(&saved); err != nil {
+		t.Fatal(err)
+	}
+	before := decodeState(t, saved.Bytes())
+	if before.Cpu.Cycles == 0 || len(before.Mapper.Regs) != 4 || len(before.Mapper.Ram) != 0x4000 {
+		t.Fatalf("%+v", before.Cpu)
+	}
+
+	j.Play()
+	time.Sleep(20 * time.Millisecond)
+	pauseSync(j)
+	if err := j.LoadState(bytes.NewReader(saved.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	if err := j.SaveState(&again); err != nil {
+		t.Fatal(err)
+	}
+	if after := decodeState(t, again.Bytes()); !reflect.DeepEqual(before, after) {
+		t.Errorf("cpu %+v\nloaded as %+v", before.Cpu, after.Cpu)
+	}
+
+	other, err := New(busyRom(), Options{Skipbios: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+	rom[0x0134] = 'X'
+	if err := other.LoadState(bytes.NewReader(saved.Bytes())); err == nil ||
+		!strings.Contains(err.Error(), "mapper") {
+		t.Errorf("loaded the state of another mapper: %v", err)
+	}
+	titled, err := New(rom, Options{Skipbios: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer titled.Stop()
+	if err := titled.LoadState(bytes.NewReader(saved.Bytes())); err == nil {
+		t.Error("loaded the state of another cartridge")
+	}
+}
+
+func TestLoadStateMismatch(t *testing.T) {
+	j, err := New(busyRom(), Options{Skipbios: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	pauseSync(j)
+	var saved bytes.Buffer
+	if err := j.SaveState(&saved); err != nil {
+		t.Fatal(err)
+	}
+	s := decodeState(t, saved.Bytes())
+	if s.Emulator != Version || s.Checksum != j.cart.globalChecksum() {
+		t.Fatalf("saved by %q for checksum 0x%04X", s.Emulator, s.Checksum)
+	}
+	var old bytes.Buffer
+	s.Emulator = "0.0.1"
+	if err := gob.NewEncoder(&old).Encode(s); err != nil {
+		t.Fatal(err)
+	}
+
+	rom := busyRom()
+	rom[0x014F]++ // same title, another revision
+	for _, force := range []bool{false, true} {
+		other, err := New(rom, Options{Skipbios: true, ForceState: force})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pauseSync(other)
+		err = other.LoadState(bytes.NewReader(saved.Bytes()))
+		if force && err != nil {
+			t.Error(err)
+		} else if !force && (err == nil || !strings.Contains(err.Error(), "checksum")) {
+			t.Errorf("loaded the state of another revision: %v", err)
+		}
+		other.Stop()
+
+		same, err := New(busyRom(), Options{Skipbios: true, ForceState: force})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pauseSync(same)
+		err = same.LoadState(bytes.NewReader(old.Bytes()))
+		if force && err != nil {
+			t.Error(err)
+		} else if !force && (err == nil || !strings.Contains(err.Error(), "0.0.1")) {
+			t.Errorf("loaded the state of another version: %v", err)
+		}
+		same.Stop()
+	}
+}
+
+func TestLoadStateMapper(t *testing.T) {
+	rom := busyRom()
+	rom[0x0147] = 0x03 // mbc1+ram+battery
+	rom[0x0149] = 0x02
+	j, err := New(rom, Options{Skipbios: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	pauseSync(j)
+	var saved bytes.Buffer
+	if err := j.SaveState(&saved); err != nil {
+		t.Fatal(err)
+	}
+	s := decodeState(t, saved.Bytes())
+	if s.Mapper.Kind != "mbc1" {
+		t.Errorf("saved a %q mapper", s.Mapper.Kind)
+	}
+
+	rom[0x0147] = 0x13 // mbc3+ram+battery
+	mbc3, err := New(rom, Options{Skipbios: true, ForceState: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mbc3.Stop()
+	pauseSync(mbc3)
+	if err := mbc3.LoadState(bytes.NewReader(saved.Bytes())); err == nil ||
+		!strings.Contains(err.Error(), "mbc1 mapper, not mbc3") {
+		t.Errorf("loaded mbc1 registers into mbc3: %v", err)
+	}
+
+	var short bytes.Buffer
+	s.Mapper.Regs = s.Mapper.Regs[:2]
+	if err := gob.NewEncoder(&short).Encode(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.LoadState(&short); err == nil || !strings.Contains(err.Error(), "registers") {
+		t.Errorf("loaded 2 mbc1 registers: %v", err)
+	}
+}
+
+// TestLoadStateModes saves the gpu in vblank and loads it back in the middle
+// of the frame, where the gpu carries on from the line and mode it was
+// saved in.
+func TestLoadStateModes(t *testing.T) {
+	cart, err := NewCartridge(busyRom())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := NewCpu(NewMmu(cart, false), nil)
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.pc, cpu.sp = 0x0150, 0xFFFE
+	g := NewGpu(cpu.mmu, nullLcd{}, cpu, false)
+	apu := NewApu(cpu.mmu, cpu)
+	cpu.writeByte(AddrNR52, Byte(0x80))
+	cpu.writeByte(AddrLCDC, Byte(0x91))
+	runTo := func(ly Byte) {
+		for cpu.readByte(AddrLY) != ly {
+			cpu.step(false, 0)
+		}
+	}
+	errs := make(chan error, 1)
+	runTo(150)
+	var s machineState
+	cpu.cmdSaveState(stateRequest{cart, g, apu, &s, errs})
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if s.Gpu.State != gpuVblank {
+		t.Fatalf("saved in state %d", s.Gpu.State)
+	}
+
+	runTo(20)
+	cpu.cmdLoadState(stateRequest{cart, g, apu, &s, errs})
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if stat := cpu.readByte(AddrSTAT) & 0x03; stat != LcdModeVBlank || g.stateID != gpuVblank {
+		t.Fatalf("mode %d state %d after loading", stat, g.stateID)
+	}
+	for start := cpu.cycles; cpu.cycles-start < 70224; {
+		cpu.step(false, 0)
+		if ly := cpu.readByte(AddrLY); ly > 153 {
+			t.Fatalf("LY %d", ly)
+		}
+	}
+	var again machineState
+	runTo(150)
+	cpu.cmdSaveState(stateRequest{cart, g, apu, &again, errs})
+	<-errs
+	if again.Gpu.State != gpuVblank || again.Apu.Regs[AddrNR52-AddrApuRegs] != s.Apu.Regs[AddrNR52-AddrApuRegs] {
+		t.Errorf("%+v after a frame", again.Gpu)
+	}
+}
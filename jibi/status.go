@@ -0,0 +1,43 @@
+package jibi
+
+import (
+	"fmt"
+	"sync"
+)
+
+// dmgHz is the clock speed of dmg hardware.
+const dmgHz = 4194304
+
+// Status is what a frontend shows about a running Jibi, it is updated once
+// a second.
+type Status struct {
+	Title string
+	FPS   float64
+	Speed float64 // 1 is full speed
+}
+
+func (s Status) String() string {
+	return fmt.Sprintf("%s - %.1f fps %.0f%%", s.Title, s.FPS, s.Speed*100)
+}
+
+type statusBox struct {
+	lock sync.Mutex
+	s    Status
+}
+
+func (b *statusBox) get() Status {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.s
+}
+
+func (b *statusBox) set(s Status) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.s = s
+}
+
+// Status returns the latest Status, it is safe to call from any goroutine.
+func (j Jibi) Status() Status {
+	return j.status.get()
+}
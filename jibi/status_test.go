@@ -0,0 +1,26 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	if s := (Status{"TETRIS", 59.73, 1}).String(); s != "TETRIS - 59.7 fps 100%" {
+		t.Errorf("%q", s)
+	}
+
+	rom := busyRom()
+	copy(rom[0x0134:], []Byte("STATUS"))
+	j, err := New(rom, Options{Skipbios: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Stop()
+	if s := j.Status(); s.Title != "STATUS" || s.FPS != 0 || s.Speed != 0 {
+		t.Errorf("%+v", s)
+	}
+	j.status.set(Status{"STATUS", 30, 0.5})
+	if s := j.Status(); s != (Status{"STATUS", 30, 0.5}) {
+		t.Errorf("%+v", s)
+	}
+}
@@ -0,0 +1,117 @@
+package jibi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Symbol is a label from a symbol file.
+type Symbol struct {
+	Bank int
+	Addr Word
+	Name string
+}
+
+// Symbols holds the labels of a rom sorted by bank and address.
+type Symbols struct {
+	syms []Symbol
+}
+
+// ReadSymFile reads an rgbds (or bgb, no$gmb) .sym file.
+func ReadSymFile(filename string) (*Symbols, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseSymbols(f)
+}
+
+// ParseSymbols parses symbol file lines of the form "BB:AAAA Name", where BB
+// is the hex rom bank and AAAA the hex address. Blank lines and anything after
+// a ';' are ignored.
+func ParseSymbols(r io.Reader) (*Symbols, error) {
+	s := &Symbols{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		loc := strings.Split(fields[0], ":")
+		if len(fields) != 2 || len(loc) != 2 {
+			return nil, fmt.Errorf("line %d: invalid symbol %q", n, line)
+		}
+		bank, err := strconv.ParseUint(loc[0], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid bank: %v", n, err)
+		}
+		addr, err := strconv.ParseUint(loc[1], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address: %v", n, err)
+		}
+		s.syms = append(s.syms, Symbol{int(bank), Word(addr), fields[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Sort(symbolsByAddr(s.syms))
+	return s, nil
+}
+
+// Lookup returns the label at or closest before addr in bank, along with the
+// offset of addr from it. Addresses below 0x4000 are always in bank 0.
+func (s *Symbols) Lookup(bank int, addr Word) (Symbol, Word, bool) {
+	if s == nil {
+		return Symbol{}, 0, false
+	}
+	if addr < 0x4000 {
+		bank = 0
+	}
+	// first symbol past bank:addr
+	i := sort.Search(len(s.syms), func(i int) bool {
+		sym := s.syms[i]
+		return sym.Bank > bank || (sym.Bank == bank && sym.Addr > addr)
+	})
+	if i == 0 {
+		return Symbol{}, 0, false
+	}
+	sym := s.syms[i-1]
+	if sym.Bank != bank || (sym.Addr < 0x4000) != (addr < 0x4000) {
+		return Symbol{}, 0, false
+	}
+	return sym, addr - sym.Addr, true
+}
+
+// Name returns the label for addr in bank, as "label+offset" if addr is
+// not on the label itself, or the hex address if there is no label.
+func (s *Symbols) Name(bank int, addr Word) string {
+	sym, off, ok := s.Lookup(bank, addr)
+	if !ok {
+		return fmt.Sprintf("%02X:%04X", bank, uint16(addr))
+	}
+	if off != 0 {
+		return fmt.Sprintf("%s+%d", sym.Name, off)
+	}
+	return sym.Name
+}
+
+type symbolsByAddr []Symbol
+
+func (s symbolsByAddr) Len() int      { return len(s) }
+func (s symbolsByAddr) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s symbolsByAddr) Less(i, j int) bool {
+	if s[i].Bank != s[j].Bank {
+		return s[i].Bank < s[j].Bank
+	}
+	return s[i].Addr < s[j].Addr
+}
@@ -0,0 +1,61 @@
+package jibi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSymbols(t *testing.T) {
+	syms, err := ParseSymbols(strings.NewReader(`; File generated by rgblink
+00:0150 Main
+00:0200 Main.loop
+01:4000 Bank1Func
+02:4000 Bank2Func ; comment
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		bank int
+		addr Word
+		name string
+	}{
+		{1, 0x0150, "Main"},
+		{0, 0x0203, "Main.loop+3"},
+		{1, 0x4010, "Bank1Func+16"},
+		{2, 0x4000, "Bank2Func"},
+		{3, 0x4000, "03:4000"},
+		{0, 0x0100, "00:0100"},
+	}
+	for _, test := range tests {
+		if name := syms.Name(test.bank, test.addr); name != test.name {
+			t.Errorf("%02X:%04X %s != %s", test.bank, uint16(test.addr), name, test.name)
+		}
+	}
+	if _, err := ParseSymbols(strings.NewReader("0150 Main")); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	p := newProfiler(1, 0x0100, 0xFFFE)
+	p.step(0x00, 4, 1, 0xFFFE, 0xFFFE, 0x0101)
+	p.step(0xCD, 24, 1, 0xFFFE, 0xFFFC, 0x0200) // call 0x0200
+	p.step(0x00, 4, 1, 0xFFFC, 0xFFFC, 0x0201)
+	p.step(0xC9, 16, 1, 0xFFFC, 0xFFFE, 0x0104) // ret
+	p.step(0xCC, 12, 1, 0xFFFE, 0xFFFE, 0x0107) // call z not taken
+
+	funcs := map[Word]FuncProfile{}
+	for _, f := range p.report() {
+		funcs[f.Addr] = f
+	}
+	if f := funcs[0x0200]; f.Calls != 1 || f.Exclusive != 20 || f.Inclusive != 20 {
+		t.Errorf("%+v", f)
+	}
+	if f := funcs[0x0100]; f.Exclusive != 40 || f.Inclusive != 60 {
+		t.Errorf("%+v", f)
+	}
+	if len(funcs) != 2 {
+		t.Errorf("%d functions", len(funcs))
+	}
+}
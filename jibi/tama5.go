@@ -0,0 +1,170 @@
+package jibi
+
+import (
+	"time"
+)
+
+// tama5 registers, selected by writing to 0xA001 and set by writing a nibble
+// to 0xA000
+const (
+	tama5RomLow   Byte = 0x0
+	tama5RomHigh  Byte = 0x1
+	tama5DataLow  Byte = 0x4
+	tama5DataHigh Byte = 0x5
+	tama5AddrHigh Byte = 0x6 // bit 0 address bit 4, bits 1-3 command
+	tama5AddrLow  Byte = 0x7 // runs the command
+	tama5Status   Byte = 0xA
+	tama5ReadLow  Byte = 0xC
+	tama5ReadHigh Byte = 0xD
+)
+
+// tama5 commands
+const (
+	tama5CmdWriteRam Byte = 0x0
+	tama5CmdReadRam  Byte = 0x1
+	tama5CmdWriteRtc Byte = 0x2
+	tama5CmdReadRtc  Byte = 0x3
+)
+
+// tama5 is Bandai's mapper for the Tamagotchi cartridge. Everything goes
+// through two registers in ram space, 0xA001 selects a register and 0xA000
+// reads or writes it a nibble at a time. Behind it are the rom bank, 32 bytes
+// of battery backed memory and a tc8521 style bcd real time clock.
+type tama5 struct {
+	rom     []Byte
+	ram     []Byte
+	reg     Byte
+	romBank int
+	data    Byte
+	addr    Byte
+	command Byte
+	read    Byte // output latch
+
+	clk    RtcClock
+	offset time.Duration // cartridge time minus clock time
+}
+
+func newTama5(rom []Byte) *tama5 {
+	return &tama5{
+		rom:     rom,
+		ram:     make([]Byte, 0x20),
+		romBank: 1,
+		clk:     systemClock{},
+	}
+}
+
+func (m *tama5) setRtcClock(clk RtcClock) {
+	m.clk = clk
+}
+
+func (m *tama5) ReadRom(addr Word) Byte {
+	if addr < 0x4000 {
+		return m.rom[addr]
+	}
+	return romBank(m.rom, m.romBank, addr)
+}
+
+func (m *tama5) RomBank() int {
+	return m.romBank
+}
+
+func (m *tama5) Rom() []Byte {
+	return m.rom
+}
+
+func (m *tama5) WriteRom(addr Word, b Byte) {
+}
+
+func (m *tama5) ReadRam(addr Word) Byte {
+	if addr&0x01 == 0x01 {
+		return 0xFF
+	}
+	switch m.reg {
+	case tama5Status:
+		return 0xF1 // ready
+	case tama5ReadLow:
+		return 0xF0 | m.read&0x0F
+	case tama5ReadHigh:
+		return 0xF0 | m.read>>4
+	}
+	return 0xFF
+}
+
+func (m *tama5) WriteRam(addr Word, b Byte) {
+	if addr&0x01 == 0x01 {
+		m.reg = b & 0x0F
+		return
+	}
+	b &= 0x0F
+	switch m.reg {
+	case tama5RomLow:
+		m.romBank = m.romBank&0x10 | int(b)
+	case tama5RomHigh:
+		m.romBank = m.romBank&0x0F | int(b&0x01)<<4
+	case tama5DataLow:
+		m.data = m.data&0xF0 | b
+	case tama5DataHigh:
+		m.data = m.data&0x0F | b<<4
+	case tama5AddrHigh:
+		m.addr = m.addr&0x0F | (b&0x01)<<4
+		m.command = b >> 1
+	case tama5AddrLow:
+		m.addr = m.addr&0x10 | b
+		m.runCommand()
+	}
+}
+
+func (m *tama5) runCommand() {
+	switch m.command {
+	case tama5CmdWriteRam:
+		m.ram[m.addr] = m.data
+	case tama5CmdReadRam:
+		m.read = m.ram[m.addr]
+	case tama5CmdWriteRtc:
+		m.setRtcNibble(m.addr&0x0F, m.data&0x0F)
+	case tama5CmdReadRtc:
+		m.read = m.rtcNibble(m.addr & 0x0F)
+	}
+}
+
+func (m *tama5) now() time.Time {
+	return m.clk.Now().Add(m.offset)
+}
+
+// rtcDigits returns the bcd clock registers 0x0-0xC: seconds, minutes and
+// hours, each units then tens, the day of the week, then day, month and 2
+// digit year, each units then tens.
+func rtcDigits(t time.Time) []int {
+	year := t.Year() % 100
+	return []int{
+		t.Second() % 10, t.Second() / 10,
+		t.Minute() % 10, t.Minute() / 10,
+		t.Hour() % 10, t.Hour() / 10,
+		int(t.Weekday()),
+		t.Day() % 10, t.Day() / 10,
+		int(t.Month()) % 10, int(t.Month()) / 10,
+		year % 10, year / 10,
+	}
+}
+
+func (m *tama5) rtcNibble(reg Byte) Byte {
+	d := rtcDigits(m.now())
+	if int(reg) < len(d) {
+		return Byte(d[reg])
+	}
+	return 0
+}
+
+// setRtcNibble changes one bcd digit of the clock. The day of the week follows
+// from the date so writes to it are ignored.
+func (m *tama5) setRtcNibble(reg, v Byte) {
+	now := m.now()
+	d := rtcDigits(now)
+	if int(reg) >= len(d) || reg == 0x6 {
+		return
+	}
+	d[reg] = int(v)
+	t := time.Date(2000+d[12]*10+d[11], time.Month(d[10]*10+d[9]), d[8]*10+d[7],
+		d[5]*10+d[4], d[3]*10+d[2], d[1]*10+d[0], now.Nanosecond(), now.Location())
+	m.offset += t.Sub(now)
+}
@@ -0,0 +1,62 @@
+package jibi
+
+import (
+	"testing"
+	"time"
+)
+
+func tama5Write(m *tama5, reg, v Byte) {
+	m.WriteRam(0xA001, reg)
+	m.WriteRam(0xA000, v)
+}
+
+func tama5Command(m *tama5, cmd, addr, data Byte) Byte {
+	tama5Write(m, tama5DataLow, data&0x0F)
+	tama5Write(m, tama5DataHigh, data>>4)
+	tama5Write(m, tama5AddrHigh, cmd<<1|addr>>4)
+	tama5Write(m, tama5AddrLow, addr&0x0F)
+	m.WriteRam(0xA001, tama5ReadLow)
+	lo := m.ReadRam(0xA000) & 0x0F
+	m.WriteRam(0xA001, tama5ReadHigh)
+	hi := m.ReadRam(0xA000) & 0x0F
+	return hi<<4 | lo
+}
+
+func TestTama5(t *testing.T) {
+	rom := make([]Byte, 0x4000*32)
+	rom[0x4000*0x13] = 0x13
+	m := newTama5(rom)
+	clk := &FixedClock{time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)}
+	m.setRtcClock(clk)
+
+	tama5Write(m, tama5RomLow, 0x3)
+	tama5Write(m, tama5RomHigh, 0x1)
+	if m.ReadRom(0x4000) != 0x13 {
+		t.Errorf("rom bank %d", m.romBank)
+	}
+
+	m.WriteRam(0xA001, tama5Status)
+	if m.ReadRam(0xA000) != 0xF1 {
+		t.Errorf("not ready")
+	}
+
+	tama5Command(m, tama5CmdWriteRam, 0x1A, 0x5C)
+	if b := tama5Command(m, tama5CmdReadRam, 0x1A, 0); b != 0x5C {
+		t.Errorf("ram 0x%02X", b)
+	}
+
+	// set minutes to 59 and let two minutes pass
+	tama5Command(m, tama5CmdWriteRtc, 0x2, 0x9)
+	tama5Command(m, tama5CmdWriteRtc, 0x3, 0x5)
+	clk.Advance(2 * time.Minute)
+	got := []Byte{}
+	for reg := Byte(0x2); reg <= 0x5; reg++ {
+		got = append(got, tama5Command(m, tama5CmdReadRtc, reg, 0))
+	}
+	want := []Byte{0x1, 0x0, 0x5, 0x0}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%v != %v", got, want)
+		}
+	}
+}
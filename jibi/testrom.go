@@ -0,0 +1,279 @@
+package jibi
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// testRomCheckFrames is how often a test rom is checked for a result.
+const testRomCheckFrames = 10
+
+// A TestRomResult is the outcome of running a test rom.
+type TestRomResult struct {
+	Passed   bool
+	Finished bool // the rom reported a result before running out of frames
+	Frames   int
+	Output   string // the text the rom printed
+	Subtests []Subtest
+}
+
+// A Subtest is one of the numbered tests of a rom that runs several, like
+// 01:ok in the output of blargg's cpu_instrs.
+type Subtest struct {
+	Name   string
+	Passed bool
+	Result string // ok, or the failure code
+}
+
+func (r TestRomResult) String() string {
+	s := "failed"
+	if !r.Finished {
+		s = fmt.Sprintf("no result after %d frames", r.Frames)
+	} else if r.Passed {
+		s = "passed"
+	}
+	for _, t := range r.Subtests {
+		if !t.Passed {
+			s += fmt.Sprintf("\n  %s failed: %s", t.Name, t.Result)
+		}
+	}
+	return s
+}
+
+// runTestRom runs rom headless without the bios, asking done every
+// testRomCheckFrames frames whether it finished. With breaks set done is
+// also asked on every ld b,b, with the breakpoint, and the cpu continues
+// when it did not finish. It returns the frames run and whether done did.
+func runTestRom(rom []Byte, frames int, options Options, breaks bool, done func(j Jibi, brk string) bool) (int, bool, error) {
+	options.Render = false
+	options.Keypad = false
+	options.Skipbios = true
+	j, err := New(rom, options)
+	if err != nil {
+		return 0, false, err
+	}
+	resp := make(chan chan ClockType)
+	j.gpu.RunCommand(CmdFrameCounter, resp)
+	frameClk := <-resp
+	var brk chan string
+	if breaks {
+		respStr := make(chan chan string)
+		j.cpu.RunCommand(CmdOnBreakpoint, respStr)
+		brk = <-respStr
+	}
+	defer func() {
+		// a breakpoint may be hit while stopping
+		stop := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-brk:
+				case <-stop:
+					return
+				}
+			}
+		}()
+		j.Stop()
+		close(stop)
+	}()
+
+	j.Play()
+	n, next := 0, testRomCheckFrames
+	for n < frames {
+		select {
+		case f := <-frameClk:
+			n += int(f)
+			if n < next {
+				continue
+			}
+			next = n + testRomCheckFrames
+			if done(j, "") {
+				return n, true, nil
+			}
+		case s := <-brk:
+			if done(j, s) {
+				return n, true, nil
+			}
+			j.Play()
+		}
+	}
+	return n, done(j, ""), nil
+}
+
+// blarggSignature follows the status byte at 0xA000 when blargg's test roms
+// report through cartridge ram, the text they print starts at 0xA004.
+var blarggSignature = []Byte{0xDE, 0xB0, 0x61}
+
+// blarggRunning is the status byte while the tests run.
+const blarggRunning = 0x80
+
+var blarggSubtest = regexp.MustCompile(`(\d\d):(\w+)`)
+
+// blarggSigned returns whether a blargg rom wrote the signature to
+// cartridge ram, to report there.
+func blarggSigned(j Jibi) bool {
+	for i, b := range j.PeekBytes(AddrERam+1, len(blarggSignature)) {
+		if b != blarggSignature[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// blarggText returns the text a blargg rom wrote to cartridge ram.
+func blarggText(j Jibi) string {
+	var s []byte
+	for _, b := range j.PeekBytes(AddrERam+4, int(AddrRam-AddrERam-4)) {
+		if b == 0 {
+			break
+		}
+		s = append(s, byte(b))
+	}
+	return string(s)
+}
+
+// RunBlargg runs one of blargg's test roms, like cpu_instrs, instr_timing
+// or mem_timing, for at most frames frames. The result is taken from what
+// the rom prints on the link port, or from cartridge ram for the roms that
+// report there, with the subtests of the roms that run several.
+// Options.Serial is replaced to read the link port.
+func RunBlargg(rom []Byte, frames int, options Options) (TestRomResult, error) {
+	serial := NewSerialCapture(nil)
+	options.Serial = serial
+	var r TestRomResult
+	var status Byte
+	memory := false
+	n, finished, err := runTestRom(rom, frames, options, false, func(j Jibi, brk string) bool {
+		if memory || blarggSigned(j) {
+			memory = true
+			if status = j.Peek(AddrERam); status == blarggRunning {
+				return false
+			}
+			r.Output = blarggText(j)
+			return true
+		}
+		r.Output = serial.String()
+		return strings.Contains(r.Output, "Passed") || strings.Contains(r.Output, "Failed")
+	})
+	if err != nil {
+		return r, err
+	}
+	r.Frames, r.Finished = n, finished
+	if memory {
+		r.Passed = finished && status == 0
+	} else {
+		r.Passed = finished && strings.Contains(r.Output, "Passed")
+	}
+	for _, m := range blarggSubtest.FindAllStringSubmatch(r.Output, -1) {
+		r.Subtests = append(r.Subtests, Subtest{m[1], m[2] == "ok", m[2]})
+	}
+	return r, nil
+}
+
+// mooneyePass are the registers B, C, D, E, H and L, the fibonacci numbers,
+// that a mooneye-gb test rom leaves at the ld b,b it ends on when it
+// passed. A rom that failed leaves 0x42 in all of them.
+var mooneyePass = [6]Byte{3, 5, 8, 13, 21, 34}
+
+// RunMooneye runs one of the mooneye-gb test roms for at most frames
+// frames. The rom passed when the registers at the ld b,b it ends on hold
+// the fibonacci numbers, Output has the breakpoint and the registers.
+func RunMooneye(rom []Byte, frames int, options Options) (TestRomResult, error) {
+	var r TestRomResult
+	n, finished, err := runTestRom(rom, frames, options, true, func(j Jibi, brk string) bool {
+		if brk == "" {
+			return false
+		}
+		regs := j.Registers()
+		r.Passed = [6]Byte{regs.B, regs.C, regs.D, regs.E, regs.H, regs.L} == mooneyePass
+		r.Output = fmt.Sprintf("%s B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X", brk,
+			uint8(regs.B), uint8(regs.C), uint8(regs.D), uint8(regs.E), uint8(regs.H), uint8(regs.L))
+		return true
+	})
+	if err != nil {
+		return r, err
+	}
+	r.Frames, r.Finished = n, finished
+	return r, nil
+}
+
+// A Score is the result of one rom of a test suite.
+type Score struct {
+	Rom string // path in the suite
+	TestRomResult
+	Err error // the rom did not run
+}
+
+// A Scoreboard is the results of the roms of a test suite, in the order
+// they ran.
+type Scoreboard []Score
+
+// Passed returns the number of roms that passed.
+func (s Scoreboard) Passed() int {
+	n := 0
+	for _, sc := range s {
+		if sc.Err == nil && sc.Passed {
+			n++
+		}
+	}
+	return n
+}
+
+// String lists every rom with its result, then the roms passed per
+// directory of the suite, like timer or ppu, and in all.
+func (s Scoreboard) String() string {
+	var b strings.Builder
+	passed, total := map[string]int{}, map[string]int{}
+	for _, sc := range s {
+		dir := filepath.Dir(sc.Rom)
+		total[dir]++
+		switch {
+		case sc.Err != nil:
+			fmt.Fprintf(&b, "FAIL %s: %v\n", sc.Rom, sc.Err)
+		case sc.Passed:
+			passed[dir]++
+			fmt.Fprintf(&b, "ok   %s\n", sc.Rom)
+		default:
+			fmt.Fprintf(&b, "FAIL %s: %s\n", sc.Rom, sc.TestRomResult.String())
+		}
+	}
+	var dirs []string
+	for dir := range total {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		fmt.Fprintf(&b, "%s: %d/%d\n", dir, passed[dir], total[dir])
+	}
+	fmt.Fprintf(&b, "passed %d/%d\n", s.Passed(), len(s))
+	return b.String()
+}
+
+// RunMooneyeSuite runs every .gb rom under dir, like the acceptance
+// directory of mooneye-gb, with RunMooneye. Roms made for other models,
+// named like -cgb or -sgb, are run too and are expected to fail on a dmg.
+func RunMooneyeSuite(dir string, frames int, options Options) (Scoreboard, error) {
+	var s Scoreboard
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".gb" {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sc := Score{Rom: filepath.ToSlash(name)}
+		rom, err := ReadRomFile(path)
+		if err == nil {
+			sc.TestRomResult, err = RunMooneye(rom, frames, options)
+		}
+		sc.Err = err
+		s = append(s, sc)
+		return nil
+	})
+	return s, err
+}
@@ -0,0 +1,62 @@
+package jibi
+
+// timerBits are the bits of the divider counter whose falling edges TIMA
+// counts, by TAC clock select: 4096Hz, 262144Hz, 65536Hz and 16384Hz
+var timerBits = [4]uint{9, 3, 5, 7}
+
+// timerInput returns the timer input for a counter value, the counter bit
+// tac selects while the timer is enabled.
+func timerInput(div Word, tac Byte) bool {
+	return tac&0x04 != 0 && div>>timerBits[tac&0x03]&0x01 != 0
+}
+
+// timers runs the divider and the timer for t clock cycles. Both are driven
+// by one 16 bit counter running at the cpu clock, DIV is its upper byte and
+// any write to DIV resets it. TIMA counts the falling edges of the timer
+// input, on overflow it is reloaded from TMA and requests the timer
+// interrupt.
+//
+// The input is the counter bit TAC selects and'ed with the TAC enable, so
+// resetting the counter while the bit is set or a TAC write that drops the
+// input count as edges too. Writes since the last run are taken to happen
+// before the t cycles.
+func (cpu *Cpu) timers(t uint8) {
+	edges := uint32(0)
+	if cpu.divW {
+		cpu.divW = false
+		if timerInput(cpu.div, cpu.tac) {
+			edges++
+		}
+		cpu.div = 0
+	}
+	if tac := cpu.readByte(AddrTAC); tac != cpu.tac {
+		if timerInput(cpu.div, cpu.tac) && !timerInput(cpu.div, tac) {
+			edges++
+		}
+		cpu.tac = tac
+	}
+
+	prev := cpu.div
+	cpu.div += Word(t)
+	if cpu.tac&0x04 != 0 {
+		shift := timerBits[cpu.tac&0x03] + 1
+		edges += (uint32(prev)+uint32(t))>>shift - uint32(prev)>>shift
+	}
+	cpu.mmu.Hardware().Write(AddrDIV, Byte(cpu.div>>8))
+	if edges == 0 {
+		return
+	}
+	tima := cpu.readByte(AddrTIMA)
+	for ; edges > 0; edges-- {
+		tima++
+		if tima != 0 {
+			continue
+		}
+		tima = cpu.readByte(AddrTMA)
+		cpu.setInterrupt(InterruptTimer)
+		if cpu.events != nil {
+			cpu.events.publish(Event{Kind: EventTimerOverflow, Cycles: cpu.cycles})
+		}
+	}
+	cpu.writeByte(AddrTIMA, tima)
+}
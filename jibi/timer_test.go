@@ -0,0 +1,122 @@
+package jibi
+
+import (
+	"testing"
+)
+
+// runCycles steps the cpu for at least n clock cycles.
+func runCycles(cpu *Cpu, n uint64) {
+	for start := cpu.cycles; cpu.cycles-start < n; {
+		cpu.step(false, 0)
+	}
+}
+
+func TestTimerRates(t *testing.T) {
+	for tac, period := range []uint64{1024, 16, 64, 256} {
+		cpu := newFrameCpu(t)
+		cpu.writeByte(AddrTIMA, Byte(0))
+		cpu.writeByte(AddrTAC, Byte(0x04|tac))
+		runCycles(cpu, 100*period)
+		if tima := cpu.readByte(AddrTIMA); tima < 100 || tima > 101 {
+			t.Errorf("TAC %d: TIMA %d after 100 periods", tac, tima)
+		}
+		cpu.RunCommand(CmdStop, nil)
+	}
+}
+
+func TestTimerDiv(t *testing.T) {
+	cpu := newFrameCpu(t)
+	defer cpu.RunCommand(CmdStop, nil)
+	runCycles(cpu, 256*10)
+	if div := cpu.readByte(AddrDIV); div != 10 {
+		t.Errorf("DIV %d after 2560 cycles", div)
+	}
+	// writes reset the whole counter
+	cpu.writeByte(AddrDIV, Byte(0x55))
+	runCycles(cpu, 200)
+	if div := cpu.readByte(AddrDIV); div != 0 {
+		t.Errorf("DIV %d after a reset", div)
+	}
+	runCycles(cpu, 100)
+	if div := cpu.readByte(AddrDIV); div != 1 {
+		t.Errorf("DIV %d", div)
+	}
+}
+
+func TestTimerOverflow(t *testing.T) {
+	cpu := newFrameCpu(t)
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.writeByte(AddrIE, Byte(InterruptTimer))
+	cpu.writeByte(AddrTMA, Byte(0x80))
+	cpu.writeByte(AddrTIMA, Byte(0xFE))
+	cpu.writeByte(AddrTAC, Byte(0x05))
+	for i := 0; cpu.pc.Word() >= 0x0100; i++ {
+		if i > 100 {
+			t.Fatal("no interrupt")
+		}
+		cpu.step(false, 0)
+	}
+	if pc := cpu.pc.Word(); pc < 0x50 || pc > 0x58 {
+		t.Errorf("pc 0x%04X", pc)
+	}
+	if tima := cpu.readByte(AddrTIMA); tima != 0x80 && tima != 0x81 {
+		t.Errorf("TIMA 0x%02X", tima)
+	}
+}
+
+func TestTimerDivWrite(t *testing.T) {
+	cpu := newFrameCpu(t)
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.writeByte(AddrTIMA, Byte(0))
+	cpu.writeByte(AddrTAC, Byte(0x05)) // bit 3
+	// resetting while the selected bit is set ticks TIMA
+	cpu.div = 0x0008
+	cpu.timers(0) // no cycles pass
+	tima := cpu.readByte(AddrTIMA)
+	cpu.writeByte(AddrDIV, Byte(0))
+	cpu.timers(0)
+	if got := cpu.readByte(AddrTIMA); got != tima+1 {
+		t.Errorf("TIMA %d after a reset, want %d", got, tima+1)
+	}
+	if cpu.div != 0 {
+		t.Errorf("counter 0x%04X after a reset", cpu.div)
+	}
+}
+
+func TestTimerTacGlitch(t *testing.T) {
+	cpu := newFrameCpu(t)
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.writeByte(AddrTIMA, Byte(0))
+	cpu.writeByte(AddrTAC, Byte(0x05))
+	cpu.div = 0x0008
+	cpu.timers(0) // no cycles pass
+	tima := cpu.readByte(AddrTIMA)
+	// disabling the timer drops the input
+	cpu.writeByte(AddrTAC, Byte(0x01))
+	cpu.timers(0)
+	if got := cpu.readByte(AddrTIMA); got != tima+1 {
+		t.Errorf("TIMA %d after disabling, want %d", got, tima+1)
+	}
+	// enabling it does not
+	cpu.writeByte(AddrTAC, Byte(0x05))
+	cpu.timers(0)
+	if got := cpu.readByte(AddrTIMA); got != tima+1 {
+		t.Errorf("TIMA %d after enabling, want %d", got, tima+1)
+	}
+}
+
+func TestTimerAccessCycle(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{0xFA, 0x05, 0xFF}) // LD A, (TIMA)
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.writeByte(AddrTIMA, Byte(0))
+	cpu.writeByte(AddrTAC, Byte(0x05)) // every 16 cycles
+	cpu.div = 0
+	cpu.step(false, 0)
+	// the read is on the 4th machine cycle, after TIMA counted once
+	if a := cpu.a.Byte(); a != 1 {
+		t.Errorf("read TIMA %d", a)
+	}
+	if cpu.t != 16 {
+		t.Errorf("%d cycles", cpu.t)
+	}
+}
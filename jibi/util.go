@@ -2,10 +2,35 @@ package jibi
 
 import (
 	"archive/zip"
+	"fmt"
+	"image"
+	"image/png"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
+// writePngFile writes img to the first prefix-NNN.png file that does not
+// exist yet in dir and returns its name.
+func writePngFile(dir, prefix string, img image.Image) (string, error) {
+	for i := 1; ; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("%s-%03d.png", prefix, i))
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if err := png.Encode(f, img); err != nil {
+			f.Close()
+			return "", err
+		}
+		return name, f.Close()
+	}
+}
+
 // BytesToWord simply converts two Byter objects into a Word.
 func BytesToWord(high, low Byter) Word {
 	return Word(uint16(high.Byte())<<8 + uint16(low.Byte()))
@@ -31,7 +56,7 @@ func readRomZipFile(filename string) ([]byte, error) {
 			return buf, nil
 		}
 	}
-	return []byte{}, nil
+	return nil, fmt.Errorf("%s: no .gb file in archive", filename)
 }
 
 // ReadRomFile reads the file named by filename and returns the contents.
@@ -54,3 +79,31 @@ func ReadRomFile(filename string) ([]Byte, error) {
 	}
 	return r, nil
 }
+
+// WatchRomFile polls the file named by filename every interval and sends the
+// contents whenever its modification time or size changes. A rom that fails
+// to read, such as one the assembler is still writing, is tried again on the
+// next poll.
+func WatchRomFile(filename string, interval time.Duration) <-chan []Byte {
+	c := make(chan []Byte)
+	var modTime time.Time
+	var size int64
+	if fi, err := os.Stat(filename); err == nil {
+		modTime, size = fi.ModTime(), fi.Size()
+	}
+	go func() {
+		for range time.Tick(interval) {
+			fi, err := os.Stat(filename)
+			if err != nil || (fi.ModTime().Equal(modTime) && fi.Size() == size) {
+				continue
+			}
+			rom, err := ReadRomFile(filename)
+			if err != nil || len(rom) < 0x0150 {
+				continue
+			}
+			modTime, size = fi.ModTime(), fi.Size()
+			c <- rom
+		}
+	}()
+	return c
+}
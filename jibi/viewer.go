@@ -0,0 +1,149 @@
+package jibi
+
+import (
+	"fmt"
+	"image"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// tiles per bank of vram and per row of the tile viewer
+const (
+	vramTiles   = 384
+	viewerTileW = 16
+)
+
+// tileShades are the gray levels of the 4 tile colors, from white to black.
+var tileShades = [4]uint8{0xFF, 0xAA, 0x55, 0x00}
+
+// drawTile draws the 16 byte tile at data with its top left corner at x,y,
+// in the raw tile colors.
+func drawTile(img *image.Gray, x, y int, data []Byte) {
+	for ty := 0; ty < 8; ty++ {
+		lo, hi := data[ty*2], data[ty*2+1]
+		for tx := 0; tx < 8; tx++ {
+			bit := uint(7 - tx)
+			color := lo>>bit&0x01 | (hi>>bit&0x01)<<1
+			img.Pix[(y+ty)*img.Stride+x+tx] = tileShades[color]
+		}
+	}
+}
+
+// Tiles draws the 384 tiles of each vram bank, 16 per row in the order they
+// are stored, with the banks side by side. The colors are the raw tile
+// colors, not put through a palette, so tiles show even when the palettes
+// hide them.
+func (s VideoSnapshot) Tiles() *image.Gray {
+	banks := len(s.VRam) / 0x2000
+	w := viewerTileW * 8
+	img := image.NewGray(image.Rect(0, 0, banks*w, vramTiles/viewerTileW*8))
+	for bank := 0; bank < banks; bank++ {
+		for t := 0; t < vramTiles; t++ {
+			x := bank*w + t%viewerTileW*8
+			y := t / viewerTileW * 8
+			drawTile(img, x, y, s.VRam[bank*0x2000+t*16:])
+		}
+	}
+	return img
+}
+
+// A Sprite is an oam entry. Y and X are as stored, 16 and 8 more than the
+// top left corner on the screen.
+type Sprite struct {
+	Index      int
+	Y, X       Byte
+	Tile, Attr Byte
+}
+
+func (sp Sprite) String() string {
+	s := fmt.Sprintf("%02d y:%3d x:%3d tile:0x%02X attr:0x%02X",
+		sp.Index, uint8(sp.Y), uint8(sp.X), uint8(sp.Tile), uint8(sp.Attr))
+	for _, f := range []struct {
+		bit  Byte
+		name string
+	}{{0x80, "behind"}, {0x40, "yflip"}, {0x20, "xflip"}, {0x10, "obp1"}, {0x08, "bank1"}} {
+		if sp.Attr&f.bit != 0 {
+			s += " " + f.name
+		}
+	}
+	return s
+}
+
+// Sprites returns the 40 oam entries.
+func (s VideoSnapshot) Sprites() []Sprite {
+	sprites := make([]Sprite, len(s.Oam)/4)
+	for i := range sprites {
+		e := s.Oam[i*4:]
+		sprites[i] = Sprite{i, e[0], e[1], e[2], e[3]}
+	}
+	return sprites
+}
+
+// SpriteImage draws the 40 sprites, 8 per row in oam order, 8x16 when LCDC
+// selects tall sprites. They are flipped like on the screen and drawn in the
+// raw tile colors, color 0 included.
+func (s VideoSnapshot) SpriteImage() *image.Gray {
+	h := 8
+	if len(s.Regs) > 0 && s.Regs[0]&0x04 != 0 {
+		h = 16
+	}
+	sprites := s.Sprites()
+	img := image.NewGray(image.Rect(0, 0, 8*8, (len(sprites)+7)/8*h))
+	tile := image.NewGray(image.Rect(0, 0, 8, 16))
+	for i, sp := range sprites {
+		t := int(sp.Tile)
+		if h == 16 {
+			t &^= 0x01
+		}
+		vram := s.VRam
+		if sp.Attr&0x08 != 0 && len(vram) > 0x2000 {
+			vram = vram[0x2000:]
+		}
+		for n := 0; n < h/8; n++ {
+			drawTile(tile, 0, n*8, vram[(t+n)*16:])
+		}
+		x0, y0 := i%8*8, i/8*h
+		for y := 0; y < h; y++ {
+			for x := 0; x < 8; x++ {
+				tx, ty := x, y
+				if sp.Attr&0x20 != 0 {
+					tx = 7 - x
+				}
+				if sp.Attr&0x40 != 0 {
+					ty = h - 1 - y
+				}
+				img.Pix[(y0+y)*img.Stride+x0+x] = tile.Pix[ty*tile.Stride+tx]
+			}
+		}
+	}
+	return img
+}
+
+// writeViewers writes the viewers of the next frame to Options.ViewerDir,
+// the tiles, the sprites and a list of the oam entries next to them. It
+// runs on its own goroutine, the snapshot waits for the frame to end.
+func (j Jibi) writeViewers() {
+	s := j.VideoSnapshot()
+	err := func() error {
+		if _, err := writePngFile(j.O.ViewerDir, "tiles", s.Tiles()); err != nil {
+			return err
+		}
+		name, err := writePngFile(j.O.ViewerDir, "sprites", s.SpriteImage())
+		if err != nil {
+			return err
+		}
+		var list []string
+		for _, sp := range s.Sprites() {
+			list = append(list, sp.String())
+		}
+		return ioutil.WriteFile(strings.TrimSuffix(name, ".png")+".txt",
+			[]byte(strings.Join(list, "\n")+"\n"), 0644)
+	}()
+	if err != nil {
+		j.log().Warn("video viewer failed", "err", err)
+		j.Notify("Video viewer failed", 2*time.Second)
+		return
+	}
+	j.Notify("Video memory saved", 2*time.Second)
+}
@@ -0,0 +1,59 @@
+package jibi
+
+import (
+	"testing"
+)
+
+func TestTileViewer(t *testing.T) {
+	s := VideoSnapshot{VRam: make([]Byte, 0x4000)}
+	s.VRam[1*16] = 0xFF          // tile 1 row 0 color 1
+	s.VRam[17*16+2] = 0x80       // tile 17 row 1 left pixel color 1
+	s.VRam[17*16+3] = 0x80       // and 2
+	s.VRam[0x2000+383*16] = 0x01 // bank 1 last tile right pixel
+	img := s.Tiles()
+	if b := img.Bounds(); b.Dx() != 256 || b.Dy() != 192 {
+		t.Fatalf("%v", b)
+	}
+	for _, c := range []struct {
+		x, y int
+		v    uint8
+	}{{0, 0, 0xFF}, {8, 0, 0xAA}, {15, 0, 0xAA}, {8, 1, 0xFF}, {8, 9, 0x00}, {9, 9, 0xFF}, {255, 184, 0xAA}} {
+		if v := img.GrayAt(c.x, c.y).Y; v != c.v {
+			t.Errorf("%d,%d: 0x%02X", c.x, c.y, v)
+		}
+	}
+}
+
+func TestSpriteViewer(t *testing.T) {
+	s := VideoSnapshot{VRam: make([]Byte, 0x4000), Oam: make([]Byte, 0xA0), Regs: []Byte{0x04}}
+	s.VRam[2*16] = 0x80    // tile 2 row 0 left pixel color 1
+	s.VRam[3*16+14] = 0x01 // tile 3 row 7 right pixel color 1
+	s.VRam[0x2000+4*16] = 0x80
+	copy(s.Oam, []Byte{16, 8, 3, 0x00, 20, 30, 2, 0x60, 0, 0, 4, 0x08})
+	sprites := s.Sprites()
+	if len(sprites) != 40 {
+		t.Fatalf("%d sprites", len(sprites))
+	}
+	if sp := sprites[1]; sp.Y != 20 || sp.X != 30 || sp.Tile != 2 || sp.Attr != 0x60 {
+		t.Errorf("%+v", sp)
+	}
+	if s := sprites[1].String(); s != "01 y: 20 x: 30 tile:0x02 attr:0x60 yflip xflip" {
+		t.Errorf("%q", s)
+	}
+	img := s.SpriteImage()
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 80 {
+		t.Fatalf("%v", b)
+	}
+	for _, c := range []struct {
+		x, y int
+		v    uint8
+	}{
+		{0, 0, 0xAA}, {1, 0, 0xFF}, {7, 15, 0xAA}, // tall sprites start at the even tile
+		{15, 15, 0xAA}, {8, 0, 0xAA}, {9, 0, 0xFF}, // both flips
+		{16, 0, 0xAA}, // bank 1
+	} {
+		if v := img.GrayAt(c.x, c.y).Y; v != c.v {
+			t.Errorf("%d,%d: 0x%02X", c.x, c.y, v)
+		}
+	}
+}
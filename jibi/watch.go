@@ -0,0 +1,122 @@
+package jibi
+
+import (
+	"sync"
+)
+
+// A Watch is an access to watched memory and the instruction that made it,
+// with the registers after the instruction. Writes by the gpu or the oam dma
+// are reported with the instruction the cpu was running, reads only when an
+// instruction makes them.
+type Watch struct {
+	Addr      Word
+	Write     bool
+	Old, New  Byte
+	PC        Word // address of the instruction
+	Inst      string
+	Registers Registers
+}
+
+// a watchpoint asks for the reads, the writes or both from start to end
+// inclusive, remove receives the func that clears it
+type watchpoint struct {
+	start, end  Word
+	read, write bool
+	remove      chan func()
+}
+
+// watchHits collects the watched accesses the hooks see until the cpu takes
+// them after the instruction.
+type watchHits struct {
+	lock sync.Mutex
+	hits []Watch
+}
+
+func (w *watchHits) hook(write bool) MemoryHook {
+	return func(addr Word, old, new Byte) {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		w.hits = append(w.hits, Watch{Addr: addr, Write: write, Old: old, New: new})
+	}
+}
+
+func (w *watchHits) take() []Watch {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	hits := w.hits
+	w.hits = nil
+	return hits
+}
+
+func (c *Cpu) cmdSetWatchpoint(data interface{}) {
+	wp, ok := data.(watchpoint)
+	if !ok {
+		panic("invalid command response type")
+	}
+	if c.watches == nil {
+		c.watches = &watchHits{}
+	}
+	var removes []func()
+	if wp.read {
+		hook := c.watches.hook(false)
+		removes = append(removes, c.mmu.OnRead(wp.start, wp.end, func(addr Word, old, new Byte) {
+			// the gpu and the timers read their registers on every
+			// cycle, only the reads of instructions count
+			if c.timed {
+				hook(addr, old, new)
+			}
+		}))
+	}
+	if wp.write {
+		removes = append(removes, c.mmu.OnWrite(wp.start, wp.end, c.watches.hook(true)))
+	}
+	wp.remove <- func() {
+		for _, remove := range removes {
+			remove()
+		}
+	}
+}
+
+func (c *Cpu) cmdOnWatch(resp interface{}) {
+	if resp, ok := resp.(chan chan Watch); !ok {
+		panic("invalid command response type")
+	} else {
+		watch := make(chan Watch)
+		c.notifyWatch = append(c.notifyWatch, watch)
+		resp <- watch
+	}
+}
+
+// watched stops the cpu after an instruction at pc that touched watched
+// memory and hands every access to everyone listening for watches.
+func (c *Cpu) watched(pc Word) {
+	hits := c.watches.take()
+	if len(hits) == 0 {
+		return
+	}
+	c.pause()
+	r := c.registers()
+	for _, hit := range hits {
+		hit.PC, hit.Inst, hit.Registers = pc, c.inst.String(), r
+		for _, watch := range c.notifyWatch {
+			watch <- hit
+		}
+	}
+}
+
+// Watch stops the cpu after any instruction that reads, writes or both
+// memory from start to end inclusive, see OnWatch and Continue. The returned
+// func removes the watchpoint.
+func (j Jibi) Watch(start, end Word, read, write bool) func() {
+	remove := make(chan func())
+	j.cpu.RunCommand(CmdSetWatchpoint, watchpoint{start, end, read, write, remove})
+	return <-remove
+}
+
+// OnWatch returns a channel receiving the accesses that stop the cpu on a
+// watchpoint. The cpu waits for them to be read.
+func (j Jibi) OnWatch() <-chan Watch {
+	resp := make(chan chan Watch)
+	j.cpu.RunCommand(CmdOnWatch, resp)
+	return <-resp
+}
@@ -0,0 +1,76 @@
+package jibi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchpoints(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{
+		0x3E, 0x42, // LD A, 0x42
+		0xEA, 0x10, 0xC0, // LD (0xC010), A
+		0xFA, 0x10, 0xC0, // LD A, (0xC010)
+		0x18, 0xFE, // JR -2
+	})
+	defer cpu.RunCommand(CmdStop, nil)
+	resp := make(chan chan Watch)
+	cpu.RunCommand(CmdOnWatch, resp)
+	watches := <-resp
+	remove := make(chan func())
+	cpu.RunCommand(CmdSetWatchpoint, watchpoint{0xC000, 0xC0FF, false, true, remove})
+	unwatch := <-remove
+	cpu.RunCommand(CmdSetWatchpoint, watchpoint{0xC010, 0xC010, true, false, remove})
+	<-remove
+	cpu.RunCommand(CmdPlay, nil)
+
+	next := func() Watch {
+		select {
+		case w := <-watches:
+			return w
+		case <-time.After(5 * time.Second):
+			t.Fatal("cpu did not stop")
+		}
+		return Watch{}
+	}
+	w := next()
+	if w.Addr != 0xC010 || !w.Write || w.New != 0x42 || w.PC != 0x0102 || w.Registers.PC != 0x0105 {
+		t.Errorf("%+v", w)
+	}
+	unwatch()
+	cpu.RunCommand(CmdContinue, nil)
+	if w := next(); w.Addr != 0xC010 || w.Write || w.Old != 0x42 || w.PC != 0x0105 {
+		t.Errorf("%+v", w)
+	}
+}
+
+// TestWatchCpuReads checks that read watchpoints on registers the gpu and
+// the timer read all the time only see the reads of instructions.
+func TestWatchCpuReads(t *testing.T) {
+	cpu := newCodeCpu(t, []Byte{
+		0x06, 0x14, // LD B, 20
+		0x0D, 0x20, 0xFD, // DEC C; JR NZ, -3
+		0x05, 0x20, 0xFA, // DEC B; JR NZ, -6, 20*256*16 cycles in all
+		0xF0, 0x40, // LDH A, (LCDC)
+		0x18, 0xFE, // JR -2
+	})
+	defer cpu.RunCommand(CmdStop, nil)
+	cpu.writeByte(AddrTAC, Byte(0x05))
+	NewGpu(cpu.mmu, nullLcd{}, cpu, false)
+	cpu.writeByte(AddrLCDC, Byte(0x93))
+	resp := make(chan chan Watch)
+	cpu.RunCommand(CmdOnWatch, resp)
+	watches := <-resp
+	remove := make(chan func(), 3)
+	for _, a := range []Word{AddrLCDC, AddrTAC, AddrOam} {
+		cpu.RunCommand(CmdSetWatchpoint, watchpoint{a, a, true, false, remove})
+	}
+	cpu.RunCommand(CmdPlay, nil)
+	select {
+	case w := <-watches:
+		if w.Addr != AddrLCDC || w.PC != 0x0108 || w.Registers.Cycles < 70224 {
+			t.Errorf("%+v", w)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cpu did not stop")
+	}
+}
@@ -0,0 +1,75 @@
+package jibi
+
+// a wave is the wave channel, it plays the 32 4 bit samples of wave ram
+type wave struct {
+	on     bool
+	dac    bool
+	volume Byte   // 0 mute, 1 full, 2 half, 3 quarter
+	freq   uint16 // 11 bits
+	timer  uint32 // cycles until the next sample
+	pos    uint8  // sample in wave ram
+	len    lengthCounter
+	ram    [16]Byte
+}
+
+// period returns the cycles between two samples.
+func (w *wave) period() uint32 {
+	return (2048 - uint32(w.freq)) * 2
+}
+
+// output returns the 4 bit output, 0 while the channel is off.
+func (w *wave) output() Byte {
+	if !w.on || w.volume == 0 {
+		return 0
+	}
+	s := w.ram[w.pos/2]
+	if w.pos%2 == 0 {
+		s >>= 4
+	}
+	return (s & 0x0F) >> (w.volume - 1)
+}
+
+func (w *wave) tick(n uint32) {
+	if !w.on {
+		return
+	}
+	if w.timer == 0 {
+		w.timer = w.period()
+	}
+	for n >= w.timer {
+		n -= w.timer
+		w.timer = w.period()
+		w.pos = (w.pos + 1) % 32
+	}
+	w.timer -= n
+}
+
+// readRam reads wave ram at i. While the channel plays the cpu sees the byte
+// being played instead.
+func (w *wave) readRam(i Word) Byte {
+	if w.on {
+		return w.ram[w.pos/2]
+	}
+	return w.ram[i]
+}
+
+func (w *wave) writeRam(i Word, b Byte) {
+	if w.on {
+		w.ram[w.pos/2] = b
+		return
+	}
+	w.ram[i] = b
+}
+
+// writeControl sets the high frequency bits and the length enable from NR34
+// and triggers the channel if bit 7 is set.
+func (w *wave) writeControl(b Byte, frameStep uint8) {
+	w.freq = w.freq&0xFF | uint16(b&0x07)<<8
+	w.len.enable(b&0x40 != 0, frameStep, &w.on)
+	if b&0x80 != 0 {
+		w.on = w.dac
+		w.len.trigger(256, frameStep)
+		w.timer = w.period()
+		w.pos = 0
+	}
+}
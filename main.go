@@ -1,28 +1,172 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/docopt/docopt.go"
 	"github.com/kbatten/jibi/jibi"
+	"github.com/kbatten/jibi/script"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
 	doc := `usage: jibi [options] <rom>
+       jibi bench [--frames=<n>] <rom>
+       jibi mooneye [--frames=<n>] <dir>
+       jibi info <rom>
+       jibi disasm [--start=<addr>] [--len=<n>] <rom>
+options:
+  --bios=<file>   boot rom to run instead of the built in one
+  --skip-bios     start the cartridge as the boot rom leaves it, without
+                  running it
+  --cgb           run on cgb hardware, colorizing dmg games
+  --palette=<c>   12 comma separated hex colors to colorize this game with
+  --color-keys=<k> keys held while the cgb bios shows the logo, picking its
+                  palette, a direction and optionally a or b, as left+a
+  --shades=<c>    colors of the dmg screen, green, grey or 4 comma separated
+                  hex colors from light to dark
+  --patch=<file>  ips or bps patch to apply to the rom
+  --sgb           run on super gameboy hardware
+  --macro=<m>     bind macros to keys, as q=right@0+10,a@5;e=...
+  --script=<file> run a lua script against the game, see package script
+  --cheat=<c>     comma separated game genie and gameshark codes, as
+                  00A-17B-C49,019900C1
+  --strict        stop on emulation that is not verified
+  --force-state   load save states of other cartridges and versions
+  --audio         play sound through aplay
+  --wav=<file>    record sound to a wav file
+  --link=<addr>   connect the link cable to a jibi listening at host:port
+  --listen=<addr> wait for a jibi to connect a link cable at host:port
+  --serial-out    print what the game sends over the link port, like the
+                  results of test roms
+  --printer=<dir> plug a game boy printer into the link port, saving its
+                  prints as png files in dir
+  --rate=<hz>     audio sample rate [default: 44100]
+  --latency=<ms>  audio buffered ahead of the speaker [default: 100]
+bench and mooneye options:
+  --frames=<n>    frames to run, per rom for mooneye [default: 600]
+disasm options:
+  --start=<addr>  rom offset to start at [default: 0x0100]
+  --len=<n>       bytes to disassemble [default: 0x100]
 dev options:
   --dev-status    show 1 second status
   --dev-norender  disable rendering
   --dev-nokeypad  disable keypad input
   --dev-quick     run a quick test cycle
   --dev-nosquash  only display upper left
-  --dev-every     print every exectuted instruction`
+  --dev-every     print every exectuted instruction
+  --dev-trace=<f> write a gameboy doctor trace line per instruction to f
+  --dev-log=<l>   log diagnostics to stderr, l is error, warn, info or debug,
+                  optionally per component as cpu=debug,mmu=warn,info
+  --dev-watch     reload the rom whenever the file changes
+  --dev-debug     pause on ld b,b breakpoints, c continues
+  --dev-messages  print the debug messages of ld d,d
+  --dev-viewer=<d> the 8 key saves png images of the vram tiles and sprites in d
+  --dev-irqstats  print interrupt latency and handler time on exit
+  --dev-profile   print cycles spent per function on exit
+  --dev-sym=<f>   symbol file naming functions in the profile
+  --dev-coverage  print executed and unimplemented opcodes on exit`
 	args, _ := docopt.Parse(doc, nil, true, "", false)
 
-	rom, err := jibi.ReadRomFile(args["<rom>"].(string))
+	if args["mooneye"].(bool) {
+		frames, err := strconv.Atoi(args["--frames"].(string))
+		if err != nil || frames < 1 {
+			fmt.Printf("invalid frame count %q\n", args["--frames"])
+			return
+		}
+		scores, err := jibi.RunMooneyeSuite(args["<dir>"].(string), frames, jibi.Options{})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Print(scores)
+		return
+	}
+
+	filename := args["<rom>"].(string)
+	rom, err := jibi.ReadRomFile(filename)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
+	if args["bench"].(bool) {
+		frames, err := strconv.Atoi(args["--frames"].(string))
+		if err != nil || frames < 1 {
+			fmt.Printf("invalid frame count %q\n", args["--frames"])
+			return
+		}
+		result, err := jibi.Bench(rom, frames, jibi.Options{})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Print(result)
+		return
+	}
+
+	if args["info"].(bool) {
+		header, err := jibi.ParseCartridgeHeader(rom)
+		if err != nil {
+			fmt.Printf("%s: %s\n", filename, err)
+			return
+		}
+		fmt.Println(header)
+		if err := header.Verify(); err != nil {
+			fmt.Printf("%s: %s\n", filename, err)
+		}
+		return
+	}
+
+	if args["disasm"].(bool) {
+		start, err := strconv.ParseUint(args["--start"].(string), 0, 32)
+		if err != nil || int(start) >= len(rom) {
+			fmt.Printf("invalid start %q\n", args["--start"])
+			return
+		}
+		n, err := strconv.ParseUint(args["--len"].(string), 0, 32)
+		if err != nil {
+			fmt.Printf("invalid length %q\n", args["--len"])
+			return
+		}
+		end := int(start + n)
+		if end > len(rom) {
+			end = len(rom)
+		}
+		// banks past the first show at 0x4000-0x7FFF
+		addr := jibi.Word(start)
+		if start >= 0x4000 {
+			addr = jibi.Word(0x4000 | start&0x3FFF)
+			fmt.Printf("bank %d\n", start/0x4000)
+		}
+		for _, l := range jibi.Disassemble(rom[start:end], addr) {
+			fmt.Println(l)
+		}
+		return
+	}
+
+	if patchname, ok := args["--patch"].(string); ok {
+		rom, err = jibi.ReadPatchFile(rom, patchname)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	header, err := jibi.ParseCartridgeHeader(rom)
+	if err == nil {
+		err = header.Verify()
+	}
+	if err != nil {
+		fmt.Printf("%s: %s\n", filename, err)
+		return
+	}
+
 	options := jibi.Options{
 		Status: args["--dev-status"].(bool),
 		Render: !args["--dev-norender"].(bool),
@@ -30,8 +174,208 @@ dev options:
 		Quick:  args["--dev-quick"].(bool),
 		Squash: !args["--dev-nosquash"].(bool),
 		Every:  args["--dev-every"].(bool),
+		Debug:  args["--dev-debug"].(bool),
+		Cgb:    args["--cgb"].(bool),
+		Sgb:    args["--sgb"].(bool),
+		Strict: args["--strict"].(bool),
+
+		Skipbios:      args["--skip-bios"].(bool),
+		ForceState:    args["--force-state"].(bool),
+		DebugMessages: args["--dev-messages"].(bool),
+	}
+	options.SaveFile = jibi.SaveFileName(filename)
+	if dir, ok := args["--dev-viewer"].(string); ok {
+		options.ViewerDir = dir
+	}
+	options.StateFile = strings.TrimSuffix(options.SaveFile, ".sav") + ".state"
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	options.Quit = quit
+	options.IrqStats = args["--dev-irqstats"].(bool)
+	options.Profile = args["--dev-profile"].(bool)
+	options.Coverage = args["--dev-coverage"].(bool)
+	if symname, ok := args["--dev-sym"].(string); ok {
+		options.Symbols, err = jibi.ReadSymFile(symname)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if macros, ok := args["--macro"].(string); ok {
+		options.Macros = map[byte]jibi.Macro{}
+		for _, binding := range strings.Split(macros, ";") {
+			parts := strings.SplitN(binding, "=", 2)
+			if len(parts) != 2 || len(parts[0]) != 1 {
+				fmt.Printf("invalid macro binding %q\n", binding)
+				return
+			}
+			m, err := jibi.ParseMacro(parts[0], parts[1])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			options.Macros[parts[0][0]] = m
+		}
+	}
+	if codes, ok := args["--cheat"].(string); ok {
+		for _, code := range strings.Split(codes, ",") {
+			c, err := jibi.ParseCheat(code)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			options.Cheats = append(options.Cheats, c)
+		}
+	}
+	if levels, ok := args["--dev-log"].(string); ok {
+		logger := jibi.NewTextLogger(os.Stderr, jibi.LogError)
+		for _, l := range strings.Split(levels, ",") {
+			parts := strings.SplitN(l, "=", 2)
+			level, err := jibi.ParseLogLevel(parts[len(parts)-1])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if len(parts) == 2 {
+				logger.SetComponentLevel(parts[0], level)
+			} else {
+				logger.SetLevel(level)
+			}
+		}
+		options.Logger = logger
+	}
+	if args["--dev-watch"].(bool) {
+		options.Reload = jibi.WatchRomFile(filename, 500*time.Millisecond)
+	}
+	if name, ok := args["--dev-trace"].(string); ok {
+		f, err := os.Create(name)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer f.Close()
+		trace := bufio.NewWriter(f)
+		defer trace.Flush()
+		options.Trace = trace
+	}
+	if biosname, ok := args["--bios"].(string); ok {
+		options.Bios, err = jibi.ReadRomFile(biosname)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if colors, ok := args["--palette"].(string); ok {
+		cz, err := jibi.ParseColorization(colors)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		cart, err := jibi.NewCartridge(rom)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		options.Colorizations = map[string]jibi.Colorization{cart.Title(): cz}
+	}
+	if keys, ok := args["--color-keys"].(string); ok {
+		options.ColorKeys, err = jibi.ParseColorKeys(keys)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if shades, ok := args["--shades"].(string); ok {
+		options.Shades, err = jibi.ParseDmgPalette(shades)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	rate, err := strconv.Atoi(args["--rate"].(string))
+	if err != nil || rate < 1 {
+		fmt.Printf("invalid sample rate %q\n", args["--rate"])
+		return
+	}
+	options.SampleRate = rate
+	if args["--audio"].(bool) {
+		latency, err := strconv.Atoi(args["--latency"].(string))
+		if err != nil || latency < 1 {
+			fmt.Printf("invalid latency %q\n", args["--latency"])
+			return
+		}
+		player := exec.Command("aplay", "-q", "-t", "raw", "-f", "S16_LE",
+			"-c", "2", "-r", strconv.Itoa(rate))
+		stdin, err := player.StdinPipe()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := player.Start(); err != nil {
+			fmt.Println(err)
+			return
+		}
+		audio := jibi.NewAudioWriter(stdin, rate, time.Duration(latency)*time.Millisecond)
+		defer player.Wait()
+		defer stdin.Close()
+		defer audio.Close()
+		options.Audio = audio
+	}
+	if name, ok := args["--wav"].(string); ok {
+		wav, err := os.Create(name)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer wav.Close()
+		options.Wav = wav
+	}
+	if addr, ok := args["--link"].(string); ok {
+		link, err := jibi.DialSerial(addr)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer link.Close()
+		options.Serial = link
+	} else if addr, ok := args["--listen"].(string); ok {
+		fmt.Printf("waiting for a link cable at %s\n", addr)
+		link, err := jibi.ListenSerial(addr)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer link.Close()
+		options.Serial = link
+	} else if args["--serial-out"].(bool) {
+		options.Serial = jibi.NewSerialCapture(os.Stdout)
+	} else if dir, ok := args["--printer"].(string); ok {
+		printer := jibi.NewPrinter(dir)
+		defer func() {
+			if err := printer.Err(); err != nil {
+				fmt.Println(err)
+			}
+		}()
+		options.Serial = printer
+	}
+	gameboy, err := jibi.New(rom, options)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if path, ok := args["--script"].(string); ok {
+		s, err := script.Run(gameboy, path)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer func() {
+			s.Stop()
+			if err := s.Err(); err != nil {
+				fmt.Println(err)
+			}
+		}()
 	}
-	gameboy := jibi.New(rom, options)
 
 	gameboy.Run()
 }
@@ -0,0 +1,188 @@
+// Package script runs lua scripts against a running jibi, for bots, trainers
+// and debugging. A script runs once when it is loaded and then through the
+// callbacks it registers, all on the goroutine of the Script.
+//
+// The jibi table holds:
+//
+//	jibi.read(addr)            the byte at addr, as the cpu reads it
+//	jibi.write(addr, b)        write b to addr, rom writes patch the mapped bank
+//	jibi.registers()           table of a f b c d e h l sp pc ime halted cycles
+//	jibi.onframe(fn)           call fn(frame) at the start of every vblank
+//	jibi.press(key, frames)    hold key, named like "a" or "start", for frames
+//	jibi.notify(text, seconds) show text to the player
+//	jibi.frame()               frames seen since the script was loaded
+//
+// Scripts stay with the Jibi they were started on, they do not follow a
+// reload.
+package script
+
+import (
+	"fmt"
+	"github.com/kbatten/jibi/jibi"
+	lua "github.com/yuin/gopher-lua"
+	"sync"
+	"time"
+)
+
+// A Script is a lua state bound to a Jibi.
+type Script struct {
+	j      jibi.Jibi
+	state  *lua.LState
+	frames []*lua.LFunction
+	frame  uint64
+	cycles uint64 // cycle of the last vblank
+
+	events <-chan jibi.Event
+	once   sync.Once
+
+	lock sync.Mutex
+	err  error
+}
+
+// Run loads the script in path and runs it against j until Stop.
+func Run(j jibi.Jibi, path string) (*Script, error) {
+	s := &Script{
+		j:     j,
+		state: lua.NewState(),
+	}
+	s.register()
+	if err := s.state.DoFile(path); err != nil {
+		s.state.Close()
+		return nil, fmt.Errorf("script %s: %v", path, err)
+	}
+	s.events = j.Subscribe(jibi.EventVBlankStart, 4)
+	go s.run()
+	return s, nil
+}
+
+// Stop ends the script, its lua state is closed once a callback that is
+// running returns.
+func (s *Script) Stop() {
+	s.once.Do(func() {
+		s.j.Unsubscribe(s.events)
+	})
+}
+
+// Err returns the first error a callback raised, the script stops calling
+// callbacks after it.
+func (s *Script) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+func (s *Script) run() {
+	defer s.state.Close()
+	for e := range s.events {
+		if s.Err() != nil {
+			continue
+		}
+		s.frame++
+		s.cycles = e.Cycles
+		for _, fn := range s.frames {
+			err := s.state.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true},
+				lua.LNumber(s.frame))
+			if err != nil {
+				s.lock.Lock()
+				s.err = err
+				s.lock.Unlock()
+				break
+			}
+		}
+	}
+}
+
+func (s *Script) register() {
+	t := s.state.NewTable()
+	for name, fn := range map[string]lua.LGFunction{
+		"read":      s.read,
+		"write":     s.write,
+		"registers": s.registers,
+		"onframe":   s.onframe,
+		"press":     s.press,
+		"notify":    s.notify,
+		"frame":     s.frameCount,
+	} {
+		s.state.SetField(t, name, s.state.NewFunction(fn))
+	}
+	s.state.SetGlobal("jibi", t)
+}
+
+func checkAddr(L *lua.LState, n int) jibi.Word {
+	addr := L.CheckInt(n)
+	if addr < 0 || addr > 0xFFFF {
+		L.ArgError(n, "address out of range")
+	}
+	return jibi.Word(addr)
+}
+
+func (s *Script) read(L *lua.LState) int {
+	L.Push(lua.LNumber(s.j.Peek(checkAddr(L, 1))))
+	return 1
+}
+
+func (s *Script) write(L *lua.LState) int {
+	addr := checkAddr(L, 1)
+	b := L.CheckInt(2)
+	if b < 0 || b > 0xFF {
+		L.ArgError(2, "byte out of range")
+	}
+	if err := s.j.Poke(addr, jibi.Byte(b)); err != nil {
+		L.RaiseError("%v", err)
+	}
+	return 0
+}
+
+func (s *Script) registers(L *lua.LState) int {
+	r := s.j.Registers()
+	t := L.NewTable()
+	for name, v := range map[string]int{
+		"a": int(r.A), "f": int(r.F), "b": int(r.B), "c": int(r.C),
+		"d": int(r.D), "e": int(r.E), "h": int(r.H), "l": int(r.L),
+		"sp": int(r.SP), "pc": int(r.PC),
+	} {
+		L.SetField(t, name, lua.LNumber(v))
+	}
+	L.SetField(t, "ime", lua.LBool(r.Ime))
+	L.SetField(t, "halted", lua.LBool(r.Halted))
+	L.SetField(t, "cycles", lua.LNumber(r.Cycles))
+	L.Push(t)
+	return 1
+}
+
+func (s *Script) onframe(L *lua.LState) int {
+	s.frames = append(s.frames, L.CheckFunction(1))
+	return 0
+}
+
+// press holds a key from the last vblank, or right away before the first,
+// for a number of frames, 1 by default.
+func (s *Script) press(L *lua.LState) int {
+	key, ok := jibi.ParseKey(L.CheckString(1))
+	if !ok {
+		L.ArgError(1, "unknown key")
+	}
+	frames := L.OptInt(2, 1)
+	if frames < 1 {
+		L.ArgError(2, "hold for at least a frame")
+	}
+	err := s.j.QueueInput(
+		jibi.InputEvent{Cycle: s.cycles, Key: key, Down: true},
+		jibi.InputEvent{Cycle: s.cycles + jibi.FrameCycle(uint64(frames)), Key: key, Down: false})
+	if err != nil {
+		L.RaiseError("%v", err)
+	}
+	return 0
+}
+
+func (s *Script) notify(L *lua.LState) int {
+	text := L.CheckString(1)
+	d := time.Duration(float64(L.OptNumber(2, 2)) * float64(time.Second))
+	s.j.Notify(text, d)
+	return 0
+}
+
+func (s *Script) frameCount(L *lua.LState) int {
+	L.Push(lua.LNumber(s.frame))
+	return 1
+}